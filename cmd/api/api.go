@@ -6,11 +6,13 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	apihandler "github.com/jofosuware/small-business-management-app/cmd/api/apiHandler"
 	"github.com/jofosuware/small-business-management-app/cmd/api/apiRoutes"
 	"github.com/jofosuware/small-business-management-app/internal/driver"
+	"github.com/jofosuware/small-business-management-app/internal/license"
 	"github.com/jofosuware/small-business-management-app/internal/repository/dbrepo"
 )
 
@@ -24,6 +26,8 @@ func main() {
 	dbPass := flag.String("dbpass", "", "Database password")
 	dbPort := flag.Int("dbport", 5432, "Database port")
 	dbSSL := flag.String("dbssl", "disable", "Database ssl settings (disable, prefer, require)")
+	licenseFile := flag.String("license", "license.lic", "Path to the license file")
+	corsOrigins := flag.String("cors-origins", "", "Comma separated browser origins allowed to call the api, the web app needs none")
 
 	flag.Parse()
 
@@ -42,6 +46,13 @@ func main() {
 	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	errorLog := log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 
+	lic := license.Load(*licenseFile)
+	if lic.Valid() {
+		infoLog.Printf("Licensed to %s until %s\n", lic.License.Licensee, lic.License.ExpiresAt.Format("02-01-2006"))
+	} else {
+		errorLog.Println("license:", lic.Err)
+	}
+
 	// connect to database
 	log.Println("Connecting to database...")
 	connectionString := fmt.Sprintf("host=%s port=%d dbname=%s user=%s password=%s sslmode=%s", *dbHost, *dbPort, *dbName, *dbUser, *dbPass, *dbSSL)
@@ -64,11 +75,12 @@ func main() {
 		DB:       model,
 		InfoLog:  infoLog,
 		ErrorLog: errorLog,
+		License:  lic,
 	}
 
 	srv := &http.Server{
 		Addr:              fmt.Sprintf(":%s", portNumber),
-		Handler:           apiRoutes.Routes(),
+		Handler:           apiRoutes.Routes(origins(*corsOrigins)),
 		IdleTimeout:       30 * time.Second,
 		ReadTimeout:       10 * time.Second,
 		ReadHeaderTimeout: 5 * time.Second,
@@ -82,3 +94,14 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// origins returns the origins listed in s, separated by commas
+func origins(s string) []string {
+	var list []string
+	for _, o := range strings.Split(s, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			list = append(list, o)
+		}
+	}
+	return list
+}
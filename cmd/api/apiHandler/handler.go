@@ -1,6 +1,7 @@
 package apihandler
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/go-chi/chi"
 	"github.com/jofosuware/small-business-management-app/internal/helpers"
+	"github.com/jofosuware/small-business-management-app/internal/license"
 	"github.com/jofosuware/small-business-management-app/internal/models"
 	"github.com/jofosuware/small-business-management-app/internal/render"
 	"github.com/jofosuware/small-business-management-app/internal/repository"
@@ -22,6 +24,18 @@ type Repository struct {
 	DB       repository.DatabaseRepo
 	ErrorLog *log.Logger
 	InfoLog  *log.Logger
+	License  *license.Status
+	// ImagePath is where the product images named in responses are served, under the api
+	// with a bearer token when empty
+	ImagePath string
+}
+
+// imagePath returns where product images are served
+func (c *Repository) imagePath() string {
+	if c.ImagePath == "" {
+		return "/api/product-image"
+	}
+	return c.ImagePath
 }
 
 // CustomerDebt handles the request for the customer balance
@@ -166,7 +180,9 @@ func (c *Repository) CustomerOwingToday(w http.ResponseWriter, r *http.Request)
 	w.Write(jsonData)
 }
 
-// ListProductByPage handles request for all product by page
+// ListProductByPage handles request for all product by page, narrowed down by the search,
+// category, brand and attributes in the query string, with the product counts of each facet and
+// the address of the thumbnail of each product's primary image
 func (c *Repository) ListProductByPage(w http.ResponseWriter, r *http.Request) {
 	page := chi.URLParam(r, "page")
 	pg, _ := strconv.Atoi(page)
@@ -174,15 +190,29 @@ func (c *Repository) ListProductByPage(w http.ResponseWriter, r *http.Request) {
 		pg = 1
 	}
 
+	type product struct {
+		models.Product
+		Thumbnail string `json:"thumbnail,omitempty"`
+	}
+
 	type payload struct {
-		Err      bool             `json:"error"`
-		Message  string           `json:"message"`
-		Products []models.Product `json:"products,omitempty"`
+		Err      bool                  `json:"error"`
+		Message  string                `json:"message"`
+		Products []product             `json:"products,omitempty"`
+		Facets   *models.ProductFacets `json:"facets,omitempty"`
 	}
 
 	var pload payload
 
-	prods, err := c.DB.FetchProductByPage(pg)
+	filter := models.ParseProductFilter(r.URL.Query())
+	filter.Page = pg
+
+	prods, err := c.DB.FetchProducts(filter)
+	if err == nil && len(prods) > 0 {
+		var facets models.ProductFacets
+		facets, err = c.DB.FetchProductFacets(filter)
+		pload.Facets = &facets
+	}
 
 	if err != nil {
 		payload := payload{
@@ -210,18 +240,23 @@ func (c *Repository) ListProductByPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var p []models.Product
+	showCosts := allowed(r, models.PermViewReports)
+	var p []product
 	for _, v := range prods {
 		v.Price = helpers.ToDecimalPlace(v.Price, 2)
-		p = append(p, v)
-	}
+		if !showCosts {
+			v.CostPrice = 0
+		}
 
-	pload = payload{
-		Err:      false,
-		Message:  "",
-		Products: p,
+		listed := product{Product: v}
+		if v.ImageId != 0 {
+			listed.Thumbnail = fmt.Sprintf("%s/%d/thumb", c.imagePath(), v.ImageId)
+		}
+		p = append(p, listed)
 	}
 
+	pload.Products = p
+
 	jsonData, _ := json.Marshal(pload)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(jsonData)
@@ -424,35 +459,90 @@ func (c *Repository) ListPurchasesByPage(w http.ResponseWriter, r *http.Request)
 	w.Write(jsonData)
 }
 
-// SystemExpires this handle is requested when the free trial is ended
-func (c *Repository) SystemExpires(w http.ResponseWriter, r *http.Request) {
+// LowStock handles the request for the products that have fallen to their reorder point, at the
+// location given in the query string or in total
+func (c *Repository) LowStock(w http.ResponseWriter, r *http.Request) {
 	type payload struct {
-		Err     bool   `json:"error"`
-		Message string `json:"message"`
+		Err      bool             `json:"error"`
+		Message  string           `json:"message"`
+		Products []models.Product `json:"products"`
 	}
 
-	var pload payload
-
-	err := c.DB.DeleteUsers()
+	locationId, _ := strconv.Atoi(r.URL.Query().Get("location"))
+	prods, err := c.DB.FetchLowStock(locationId)
 	if err != nil {
-		c.ErrorLog.Println("Error deleting users: ", err)
-		pload = payload{
+		payload := payload{
 			Err:     true,
-			Message: "",
+			Message: "Low stock products cannot be retrieved, try again!",
 		}
 
-		jsonData, _ := json.Marshal(pload)
+		jsonData, _ := json.Marshal(payload)
+		c.ErrorLog.Println(err)
 		w.Header().Set("Content-Type", "application/json")
 		w.Write(jsonData)
 		return
 	}
 
-	pload = payload{
-		Err:     false,
-		Message: "Users deleted",
+	showCosts := allowed(r, models.PermViewReports)
+	var p []models.Product
+	for _, v := range prods {
+		v.Price = helpers.ToDecimalPlace(v.Price, 2)
+		if !showCosts {
+			v.CostPrice = 0
+		}
+		p = append(p, v)
+	}
+
+	pload := payload{
+		Err:      false,
+		Message:  "",
+		Products: p,
 	}
 
 	jsonData, _ := json.Marshal(pload)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(jsonData)
 }
+
+// ProductImage handles the request for a product image by id. The image with an id never
+// changes, so clients are told to keep it.
+func (c *Repository) ProductImage(w http.ResponseWriter, r *http.Request) {
+	c.serveProductImage(w, r, false)
+}
+
+// ProductThumbnail handles the request for the thumbnail of a product image by id
+func (c *Repository) ProductThumbnail(w http.ResponseWriter, r *http.Request) {
+	c.serveProductImage(w, r, true)
+}
+
+// serveProductImage writes the image, or thumbnail, with the id in the path unless the client
+// has it already
+func (c *Repository) serveProductImage(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	etag := "product-image-" + strconv.Itoa(id)
+	if thumbnail {
+		etag += "-thumb"
+	}
+	if helpers.ImageCached(w, r, etag) {
+		return
+	}
+
+	img, err := c.DB.FetchProductImageData(id, thumbnail)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			c.ErrorLog.Println(err)
+		}
+		w.Header().Del("Cache-Control")
+		w.Header().Del("ETag")
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	_, _ = w.Write(img)
+}
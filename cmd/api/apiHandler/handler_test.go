@@ -0,0 +1,67 @@
+package apihandler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// productsRepo lists the same products whatever the filter
+type productsRepo struct {
+	repository.DatabaseRepo
+	products []models.Product
+}
+
+func (f *productsRepo) FetchProducts(filter models.ProductFilter) ([]models.Product, error) {
+	return f.products, nil
+}
+
+func (f *productsRepo) FetchProductFacets(filter models.ProductFilter) (models.ProductFacets, error) {
+	return models.ProductFacets{}, nil
+}
+
+func TestListProductByPage_CostPrice(t *testing.T) {
+	c := &Repository{
+		DB:       &productsRepo{products: []models.Product{{Serial: "A", Price: 15, CostPrice: 9.5}}},
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+	owner := models.User{ID: 1, AccessLevel: models.AccessOwner}
+	clerk := models.User{ID: 2, AccessLevel: models.AccessClerk}
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		expected float64
+	}{
+		{"owner", WithUser(context.Background(), owner), 9.5},
+		{"clerk", WithUser(context.Background(), clerk), 0},
+		{"owner with a token granting reports", context.WithValue(WithUser(context.Background(), owner), tokenContextKey,
+			models.APIToken{Scopes: []string{models.PermViewProducts, models.PermViewReports}}), 9.5},
+		{"owner with a token not granting reports", context.WithValue(WithUser(context.Background(), owner), tokenContextKey,
+			models.APIToken{Scopes: []string{models.PermViewProducts}}), 0},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c.ListProductByPage(w, httptest.NewRequest("GET", "/api/list-products/1", nil).WithContext(tt.ctx))
+
+		var got struct {
+			Products []models.Product `json:"products"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Products) != 1 {
+			t.Fatalf("%s: got %d products, expected 1", tt.name, len(got.Products))
+		}
+		if got.Products[0].CostPrice != tt.expected {
+			t.Errorf("%s: got cost price %v, expected %v", tt.name, got.Products[0].CostPrice, tt.expected)
+		}
+	}
+}
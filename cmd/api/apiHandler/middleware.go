@@ -0,0 +1,177 @@
+package apihandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/jofosuware/small-business-management-app/internal/helpers"
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+type contextKey string
+
+const (
+	userContextKey  contextKey = "user"
+	tokenContextKey contextKey = "token"
+)
+
+// WithUser returns a copy of ctx carrying the authenticated user
+func WithUser(ctx context.Context, u models.User) context.Context {
+	return context.WithValue(ctx, userContextKey, u)
+}
+
+// UserFromContext returns the user the request was authenticated as
+func UserFromContext(ctx context.Context) (models.User, bool) {
+	u, ok := ctx.Value(userContextKey).(models.User)
+	return u, ok
+}
+
+// Authenticate resolves the bearer token of the request to its user, requests without a
+// token carry no user and are refused by RequirePermission and RequireRole
+func (c *Repository) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		bearer, found := strings.CutPrefix(header, "Bearer ")
+		if !found || bearer == "" {
+			c.errorJSON(w, http.StatusUnauthorized, "invalid authorization header")
+			return
+		}
+
+		token, err := c.DB.FetchAPIToken(helpers.HashToken(strings.TrimSpace(bearer)))
+		if errors.Is(err, repository.ErrInvalidToken) {
+			c.errorJSON(w, http.StatusUnauthorized, "invalid or expired token")
+			return
+		}
+
+		if err != nil {
+			c.ErrorLog.Println(err)
+			c.errorJSON(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		username, err := c.DB.FetchUserById(token.UserId)
+		if err != nil {
+			c.ErrorLog.Println(err)
+			c.errorJSON(w, http.StatusUnauthorized, "invalid or expired token")
+			return
+		}
+
+		user, err := c.DB.FetchUser(username)
+		if err != nil || !user.Active() {
+			c.ErrorLog.Println(err)
+			c.errorJSON(w, http.StatusUnauthorized, "invalid or expired token")
+			return
+		}
+
+		if err := c.DB.TouchAPIToken(token.ID); err != nil {
+			c.ErrorLog.Println(err)
+		}
+
+		ctx := WithUser(r.Context(), user)
+		ctx = context.WithValue(ctx, tokenContextKey, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireModule refuses requests when the license does not enable module
+func (c *Repository) RequireModule(module string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !c.License.HasModule(module) {
+				c.errorJSON(w, http.StatusForbidden, "the license does not include the "+module+" module")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TokenFromContext returns the api token the request was authenticated with
+func TokenFromContext(ctx context.Context) (models.APIToken, bool) {
+	t, ok := ctx.Value(tokenContextKey).(models.APIToken)
+	return t, ok
+}
+
+// RequirePermission rejects requests whose user lacks perm or whose token was not granted it
+func (c *Repository) RequirePermission(perm string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := UserFromContext(r.Context())
+			if !ok {
+				c.errorJSON(w, http.StatusUnauthorized, "authentication required")
+				return
+			}
+
+			if token, ok := TokenFromContext(r.Context()); ok && !token.Allows(perm) {
+				c.errorJSON(w, http.StatusForbidden, "token does not grant "+perm)
+				return
+			}
+
+			if !user.Can(perm) {
+				c.errorJSON(w, http.StatusForbidden, "you are not allowed to access this resource")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allowed reports whether the request's user has perm and its token, if any, was granted it
+func allowed(r *http.Request, perm string) bool {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		return false
+	}
+
+	if token, ok := TokenFromContext(r.Context()); ok && !token.Allows(perm) {
+		return false
+	}
+
+	return user.Can(perm)
+}
+
+// RequireRole rejects requests whose user holds none of the given roles
+func (c *Repository) RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := UserFromContext(r.Context())
+			if !ok {
+				c.errorJSON(w, http.StatusUnauthorized, "authentication required")
+				return
+			}
+
+			for _, role := range roles {
+				if user.Role() == role {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			c.errorJSON(w, http.StatusForbidden, "you are not allowed to access this resource")
+		})
+	}
+}
+
+// errorJSON writes an error payload with the given status code
+func (c *Repository) errorJSON(w http.ResponseWriter, status int, message string) {
+	type payload struct {
+		Err     bool   `json:"error"`
+		Message string `json:"message"`
+	}
+
+	jsonData, _ := json.Marshal(payload{
+		Err:     true,
+		Message: message,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonData)
+}
@@ -0,0 +1,130 @@
+package apihandler
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/helpers"
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// tokenRepo knows the api tokens in tokens, by the token they were issued as
+type tokenRepo struct {
+	repository.DatabaseRepo
+	tokens  map[string]models.APIToken
+	users   map[int]models.User
+	touched []int
+}
+
+func (f *tokenRepo) FetchAPIToken(tokenHash string) (models.APIToken, error) {
+	for token, t := range f.tokens {
+		if helpers.HashToken(token) == tokenHash {
+			return t, nil
+		}
+	}
+	return models.APIToken{}, repository.ErrInvalidToken
+}
+
+func (f *tokenRepo) FetchUserById(id int) (string, error) {
+	return f.users[id].Username, nil
+}
+
+func (f *tokenRepo) FetchUser(username string) (models.User, error) {
+	for _, u := range f.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return models.User{}, repository.ErrInvalidToken
+}
+
+func (f *tokenRepo) TouchAPIToken(id int) error {
+	f.touched = append(f.touched, id)
+	return nil
+}
+
+func newTokenRepo() *tokenRepo {
+	return &tokenRepo{
+		tokens: map[string]models.APIToken{
+			"owner-token":  {ID: 1, UserId: 1, Scopes: []string{models.PermViewProducts, models.PermViewReports}},
+			"clerk-token":  {ID: 2, UserId: 2, Scopes: []string{models.PermViewProducts, models.PermViewReports}},
+			"former-token": {ID: 3, UserId: 3, Scopes: []string{models.PermViewProducts}},
+		},
+		users: map[int]models.User{
+			1: {ID: 1, Username: "ama", AccessLevel: models.AccessOwner},
+			2: {ID: 2, Username: "kofi", AccessLevel: models.AccessClerk},
+			3: {ID: 3, Username: "yaw", AccessLevel: models.AccessOwner, DisabledAt: time.Now()},
+		},
+	}
+}
+
+// serve runs a request with header as its Authorization through Authenticate and then
+// RequirePermission(perm)
+func serve(c *Repository, header, perm string) int {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	r := httptest.NewRequest("GET", "/api/list-products/1", nil)
+	if header != "" {
+		r.Header.Set("Authorization", header)
+	}
+	w := httptest.NewRecorder()
+	c.Authenticate(c.RequirePermission(perm)(ok)).ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestAuthenticate(t *testing.T) {
+	db := newTokenRepo()
+	c := &Repository{DB: db, ErrorLog: log.New(io.Discard, "", 0)}
+
+	tests := []struct {
+		name     string
+		header   string
+		expected int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"not a bearer token", "Basic b3duZXItdG9rZW4=", http.StatusUnauthorized},
+		{"empty bearer token", "Bearer ", http.StatusUnauthorized},
+		{"unknown token", "Bearer stolen-token", http.StatusUnauthorized},
+		{"token hash used as the token", "Bearer " + helpers.HashToken("owner-token"), http.StatusUnauthorized},
+		{"token of a deactivated user", "Bearer former-token", http.StatusUnauthorized},
+		{"valid token", "Bearer owner-token", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		if got := serve(c, tt.header, models.PermViewProducts); got != tt.expected {
+			t.Errorf("%s: got %d, expected %d", tt.name, got, tt.expected)
+		}
+	}
+
+	if len(db.touched) != 1 || db.touched[0] != 1 {
+		t.Errorf("expected only token 1 to be marked as used, got %v", db.touched)
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	c := &Repository{DB: newTokenRepo(), ErrorLog: log.New(io.Discard, "", 0)}
+
+	tests := []struct {
+		name     string
+		header   string
+		perm     string
+		expected int
+	}{
+		{"owner with the scope", "Bearer owner-token", models.PermViewReports, http.StatusOK},
+		{"owner without the scope", "Bearer owner-token", models.PermManageUsers, http.StatusForbidden},
+		{"clerk with the scope", "Bearer clerk-token", models.PermViewProducts, http.StatusOK},
+		{"clerk with the scope but not the permission", "Bearer clerk-token", models.PermViewReports, http.StatusForbidden},
+		{"no user", "", models.PermViewProducts, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		if got := serve(c, tt.header, tt.perm); got != tt.expected {
+			t.Errorf("%s: got %d, expected %d", tt.name, got, tt.expected)
+		}
+	}
+}
@@ -6,27 +6,48 @@ import (
 	"github.com/go-chi/chi"
 	"github.com/go-chi/cors"
 	apihandler "github.com/jofosuware/small-business-management-app/cmd/api/apiHandler"
+	"github.com/jofosuware/small-business-management-app/internal/license"
+	"github.com/jofosuware/small-business-management-app/internal/models"
 )
 
-func Routes() http.Handler {
+// Routes returns the api router, allowedOrigins lists the browser origins allowed to call it.
+// Without any, cross-origin calls are refused; the web app serves its own pages their data.
+func Routes(allowedOrigins []string) http.Handler {
 	mux := chi.NewRouter()
 
-	mux.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		AllowCredentials: false,
-		MaxAge:           300,
-	}))
+	if len(allowedOrigins) > 0 {
+		mux.Use(cors.Handler(cors.Options{
+			AllowedOrigins:   allowedOrigins,
+			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+			AllowCredentials: false,
+			MaxAge:           300,
+		}))
+	}
 
 	mux.Route("/api", func(mux chi.Router) {
-		mux.Post("/customer-debt/{id}", apihandler.Repo.CustomerDebt)
-		mux.Get("/owing-today", apihandler.Repo.CustomerOwingToday)
-		mux.Get("/list-products/{page}", apihandler.Repo.ListProductByPage)
-		mux.Get("/list-customers/{page}", apihandler.Repo.ListCustomersByPage)
-		mux.Get("/list-payments/{page}", apihandler.Repo.ListPaymentsByPage)
-		mux.Get("/list-purchases/{page}", apihandler.Repo.ListPurchasesByPage)
-		mux.Get("/expired", apihandler.Repo.SystemExpires)
+		mux.Use(apihandler.Repo.RequireModule(license.ModuleAPI))
+		mux.Use(apihandler.Repo.Authenticate)
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(apihandler.Repo.RequirePermission(models.PermViewCustomers))
+			mux.Post("/customer-debt/{id}", apihandler.Repo.CustomerDebt)
+			mux.Get("/owing-today", apihandler.Repo.CustomerOwingToday)
+			mux.Get("/list-customers/{page}", apihandler.Repo.ListCustomersByPage)
+			mux.Get("/list-payments/{page}", apihandler.Repo.ListPaymentsByPage)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(apihandler.Repo.RequirePermission(models.PermViewProducts))
+			mux.Get("/list-products/{page}", apihandler.Repo.ListProductByPage)
+			mux.Get("/product-image/{id}", apihandler.Repo.ProductImage)
+			mux.Get("/product-image/{id}/thumb", apihandler.Repo.ProductThumbnail)
+		})
+
+		mux.With(apihandler.Repo.RequireModule(license.ModuleInventory), apihandler.Repo.RequirePermission(models.PermViewProducts)).
+			Get("/low-stock", apihandler.Repo.LowStock)
+		mux.With(apihandler.Repo.RequirePermission(models.PermViewSales)).
+			Get("/list-purchases/{page}", apihandler.Repo.ListPurchasesByPage)
 	})
 	return mux
 }
@@ -0,0 +1,106 @@
+// Command license creates vendor keys and signs license files.
+//
+//	license keygen
+//	license sign -key <private key> -licensee "Osee Enterprise" -expires 2027-12-31 -seats 5 -out license.lic
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/license"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "keygen":
+		keygen()
+	case "sign":
+		sign(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: license keygen | license sign [flags]")
+	os.Exit(2)
+}
+
+func keygen() {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("public key: ", base64.StdEncoding.EncodeToString(pub))
+	fmt.Println("private key:", base64.StdEncoding.EncodeToString(priv))
+}
+
+func sign(args []string) {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	key := fs.String("key", os.Getenv("LICENSE_PRIVATE_KEY"), "Base64 private key, defaults to $LICENSE_PRIVATE_KEY")
+	licensee := fs.String("licensee", "", "Business the license is issued to")
+	expires := fs.String("expires", "", "Expiry date as YYYY-MM-DD, empty for a perpetual license")
+	seats := fs.Int("seats", 0, "Number of active users allowed, 0 for unlimited")
+	modules := fs.String("modules", "", "Comma separated modules to enable, empty for all")
+	out := fs.String("out", "license.lic", "File to write the license to")
+	fs.Parse(args)
+
+	if *key == "" || *licensee == "" {
+		fmt.Fprintln(os.Stderr, "sign needs -key and -licensee")
+		os.Exit(2)
+	}
+
+	priv, err := license.ParsePrivateKey(*key)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		log.Fatal(err)
+	}
+
+	l := license.License{
+		ID:       hex.EncodeToString(id),
+		Licensee: *licensee,
+		IssuedAt: time.Now().UTC(),
+		Seats:    *seats,
+	}
+
+	if *expires != "" {
+		// the license runs until the end of the expiry day
+		l.ExpiresAt, err = time.Parse("2006-01-02", *expires)
+		if err != nil {
+			log.Fatal(err)
+		}
+		l.ExpiresAt = l.ExpiresAt.Add(24*time.Hour - time.Second)
+	}
+
+	if *modules != "" {
+		l.Modules = strings.Split(*modules, ",")
+	}
+
+	data, err := license.Sign(l, priv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile(*out, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("license %s for %s written to %s\n", l.ID, l.Licensee, *out)
+}
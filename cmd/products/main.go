@@ -0,0 +1,211 @@
+// Command products imports and exports the product catalogue as csv or xlsx files.
+//
+//	products import -dbuser postgres -file stock.xlsx -map "Item Code=serial,Qty=units" -dry-run
+//	products export -dbuser postgres -out products.csv
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jofosuware/small-business-management-app/internal/config"
+	"github.com/jofosuware/small-business-management-app/internal/driver"
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/productfile"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+	"github.com/jofosuware/small-business-management-app/internal/repository/auditrepo"
+	"github.com/jofosuware/small-business-management-app/internal/repository/dbrepo"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "import":
+		importProducts(os.Args[2:])
+	case "export":
+		exportProducts(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: products import [flags] | products export [flags]")
+	os.Exit(2)
+}
+
+// dbFlags adds the database connection flags to fs and returns a function connecting with them
+func dbFlags(fs *flag.FlagSet) func() repository.DatabaseRepo {
+	dbHost := fs.String("dbhost", "localhost", "Database host")
+	dbName := fs.String("dbname", "sbma", "Database name")
+	dbUser := fs.String("dbuser", "", "Database user")
+	dbPass := fs.String("dbpass", "", "Database password")
+	dbPort := fs.Int("dbport", 5432, "Database port")
+	dbSSL := fs.String("dbssl", "disable", "Database ssl settings (disable, prefer, require)")
+
+	return func() repository.DatabaseRepo {
+		if *dbName == "" || *dbUser == "" {
+			fmt.Fprintln(os.Stderr, "-dbname and -dbuser are required")
+			os.Exit(2)
+		}
+
+		connectionString := fmt.Sprintf("host=%s port=%d dbname=%s user=%s password=%s sslmode=%s", *dbHost, *dbPort, *dbName, *dbUser, *dbPass, *dbSSL)
+		db, err := driver.ConnectSQL(connectionString)
+		if err != nil {
+			log.Fatal("Cannot connect to database! ", err)
+		}
+
+		return dbrepo.NewPostgresRepo(db.SQL, &config.AppConfig{})
+	}
+}
+
+func importProducts(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	file := fs.String("file", "", "csv or xlsx file to import, the first row names the columns")
+	mapTo := fs.String("map", "", `Columns to map by header, as "Item Code=serial,Qty=units", columns not named are guessed from their headers`)
+	dryRun := fs.Bool("dry-run", false, "Check the rows and report what would change without saving anything")
+	userId := fs.Int("user", 0, "Id of the user the import is recorded against")
+	connect := dbFlags(fs)
+	fs.Parse(args)
+
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "import needs -file")
+		os.Exit(2)
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sheet, err := productfile.Read(f, *file)
+	f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mapping := productfile.Guess(sheet.Header)
+	if *mapTo != "" {
+		for _, pair := range strings.Split(*mapTo, ",") {
+			header, field, _ := strings.Cut(pair, "=")
+			found := false
+			for i, h := range sheet.Header {
+				if strings.EqualFold(h, strings.TrimSpace(header)) {
+					mapping[i] = strings.TrimSpace(field)
+					found = true
+				}
+			}
+			if !found {
+				log.Fatalf("%s has no column %q", *file, header)
+			}
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "COLUMN\tIMPORTED AS")
+	for i, h := range sheet.Header {
+		field := "skipped"
+		if mapping[i] != "" {
+			field = productfile.Label(mapping[i])
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", h, field)
+	}
+	tw.Flush()
+
+	if problems := mapping.Check(sheet.Header); len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Fprintln(os.Stderr, p)
+		}
+		os.Exit(1)
+	}
+
+	repo := auditrepo.New(connect(), auditrepo.Actor{UserId: *userId}, log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime))
+
+	var result productfile.Result
+	var rows []productfile.Row
+	err = repo.WithTx(context.Background(), func(repo repository.DatabaseRepo) error {
+		products, err := productfile.Products(repo)
+		if err != nil {
+			return err
+		}
+
+		existing := make(map[string]models.Product, len(products))
+		for _, p := range products {
+			existing[p.Serial] = p
+		}
+		rows = productfile.Check(sheet, mapping, existing)
+
+		if *dryRun {
+			return nil
+		}
+		result, err = productfile.Import(repo, rows, *userId)
+		return err
+	})
+	if err != nil {
+		log.Fatal("nothing was imported: ", err)
+	}
+
+	fmt.Println()
+	var preview productfile.Result
+	tw = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LINE\tSERIAL\tRESULT")
+	for _, row := range rows {
+		switch {
+		case !row.Valid():
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", row.Line, row.Product.Serial, strings.Join(row.Problems(), "; "))
+			preview.Skipped++
+		case row.New:
+			fmt.Fprintf(tw, "%d\t%s\tnew\n", row.Line, row.Product.Serial)
+			preview.Created++
+		default:
+			fmt.Fprintf(tw, "%d\t%s\tupdate\n", row.Line, row.Product.Serial)
+			preview.Updated++
+		}
+	}
+	tw.Flush()
+
+	if *dryRun {
+		fmt.Printf("\ndry run: %d products would be added, %d updated and %d rows skipped\n", preview.Created, preview.Updated, preview.Skipped)
+		return
+	}
+	fmt.Printf("\n%d products added, %d updated and %d rows skipped\n", result.Created, result.Updated, result.Skipped)
+}
+
+func exportProducts(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	out := fs.String("out", "products.csv", "File to write the catalogue to, its extension picks csv or xlsx")
+	withCost := fs.Bool("cost", true, "Include the cost prices")
+	connect := dbFlags(fs)
+	fs.Parse(args)
+
+	format := productfile.Format(*out)
+	if format == "" {
+		log.Fatal(productfile.ErrFormat)
+	}
+
+	products, err := productfile.Products(connect())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = productfile.Write(f, format, products, *withCost)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%d products written to %s\n", len(products), *out)
+}
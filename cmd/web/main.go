@@ -1,23 +1,34 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/jofosuware/small-business-management-app/cmd/web/middleware"
 	"github.com/jofosuware/small-business-management-app/cmd/web/routes"
+	"github.com/jofosuware/small-business-management-app/internal/alerts"
 	"github.com/jofosuware/small-business-management-app/internal/config"
 	"github.com/jofosuware/small-business-management-app/internal/driver"
 	"github.com/jofosuware/small-business-management-app/internal/handlers"
 	"github.com/jofosuware/small-business-management-app/internal/helpers"
+	"github.com/jofosuware/small-business-management-app/internal/license"
 	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/pricing"
+	"github.com/jofosuware/small-business-management-app/internal/productfile"
 	"github.com/jofosuware/small-business-management-app/internal/render"
+	"github.com/jofosuware/small-business-management-app/internal/repository/auditrepo"
+	"github.com/jofosuware/small-business-management-app/internal/repository/dbrepo"
+	"github.com/jofosuware/small-business-management-app/internal/totp"
 )
 
 var app config.AppConfig
@@ -26,7 +37,11 @@ var infoLog *log.Logger
 var errorLog *log.Logger
 
 func main() {
-	db, err := run()
+	// The background checks stop and the server shuts down on an interrupt or termination
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db, err := run(ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -47,11 +62,20 @@ func main() {
 		Handler: routes.Routes(&app),
 	}
 
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+
 	err = srv.ListenAndServe()
-	log.Fatal(err)
+	if !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
 }
 
-func run() (*driver.DB, error) {
+func run(ctx context.Context) (*driver.DB, error) {
 	// what am I going to put in the session
 	gob.Register(models.User{})
 	gob.Register(models.Product{})
@@ -60,6 +84,7 @@ func run() (*driver.DB, error) {
 	gob.Register([]models.Product{})
 	gob.Register(models.Item{})
 	gob.Register(models.Payments{})
+	gob.Register(productfile.Sheet{})
 
 	//read flags
 	inProduction := flag.Bool("production", true, "application is in production")
@@ -70,6 +95,16 @@ func run() (*driver.DB, error) {
 	dbPass := flag.String("dbpass", "", "Database password")
 	dbPort := flag.Int("dbport", 5432, "Database port")
 	dbSSL := flag.String("dbssl", "disable", "Database ssl settings (disable, prefer, require)")
+	loginMaxFailures := flag.Int("login-max-failures", 5, "Failed logins allowed per username before it is locked out")
+	loginMaxIPFailures := flag.Int("login-max-ip-failures", 20, "Failed logins allowed per client IP before it is locked out")
+	loginLockout := flag.Duration("login-lockout", 15*time.Minute, "How long a lockout lasts")
+	totpKey := flag.String("totp-key", os.Getenv("TOTP_KEY"), "Base64 32 byte key two-factor secrets are sealed with, defaults to $TOTP_KEY")
+	trustedProxies := flag.String("trusted-proxies", "", "Comma separated addresses or CIDR networks of reverse proxies whose X-Forwarded-For is trusted")
+	passwordMinLength := flag.Int("password-min-length", 8, "Minimum length of new passwords")
+	passwordHistory := flag.Int("password-history", 5, "How many previous passwords cannot be reused")
+	stockCheckInterval := flag.Duration("stock-check-interval", 5*time.Minute, "How often stock levels are checked for restock alerts, 0 turns the check off")
+	priceCheckInterval := flag.Duration("price-check-interval", time.Minute, "How often scheduled price changes are checked for their effective date, 0 turns the check off")
+	licenseFile := flag.String("license", "license.lic", "Path to the license file")
 
 	flag.Parse()
 
@@ -81,6 +116,28 @@ func run() (*driver.DB, error) {
 	//change this to true when in production
 	app.InProduction = *inProduction
 	app.UseCache = *inProduction
+	app.Login = config.LoginPolicy{
+		MaxFailures:   *loginMaxFailures,
+		MaxIPFailures: *loginMaxIPFailures,
+		Lockout:       *loginLockout,
+	}
+	app.Password = config.PasswordPolicy{
+		MinLength: *passwordMinLength,
+		History:   *passwordHistory,
+	}
+
+	proxies, err := config.ParseProxies(*trustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("trusted-proxies: %w", err)
+	}
+	app.Proxies = proxies
+
+	if *totpKey != "" {
+		app.TOTPKey, err = totp.ParseKey(*totpKey)
+		if err != nil {
+			return nil, fmt.Errorf("totp-key: %w", err)
+		}
+	}
 
 	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	app.InfoLog = infoLog
@@ -88,6 +145,13 @@ func run() (*driver.DB, error) {
 	errorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 	app.ErrorLog = errorLog
 
+	app.License = license.Load(*licenseFile)
+	if app.License.Valid() {
+		infoLog.Printf("Licensed to %s until %s\n", app.License.License.Licensee, app.License.License.ExpiresAt.Format("02-01-2006"))
+	} else {
+		errorLog.Println("license:", app.License.Err)
+	}
+
 	session = scs.New()
 	session.Lifetime = 24 * time.Hour
 	session.Cookie.Persist = true
@@ -97,6 +161,8 @@ func run() (*driver.DB, error) {
 	app.Session = session
 	middleware.Session = session
 	middleware.App.InProduction = app.InProduction
+	middleware.App.ErrorLog = app.ErrorLog
+	middleware.App.License = app.License
 
 	// connect to database
 	log.Println("Connecting to database...")
@@ -112,6 +178,28 @@ func run() (*driver.DB, error) {
 	}
 	log.Println("Connected to database!")
 
+	session.Store = dbrepo.NewSessionStore(ctx, db.SQL, 5*time.Minute)
+	middleware.DB = dbrepo.NewPostgresRepo(db.SQL, &app)
+
+	if *stockCheckInterval > 0 {
+		checker := &alerts.Checker{
+			DB:       dbrepo.NewPostgresRepo(db.SQL, &app),
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		}
+		go checker.Run(ctx, *stockCheckInterval)
+	}
+
+	if *priceCheckInterval > 0 {
+		// Scheduled prices are applied by nobody in particular, they are audited as user 0
+		scheduler := &pricing.Scheduler{
+			DB:       auditrepo.New(dbrepo.NewPostgresRepo(db.SQL, &app), auditrepo.Actor{}, errorLog),
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		}
+		go scheduler.Run(ctx, *priceCheckInterval)
+	}
+
 	tc, err := render.CreateTemplateCache()
 	if err != nil {
 		errorLog.Println("cannot create template cache")
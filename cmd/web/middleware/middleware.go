@@ -2,15 +2,21 @@ package middleware
 
 import (
 	"net/http"
+	"net/netip"
+	"strings"
 
 	"github.com/alexedwards/scs/v2"
+	apihandler "github.com/jofosuware/small-business-management-app/cmd/api/apiHandler"
 	"github.com/jofosuware/small-business-management-app/internal/config"
 	"github.com/jofosuware/small-business-management-app/internal/helpers"
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
 	"github.com/justinas/nosurf"
 )
 
 var App config.AppConfig
 var Session *scs.SessionManager
+var DB repository.DatabaseRepo
 
 // NoSurf adds CSRF protection to all POST requests
 func NoSurf(next http.Handler) http.Handler {
@@ -30,6 +36,20 @@ func SessionLoad(next http.Handler) http.Handler {
 	return Session.LoadAndSave(next)
 }
 
+// RealIP sets the remote address of requests that come through one of the trusted reverse
+// proxies to the client address they forward, requests from anywhere else keep their own
+func RealIP(proxies []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(proxies) > 0 {
+				r.RemoteAddr = helpers.ForwardedClientIP(r, proxies)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Auth only lets through logged in users whose session has not been revoked
 func Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !helpers.IsAuthenticated(r) {
@@ -37,6 +57,113 @@ func Auth(next http.Handler) http.Handler {
 			http.Redirect(w, r, "/", http.StatusSeeOther)
 			return
 		}
+
+		// A session that cannot be checked is not let through, it may have been revoked
+		live, err := DB.TouchUserSession(Session.Token(r.Context()), helpers.ClientIP(r))
+		if err != nil {
+			App.ErrorLog.Println(err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if !live {
+			_ = Session.Destroy(r.Context())
+			Session.Put(r.Context(), "error", "Your session has ended, log in again")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequirePermission only lets through users whose access level grants perm
+func RequirePermission(perm string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := Session.Get(r.Context(), "user").(models.User)
+			if !ok || !user.Can(perm) {
+				forbidden(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SessionUser hands the logged in user to the api handlers that serve the pages their data,
+// they check it the way they check the user of an api token
+func SessionUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := Session.Get(r.Context(), "user").(models.User)
+		if !ok {
+			forbidden(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(apihandler.WithUser(r.Context(), user)))
+	})
+}
+
+// RequireRole only lets through users holding one of the given roles
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := Session.Get(r.Context(), "user").(models.User)
+			if ok {
+				for _, role := range roles {
+					if user.Role() == role {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+			forbidden(w, r)
+		})
+	}
+}
+
+// forbidden sends the user back to the dashboard with an error
+func forbidden(w http.ResponseWriter, r *http.Request) {
+	App.ErrorLog.Printf("access denied to %s for user %v", r.URL.Path, Session.Get(r.Context(), "user_id"))
+	Session.Put(r.Context(), "error", "You are not allowed to access that page")
+	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+}
+
+// TwoFactorSetup keeps users whose access level must use two-factor authentication on the
+// user page until they have enrolled
+func TwoFactorSetup(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if Session.GetBool(r.Context(), "two_factor_setup") &&
+			r.URL.Path != "/admin/edit-user" && !strings.HasPrefix(r.URL.Path, "/admin/two-factor/") {
+			Session.Put(r.Context(), "warning", "Set up two-factor authentication to continue")
+			http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ReadOnly refuses changes while the license has lapsed or is missing
+func ReadOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && App.License.ReadOnly() {
+			Session.Put(r.Context(), "error", "The license has lapsed, changes are disabled until it is renewed")
+			http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireModule hides the routes of a module the license does not enable
+func RequireModule(module string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !App.License.HasModule(module) {
+				Session.Put(r.Context(), "error", "Your license does not include this feature")
+				http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"encoding/gob"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/jofosuware/small-business-management-app/internal/helpers"
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// sessionsRepo answers every session check with live and err
+type sessionsRepo struct {
+	repository.DatabaseRepo
+	live bool
+	err  error
+}
+
+func (f *sessionsRepo) TouchUserSession(token, ip string) (bool, error) {
+	return f.live, f.err
+}
+
+func TestMain(m *testing.M) {
+	gob.Register(models.User{})
+
+	Session = scs.New()
+	App.Session = Session
+	App.ErrorLog = log.New(io.Discard, "", 0)
+	helpers.NewHandlers(&App)
+
+	os.Exit(m.Run())
+}
+
+// serve runs a request through mw for the logged in user, or for nobody when user is nil,
+// and returns the response along with whether the request got past mw
+func serve(mw func(http.Handler) http.Handler, user *models.User) (*httptest.ResponseRecorder, bool) {
+	passed := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		passed = true
+	})
+
+	login := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user != nil {
+				Session.Put(r.Context(), "user_id", user.ID)
+				Session.Put(r.Context(), "user", *user)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	w := httptest.NewRecorder()
+	Session.LoadAndSave(login(mw(next))).ServeHTTP(w, httptest.NewRequest("GET", "/admin/dashboard", nil))
+	return w, passed
+}
+
+func TestAuth(t *testing.T) {
+	user := &models.User{ID: 1, Username: "ama", AccessLevel: models.AccessOwner}
+
+	tests := []struct {
+		name     string
+		user     *models.User
+		db       *sessionsRepo
+		passed   bool
+		expected int
+	}{
+		{"not logged in", nil, &sessionsRepo{live: true}, false, http.StatusSeeOther},
+		{"live session", user, &sessionsRepo{live: true}, true, http.StatusOK},
+		{"revoked session", user, &sessionsRepo{live: false}, false, http.StatusSeeOther},
+		{"session that cannot be checked", user, &sessionsRepo{err: errors.New("connection refused")}, false, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		DB = tt.db
+		w, passed := serve(Auth, tt.user)
+		if passed != tt.passed || w.Code != tt.expected {
+			t.Errorf("%s: got %d and passed %t, expected %d and passed %t", tt.name, w.Code, passed, tt.expected, tt.passed)
+		}
+	}
+}
+
+func TestAuth_RevokedSessionIsDestroyed(t *testing.T) {
+	DB = &sessionsRepo{live: false}
+	user := &models.User{ID: 1, Username: "ama", AccessLevel: models.AccessOwner}
+
+	var loggedIn bool
+	check := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			loggedIn = Session.Exists(r.Context(), "user_id")
+		})
+	}
+
+	serve(func(next http.Handler) http.Handler { return check(Auth(next)) }, user)
+	if loggedIn {
+		t.Error("the revoked session still holds the user")
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		name   string
+		user   *models.User
+		passed bool
+	}{
+		{"owner", &models.User{ID: 1, AccessLevel: models.AccessOwner}, true},
+		{"manager", &models.User{ID: 2, AccessLevel: models.AccessManager}, true},
+		{"clerk", &models.User{ID: 3, AccessLevel: models.AccessClerk}, false},
+		{"collector", &models.User{ID: 4, AccessLevel: models.AccessCollector}, false},
+		{"not logged in", nil, false},
+	}
+
+	for _, tt := range tests {
+		w, passed := serve(RequirePermission(models.PermManagePurchases), tt.user)
+		if passed != tt.passed {
+			t.Errorf("%s: passed %t, expected %t", tt.name, passed, tt.passed)
+		}
+		if !passed && (w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/admin/dashboard") {
+			t.Errorf("%s: got %d to %q, expected to be sent to the dashboard", tt.name, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
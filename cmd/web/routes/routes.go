@@ -6,14 +6,27 @@ import (
 	"github.com/go-chi/chi"
 	chiMiddleware "github.com/go-chi/chi/middleware"
 	"github.com/go-chi/cors"
+	apihandler "github.com/jofosuware/small-business-management-app/cmd/api/apiHandler"
 	"github.com/jofosuware/small-business-management-app/cmd/web/middleware"
 	"github.com/jofosuware/small-business-management-app/internal/config"
 	"github.com/jofosuware/small-business-management-app/internal/handlers"
+	"github.com/jofosuware/small-business-management-app/internal/license"
+	"github.com/jofosuware/small-business-management-app/internal/models"
 )
 
 func Routes(app *config.AppConfig) http.Handler {
 	mux := chi.NewRouter()
 
+	// The pages page through their lists with the api handlers, served here to the session so
+	// that no api token or api license is needed
+	data := &apihandler.Repository{
+		DB:        handlers.Repo.DB,
+		InfoLog:   app.InfoLog,
+		ErrorLog:  app.ErrorLog,
+		License:   app.License,
+		ImagePath: "/admin/product-image",
+	}
+
 	mux.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
@@ -22,6 +35,7 @@ func Routes(app *config.AppConfig) http.Handler {
 		MaxAge:           300,
 	}))
 
+	mux.Use(middleware.RealIP(app.Proxies))
 	mux.Use(chiMiddleware.Recoverer)
 	//mux.Use(middleware.NoSurf)
 	mux.Use(middleware.SessionLoad)
@@ -30,61 +44,237 @@ func Routes(app *config.AppConfig) http.Handler {
 	mux.Post("/login", handlers.Repo.PostLogin)
 	mux.Get("/logout", handlers.Repo.Logout)
 	mux.Post("/developer", handlers.Repo.PostDeveloper)
+	mux.Get("/activate/{token}", handlers.Repo.ActivationForm)
+	mux.Post("/activate/{token}", handlers.Repo.PostActivation)
+	mux.Get("/login/2fa", handlers.Repo.TwoFactorForm)
+	mux.Post("/login/2fa", handlers.Repo.PostTwoFactor)
 
 	fileServer := http.FileServer(http.Dir("./static"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
 	mux.Route("/admin", func(mux chi.Router) {
 		mux.Use(middleware.Auth)
+		mux.Use(middleware.TwoFactorSetup)
 		mux.Get("/dashboard", handlers.Repo.Dashboard)
 
 		//Product route
-		mux.Get("/add-product", handlers.Repo.ProductForm)
-		mux.Post("/add-product", handlers.Repo.AddProduct)
-		mux.Get("/search-product", handlers.Repo.SearchProduct)
-		mux.Post("/edit-form", handlers.Repo.EditProductForm)
-		mux.Get("/edit-product", handlers.Repo.ProductForm)
-		mux.Post("/edit-product", handlers.Repo.UpdateProduct)
-		mux.Get("/delete-product", handlers.Repo.SearchProduct)
-		mux.Post("/delete-product", handlers.Repo.DeleteProduct)
-		mux.Get("/increase-qty", handlers.Repo.IncreaseQtyForm)
-		mux.Post("/increase-qty", handlers.Repo.PostIncreaseQty)
-		mux.Get("/list-products/{page}", handlers.Repo.ListProducts)
+		mux.Group(func(mux chi.Router) {
+			mux.Use(middleware.RequirePermission(models.PermViewProducts))
+			mux.Use(middleware.RequireModule(license.ModuleInventory))
+			mux.Get("/list-products/{page}", handlers.Repo.ListProducts)
+			mux.Get("/stock-movements", handlers.Repo.StockMovements)
+			mux.Get("/stock-alerts", handlers.Repo.StockAlerts)
+			mux.Get("/stock-levels", handlers.Repo.StockLevels)
+			mux.Get("/expiring-stock", handlers.Repo.ExpiringStock)
+			mux.Get("/product-images", handlers.Repo.ProductImages)
+			mux.Get("/product-image/{id}", handlers.Repo.ProductImage)
+			mux.Get("/product-image/{id}/thumb", handlers.Repo.ProductThumbnail)
+			mux.Get("/export-products", handlers.Repo.ExportProducts)
+			mux.Get("/scan-product", handlers.Repo.ScanProduct)
+			mux.Get("/barcode", handlers.Repo.Barcode)
+			mux.Get("/labels", handlers.Repo.Labels)
+			mux.Post("/labels", handlers.Repo.PostLabels)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(middleware.RequirePermission(models.PermManageProducts))
+			mux.Use(middleware.ReadOnly, middleware.RequireModule(license.ModuleInventory))
+			mux.Get("/add-product", handlers.Repo.ProductForm)
+			mux.Post("/add-product", handlers.Repo.AddProduct)
+			mux.Get("/search-product", handlers.Repo.SearchProduct)
+			mux.Post("/edit-form", handlers.Repo.EditProductForm)
+			mux.Get("/edit-product", handlers.Repo.ProductForm)
+			mux.Post("/edit-product", handlers.Repo.UpdateProduct)
+			mux.Get("/delete-product", handlers.Repo.SearchProduct)
+			mux.Post("/delete-product", handlers.Repo.DeleteProduct)
+			mux.Post("/archive-product", handlers.Repo.PostArchiveProduct)
+			mux.Post("/restore-product", handlers.Repo.PostRestoreProduct)
+			mux.Post("/product-images", handlers.Repo.PostProductImages)
+			mux.Post("/primary-product-image", handlers.Repo.PostPrimaryProductImage)
+			mux.Post("/delete-product-image", handlers.Repo.PostDeleteProductImage)
+			mux.Get("/product-prices", handlers.Repo.ProductPrices)
+			mux.Post("/product-prices", handlers.Repo.PostProductPrice)
+			mux.Post("/cancel-price-change", handlers.Repo.PostCancelPriceChange)
+			mux.Get("/catalogue", handlers.Repo.Catalogue)
+			mux.Post("/categories", handlers.Repo.PostCategory)
+			mux.Post("/delete-category", handlers.Repo.PostDeleteCategory)
+			mux.Post("/brands", handlers.Repo.PostBrand)
+			mux.Post("/delete-brand", handlers.Repo.PostDeleteBrand)
+			mux.Get("/import-products", handlers.Repo.ImportProducts)
+			mux.Post("/import-products", handlers.Repo.PostUploadProducts)
+			mux.Post("/import-products/preview", handlers.Repo.PostPreviewImport)
+			mux.Post("/import-products/run", handlers.Repo.PostImportProducts)
+			mux.Get("/locations", handlers.Repo.Locations)
+			mux.Post("/locations", handlers.Repo.PostLocation)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(middleware.RequirePermission(models.PermAdjustStock))
+			mux.Use(middleware.ReadOnly, middleware.RequireModule(license.ModuleInventory))
+			mux.Get("/increase-qty", handlers.Repo.IncreaseQtyForm)
+			mux.Post("/increase-qty", handlers.Repo.PostIncreaseQty)
+			mux.Post("/stock-takes", handlers.Repo.PostStockTake)
+			mux.Post("/stock-take/approve", handlers.Repo.PostApproveStockTake)
+			mux.Post("/stock-take/cancel", handlers.Repo.PostCancelStockTake)
+			mux.Get("/stock-transfers", handlers.Repo.StockTransfers)
+			mux.Get("/stock-transfer", handlers.Repo.StockTransfer)
+			mux.Post("/stock-transfer", handlers.Repo.PostStockTransfer)
+			mux.Post("/complete-stock-transfer", handlers.Repo.PostCompleteStockTransfer)
+			mux.Post("/delete-stock-transfer", handlers.Repo.PostDeleteStockTransfer)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(middleware.RequirePermission(models.PermCountStock))
+			mux.Use(middleware.ReadOnly, middleware.RequireModule(license.ModuleInventory))
+			mux.Get("/stock-takes", handlers.Repo.StockTakes)
+			mux.Get("/stock-take", handlers.Repo.StockTake)
+			mux.Post("/stock-take/counts", handlers.Repo.PostStockCounts)
+		})
+
+		//Purchasing Route
+		mux.Group(func(mux chi.Router) {
+			mux.Use(middleware.RequirePermission(models.PermManagePurchases))
+			mux.Use(middleware.ReadOnly, middleware.RequireModule(license.ModuleInventory))
+			mux.Get("/suppliers", handlers.Repo.Suppliers)
+			mux.Post("/suppliers", handlers.Repo.PostSupplier)
+			mux.Get("/purchase-orders", handlers.Repo.PurchaseOrders)
+			mux.Get("/purchase-order", handlers.Repo.PurchaseOrder)
+			mux.Post("/purchase-order", handlers.Repo.PostPurchaseOrder)
+			mux.Post("/place-purchase-order", handlers.Repo.PostPlacePurchaseOrder)
+			mux.Post("/receive-purchase-order", handlers.Repo.PostReceivePurchaseOrder)
+			mux.Post("/delete-purchase-order", handlers.Repo.PostDeletePurchaseOrder)
+		})
 
 		//Contract Route
-		mux.Get("/add-contract", handlers.Repo.CustomerForm)
-		mux.Post("/add-contract", handlers.Repo.PostCustomer)
-		mux.Get("/edit-contract", handlers.Repo.CustomerForm)
-		mux.Post("/update-contract", handlers.Repo.UpdateCustomer)
-		mux.Get("/add-witness", handlers.Repo.GetWitnessForm)
-		mux.Post("/add-witness", handlers.Repo.PostWitness)
-		mux.Get("/edit-witness", handlers.Repo.GetWitnessForm)
-		mux.Post("/update-witness", handlers.Repo.UpdateWitness)
-		mux.Get("/add-item", handlers.Repo.ItemForm)
-		mux.Post("/add-item", handlers.Repo.PostItem)
-		mux.Get("/edit-item", handlers.Repo.ItemForm)
-		mux.Post("/edit-item", handlers.Repo.UpdateItem)
-		mux.Get("/pay", handlers.Repo.PaymentForm)
-		mux.Post("/pay", handlers.Repo.PostPayments)
-		mux.Get("/generate-receipt", handlers.Repo.ReceiptPage)
-		mux.Get("/list-customers/{page}", handlers.Repo.ListCustomers)
-		mux.Get("/list-payments/{page}", handlers.Repo.ListPayments)
+		mux.Group(func(mux chi.Router) {
+			mux.Use(middleware.RequirePermission(models.PermManageContracts))
+			mux.Use(middleware.ReadOnly, middleware.RequireModule(license.ModuleContracts))
+			mux.Get("/add-contract", handlers.Repo.CustomerForm)
+			mux.Post("/add-contract", handlers.Repo.PostCustomer)
+			mux.Get("/edit-contract", handlers.Repo.CustomerForm)
+			mux.Post("/update-contract", handlers.Repo.UpdateCustomer)
+			mux.Get("/add-witness", handlers.Repo.GetWitnessForm)
+			mux.Post("/add-witness", handlers.Repo.PostWitness)
+			mux.Get("/edit-witness", handlers.Repo.GetWitnessForm)
+			mux.Post("/update-witness", handlers.Repo.UpdateWitness)
+			mux.Get("/add-item", handlers.Repo.ItemForm)
+			mux.Post("/add-item", handlers.Repo.PostItem)
+			mux.Get("/edit-item", handlers.Repo.ItemForm)
+			mux.Post("/edit-item", handlers.Repo.UpdateItem)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(middleware.RequirePermission(models.PermCollectPayments))
+			mux.Use(middleware.ReadOnly, middleware.RequireModule(license.ModuleContracts))
+			mux.Get("/pay", handlers.Repo.PaymentForm)
+			mux.Post("/pay", handlers.Repo.PostPayments)
+			mux.Get("/generate-receipt", handlers.Repo.ReceiptPage)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(middleware.RequirePermission(models.PermViewCustomers))
+			mux.Use(middleware.RequireModule(license.ModuleContracts))
+			mux.Get("/list-customers/{page}", handlers.Repo.ListCustomers)
+			mux.Get("/list-payments/{page}", handlers.Repo.ListPayments)
+		})
 
 		//Purchase Route
-		mux.Get("/add-purchase", handlers.Repo.PurchaseForm)
-		mux.Post("/add-purchase", handlers.Repo.PostPurchase)
-		mux.Get("/list-purchases/{pages}", handlers.Repo.ListPurchases)
+		mux.Group(func(mux chi.Router) {
+			mux.Use(middleware.RequirePermission(models.PermSell))
+			mux.Use(middleware.ReadOnly, middleware.RequireModule(license.ModuleSales))
+			mux.Get("/add-purchase", handlers.Repo.PurchaseForm)
+			mux.Post("/add-purchase", handlers.Repo.PostPurchase)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(middleware.RequirePermission(models.PermViewSales))
+			mux.Use(middleware.RequireModule(license.ModuleSales))
+			mux.Get("/list-purchases/{pages}", handlers.Repo.ListPurchases)
+		})
+
+		//Reports Route
+		mux.Group(func(mux chi.Router) {
+			mux.Use(middleware.RequirePermission(models.PermViewReports))
+			mux.Use(middleware.RequireModule(license.ModuleSales))
+			mux.Get("/reports/gross-profit", handlers.Repo.GrossProfit)
+		})
 
 		//Users Route
-		mux.Get("/signup", handlers.Repo.UserForm)
 		mux.Get("/edit-user", handlers.Repo.UserForm)
-		mux.Post("/signup", handlers.Repo.PostUser)
-		mux.Get("/list-users", handlers.Repo.ListUsers)
-		mux.Post("/resetPassword", handlers.Repo.PostReset)
+		mux.With(middleware.ReadOnly).Post("/edit-user", handlers.Repo.PostEditUser)
+		mux.Get("/change-password", handlers.Repo.ChangePasswordForm)
+		mux.Post("/change-password", handlers.Repo.PostChangePassword)
+		mux.Post("/two-factor/setup", handlers.Repo.PostTwoFactorSetup)
+		mux.Post("/two-factor/enable", handlers.Repo.PostTwoFactorEnable)
+		mux.Post("/two-factor/disable", handlers.Repo.PostTwoFactorDisable)
+		mux.Get("/api-tokens", handlers.Repo.APITokens)
+		mux.Post("/api-tokens", handlers.Repo.PostAPIToken)
+		mux.Post("/revoke-api-token", handlers.Repo.PostRevokeAPIToken)
+		mux.Get("/sessions", handlers.Repo.Sessions)
+		mux.Post("/revoke-session", handlers.Repo.PostRevokeSession)
+		mux.Post("/revoke-other-sessions", handlers.Repo.PostRevokeOtherSessions)
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(middleware.RequirePermission(models.PermManageUsers))
+			mux.Use(middleware.ReadOnly)
+			mux.Get("/signup", handlers.Repo.UserForm)
+			mux.Post("/signup", handlers.Repo.PostUser)
+			mux.Get("/list-users", handlers.Repo.ListUsers)
+			mux.Post("/reissue-activation", handlers.Repo.ReissueActivation)
+			mux.Post("/revoke-activation", handlers.Repo.RevokeActivation)
+			mux.Post("/deactivate-user", handlers.Repo.PostDeactivateUser)
+			mux.Post("/reactivate-user", handlers.Repo.PostReactivateUser)
+			mux.Post("/delete-user", handlers.Repo.PostDeleteUser)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(middleware.RequirePermission(models.PermUnlockUsers))
+			mux.Get("/lockouts", handlers.Repo.Lockouts)
+			mux.Post("/unlock", handlers.Repo.PostUnlock)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(middleware.RequirePermission(models.PermRevokeSessions))
+			mux.Get("/active-sessions", handlers.Repo.ActiveSessions)
+			mux.Post("/end-session", handlers.Repo.PostEndSession)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(middleware.RequirePermission(models.PermViewAudit))
+			mux.Get("/audit", handlers.Repo.AuditLog)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(middleware.RequireRole(models.AccessOwner))
+			mux.Get("/two-factor-policy", handlers.Repo.TwoFactorPolicy)
+			mux.Post("/two-factor-policy", handlers.Repo.PostTwoFactorPolicy)
+		})
+
+		//Page data Route
+		mux.Route("/data", func(mux chi.Router) {
+			mux.Use(middleware.SessionUser)
+
+			mux.Group(func(mux chi.Router) {
+				mux.Use(middleware.RequirePermission(models.PermViewCustomers))
+				mux.Use(middleware.RequireModule(license.ModuleContracts))
+				mux.Post("/customer-debt/{id}", data.CustomerDebt)
+				mux.Get("/owing-today", data.CustomerOwingToday)
+				mux.Get("/list-customers/{page}", data.ListCustomersByPage)
+				mux.Get("/list-payments/{page}", data.ListPaymentsByPage)
+			})
+
+			mux.With(middleware.RequirePermission(models.PermViewProducts), middleware.RequireModule(license.ModuleInventory)).
+				Get("/list-products/{page}", data.ListProductByPage)
+			mux.With(middleware.RequirePermission(models.PermViewSales), middleware.RequireModule(license.ModuleSales)).
+				Get("/list-purchases/{page}", data.ListPurchasesByPage)
+		})
 
 		//Backup and Recovery Route
-		mux.Get("/backup", handlers.Repo.BackupAndRecovery)
-		mux.Get("/restore", handlers.Repo.BackupAndRecovery)
+		mux.Group(func(mux chi.Router) {
+			mux.Use(middleware.RequireRole(models.AccessOwner))
+			mux.Get("/backup", handlers.Repo.BackupAndRecovery)
+			mux.Get("/restore", handlers.Repo.BackupAndRecovery)
+		})
 	})
 
 	return mux
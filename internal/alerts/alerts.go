@@ -0,0 +1,52 @@
+// Package alerts watches stock levels in the background and raises a restock alert once when a
+// product falls to its reorder point, rather than every time someone looks at it.
+package alerts
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// Checker raises the restock alerts
+type Checker struct {
+	DB       repository.DatabaseRepo
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// Check raises an alert for every product that has fallen to its reorder point since the last
+// check and returns them
+func (c *Checker) Check() ([]models.StockAlert, error) {
+	raised, err := c.DB.RaiseStockAlerts()
+	if err != nil {
+		return raised, err
+	}
+
+	for _, a := range raised {
+		c.InfoLog.Printf("Restock alert: %s (%s) is down to %d units, reorder %d\n", a.Name, a.Serial, a.Units, a.ReorderQty)
+	}
+
+	return raised, nil
+}
+
+// Run checks stock levels now and then every interval until ctx is done
+func (c *Checker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := c.Check(); err != nil {
+			c.ErrorLog.Println("stock alerts:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+type testRepo struct {
+	repository.DatabaseRepo
+	raised []models.StockAlert
+	checks int
+}
+
+func (r *testRepo) RaiseStockAlerts() ([]models.StockAlert, error) {
+	r.checks++
+	raised := r.raised
+	r.raised = nil
+	return raised, nil
+}
+
+func TestChecker_Check(t *testing.T) {
+	var out bytes.Buffer
+	repo := &testRepo{raised: []models.StockAlert{{Serial: "SN-1", Name: "Rice", Units: 2, ReorderPoint: 5, ReorderQty: 20}}}
+	c := &Checker{DB: repo, InfoLog: log.New(&out, "", 0), ErrorLog: log.New(&out, "", 0)}
+
+	raised, err := c.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raised) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(raised))
+	}
+	if !strings.Contains(out.String(), "Rice (SN-1) is down to 2 units") {
+		t.Errorf("alert was not logged: %q", out.String())
+	}
+
+	out.Reset()
+	raised, _ = c.Check()
+	if len(raised) != 0 || out.Len() != 0 {
+		t.Errorf("expected no alert on the second check, got %d and %q", len(raised), out.String())
+	}
+}
+
+func TestChecker_Run(t *testing.T) {
+	var out bytes.Buffer
+	repo := &testRepo{}
+	c := &Checker{DB: repo, InfoLog: log.New(&out, "", 0), ErrorLog: log.New(&out, "", 0)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx, 5*time.Millisecond)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return once its context was done")
+	}
+
+	if repo.checks < 2 {
+		t.Errorf("expected stock to be checked repeatedly, checked %d times", repo.checks)
+	}
+}
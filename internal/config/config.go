@@ -3,8 +3,12 @@ package config
 import (
 	"html/template"
 	"log"
+	"net/netip"
+	"strings"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/jofosuware/small-business-management-app/internal/license"
 )
 
 // AppConfig holds the application config
@@ -15,4 +19,67 @@ type AppConfig struct {
 	ErrorLog      *log.Logger
 	InProduction  bool
 	Session       *scs.SessionManager
+	Login         LoginPolicy
+	Password      PasswordPolicy
+	License       *license.Status
+	Proxies       []netip.Prefix
+	TOTPKey       []byte
+}
+
+// LoginPolicy holds the limits applied to failed logins
+type LoginPolicy struct {
+	MaxFailures   int
+	MaxIPFailures int
+	Lockout       time.Duration
+}
+
+// PasswordPolicy holds the rules new passwords must follow
+type PasswordPolicy struct {
+	MinLength int
+	History   int
+}
+
+// Delay returns how long to wait after the last failure before another attempt is allowed
+func (p LoginPolicy) Delay(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+
+	if failures > 30 {
+		return p.Lockout
+	}
+
+	delay := time.Second << (failures - 1)
+	if delay > p.Lockout {
+		return p.Lockout
+	}
+	return delay
+}
+
+// ParseProxies reads a comma separated list of the addresses, or networks in CIDR notation, of
+// the reverse proxies whose forwarded client address headers are trusted
+func ParseProxies(s string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		if !strings.Contains(p, "/") {
+			addr, err := netip.ParseAddr(p)
+			if err != nil {
+				return nil, err
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
 }
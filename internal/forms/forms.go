@@ -1,8 +1,10 @@
 package forms
 
 import (
+	_ "embed"
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/asaskevich/govalidator"
@@ -58,3 +60,61 @@ func (f *Form) IsEmail(field string) {
 		f.Errors.Add(field, "Invalid email address")
 	}
 }
+
+// IsNumber checks that a field, when given, is a number of at least min
+func (f *Form) IsNumber(field string, min float64) bool {
+	x := strings.TrimSpace(f.Get(field))
+	if x == "" {
+		return true
+	}
+
+	n, err := strconv.ParseFloat(x, 64)
+	if err != nil || n < min {
+		f.Errors.Add(field, fmt.Sprintf("Enter a number of %s or more", strconv.FormatFloat(min, 'f', -1, 64)))
+		return false
+	}
+	return true
+}
+
+// IsWholeNumber checks that a field, when given, is a whole number of at least min
+func (f *Form) IsWholeNumber(field string, min int) bool {
+	x := strings.TrimSpace(f.Get(field))
+	if x == "" {
+		return true
+	}
+
+	n, err := strconv.Atoi(x)
+	if err != nil || n < min {
+		f.Errors.Add(field, fmt.Sprintf("Enter a whole number of %d or more", min))
+		return false
+	}
+	return true
+}
+
+//go:embed common-passwords.txt
+var commonPasswordList string
+
+// commonPasswords holds the bundled list of commonly used passwords
+var commonPasswords = func() map[string]bool {
+	m := map[string]bool{}
+	for _, p := range strings.Fields(commonPasswordList) {
+		m[p] = true
+	}
+	return m
+}()
+
+// Password checks that a new password is at least minLength characters long and is not a
+// commonly used password
+func (f *Form) Password(field string, minLength int) bool {
+	x := f.Get(field)
+	if len([]rune(x)) < minLength {
+		f.Errors.Add(field, fmt.Sprintf("Password must be at least %d characters long", minLength))
+		return false
+	}
+
+	if commonPasswords[strings.ToLower(x)] {
+		f.Errors.Add(field, "This password is too common, choose another one")
+		return false
+	}
+	return true
+}
@@ -121,3 +121,92 @@ func TestForm_IsEmail(t *testing.T) {
 		t.Error("form shows error for valid email")
 	}
 }
+
+func TestForm_Password(t *testing.T) {
+	postedValues := url.Values{}
+	form := New(postedValues)
+
+	form.Password("password", 8)
+	if form.Valid() {
+		t.Error("form shows valid password for non-existent field")
+	}
+
+	postedValues = url.Values{}
+	postedValues.Add("password", "abc")
+	form = New(postedValues)
+
+	form.Password("password", 8)
+	if form.Valid() {
+		t.Error("form shows valid password when it is too short")
+	}
+
+	isError := form.Errors.Get("password")
+	if isError == "" {
+		t.Error("should have an error, but did not get one")
+	}
+
+	postedValues = url.Values{}
+	postedValues.Add("password", "Password1")
+	form = New(postedValues)
+
+	form.Password("password", 8)
+	if form.Valid() {
+		t.Error("form shows valid password when it is a common one")
+	}
+
+	postedValues = url.Values{}
+	postedValues.Add("password", "plantain-kenkey-42")
+	form = New(postedValues)
+
+	form.Password("password", 8)
+	if !form.Valid() {
+		t.Error("form shows invalid password when it should be valid")
+	}
+
+	isError = form.Errors.Get("password")
+	if isError != "" {
+		t.Error("should not have an error, but got one")
+	}
+}
+
+func TestForm_IsNumber(t *testing.T) {
+	postedValues := url.Values{}
+	postedValues.Add("price", "12.50")
+	postedValues.Add("cost", "-1")
+	postedValues.Add("name", "kenkey")
+	form := New(postedValues)
+
+	if !form.IsNumber("price", 0) {
+		t.Error("form shows invalid number when it should be valid")
+	}
+	if form.IsNumber("cost", 0) {
+		t.Error("form shows valid number when it is below the minimum")
+	}
+	if form.IsNumber("name", 0) {
+		t.Error("form shows valid number when it is not a number")
+	}
+	if !form.IsNumber("missing", 0) {
+		t.Error("form shows invalid number for a field that was not given")
+	}
+
+	if form.Errors.Get("cost") == "" || form.Errors.Get("name") == "" {
+		t.Error("should have an error, but did not get one")
+	}
+}
+
+func TestForm_IsWholeNumber(t *testing.T) {
+	postedValues := url.Values{}
+	postedValues.Add("units", "4")
+	postedValues.Add("half", "1.5")
+	form := New(postedValues)
+
+	if !form.IsWholeNumber("units", 0) {
+		t.Error("form shows invalid whole number when it should be valid")
+	}
+	if form.IsWholeNumber("units", 5) {
+		t.Error("form shows valid whole number when it is below the minimum")
+	}
+	if form.IsWholeNumber("half", 0) {
+		t.Error("form shows valid whole number when it has a fraction")
+	}
+}
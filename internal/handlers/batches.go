@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/forms"
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/render"
+)
+
+// expiryAlertDays is how close to its expiry date a batch is shown on the dashboard, and the
+// default window of the expiring stock report
+const expiryAlertDays = 30
+
+// ExpiringStock shows the batches with units left that expire within the days in the query
+// string, or have already expired, at a location or at every location
+func (m *Repository) ExpiringStock(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "Product",
+		Url:     "/admin/expiring-stock",
+	}
+
+	locationId, _ := m.locationFilter(r, data)
+
+	days, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil || days < 0 {
+		days = expiryAlertDays
+	}
+	data["days"] = days
+
+	batches, err := m.DB.FetchExpiringBatches(days, locationId)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Expiring stock cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+	}
+
+	if r.URL.Query().Get("export") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=expiring-stock.csv")
+
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"Serial", "Name", "Location", "Batch", "Expires", "Days Left", "Units"})
+		now := time.Now()
+		for _, b := range batches {
+			_ = cw.Write([]string{
+				b.Serial,
+				b.Name,
+				b.LocationName,
+				b.BatchNo,
+				b.ExpiresAt.Format("2006-01-02"),
+				strconv.Itoa(b.DaysLeft(now)),
+				strconv.Itoa(b.Units),
+			})
+		}
+		cw.Flush()
+		return
+	}
+
+	data["batches"] = batches
+	data["now"] = time.Now()
+
+	render.Template(w, r, "expiringstock.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// expiryDate reads an optional expiry date from the form, an empty field is no expiry date
+func expiryDate(form *forms.Form, field string) time.Time {
+	v := strings.TrimSpace(form.Get(field))
+	if v == "" {
+		return time.Time{}
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+	if err != nil {
+		form.Errors.Add(field, "Enter the expiry date as a date")
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jofosuware/small-business-management-app/internal/forms"
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/render"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// Catalogue shows the categories and brands products are sorted by, with forms to add them or
+// to edit the category or brand with the id in the query string
+func (m *Repository) Catalogue(w http.ResponseWriter, r *http.Request) {
+	var category models.Category
+	var brand models.Brand
+	var err error
+
+	if id, _ := strconv.Atoi(r.URL.Query().Get("category")); id != 0 {
+		category, err = m.DB.FetchCategory(id)
+	}
+	if id, _ := strconv.Atoi(r.URL.Query().Get("brand")); id != 0 && err == nil {
+		brand, err = m.DB.FetchBrand(id)
+	}
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Category or brand cannot be found!")
+		http.Redirect(w, r, "/admin/catalogue", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.renderCatalogue(w, r, forms.New(nil), category, brand)
+}
+
+// PostCategory adds a category, or saves the changes to an existing one
+func (m *Repository) PostCategory(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/catalogue", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	category := models.Category{
+		Name: strings.TrimSpace(r.Form.Get("category_name")),
+	}
+	category.ID, _ = strconv.Atoi(r.Form.Get("category_id"))
+	category.ParentId, _ = strconv.Atoi(r.Form.Get("parent_id"))
+
+	form := forms.New(r.PostForm)
+	form.Required("category_name")
+	if category.ID != 0 && category.ID == category.ParentId {
+		form.Errors.Add("parent_id", "A category cannot be its own parent")
+	}
+	if !form.Valid() {
+		m.renderCatalogue(w, r, form, category, models.Brand{})
+		return
+	}
+
+	if category.ID == 0 {
+		_, err = m.audited(r).InsertCategory(category)
+	} else {
+		err = m.audited(r).UpdateCategory(category)
+	}
+	switch {
+	case errors.Is(err, repository.ErrDuplicate):
+		form.Errors.Add("category_name", "A category with this name is already under the same parent")
+		m.renderCatalogue(w, r, form, category, models.Brand{})
+		return
+	case errors.Is(err, repository.ErrCategoryCycle):
+		form.Errors.Add("parent_id", "A category cannot be moved under one of its subcategories")
+		m.renderCatalogue(w, r, form, category, models.Brand{})
+		return
+	case err != nil:
+		m.App.Session.Put(r.Context(), "error", "Category could not be saved!")
+		http.Redirect(w, r, "/admin/catalogue", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Category %s saved!", category.Name))
+	http.Redirect(w, r, "/admin/catalogue", http.StatusSeeOther)
+}
+
+// PostDeleteCategory removes a category, its subcategories move up a level
+func (m *Repository) PostDeleteCategory(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.FormValue("category_id"))
+
+	err := m.audited(r).DeleteCategory(id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Category could not be deleted!")
+		m.App.ErrorLog.Println(err)
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Category deleted!")
+	}
+
+	http.Redirect(w, r, "/admin/catalogue", http.StatusSeeOther)
+}
+
+// PostBrand adds a brand, or renames an existing one
+func (m *Repository) PostBrand(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/catalogue", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	brand := models.Brand{
+		Name: strings.TrimSpace(r.Form.Get("brand_name")),
+	}
+	brand.ID, _ = strconv.Atoi(r.Form.Get("brand_id"))
+
+	form := forms.New(r.PostForm)
+	form.Required("brand_name")
+	if !form.Valid() {
+		m.renderCatalogue(w, r, form, models.Category{}, brand)
+		return
+	}
+
+	if brand.ID == 0 {
+		_, err = m.audited(r).InsertBrand(brand)
+	} else {
+		err = m.audited(r).UpdateBrand(brand)
+	}
+	if errors.Is(err, repository.ErrDuplicate) {
+		form.Errors.Add("brand_name", "A brand with this name already exists")
+		m.renderCatalogue(w, r, form, models.Category{}, brand)
+		return
+	}
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Brand could not be saved!")
+		http.Redirect(w, r, "/admin/catalogue", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Brand %s saved!", brand.Name))
+	http.Redirect(w, r, "/admin/catalogue", http.StatusSeeOther)
+}
+
+// PostDeleteBrand removes a brand
+func (m *Repository) PostDeleteBrand(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.FormValue("brand_id"))
+
+	err := m.audited(r).DeleteBrand(id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Brand could not be deleted!")
+		m.App.ErrorLog.Println(err)
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Brand deleted!")
+	}
+
+	http.Redirect(w, r, "/admin/catalogue", http.StatusSeeOther)
+}
+
+// renderCatalogue shows the category and brand lists and forms
+func (m *Repository) renderCatalogue(w http.ResponseWriter, r *http.Request, form *forms.Form, category models.Category, brand models.Brand) {
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "Product",
+		Url:     "/admin/catalogue",
+	}
+
+	categories, err := m.DB.FetchCategories()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Categories cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+	}
+
+	brands, err := m.DB.FetchBrands()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Brands cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+	}
+
+	data["categories"] = categories
+	data["brands"] = brands
+	data["category"] = category
+	data["brand"] = brand
+
+	render.Template(w, r, "catalogue.page.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// productCatalogue reads the category, brand and attributes of a product from the form,
+// attributes are posted as attr_name and attr_value pairs
+func productCatalogue(form *forms.Form, p *models.Product) {
+	p.CategoryId, _ = strconv.Atoi(form.Get("category_id"))
+	p.BrandId, _ = strconv.Atoi(form.Get("brand_id"))
+	p.Attributes = nil
+
+	names, values := form.Values["attr_name"], form.Values["attr_value"]
+	seen := make(map[string]bool)
+	for i, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		value := ""
+		if i < len(values) {
+			value = strings.TrimSpace(values[i])
+		}
+		if name == "" && value == "" {
+			continue
+		}
+
+		switch {
+		case name == "" || value == "":
+			form.Errors.Add("attributes", "Give each attribute a name and a value")
+		case strings.Contains(name, ":"):
+			form.Errors.Add("attributes", "Attribute names cannot contain a colon")
+		case seen[name]:
+			form.Errors.Add("attributes", fmt.Sprintf("The %s attribute is given more than once", name))
+		}
+		seen[name] = true
+
+		p.Attributes = append(p.Attributes, models.ProductAttribute{Name: name, Value: value})
+	}
+}
+
+// addCatalogueData adds the categories and brands a product can be given to data
+func (m *Repository) addCatalogueData(data map[string]interface{}) {
+	categories, err := m.DB.FetchCategories()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+
+	brands, err := m.DB.FetchBrands()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+
+	data["categories"] = categories
+	data["brands"] = brands
+}
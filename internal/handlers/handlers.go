@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"database/sql"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"log"
@@ -19,12 +21,25 @@ import (
 	"github.com/jofosuware/small-business-management-app/internal/models"
 	"github.com/jofosuware/small-business-management-app/internal/render"
 	"github.com/jofosuware/small-business-management-app/internal/repository"
+	"github.com/jofosuware/small-business-management-app/internal/repository/auditrepo"
 	"github.com/jofosuware/small-business-management-app/internal/repository/dbrepo"
+	"github.com/jofosuware/small-business-management-app/internal/totp"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var Repo *Repository
 
+const (
+	// activationTokenLifetime is how long a new user's activation link stays valid
+	activationTokenLifetime = 72 * time.Hour
+	// twoFactorPendingLifetime is how long a user has to give their second factor after the password
+	twoFactorPendingLifetime = 5 * time.Minute
+	// recoveryCodeCount is how many recovery codes are issued when two-factor is enabled
+	recoveryCodeCount = 10
+	// twoFactorIssuer names the app in authenticator apps
+	twoFactorIssuer = "OseeEA"
+)
+
 type Repository struct {
 	App *config.AppConfig
 	DB  repository.DatabaseRepo
@@ -38,6 +53,15 @@ func NewRepo(a *config.AppConfig, db *driver.DB) *Repository {
 	}
 }
 
+// audited returns the repository with its changes recorded in the audit log against the
+// logged in user
+func (m *Repository) audited(r *http.Request) repository.DatabaseRepo {
+	return auditrepo.New(m.DB, auditrepo.Actor{
+		UserId:    m.App.Session.GetInt(r.Context(), "user_id"),
+		IPAddress: helpers.ClientIP(r),
+	}, m.App.ErrorLog)
+}
+
 // NewHandlers set the repository for the handlers
 func NewHandlers(r *Repository) {
 	Repo = r
@@ -58,6 +82,23 @@ func (m *Repository) Dashboard(w http.ResponseWriter, r *http.Request) {
 		Url: r.URL.Path,
 	}
 
+	user, _ := m.App.Session.Get(r.Context(), "user").(models.User)
+	if user.Can(models.PermViewProducts) {
+		lowStock, err := m.DB.FetchLowStock(0)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+		data["lowStock"] = lowStock
+
+		expiring, err := m.DB.FetchExpiringBatches(expiryAlertDays, 0)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+		data["expiring"] = expiring
+		data["expiryDays"] = expiryAlertDays
+		data["now"] = time.Now()
+	}
+
 	data["metadata"] = metaData
 	render.Template(w, r, "dashboard.page.html", &models.TemplateData{
 		Data: data,
@@ -87,34 +128,271 @@ func (m *Repository) PostLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ip := helpers.ClientIP(r)
+	failures, msg, err := m.loginThrottle(username, ip)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Internal server error! try again")
+		m.App.ErrorLog.Println(err)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if msg != "" {
+		m.App.Session.Put(r.Context(), "error", msg)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
 	user, err := m.DB.Authenticate(username, password)
 	if err != nil {
+		m.recordLoginFailure(username, ip, failures)
 		m.App.Session.Put(r.Context(), "error", "Invalid login credentials")
 		m.App.ErrorLog.Println(err)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	if password == "SbmaPassword" {
-		m.App.Session.Put(r.Context(), "user", user)
-		render.Template(w, r, "reset.page.html", &models.TemplateData{})
-		m.App.Session.Put(r.Context(), "user_id", user.ID)
+	if user.TOTPEnabled {
+		m.App.Session.Put(r.Context(), "pending_user_id", user.ID)
+		m.App.Session.Put(r.Context(), "pending_until", time.Now().Add(twoFactorPendingLifetime).Unix())
+		http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
 		return
 	}
 
+	m.completeLogin(w, r, user)
+}
+
+// loginThrottle returns the recent failed logins of username and ip, and the message to show
+// when they are not allowed another attempt yet
+func (m *Repository) loginThrottle(username, ip string) (models.LoginFailures, string, error) {
+	lockout, err := m.DB.FetchActiveLockout(username, ip)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return models.LoginFailures{}, "", err
+	}
+
+	if lockout.ID != 0 {
+		return models.LoginFailures{}, fmt.Sprintf("Too many failed attempts, try again after %s", lockout.LockedUntil.Format("3:04 pm")), nil
+	}
+
+	failures, err := m.DB.FetchLoginFailures(username, ip, time.Now().Add(-m.App.Login.Lockout))
+	if err != nil {
+		return failures, "", err
+	}
+
+	if wait := m.App.Login.Delay(failures.ByUsername) - time.Since(failures.LastFailure); wait > 0 {
+		return failures, fmt.Sprintf("Too many failed attempts, wait %d seconds and try again", int(wait.Seconds())+1), nil
+	}
+
+	return failures, "", nil
+}
+
+// completeLogin records the successful login and puts the user in the session
+func (m *Repository) completeLogin(w http.ResponseWriter, r *http.Request, user models.User) {
+	err := m.DB.InsertLoginAttempt(models.LoginAttempt{
+		Username:  user.Username,
+		IPAddress: helpers.ClientIP(r),
+		Succeeded: true,
+	})
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+
+	_ = m.App.Session.RenewToken(r.Context())
+	m.App.Session.Remove(r.Context(), "pending_user_id")
+	m.App.Session.Remove(r.Context(), "pending_until")
 	m.App.Session.Put(r.Context(), "user_id", user.ID)
 	m.App.Session.Put(r.Context(), "user", user)
+
+	err = m.DB.InsertUserSession(models.UserSession{
+		Token:     m.App.Session.Token(r.Context()),
+		UserId:    user.ID,
+		IPAddress: helpers.ClientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+
+	if !user.TOTPEnabled {
+		required, err := m.twoFactorRequired(user)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+
+		if required {
+			m.App.Session.Put(r.Context(), "two_factor_setup", true)
+			m.App.Session.Put(r.Context(), "warning", "Your account must use two-factor authentication, set it up to continue")
+			http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
+			return
+		}
+	}
+
 	m.App.Session.Put(r.Context(), "flash", "Logged in successfully")
 	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 }
 
+// twoFactorRequired reports whether the user's access level must use two-factor authentication
+func (m *Repository) twoFactorRequired(user models.User) (bool, error) {
+	levels, err := m.DB.FetchTwoFactorLevels()
+	if err != nil {
+		return false, err
+	}
+
+	for _, level := range levels {
+		if level == user.Role() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// pendingUser returns the user who passed the password step and still owes a second factor
+func (m *Repository) pendingUser(r *http.Request) (models.User, error) {
+	id, ok := m.App.Session.Get(r.Context(), "pending_user_id").(int)
+	if !ok {
+		return models.User{}, errors.New("no login is waiting for a second factor")
+	}
+
+	until, _ := m.App.Session.Get(r.Context(), "pending_until").(int64)
+	if time.Now().Unix() > until {
+		m.App.Session.Remove(r.Context(), "pending_user_id")
+		m.App.Session.Remove(r.Context(), "pending_until")
+		return models.User{}, errors.New("second factor was not given in time")
+	}
+
+	return m.userByID(id)
+}
+
+// TwoFactorForm displays the form asking for the second factor
+func (m *Repository) TwoFactorForm(w http.ResponseWriter, r *http.Request) {
+	_, err := m.pendingUser(r)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Log in first")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	render.Template(w, r, "twofactor.page.html", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+// PostTwoFactor checks the authenticator or recovery code and finishes the login
+func (m *Repository) PostTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, err := m.pendingUser(r)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Log in first")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
+		http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Form Parse error", err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code")
+	if !form.Valid() {
+		render.Template(w, r, "twofactor.page.html", &models.TemplateData{
+			Form: form,
+		})
+		return
+	}
+
+	ip := helpers.ClientIP(r)
+	failures, msg, err := m.loginThrottle(user.Username, ip)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Internal server error! try again")
+		m.App.ErrorLog.Println(err)
+		http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	if msg != "" {
+		m.App.Session.Put(r.Context(), "error", msg)
+		http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	ok, err := m.checkSecondFactor(user, form.Get("code"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Internal server error! try again")
+		m.App.ErrorLog.Println(err)
+		http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	if !ok {
+		m.recordLoginFailure(user.Username, ip, failures)
+		form.Errors.Add("code", "Invalid code, try again!")
+		render.Template(w, r, "twofactor.page.html", &models.TemplateData{
+			Form: form,
+		})
+		return
+	}
+
+	m.completeLogin(w, r, user)
+}
+
+// checkSecondFactor reports whether code is a current authenticator code or an unused
+// recovery code of the user, a recovery code is used up by the check
+func (m *Repository) checkSecondFactor(user models.User, code string) (bool, error) {
+	secret, err := m.totpSecret(user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	if step, ok := totp.Match(code, secret, time.Now()); ok {
+		return m.useTOTPStep(user.ID, step)
+	}
+
+	err = m.DB.UseRecoveryCode(user.ID, helpers.HashRecoveryCode(code))
+	if errors.Is(err, repository.ErrInvalidToken) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// totpSecret returns the two-factor secret of a user, opened with the server's key
+func (m *Repository) totpSecret(userId int) (string, error) {
+	stored, err := m.DB.FetchTOTPSecret(userId)
+	if err != nil {
+		return "", err
+	}
+	return totp.Open(stored, m.App.TOTPKey)
+}
+
+// useTOTPStep reports whether the authenticator code a user gave for step may be taken, each
+// code is only taken once and none from before it after that
+func (m *Repository) useTOTPStep(userId int, step uint64) (bool, error) {
+	err := m.DB.UseTOTPStep(userId, step)
+	if errors.Is(err, repository.ErrInvalidToken) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
 // User
 // UserForm handles request for user form
 func (m *Repository) UserForm(w http.ResponseWriter, r *http.Request) {
 	data := make(map[string]interface{})
 
 	if r.URL.Path == "/admin/edit-user" {
-		user, _ := m.App.Session.Get(r.Context(), "user").(models.User)
+		current, _ := m.App.Session.Get(r.Context(), "user").(models.User)
 		metaData := models.FormMetaData{
 			Section: "User",
 			Message: "Edit User Information",
@@ -122,8 +400,31 @@ func (m *Repository) UserForm(w http.ResponseWriter, r *http.Request) {
 			Url:     "/admin/edit-user",
 		}
 
+		id := current.ID
+		if current.Can(models.PermManageUsers) && r.URL.Query().Get("id") != "" {
+			id, _ = strconv.Atoi(r.URL.Query().Get("id"))
+		}
+
+		user, err := m.userByID(id)
+		if err != nil || !user.DeletedAt.IsZero() {
+			m.App.Session.Put(r.Context(), "error", "User cannot be found!")
+			http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+			m.App.ErrorLog.Println(err)
+			return
+		}
+
 		data["usr"] = user
 		data["metadata"] = metaData
+		data["self"] = user.ID == current.ID
+		data["canChangeRole"] = current.Can(models.PermManageUsers)
+
+		if user.ID == current.ID {
+			err = m.addTwoFactorData(data, user)
+			if err != nil {
+				m.App.Session.Put(r.Context(), "error", "Two-factor settings cannot be fetched!")
+				m.App.ErrorLog.Println(err)
+			}
+		}
 	} else {
 		metaData := models.FormMetaData{
 			Section: "User",
@@ -135,12 +436,59 @@ func (m *Repository) UserForm(w http.ResponseWriter, r *http.Request) {
 		data["metadata"] = metaData
 	}
 
+	locations, err := m.DB.FetchLocations()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+
+	data["accessLevels"] = models.AccessLevels
+	data["locations"] = locations
 	render.Template(w, r, "userform.page.html", &models.TemplateData{
 		Data: data,
 		Form: forms.New(nil),
 	})
 }
 
+// recordLoginFailure stores a failed login and locks the username or client IP once
+// they reach the failure limit
+func (m *Repository) recordLoginFailure(username, ip string, failures models.LoginFailures) {
+	err := m.DB.InsertLoginAttempt(models.LoginAttempt{
+		Username:  username,
+		IPAddress: ip,
+	})
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	policy := m.App.Login
+	lockouts := []models.Lockout{}
+	if policy.MaxFailures > 0 && failures.ByUsername+1 >= policy.MaxFailures {
+		lockouts = append(lockouts, models.Lockout{
+			Scope:    models.LockoutScopeUsername,
+			Failures: failures.ByUsername + 1,
+		})
+	}
+	if policy.MaxIPFailures > 0 && failures.ByIP+1 >= policy.MaxIPFailures {
+		lockouts = append(lockouts, models.Lockout{
+			Scope:    models.LockoutScopeIP,
+			Failures: failures.ByIP + 1,
+		})
+	}
+
+	for _, l := range lockouts {
+		l.Username = username
+		l.IPAddress = ip
+		l.LockedUntil = time.Now().Add(policy.Lockout)
+		err = m.DB.InsertLockout(l)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			continue
+		}
+		m.App.InfoLog.Printf("locked out %s %s/%s after %d failed logins", l.Scope, username, ip, l.Failures)
+	}
+}
+
 // PostUser ceates user
 func (m *Repository) PostUser(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseMultipartForm(10 << 20)
@@ -156,14 +504,6 @@ func (m *Repository) PostUser(w http.ResponseWriter, r *http.Request) {
 	username := r.Form.Get("username")
 	userImage, _, _ := r.FormFile("userPhoto")
 	defer userImage.Close()
-	password := "SbmaPassword"
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Couldn't process password! try again")
-		http.Redirect(w, r, "/admin/signup", http.StatusSeeOther)
-		m.App.ErrorLog.Println("error hashing password", err)
-		return
-	}
 
 	usrImage, err := helpers.ProcessImage(userImage)
 	if err != nil {
@@ -177,12 +517,12 @@ func (m *Repository) PostUser(w http.ResponseWriter, r *http.Request) {
 		FirstName:   firstName,
 		LastName:    lastName,
 		Username:    username,
-		Password:    string(hashedPassword),
 		AccessLevel: r.Form.Get("accesslevel"),
 		Image:       usrImage,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
+	user.LocationId, _ = strconv.Atoi(r.Form.Get("location_id"))
 
 	form := forms.New(r.PostForm)
 	form.Required("firstname", "lastname", "username")
@@ -194,6 +534,12 @@ func (m *Repository) PostUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !models.IsAccessLevel(user.AccessLevel) {
+		m.App.Session.Put(r.Context(), "error", "Choose a valid user type!")
+		http.Redirect(w, r, "/admin/signup", http.StatusSeeOther)
+		return
+	}
+
 	u, err := m.DB.FetchUser(username)
 
 	if err != nil && err.Error() != "sql: no rows in result set" {
@@ -203,13 +549,27 @@ func (m *Repository) PostUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	urs, err := m.DB.FetchAllUsers()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Internal server error! try again")
+		http.Redirect(w, r, "/admin/signup", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	if !m.App.License.SeatsLeft(activeUsers(urs)) {
+		m.App.Session.Put(r.Context(), "error", "Your license has no seats left for another user!")
+		http.Redirect(w, r, "/admin/signup", http.StatusSeeOther)
+		return
+	}
+
 	if u.Username == username {
 		m.App.Session.Put(r.Context(), "error", "Username already exist!, choose another one")
 		http.Redirect(w, r, "/admin/signup", http.StatusSeeOther)
 		return
 	}
 
-	_, err = m.DB.InsertUser(user)
+	user.ID, err = m.audited(r).InsertUser(user)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "User couldn't be saved! try again")
 		http.Redirect(w, r, "/admin/signup", http.StatusSeeOther)
@@ -217,1096 +577,2484 @@ func (m *Repository) PostUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("User %s created!", u.Username))
-	http.Redirect(w, r, "/admin/signup", http.StatusSeeOther)
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("User %s created!", user.Username))
+	m.issueActivation(w, r, user)
 }
 
-// PostReset handles request for reseting user password
-func (m *Repository) PostReset(w http.ResponseWriter, r *http.Request) {
-	data := make(map[string]any)
-	data["error"] = ""
-	err := r.ParseForm()
+// PostEditUser saves changes to a user's profile, users without the users.manage permission
+// can only edit their own name, username and photo
+func (m *Repository) PostEditUser(w http.ResponseWriter, r *http.Request) {
+	current, _ := m.App.Session.Get(r.Context(), "user").(models.User)
+
+	err := r.ParseMultipartForm(10 << 20)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
-		render.Template(w, r, "reset.page.html", &models.TemplateData{
-			Data: data,
-		})
+		http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
 		m.App.ErrorLog.Println("Form Parse error", err)
 		return
 	}
 
-	user, ok := m.App.Session.Get(r.Context(), "user").(models.User)
-	if !ok {
-		m.App.Session.Put(r.Context(), "error", "can't find you in the session, reload the app!")
-		render.Template(w, r, "reset.page.html", &models.TemplateData{
-			Data: data,
-		})
-		m.App.ErrorLog.Println("User session error: ", err)
-		return
+	id, err := strconv.Atoi(r.Form.Get("user_id"))
+	if err != nil {
+		id = current.ID
 	}
 
-	pwd := r.Form.Get("password")
-	rPwd := r.Form.Get("repeatPassword")
-
-	if pwd != rPwd {
-		data["error"] = "Passwords do not match, try again!"
-		render.Template(w, r, "reset.page.html", &models.TemplateData{
-			Data: data,
-		})
-		//m.App.Session.Put(r.Context(), "error", "passwords do not match, try again!")
-		m.App.ErrorLog.Println("Password mismatch")
-		return
+	back := "/admin/edit-user"
+	if id != current.ID {
+		if !current.Can(models.PermManageUsers) {
+			m.App.Session.Put(r.Context(), "error", "You are not allowed to edit other users")
+			http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+			return
+		}
+		back = fmt.Sprintf("/admin/edit-user?id=%d", id)
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.DefaultCost)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Couldn't process password! try again")
-		render.Template(w, r, "reset.page.html", &models.TemplateData{
-			Data: data,
-		})
-		m.App.ErrorLog.Println("error hashing password", err)
+	user, err := m.userByID(id)
+	if err != nil || !user.DeletedAt.IsZero() {
+		m.App.Session.Put(r.Context(), "error", "User cannot be found!")
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	usr := models.User{
-		Username: user.Username,
-		Password: string(hashedPassword),
-	}
-
 	form := forms.New(r.PostForm)
-	form.Required("password", "repeatPassword")
-
+	form.Required("firstname", "lastname", "username")
 	if !form.Valid() {
 		m.App.Session.Put(r.Context(), "error", "All fields need to be filled!")
-		render.Template(w, r, "reset.page.html", &models.TemplateData{
-			Data: data,
-		})
-		m.App.ErrorLog.Println("empty form field")
+		http.Redirect(w, r, back, http.StatusSeeOther)
 		return
 	}
 
-	err = m.DB.ResetUser(usr)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Password reset unsuccessful, try again!")
-		render.Template(w, r, "reset.page.html", &models.TemplateData{
-			Data: data,
-		})
-		m.App.ErrorLog.Println("Database error: ", err)
-		return
+	username := form.Get("username")
+	if username != user.Username {
+		u, err := m.DB.FetchUser(username)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			m.App.Session.Put(r.Context(), "error", "Internal server error! try again")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			m.App.ErrorLog.Println(err)
+			return
+		}
+
+		if u.Username == username {
+			m.App.Session.Put(r.Context(), "error", "Username already exist!, choose another one")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
 	}
 
-	m.App.Session.Put(r.Context(), "flash", "Logged in successfully")
-	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
-}
+	accessLevel := user.AccessLevel
+	if current.Can(models.PermManageUsers) && form.Get("accesslevel") != "" {
+		accessLevel = form.Get("accesslevel")
+		if !models.IsAccessLevel(accessLevel) {
+			m.App.Session.Put(r.Context(), "error", "Choose a valid user type!")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
 
-// PostDeveloper ceates one superuser for the developer
-func (m *Repository) PostDeveloper(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
-		http.Redirect(w, r, "/signup", http.StatusSeeOther)
-		m.App.ErrorLog.Println("Form Parse error", err)
-		return
+		if user.Role() == models.AccessOwner && accessLevel != models.AccessOwner {
+			last, err := m.lastActiveOwner(user)
+			if err != nil || last {
+				m.App.Session.Put(r.Context(), "error", "The last owner cannot be given another user type!")
+				http.Redirect(w, r, back, http.StatusSeeOther)
+				m.App.ErrorLog.Println(err)
+				return
+			}
+		}
 	}
 
-	firstName := r.Form.Get("firstname")
-	lastName := r.Form.Get("lastname")
-	username := r.Form.Get("username")
-	password := r.Form.Get("password")
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Couldn't process password! try again")
-		http.Redirect(w, r, "/signup", http.StatusSeeOther)
-		m.App.ErrorLog.Println("error hashing password", err)
-		return
+	var image []byte
+	if userImage, _, err := r.FormFile("userPhoto"); err == nil {
+		defer userImage.Close()
+		image, err = helpers.ProcessImage(userImage)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Can't process user photo")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			m.App.ErrorLog.Println(err)
+			return
+		}
 	}
 
-	user := models.User{
-		FirstName:   firstName,
-		LastName:    lastName,
-		Username:    username,
-		Password:    string(hashedPassword),
-		AccessLevel: r.Form.Get("accesslevel"),
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+	if current.Can(models.PermManageUsers) {
+		user.LocationId, _ = strconv.Atoi(form.Get("location_id"))
 	}
 
-	form := forms.New(r.PostForm)
-	form.Required("firstname", "lastname", "username", "password")
+	roleChanged := models.Role(accessLevel) != user.Role()
+	user.FirstName = form.Get("firstname")
+	user.LastName = form.Get("lastname")
+	user.Username = username
+	user.AccessLevel = accessLevel
+	user.Image = image
 
-	if !form.Valid() {
-		m.App.Session.Put(r.Context(), "error", "All fields need to be filled!")
-		http.Redirect(w, r, "/signup", http.StatusSeeOther)
-		m.App.ErrorLog.Println("empty form field", err)
+	err = m.audited(r).UpdateUser(user)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "User couldn't be updated! try again")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	u, err := m.DB.FetchUser(username)
+	// sessions hold a copy of the user, so a new access level only applies once they log in again
+	if roleChanged {
+		err = m.audited(r).RevokeUserSessions(user.ID, m.App.Session.Token(r.Context()))
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+	}
 
-	if err != nil && err.Error() != "sql: no rows in result set" {
-		m.App.Session.Put(r.Context(), "error", "Internal server error! try again")
-		http.Redirect(w, r, "/signup", http.StatusSeeOther)
-		m.App.ErrorLog.Println(err)
-		return
+	if user.ID == current.ID {
+		updated, err := m.userByID(user.ID)
+		if err == nil {
+			m.App.Session.Put(r.Context(), "user", updated)
+		}
 	}
 
-	if u.Username == username {
-		m.App.Session.Put(r.Context(), "error", "Username already exist!, choose another one")
-		http.Redirect(w, r, "/signup", http.StatusSeeOther)
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("User %s updated!", user.Username))
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// PostDeactivateUser stops a user from logging in
+func (m *Repository) PostDeactivateUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.lifecycleTarget(w, r)
+	if !ok {
 		return
 	}
 
-	_, err = m.DB.InsertUser(user)
+	err := m.audited(r).DeactivateUser(user.ID)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "User couldn't be saved! try again")
-		http.Redirect(w, r, "/signup", http.StatusSeeOther)
+		m.App.Session.Put(r.Context(), "error", "User couldn't be deactivated! try again")
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
 		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("User %s created!", u.Username))
-	http.Redirect(w, r, "/signup", http.StatusSeeOther)
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("User %s deactivated!", user.Username))
+	http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
 }
 
-// Logout logs a user out
-func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
-	_ = m.App.Session.Destroy(r.Context())
-	_ = m.App.Session.RenewToken(r.Context())
+// PostReactivateUser lets a deactivated user log in again
+func (m *Repository) PostReactivateUser(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Form Parse error", err)
+		return
+	}
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
-}
+	id, err := strconv.Atoi(r.Form.Get("user_id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid user selected!")
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
+		return
+	}
 
-// Products information processing
-// ProductForm is a handler that returns product creation form
-func (m *Repository) ProductForm(w http.ResponseWriter, r *http.Request) {
-	data := make(map[string]interface{})
+	urs, err := m.DB.FetchAllUsers()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Internal server error! try again")
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
 
-	if r.URL.Path == "/admin/edit-product" {
-		prod, _ := m.App.Session.Pop(r.Context(), "product").(models.Product)
+	if !m.App.License.SeatsLeft(activeUsers(urs)) {
+		m.App.Session.Put(r.Context(), "error", "Your license has no seats left for another user!")
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
+		return
+	}
 
-		metaData := models.FormMetaData{
-			Message: "Edit Product Information",
-			Button:  "Patch Product",
-			Url:     "/admin/edit-product",
-			Section: "Product",
-		}
-		data["product"] = prod
-		data["metadata"] = metaData
-	} else {
-		metaData := models.FormMetaData{
-			Message: "Enter Product Information",
-			Button:  "Post Product",
-			Url:     "/admin/add-product",
-			Section: "Product",
-		}
-		data["product"] = models.Product{}
-		data["metadata"] = metaData
+	err = m.audited(r).ReactivateUser(id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "User couldn't be reactivated! try again")
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
 	}
 
-	render.Template(w, r, "addproduct.page.html", &models.TemplateData{
-		Form: forms.New(nil),
-		Data: data,
-	})
+	m.App.Session.Put(r.Context(), "flash", "User reactivated!")
+	http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
 }
 
-// AddProduct is handler for handling product creation requests
-func (m *Repository) AddProduct(w http.ResponseWriter, r *http.Request) {
-	userId, ok := m.App.Session.Get(r.Context(), "user_id").(int)
-
+// PostDeleteUser deletes a user, the records they created stay attributed to them
+func (m *Repository) PostDeleteUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.lifecycleTarget(w, r)
 	if !ok {
-		m.App.Session.Put(r.Context(), "error", "internal server error")
-		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
-		m.App.ErrorLog.Println("Failed casting userid to int from session")
 		return
 	}
 
+	err := m.audited(r).DeleteUser(user.ID)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "User couldn't be deleted! try again")
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("User %s deleted!", user.Username))
+	http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
+}
+
+// lifecycleTarget returns the user a deactivate or delete request is for, refusing the
+// logged in user and the last active owner
+func (m *Repository) lifecycleTarget(w http.ResponseWriter, r *http.Request) (models.User, bool) {
 	err := r.ParseForm()
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
-		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
 		m.App.ErrorLog.Println("Form Parse error", err)
-		return
+		return models.User{}, false
 	}
 
-	price, err := strconv.ParseFloat(r.Form.Get("price"), 64)
+	id, err := strconv.Atoi(r.Form.Get("user_id"))
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "invalid data!")
-		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
-		m.App.ErrorLog.Println("Price Parse error", err)
-		return
+		m.App.Session.Put(r.Context(), "error", "Invalid user selected!")
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
+		return models.User{}, false
 	}
 
-	stock, err := strconv.Atoi(r.Form.Get("stock"))
+	if id == m.App.Session.GetInt(r.Context(), "user_id") {
+		m.App.Session.Put(r.Context(), "error", "You cannot deactivate or delete yourself!")
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
+		return models.User{}, false
+	}
+
+	user, err := m.userByID(id)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "invalid data!")
-		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
-		m.App.ErrorLog.Println("Stock Parse error", err)
-		return
+		m.App.Session.Put(r.Context(), "error", "User cannot be found!")
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return models.User{}, false
 	}
 
-	product := models.Product{
-		Serial:      r.Form.Get("serial"),
-		Name:        r.Form.Get("name"),
-		Description: r.Form.Get("description"),
-		Price:       price,
-		Units:       int32(stock),
-		UserId:      userId,
+	if user.Role() == models.AccessOwner {
+		last, err := m.lastActiveOwner(user)
+		if err != nil || last {
+			m.App.Session.Put(r.Context(), "error", "The last owner cannot be deactivated or deleted!")
+			http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
+			m.App.ErrorLog.Println(err)
+			return models.User{}, false
+		}
 	}
 
-	form := forms.New(r.PostForm)
-	data := make(map[string]interface{})
+	return user, true
+}
 
-	form.Required("name", "description", "price", "stock")
-	if !form.Valid() {
-		data["product"] = product
+// lastActiveOwner reports whether user is the only active owner left
+func (m *Repository) lastActiveOwner(user models.User) (bool, error) {
+	urs, err := m.DB.FetchAllUsers()
+	if err != nil {
+		return false, err
+	}
 
-		render.Template(w, r, "addproduct.page.html", &models.TemplateData{
-			Form: form,
-			Data: data,
-		})
+	for _, u := range urs {
+		if u.ID != user.ID && u.Active() && u.Role() == models.AccessOwner {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// activeUsers counts the users who can log in
+func activeUsers(urs []models.User) int {
+	n := 0
+	for _, u := range urs {
+		if u.Active() {
+			n++
+		}
+	}
+	return n
+}
+
+// userByID retrieves a user by id
+func (m *Repository) userByID(id int) (models.User, error) {
+	username, err := m.DB.FetchUserById(id)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return m.DB.FetchUser(username)
+}
+
+// ReissueActivation revokes a user's outstanding activation links and issues a new one
+func (m *Repository) ReissueActivation(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Form Parse error", err)
 		return
 	}
 
-	p, _ := m.DB.FetchProduct(product.Serial)
-	if p.Serial == product.Serial {
-		m.App.Session.Put(r.Context(), "error", "Product with same serial number already exists")
-		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
-		m.App.ErrorLog.Println("Product with same serial number already exists")
+	id, err := strconv.Atoi(r.Form.Get("user_id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid user selected!")
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
 		return
 	}
 
-	product, err = m.DB.InsertProduct(product)
+	user, err := m.userByID(id)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Product could not be inserted")
-		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
+		m.App.Session.Put(r.Context(), "error", "User cannot be found!")
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
 		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	product.Price = price
-
-	data["product"] = product
+	err = m.audited(r).RevokeActivationTokens(user.ID)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Activation link couldn't be reissued! try again")
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
 
-	m.App.Session.Put(r.Context(), "flash", "Product inserted!")
-	m.App.Session.Put(r.Context(), "product", product)
-	render.Template(w, r, "displayproduct.page.html", &models.TemplateData{
-		Data: data,
-	})
+	m.issueActivation(w, r, user)
 }
 
-// UpdateProduct update product with changes by ID
-func (m *Repository) UpdateProduct(w http.ResponseWriter, r *http.Request) {
+// RevokeActivation revokes every outstanding activation link of a user
+func (m *Repository) RevokeActivation(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
-		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
-		m.App.ErrorLog.Println("Error parsing form")
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Form Parse error", err)
 		return
 	}
 
-	price, err := strconv.ParseFloat(r.Form.Get("price"), 64)
+	id, err := strconv.Atoi(r.Form.Get("user_id"))
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "invalid data!")
-		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
-		m.App.ErrorLog.Println("Error parsing int for price")
+		m.App.Session.Put(r.Context(), "error", "Invalid user selected!")
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
 		return
 	}
 
-	stock, err := strconv.Atoi(r.Form.Get("stock"))
+	err = m.audited(r).RevokeActivationTokens(id)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "invalid data!")
-		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
-		m.App.ErrorLog.Println("Error parsing int for stock")
+		m.App.Session.Put(r.Context(), "error", "Activation link couldn't be revoked! try again")
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	prod_id, err := strconv.Atoi(r.Form.Get("prod_id"))
+	m.App.Session.Put(r.Context(), "flash", "Activation link revoked!")
+	http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
+}
+
+// issueActivation stores a new activation token for user and shows the link to hand over
+func (m *Repository) issueActivation(w http.ResponseWriter, r *http.Request, user models.User) {
+	token, hash, err := helpers.NewToken()
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "invalid data!")
-		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
-		m.App.ErrorLog.Println("Error parsing int for product ID")
+		m.App.Session.Put(r.Context(), "error", "Activation link couldn't be created! try again")
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	userId := m.App.Session.Get(r.Context(), "user_id").(int)
-	product := models.Product{
-		ID:          prod_id,
-		Serial:      r.Form.Get("serial"),
-		Name:        r.Form.Get("name"),
-		Description: r.Form.Get("description"),
-		Price:       price,
-		Units:       int32(stock),
-		UserId:      userId,
+	t := models.ActivationToken{
+		UserId:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(activationTokenLifetime),
+		CreatedBy: m.App.Session.GetInt(r.Context(), "user_id"),
 	}
 
-	form := forms.New(r.PostForm)
-	data := make(map[string]interface{})
+	err = m.audited(r).InsertActivationToken(t)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Activation link couldn't be created! try again")
+		http.Redirect(w, r, "/admin/list-users", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
 
-	form.Required("prod_id", "name", "description", "price", "stock")
-	if !form.Valid() {
-		data["product"] = product
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
 
-		render.Template(w, r, "addproduct.page.html", &models.TemplateData{
-			Form: form,
-			Data: data,
-		})
-		m.App.ErrorLog.Println("Invalid form values")
-		return
+	data := make(map[string]any)
+	data["usr"] = user
+	data["link"] = fmt.Sprintf("%s://%s/activate/%s", scheme, r.Host, token)
+	data["expires"] = t.ExpiresAt
+	data["metadata"] = models.FormMetaData{
+		Section: "User",
+		Url:     "/admin/list-users",
 	}
 
-	err = m.DB.UpdateProduct(product)
+	render.Template(w, r, "activationlink.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// ActivationForm displays the form a new user sets their password with
+func (m *Repository) ActivationForm(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	user, err := m.activationUser(token)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Product could not be updated")
-		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
+		m.App.Session.Put(r.Context(), "error", "This activation link is invalid or has expired!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
 		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	data["product"] = product
-	m.App.Session.Put(r.Context(), "product", product)
-	m.App.Session.Put(r.Context(), "flash", "Product updated!")
-	render.Template(w, r, "displayproduct.page.html", &models.TemplateData{
+	data := make(map[string]any)
+	data["usr"] = user
+	data["token"] = token
+
+	render.Template(w, r, "activate.page.html", &models.TemplateData{
 		Data: data,
+		Form: forms.New(nil),
 	})
 }
 
-// SearchProduct handlers the request for Product form
-func (m *Repository) SearchProduct(w http.ResponseWriter, r *http.Request) {
-	data := make(map[string]interface{})
+// PostActivation sets the new user's password and consumes the activation token
+func (m *Repository) PostActivation(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
 
-	if r.URL.Path == "/admin/search-product" {
-		metaData := models.FormMetaData{
-			Url:     "/admin/edit-form",
-			Section: "Product",
-			Message: "Search Product",
-			Button:  "Search",
-		}
-		data["metadata"] = metaData
-	} else {
-		metaData := models.FormMetaData{
-			Url:     "/admin/delete-product",
-			Section: "Product",
-			Message: "Enter Product Serial",
-			Button:  "Delete",
-		}
-		data["metadata"] = metaData
+	user, err := m.activationUser(token)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "This activation link is invalid or has expired!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
 	}
-	render.Template(w, r, "editproduct.page.html", &models.TemplateData{
-		Data: data,
-		Form: forms.New(nil),
-	})
-}
 
-// EditProductForm handlers edit product form request
-func (m *Repository) EditProductForm(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	err = r.ParseForm()
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't process form")
-		http.Redirect(w, r, "/admin/search-product", http.StatusSeeOther)
-		fmt.Println("Error Parsing form ", err)
+		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
+		http.Redirect(w, r, "/activate/"+token, http.StatusSeeOther)
+		m.App.ErrorLog.Println("Form Parse error", err)
 		return
 	}
 
 	form := forms.New(r.PostForm)
-	form.Required("serial")
+	form.Required("password", "repeatPassword")
+	if form.Get("password") != form.Get("repeatPassword") {
+		form.Errors.Add("repeatPassword", "Passwords do not match, try again!")
+	}
+
+	err = m.checkPassword(form, "password", user.ID)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
 
 	if !form.Valid() {
-		m.App.Session.Put(r.Context(), "error", "form field can't be empty")
-		render.Template(w, r, "editproduct.page.html", &models.TemplateData{
+		data := make(map[string]any)
+		data["usr"] = user
+		data["token"] = token
+		render.Template(w, r, "activate.page.html", &models.TemplateData{
+			Data: data,
 			Form: form,
 		})
-		fmt.Println("Error in form values ", err)
 		return
 	}
 
-	p, err := m.DB.FetchProduct(r.Form.Get("serial"))
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(form.Get("password")), bcrypt.DefaultCost)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "No product with such serial number")
-		http.Redirect(w, r, "/admin/search-product", http.StatusSeeOther)
-		//fmt.Println("Error Querying database ", err)
+		m.App.Session.Put(r.Context(), "error", "Couldn't process password! try again")
+		http.Redirect(w, r, "/activate/"+token, http.StatusSeeOther)
+		m.App.ErrorLog.Println("error hashing password", err)
 		return
 	}
 
-	m.App.Session.Put(r.Context(), "product", p)
-	http.Redirect(w, r, "/admin/edit-product", http.StatusSeeOther)
-}
-
-// ListProducts handles request for products in the database
-func (m *Repository) ListProducts(w http.ResponseWriter, r *http.Request) {
-	page := chi.URLParam(r, "page")
-	pg, _ := strconv.Atoi(page)
-	if pg == 0 {
-		pg = 1
-	}
-	meta := models.FormMetaData{
-		Section: "Product",
-		Url:     "/admin/list-products/1",
+	err = m.audited(r).ActivateUser(helpers.HashToken(token), string(hashedPassword))
+	if errors.Is(err, repository.ErrInvalidToken) {
+		m.App.Session.Put(r.Context(), "error", "This activation link is invalid or has expired!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
 	}
 
-	data := make(map[string]any)
-
-	prods, err := m.DB.FetchProductByPage(pg)
-
-	var p []models.Product
-	for _, v := range prods {
-		v.Price = helpers.ToDecimalPlace(v.Price, 2)
-		p = append(p, v)
-	}
-	data["products"] = p
-	data["metadata"] = meta
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Products cannot be fetched!")
-		m.App.ErrorLog.Println("Products cannot be fetched!")
-		render.Template(w, r, "displayproducts.page.html", &models.TemplateData{
-			Data: data,
-		})
+		m.App.Session.Put(r.Context(), "error", "Account couldn't be activated! try again")
+		http.Redirect(w, r, "/activate/"+token, http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	if len(prods) == 0 {
-		m.App.Session.Put(r.Context(), "error", "No product was found!")
-		render.Template(w, r, "displayproducts.page.html", &models.TemplateData{
-			Data: data,
-		})
-		return
+	m.App.Session.Put(r.Context(), "flash", "Account activated, log in with your new password")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// activationUser returns the user a still usable activation token belongs to
+func (m *Repository) activationUser(token string) (models.User, error) {
+	t, err := m.DB.FetchActivationToken(helpers.HashToken(token))
+	if err != nil {
+		return models.User{}, err
 	}
 
-	render.Template(w, r, "displayproducts.page.html", &models.TemplateData{
-		Data: data,
-	})
+	return m.userByID(t.UserId)
 }
 
-// DeleteProduct handlers request for delete product form
-func (m *Repository) DeleteProduct(w http.ResponseWriter, r *http.Request) {
+// ChangePasswordForm shows the form the logged in user changes their password with
+func (m *Repository) ChangePasswordForm(w http.ResponseWriter, r *http.Request) {
+	m.renderChangePassword(w, r, forms.New(nil))
+}
+
+// PostChangePassword changes the logged in user's password once the current one is confirmed
+func (m *Repository) PostChangePassword(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't process form!")
-		http.Redirect(w, r, "/admin/delete-product", http.StatusSeeOther)
+		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
+		http.Redirect(w, r, "/admin/change-password", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Form Parse error", err)
 		return
 	}
 
+	user, _ := m.App.Session.Get(r.Context(), "user").(models.User)
+
 	form := forms.New(r.PostForm)
-	form.Required("serial")
+	form.Required("currentPassword", "password", "repeatPassword")
+
+	if form.Has("currentPassword") {
+		_, err = m.DB.Authenticate(user.Username, form.Get("currentPassword"))
+		if err != nil {
+			form.Errors.Add("currentPassword", "Your current password is incorrect")
+		}
+	}
+
+	if form.Get("password") != form.Get("repeatPassword") {
+		form.Errors.Add("repeatPassword", "Passwords do not match, try again!")
+	}
+
+	err = m.checkPassword(form, "password", user.ID)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Internal server error! try again")
+		http.Redirect(w, r, "/admin/change-password", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
 
 	if !form.Valid() {
-		m.App.Session.Put(r.Context(), "error", "Invalid form data!")
-		http.Redirect(w, r, "/admin/delete-product", http.StatusSeeOther)
+		m.renderChangePassword(w, r, form)
 		return
 	}
 
-	prod, err := m.DB.FetchProduct(r.Form.Get("serial"))
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(form.Get("password")), bcrypt.DefaultCost)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "No product with such serial number found")
-		http.Redirect(w, r, "/admin/delete-product", http.StatusSeeOther)
+		m.App.Session.Put(r.Context(), "error", "Couldn't process password! try again")
+		http.Redirect(w, r, "/admin/change-password", http.StatusSeeOther)
+		m.App.ErrorLog.Println("error hashing password", err)
 		return
 	}
 
-	if prod.Serial != r.Form.Get("serial") {
-		m.App.Session.Put(r.Context(), "error", "No product with such serial number found")
-		http.Redirect(w, r, "/admin/delete-product", http.StatusSeeOther)
+	err = m.audited(r).ResetUser(models.User{
+		Username: user.Username,
+		Password: string(hashedPassword),
+	})
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Password couldn't be changed, try again!")
+		http.Redirect(w, r, "/admin/change-password", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Database error: ", err)
 		return
 	}
 
-	err = m.DB.DeleteProduct(r.Form.Get("serial"))
+	// Anyone who knew the old password must log in again
+	err = m.audited(r).RevokeUserSessions(user.ID, m.App.Session.Token(r.Context()))
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "No product with such serial number found")
-		http.Redirect(w, r, "/admin/delete-product", http.StatusSeeOther)
-		return
+		m.App.ErrorLog.Println(err)
 	}
 
-	m.App.Session.Put(r.Context(), "flash", "Product deleted successfully")
-	http.Redirect(w, r, "/admin/delete-product", http.StatusSeeOther)
+	m.App.Session.Put(r.Context(), "flash", "Password changed, your other sessions have been logged out")
+	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 }
 
-// IncreaseQtyForm serves request for form for increasing product quantity
-func (m *Repository) IncreaseQtyForm(w http.ResponseWriter, r *http.Request) {
+// renderChangePassword shows the change password form
+func (m *Repository) renderChangePassword(w http.ResponseWriter, r *http.Request, form *forms.Form) {
 	data := make(map[string]interface{})
-
-	metaData := models.FormMetaData{
-		Message: "Add Product Quantity",
-		Button:  "Post Quantity",
-		Url:     "/admin/increase-qty",
-		Section: "Product",
+	data["metadata"] = models.FormMetaData{
+		Section: "Account",
+		Url:     "/admin/change-password",
 	}
+	data["policy"] = m.App.Password
 
-	data["metadata"] = metaData
-
-	render.Template(w, r, "increaseQtyform.page.html", &models.TemplateData{
-		Form: forms.New(nil),
+	render.Template(w, r, "changepassword.page.html", &models.TemplateData{
 		Data: data,
+		Form: form,
 	})
 }
 
-// PostIncreaseQty process product quantity addition request
-func (m *Repository) PostIncreaseQty(w http.ResponseWriter, r *http.Request) {
-	userId, ok := m.App.Session.Get(r.Context(), "user_id").(int)
-	data := make(map[string]interface{})
-	if !ok {
-		m.App.Session.Put(r.Context(), "error", "Failed to get user ID")
-		http.Redirect(w, r, "/admin/increase-qty", http.StatusSeeOther)
-		m.App.ErrorLog.Println("Failed to get user ID")
+// checkPassword adds an error to field when the new password breaks the password policy or
+// is one of the user's recent passwords
+func (m *Repository) checkPassword(form *forms.Form, field string, userId int) error {
+	if !form.Password(field, m.App.Password.MinLength) || userId == 0 {
+		return nil
+	}
+
+	hashes, err := m.DB.FetchPasswordHistory(userId, m.App.Password.History)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(form.Get(field))) == nil {
+			form.Errors.Add(field, "You have used this password recently, choose another one")
+			break
+		}
+	}
+	return nil
+}
+
+// PostDeveloper ceates one superuser for the developer
+func (m *Repository) PostDeveloper(w http.ResponseWriter, r *http.Request) {
+	// Only allowed to bootstrap the first owner of an empty system
+	urs, err := m.DB.FetchAllUsers()
+	if err != nil || len(urs) != 0 {
+		m.App.Session.Put(r.Context(), "error", "You are not allowed to create users")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	err := r.ParseForm()
+	err = r.ParseForm()
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't process form")
-		http.Redirect(w, r, "/admin/increase-qty", http.StatusSeeOther)
-		log.Println(err)
+		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
+		http.Redirect(w, r, "/signup", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Form Parse error", err)
 		return
 	}
 
-	qty, _ := strconv.Atoi(r.Form.Get("quantity"))
-	p := models.Product{
-		Serial: r.Form.Get("serial"),
-		Units:  int32(qty),
-		UserId: userId,
+	firstName := r.Form.Get("firstname")
+	lastName := r.Form.Get("lastname")
+	username := r.Form.Get("username")
+	password := r.Form.Get("password")
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Couldn't process password! try again")
+		http.Redirect(w, r, "/signup", http.StatusSeeOther)
+		m.App.ErrorLog.Println("error hashing password", err)
+		return
 	}
 
-	metaData := models.FormMetaData{
-		Message: "Add Product Quantity",
-		Button:  "Post Quantity",
-		Url:     "/admin/increase-qty",
-		Section: "Product",
+	user := models.User{
+		FirstName:   firstName,
+		LastName:    lastName,
+		Username:    username,
+		Password:    string(hashedPassword),
+		AccessLevel: models.AccessOwner,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
 	}
-	data["product"] = p
-	data["metadata"] = metaData
 
 	form := forms.New(r.PostForm)
-	form.Required("serial", "quantity")
+	form.Required("firstname", "lastname", "username", "password")
+
 	if !form.Valid() {
-		render.Template(w, r, "increaseQtyform.page.html", &models.TemplateData{
-			Form: form,
-			Data: data,
-		})
+		m.App.Session.Put(r.Context(), "error", "All fields need to be filled!")
+		http.Redirect(w, r, "/signup", http.StatusSeeOther)
+		m.App.ErrorLog.Println("empty form field", err)
+		return
 	}
 
-	prod, err := m.DB.FetchProduct(p.Serial)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Failed retrieving the product, check the serial again!")
-		http.Redirect(w, r, "/admin/increase-qty", http.StatusSeeOther)
-		m.App.ErrorLog.Println(err)
+	if !form.Password("password", m.App.Password.MinLength) {
+		m.App.Session.Put(r.Context(), "error", form.Errors.Get("password"))
+		http.Redirect(w, r, "/signup", http.StatusSeeOther)
 		return
 	}
 
-	if prod.Serial != p.Serial {
-		m.App.Session.Put(r.Context(), "error", "Sorry, couldn't find a product with this serial number!")
-		http.Redirect(w, r, "/admin/increase-qty", http.StatusSeeOther)
+	u, err := m.DB.FetchUser(username)
+
+	if err != nil && err.Error() != "sql: no rows in result set" {
+		m.App.Session.Put(r.Context(), "error", "Internal server error! try again")
+		http.Redirect(w, r, "/signup", http.StatusSeeOther)
 		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	err = m.DB.IncreaseQuantity(p)
+	if u.Username == username {
+		m.App.Session.Put(r.Context(), "error", "Username already exist!, choose another one")
+		http.Redirect(w, r, "/signup", http.StatusSeeOther)
+		return
+	}
+
+	_, err = m.audited(r).InsertUser(user)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Failed to insert customer items purchased")
-		http.Redirect(w, r, "/admin/increase-qty", http.StatusSeeOther)
+		m.App.Session.Put(r.Context(), "error", "User couldn't be saved! try again")
+		http.Redirect(w, r, "/signup", http.StatusSeeOther)
 		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Product with serial number %s quantity increased!", p.Serial))
-	render.Template(w, r, "increaseQtyform.page.html", &models.TemplateData{
-		Form: form,
-		Data: data,
-	})
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("User %s created!", u.Username))
+	http.Redirect(w, r, "/signup", http.StatusSeeOther)
 }
 
-// Contract Section handles Contract processing
-// ContractForm handler handles contract form request
-func (m *Repository) CustomerForm(w http.ResponseWriter, r *http.Request) {
-	data := make(map[string]interface{})
-
-	if r.URL.Path == "/admin/edit-contract" {
-		cust, _ := m.App.Session.Get(r.Context(), "customer").(models.Customer)
+// Logout logs a user out
+func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
+	_ = m.App.Session.Destroy(r.Context())
+	_ = m.App.Session.RenewToken(r.Context())
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Products information processing
+// ProductForm is a handler that returns product creation form
+func (m *Repository) ProductForm(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+
+	if r.URL.Path == "/admin/edit-product" {
+		prod, _ := m.App.Session.Pop(r.Context(), "product").(models.Product)
+
 		metaData := models.FormMetaData{
-			Section: "Contract",
-			Message: "Edit Customer Information",
-			Button:  "Update Information",
-			Url:     "/admin/update-contract",
+			Message: "Edit Product Information",
+			Button:  "Patch Product",
+			Url:     "/admin/edit-product",
+			Section: "Product",
 		}
-
-		data["customer"] = cust
+		data["product"] = prod
 		data["metadata"] = metaData
 	} else {
 		metaData := models.FormMetaData{
-			Section: "Contract",
-			Message: "Add Customer Information",
-			Button:  "Add Information",
-			Url:     "/admin/add-contract",
+			Message: "Enter Product Information",
+			Button:  "Post Product",
+			Url:     "/admin/add-product",
+			Section: "Product",
 		}
-		data["customer"] = models.Customer{}
+		data["product"] = models.Product{}
 		data["metadata"] = metaData
 	}
+	m.addCatalogueData(data)
 
-	render.Template(w, r, "customerform.page.html", &models.TemplateData{
-		Data: data,
+	render.Template(w, r, "addproduct.page.html", &models.TemplateData{
 		Form: forms.New(nil),
+		Data: data,
 	})
 }
 
-// PostCustomer handles customer creation request
-func (m *Repository) PostCustomer(w http.ResponseWriter, r *http.Request) {
+// AddProduct is handler for handling product creation requests
+func (m *Repository) AddProduct(w http.ResponseWriter, r *http.Request) {
 	userId, ok := m.App.Session.Get(r.Context(), "user_id").(int)
+
 	if !ok {
-		m.App.Session.Put(r.Context(), "error", "Failed to get user ID")
-		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
-		m.App.ErrorLog.Println("Failed to get user ID")
+		m.App.Session.Put(r.Context(), "error", "internal server error")
+		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Failed casting userid to int from session")
 		return
 	}
-	err := r.ParseMultipartForm(10 << 20)
+
+	err := r.ParseForm()
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't process form")
-		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
-		log.Println(err)
+		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
+		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Form Parse error", err)
 		return
 	}
 
-	customerId := r.Form.Get("customerId")
-	idType := r.Form.Get("idtype")
-	cardImage, _, _ := r.FormFile("cardPhoto")
-	custImage, _, _ := r.FormFile("custPhoto")
-	firstName := r.Form.Get("firstname")
-	lastName := r.Form.Get("lastname")
-	hAddress := r.Form.Get("houseaddress")
-	phone := r.Form.Get("phone")
-	location := r.Form.Get("location")
-	landmark := r.Form.Get("landmark")
-	months, _ := strconv.Atoi(r.Form.Get("months"))
-	agreement := r.Form.Get("agreement")
-
-	ctsImage, err := helpers.ProcessImage(custImage)
-	defer custImage.Close()
+	price, err := strconv.ParseFloat(r.Form.Get("price"), 64)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't process custumer photo")
-		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
-		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "error", "invalid data!")
+		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Price Parse error", err)
 		return
 	}
 
-	crdImage, err := helpers.ProcessImage(cardImage)
-	defer cardImage.Close()
+	stock, err := strconv.Atoi(r.Form.Get("stock"))
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't process ID card photo")
-		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
-		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "error", "invalid data!")
+		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Stock Parse error", err)
 		return
 	}
 
-	// do necessary conversion
-	p, _ := strconv.Atoi(phone)
-
-	c := models.Customer{
-		CustomerId:   customerId,
-		CustImage:    ctsImage,
-		IDType:       idType,
-		CardImage:    crdImage,
-		FirstName:    firstName,
-		LastName:     lastName,
-		Phone:        p,
-		HouseAddress: hAddress,
-		Location:     location,
-		Landmark:     landmark,
-		Status:       "on_contract",
-		Months:       months,
-		Agreement:    agreement,
-		UserId:       userId,
+	product := models.Product{
+		Serial:      r.Form.Get("serial"),
+		Name:        r.Form.Get("name"),
+		Description: r.Form.Get("description"),
+		Price:       price,
+		Units:       int32(stock),
+		UserId:      userId,
 	}
 
-	form := forms.New(r.Form)
+	form := forms.New(r.PostForm)
 	data := make(map[string]interface{})
-	form.Required("customerId", "idtype", "firstname", "lastname", "houseaddress", "phone", "location", "landmark", "agreement")
 
+	product.ReorderPoint, product.ReorderQty = reorderLevels(form)
+	product.CostPrice = unitCost(form, "cost_price")
+	productCatalogue(form, &product)
+	form.Required("name", "description", "price", "stock")
 	if !form.Valid() {
-		m.App.Session.Put(r.Context(), "error", "One of the fields is empty")
-		metaData := models.FormMetaData{
-			Section: "Contract",
-			Message: "Add Customer Information",
-			Button:  "Add Information",
-			Url:     "/admin/add-contract",
-		}
-		data["customer"] = c
-		data["metadata"] = metaData
-		render.Template(w, r, "customerform.page.html", &models.TemplateData{
+		data["product"] = product
+		m.addCatalogueData(data)
+
+		render.Template(w, r, "addproduct.page.html", &models.TemplateData{
 			Form: form,
 			Data: data,
 		})
-		m.App.ErrorLog.Println("One of the fields is empty")
 		return
 	}
 
-	cust, _ := m.DB.FetchCustomer(c.CustomerId)
-
-	if cust.CustomerId == c.CustomerId {
-		m.App.Session.Put(r.Context(), "error", "Customer with such ID already exist")
-		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
-		m.App.InfoLog.Println("Customer with such ID already exist")
+	p, _ := m.DB.FetchProduct(product.Serial)
+	if p.Serial == product.Serial {
+		m.App.Session.Put(r.Context(), "error", "Product with same serial number already exists")
+		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Product with same serial number already exists")
 		return
 	}
 
-	err = m.DB.InsertCustomer(c)
+	product, err = m.audited(r).InsertProduct(product)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Customer information could not be inserted!")
-		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
+		m.App.Session.Put(r.Context(), "error", "Product could not be inserted")
+		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
 		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	data["customer"] = c
-	m.App.Session.Put(r.Context(), "customer", c)
-	m.App.Session.Put(r.Context(), "customerId", c.CustomerId)
-	m.App.Session.Put(r.Context(), "flash", "Customer inserted successfully")
-	render.Template(w, r, "displayCustomer.page.html", &models.TemplateData{
+	product.Price = price
+	if p, err := m.DB.FetchProduct(product.Serial); err == nil {
+		product = p
+	}
+
+	locationStock, err := m.DB.FetchProductStock(product.Serial)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+
+	data["product"] = product
+	data["stock"] = locationStock
+
+	m.App.Session.Put(r.Context(), "flash", "Product inserted!")
+	m.App.Session.Put(r.Context(), "product", product)
+	render.Template(w, r, "displayproduct.page.html", &models.TemplateData{
 		Data: data,
 	})
 }
 
-// UpdateCustomer update customer information with changes by ID
-func (m *Repository) UpdateCustomer(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseMultipartForm(10 << 20)
+// UpdateProduct update product with changes by ID
+func (m *Repository) UpdateProduct(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
-		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
+		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
 		m.App.ErrorLog.Println("Error parsing form")
 		return
 	}
 
-	userId := m.App.Session.Get(r.Context(), "user_id").(int)
-	customerId := r.Form.Get("customerId")
-	idType := r.Form.Get("idtype")
-	firstName := r.Form.Get("firstname")
-	lastName := r.Form.Get("lastname")
-	hAddress := r.Form.Get("houseaddress")
-	phone := r.Form.Get("phone")
-	location := r.Form.Get("location")
-	landmark := r.Form.Get("landmark")
-	months, _ := strconv.Atoi(strings.TrimSpace(r.Form.Get("months")))
-	agreement := r.Form.Get("agreement")
-	custImage, _, _ := r.FormFile("custPhoto")
-	cardImage, _, _ := r.FormFile("cardPhoto")
-
-	// do necessary conversion
-	p, _ := strconv.Atoi(strings.TrimSpace(phone))
-	id, _ := strconv.Atoi(r.Form.Get("cust_id"))
-
-	defer custImage.Close()
-	defer cardImage.Close()
+	price, err := strconv.ParseFloat(r.Form.Get("price"), 64)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "invalid data!")
+		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Error parsing int for price")
+		return
+	}
 
-	ctsImg, err := helpers.ProcessImage(custImage)
+	stock, err := strconv.Atoi(r.Form.Get("stock"))
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "error processing customer's image!")
-		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
-		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "error", "invalid data!")
+		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Error parsing int for stock")
 		return
 	}
 
-	crdImg, err := helpers.ProcessImage(cardImage)
+	prod_id, err := strconv.Atoi(r.Form.Get("prod_id"))
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "error processing id card's image!")
-		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
-		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "error", "invalid data!")
+		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Error parsing int for product ID")
 		return
 	}
 
-	c := models.Customer{
-		ID:           id,
-		CustomerId:   customerId,
-		CustImage:    ctsImg,
-		IDType:       idType,
-		CardImage:    crdImg,
-		FirstName:    firstName,
-		LastName:     lastName,
-		Phone:        p,
-		HouseAddress: hAddress,
-		Location:     location,
-		Landmark:     landmark,
-		Status:       "on_contract",
-		Agreement:    agreement,
-		Months:       months,
-		UserId:       userId,
+	userId := m.App.Session.Get(r.Context(), "user_id").(int)
+	product := models.Product{
+		ID:          prod_id,
+		Serial:      r.Form.Get("serial"),
+		Name:        r.Form.Get("name"),
+		Description: r.Form.Get("description"),
+		Price:       price,
+		Units:       int32(stock),
+		UserId:      userId,
 	}
 
-	form := forms.New(r.Form)
+	form := forms.New(r.PostForm)
 	data := make(map[string]interface{})
-	form.Required("customerId", "idtype", "firstname", "lastname", "houseaddress", "phone",
-		"location", "landmark", "agreement")
 
+	product.ReorderPoint, product.ReorderQty = reorderLevels(form)
+	product.CostPrice = unitCost(form, "cost_price")
+	productCatalogue(form, &product)
+	form.Required("prod_id", "name", "description", "price", "stock")
 	if !form.Valid() {
-		m.App.Session.Put(r.Context(), "error", "One of the fields is empty")
-		metaData := models.FormMetaData{
-			Section: "Contract",
-			Message: "Add Customer Information",
-			Button:  "Add Information",
-			Url:     "/admin/add-contract",
-		}
+		data["product"] = product
+		m.addCatalogueData(data)
+
+		render.Template(w, r, "addproduct.page.html", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
+		m.App.ErrorLog.Println("Invalid form values")
+		return
+	}
+
+	err = m.audited(r).UpdateProduct(product)
+	if errors.Is(err, repository.ErrInsufficientStock) {
+		form.Errors.Add("stock", "Units can only be taken off stock held at your location")
+		data["product"] = product
+		m.addCatalogueData(data)
+
+		render.Template(w, r, "addproduct.page.html", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
+		return
+	}
+
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Product could not be updated")
+		http.Redirect(w, r, "/admin/add-product", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	if p, err := m.DB.FetchProduct(product.Serial); err == nil {
+		product = p
+	}
+
+	locationStock, err := m.DB.FetchProductStock(product.Serial)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+
+	data["product"] = product
+	data["stock"] = locationStock
+	m.App.Session.Put(r.Context(), "product", product)
+	m.App.Session.Put(r.Context(), "flash", "Product updated!")
+	render.Template(w, r, "displayproduct.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// SearchProduct handlers the request for Product form
+func (m *Repository) SearchProduct(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+
+	if r.URL.Path == "/admin/search-product" {
+		metaData := models.FormMetaData{
+			Url:     "/admin/edit-form",
+			Section: "Product",
+			Message: "Search Product",
+			Button:  "Search",
+		}
+		data["metadata"] = metaData
+	} else {
+		metaData := models.FormMetaData{
+			Url:     "/admin/delete-product",
+			Section: "Product",
+			Message: "Enter Product Serial",
+			Button:  "Delete",
+		}
+		data["metadata"] = metaData
+	}
+	render.Template(w, r, "editproduct.page.html", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// EditProductForm handlers edit product form request
+func (m *Repository) EditProductForm(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/search-product", http.StatusSeeOther)
+		fmt.Println("Error Parsing form ", err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("serial")
+
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "form field can't be empty")
+		render.Template(w, r, "editproduct.page.html", &models.TemplateData{
+			Form: form,
+		})
+		fmt.Println("Error in form values ", err)
+		return
+	}
+
+	p, err := m.DB.FetchProduct(r.Form.Get("serial"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "No product with such serial number")
+		http.Redirect(w, r, "/admin/search-product", http.StatusSeeOther)
+		//fmt.Println("Error Querying database ", err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "product", p)
+	http.Redirect(w, r, "/admin/edit-product", http.StatusSeeOther)
+}
+
+// ListProducts handles request for products in the database, narrowed down by the search,
+// category, brand and attributes in the query string
+func (m *Repository) ListProducts(w http.ResponseWriter, r *http.Request) {
+	page := chi.URLParam(r, "page")
+	pg, _ := strconv.Atoi(page)
+	if pg == 0 {
+		pg = 1
+	}
+	meta := models.FormMetaData{
+		Section: "Product",
+		Url:     "/admin/list-products/1",
+	}
+
+	data := make(map[string]any)
+
+	filter := models.ParseProductFilter(r.URL.Query())
+	filter.Page = pg
+	data["filter"] = filter
+
+	facets, err := m.DB.FetchProductFacets(filter)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+	data["facets"] = facets
+
+	prods, err := m.DB.FetchProducts(filter)
+
+	var p []models.Product
+	for _, v := range prods {
+		v.Price = helpers.ToDecimalPlace(v.Price, 2)
+		p = append(p, v)
+	}
+	data["products"] = p
+	data["metadata"] = meta
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Products cannot be fetched!")
+		m.App.ErrorLog.Println("Products cannot be fetched!")
+		render.Template(w, r, "displayproducts.page.html", &models.TemplateData{
+			Data: data,
+		})
+		return
+	}
+
+	if len(prods) == 0 {
+		m.App.Session.Put(r.Context(), "error", "No product was found!")
+		render.Template(w, r, "displayproducts.page.html", &models.TemplateData{
+			Data: data,
+		})
+		return
+	}
+
+	render.Template(w, r, "displayproducts.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// DeleteProduct handlers request for delete product form
+func (m *Repository) DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form!")
+		http.Redirect(w, r, "/admin/delete-product", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("serial")
+
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "Invalid form data!")
+		http.Redirect(w, r, "/admin/delete-product", http.StatusSeeOther)
+		return
+	}
+
+	prod, err := m.DB.FetchProduct(r.Form.Get("serial"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "No product with such serial number found")
+		http.Redirect(w, r, "/admin/delete-product", http.StatusSeeOther)
+		return
+	}
+
+	if prod.Serial != r.Form.Get("serial") {
+		m.App.Session.Put(r.Context(), "error", "No product with such serial number found")
+		http.Redirect(w, r, "/admin/delete-product", http.StatusSeeOther)
+		return
+	}
+
+	err = m.audited(r).DeleteProduct(r.Form.Get("serial"))
+	if errors.Is(err, repository.ErrProductInUse) {
+		m.App.Session.Put(r.Context(), "error", "This product has sales or stock records and cannot be deleted, archive it instead")
+		http.Redirect(w, r, "/admin/delete-product", http.StatusSeeOther)
+		return
+	}
+
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Product cannot be deleted!")
+		http.Redirect(w, r, "/admin/delete-product", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Product deleted successfully")
+	http.Redirect(w, r, "/admin/delete-product", http.StatusSeeOther)
+}
+
+// PostArchiveProduct takes the product with the serial in the form off sale, its sales and stock
+// records are kept
+func (m *Repository) PostArchiveProduct(w http.ResponseWriter, r *http.Request) {
+	m.setProductArchived(w, r, true, "/admin/delete-product")
+}
+
+// PostRestoreProduct puts the archived product with the serial in the form back on sale
+func (m *Repository) PostRestoreProduct(w http.ResponseWriter, r *http.Request) {
+	m.setProductArchived(w, r, false, "/admin/list-products/1?archived=1")
+}
+
+// setProductArchived archives or restores the product with the serial in the form, then goes
+// back to the page the form was on
+func (m *Repository) setProductArchived(w http.ResponseWriter, r *http.Request, archived bool, back string) {
+	userId, ok := m.App.Session.Get(r.Context(), "user_id").(int)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Failed to get user ID")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form!")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	serial := r.Form.Get("serial")
+	prod, err := m.DB.FetchProduct(serial)
+	if err != nil || serial == "" {
+		m.App.Session.Put(r.Context(), "error", "No product with such serial number found")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	if archived {
+		err = m.audited(r).ArchiveProduct(prod.Serial, userId)
+	} else {
+		err = m.audited(r).RestoreProduct(prod.Serial, userId)
+	}
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Product cannot be changed!")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	if archived {
+		m.App.Session.Put(r.Context(), "flash", prod.Name+" archived, it can no longer be sold")
+	} else {
+		m.App.Session.Put(r.Context(), "flash", prod.Name+" restored and back on sale")
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// IncreaseQtyForm serves request for form for increasing product quantity
+func (m *Repository) IncreaseQtyForm(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+
+	metaData := models.FormMetaData{
+		Message: "Add Product Quantity",
+		Button:  "Post Quantity",
+		Url:     "/admin/increase-qty",
+		Section: "Product",
+	}
+
+	data["metadata"] = metaData
+
+	render.Template(w, r, "increaseQtyform.page.html", &models.TemplateData{
+		Form: forms.New(nil),
+		Data: data,
+	})
+}
+
+// PostIncreaseQty process product quantity addition request
+func (m *Repository) PostIncreaseQty(w http.ResponseWriter, r *http.Request) {
+	userId, ok := m.App.Session.Get(r.Context(), "user_id").(int)
+	data := make(map[string]interface{})
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Failed to get user ID")
+		http.Redirect(w, r, "/admin/increase-qty", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Failed to get user ID")
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/increase-qty", http.StatusSeeOther)
+		log.Println(err)
+		return
+	}
+
+	qty, _ := strconv.Atoi(r.Form.Get("quantity"))
+	p := models.Product{
+		Serial: r.Form.Get("serial"),
+		Units:  int32(qty),
+		UserId: userId,
+	}
+
+	metaData := models.FormMetaData{
+		Message: "Add Product Quantity",
+		Button:  "Post Quantity",
+		Url:     "/admin/increase-qty",
+		Section: "Product",
+	}
+	data["product"] = p
+	data["metadata"] = metaData
+
+	form := forms.New(r.PostForm)
+	form.Required("serial", "quantity")
+	if qty <= 0 {
+		form.Errors.Add("quantity", "Quantity must be a whole number above zero")
+	}
+	cost := unitCost(form, "unit_cost")
+	batchNo := strings.TrimSpace(r.Form.Get("batch_no"))
+	expiresAt := expiryDate(form, "expires_at")
+	if !form.Valid() {
+		render.Template(w, r, "increaseQtyform.page.html", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
+		return
+	}
+
+	err = m.audited(r).WithTx(r.Context(), func(repo repository.DatabaseRepo) error {
+		prod, err := repo.FetchProduct(p.Serial)
+		if err != nil {
+			return err
+		}
+
+		if prod.Serial != p.Serial {
+			return sql.ErrNoRows
+		}
+
+		return repo.RecordStockMovement(models.StockMovement{
+			Serial:    p.Serial,
+			Quantity:  qty,
+			Reason:    models.StockRestock,
+			BatchNo:   batchNo,
+			ExpiresAt: expiresAt,
+			UnitCost:  cost,
+			UserId:    userId,
+		})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "Sorry, couldn't find a product with this serial number!")
+		http.Redirect(w, r, "/admin/increase-qty", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Failed to insert customer items purchased")
+		http.Redirect(w, r, "/admin/increase-qty", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Product with serial number %s quantity increased!", p.Serial))
+	render.Template(w, r, "increaseQtyform.page.html", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// Contract Section handles Contract processing
+// ContractForm handler handles contract form request
+func (m *Repository) CustomerForm(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+
+	if r.URL.Path == "/admin/edit-contract" {
+		cust, _ := m.App.Session.Get(r.Context(), "customer").(models.Customer)
+		metaData := models.FormMetaData{
+			Section: "Contract",
+			Message: "Edit Customer Information",
+			Button:  "Update Information",
+			Url:     "/admin/update-contract",
+		}
+
+		data["customer"] = cust
+		data["metadata"] = metaData
+	} else {
+		metaData := models.FormMetaData{
+			Section: "Contract",
+			Message: "Add Customer Information",
+			Button:  "Add Information",
+			Url:     "/admin/add-contract",
+		}
+		data["customer"] = models.Customer{}
+		data["metadata"] = metaData
+	}
+
+	render.Template(w, r, "customerform.page.html", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// PostCustomer handles customer creation request
+func (m *Repository) PostCustomer(w http.ResponseWriter, r *http.Request) {
+	userId, ok := m.App.Session.Get(r.Context(), "user_id").(int)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Failed to get user ID")
+		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Failed to get user ID")
+		return
+	}
+	err := r.ParseMultipartForm(10 << 20)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
+		log.Println(err)
+		return
+	}
+
+	customerId := r.Form.Get("customerId")
+	idType := r.Form.Get("idtype")
+	cardImage, _, _ := r.FormFile("cardPhoto")
+	custImage, _, _ := r.FormFile("custPhoto")
+	firstName := r.Form.Get("firstname")
+	lastName := r.Form.Get("lastname")
+	hAddress := r.Form.Get("houseaddress")
+	phone := r.Form.Get("phone")
+	location := r.Form.Get("location")
+	landmark := r.Form.Get("landmark")
+	months, _ := strconv.Atoi(r.Form.Get("months"))
+	agreement := r.Form.Get("agreement")
+
+	ctsImage, err := helpers.ProcessImage(custImage)
+	defer custImage.Close()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't process custumer photo")
+		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	crdImage, err := helpers.ProcessImage(cardImage)
+	defer cardImage.Close()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't process ID card photo")
+		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	// do necessary conversion
+	p, _ := strconv.Atoi(phone)
+
+	c := models.Customer{
+		CustomerId:   customerId,
+		CustImage:    ctsImage,
+		IDType:       idType,
+		CardImage:    crdImage,
+		FirstName:    firstName,
+		LastName:     lastName,
+		Phone:        p,
+		HouseAddress: hAddress,
+		Location:     location,
+		Landmark:     landmark,
+		Status:       "on_contract",
+		Months:       months,
+		Agreement:    agreement,
+		UserId:       userId,
+	}
+
+	form := forms.New(r.Form)
+	data := make(map[string]interface{})
+	form.Required("customerId", "idtype", "firstname", "lastname", "houseaddress", "phone", "location", "landmark", "agreement")
+
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "One of the fields is empty")
+		metaData := models.FormMetaData{
+			Section: "Contract",
+			Message: "Add Customer Information",
+			Button:  "Add Information",
+			Url:     "/admin/add-contract",
+		}
+		data["customer"] = c
+		data["metadata"] = metaData
+		render.Template(w, r, "customerform.page.html", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
+		m.App.ErrorLog.Println("One of the fields is empty")
+		return
+	}
+
+	cust, _ := m.DB.FetchCustomer(c.CustomerId)
+
+	if cust.CustomerId == c.CustomerId {
+		m.App.Session.Put(r.Context(), "error", "Customer with such ID already exist")
+		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
+		m.App.InfoLog.Println("Customer with such ID already exist")
+		return
+	}
+
+	err = m.audited(r).InsertCustomer(c)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Customer information could not be inserted!")
+		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	data["customer"] = c
+	m.App.Session.Put(r.Context(), "customer", c)
+	m.App.Session.Put(r.Context(), "customerId", c.CustomerId)
+	m.App.Session.Put(r.Context(), "flash", "Customer inserted successfully")
+	render.Template(w, r, "displayCustomer.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// UpdateCustomer update customer information with changes by ID
+func (m *Repository) UpdateCustomer(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(10 << 20)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
+		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Error parsing form")
+		return
+	}
+
+	userId := m.App.Session.Get(r.Context(), "user_id").(int)
+	customerId := r.Form.Get("customerId")
+	idType := r.Form.Get("idtype")
+	firstName := r.Form.Get("firstname")
+	lastName := r.Form.Get("lastname")
+	hAddress := r.Form.Get("houseaddress")
+	phone := r.Form.Get("phone")
+	location := r.Form.Get("location")
+	landmark := r.Form.Get("landmark")
+	months, _ := strconv.Atoi(strings.TrimSpace(r.Form.Get("months")))
+	agreement := r.Form.Get("agreement")
+	custImage, _, _ := r.FormFile("custPhoto")
+	cardImage, _, _ := r.FormFile("cardPhoto")
+
+	// do necessary conversion
+	p, _ := strconv.Atoi(strings.TrimSpace(phone))
+	id, _ := strconv.Atoi(r.Form.Get("cust_id"))
+
+	defer custImage.Close()
+	defer cardImage.Close()
+
+	ctsImg, err := helpers.ProcessImage(custImage)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "error processing customer's image!")
+		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	crdImg, err := helpers.ProcessImage(cardImage)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "error processing id card's image!")
+		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	c := models.Customer{
+		ID:           id,
+		CustomerId:   customerId,
+		CustImage:    ctsImg,
+		IDType:       idType,
+		CardImage:    crdImg,
+		FirstName:    firstName,
+		LastName:     lastName,
+		Phone:        p,
+		HouseAddress: hAddress,
+		Location:     location,
+		Landmark:     landmark,
+		Status:       "on_contract",
+		Agreement:    agreement,
+		Months:       months,
+		UserId:       userId,
+	}
+
+	form := forms.New(r.Form)
+	data := make(map[string]interface{})
+	form.Required("customerId", "idtype", "firstname", "lastname", "houseaddress", "phone",
+		"location", "landmark", "agreement")
+
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "One of the fields is empty")
+		metaData := models.FormMetaData{
+			Section: "Contract",
+			Message: "Add Customer Information",
+			Button:  "Add Information",
+			Url:     "/admin/add-contract",
+		}
 		data["customer"] = c
 		data["metadata"] = metaData
-		render.Template(w, r, "customerform.page.html", &models.TemplateData{
+		render.Template(w, r, "customerform.page.html", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
+		m.App.ErrorLog.Println("One of the fields is empty")
+		return
+	}
+
+	err = m.audited(r).UpdateCustomer(c)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Customer informaction could not be updated")
+		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	data["customer"] = c
+	m.App.Session.Put(r.Context(), "customer", c)
+	m.App.Session.Put(r.Context(), "customerId", c.CustomerId)
+	m.App.Session.Put(r.Context(), "flash", "Customer updated successfully")
+	render.Template(w, r, "displayCustomer.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+func (m *Repository) GetWitnessForm(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+
+	if r.URL.Path == "/admin/edit-witness" {
+		witn, _ := m.App.Session.Pop(r.Context(), "witness").(models.Witness)
+		meta := models.FormMetaData{
+			Message: "Eidt Witness Information",
+			Button:  "Edit Witness Information",
+			Url:     "/admin/update-witness",
+			Section: "Contract",
+		}
+
+		data["witness"] = witn
+		data["metadata"] = meta
+	} else {
+		meta := models.FormMetaData{
+			Message: "Add Witness Information",
+			Button:  "Add Witness Information",
+			Url:     "/admin/add-witness",
+			Section: "Contract",
+		}
+		data["witness"] = models.Witness{}
+		data["metadata"] = meta
+	}
+
+	render.Template(w, r, "witnessform.page.html", &models.TemplateData{
+		Form: forms.New(nil),
+		Data: data,
+	})
+}
+
+// PostWitness handles post request for witness
+func (m *Repository) PostWitness(w http.ResponseWriter, r *http.Request) {
+	userId, ok := m.App.Session.Get(r.Context(), "user_id").(int)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Failed to get user ID")
+		http.Redirect(w, r, "/admin/add-witness", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Failed to get user ID")
+		return
+	}
+
+	customerId, ok := m.App.Session.Get(r.Context(), "customerId").(string)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Failed to get customer ID")
+		http.Redirect(w, r, "/admin/add-witness", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Failed to get customer ID")
+		return
+	}
+
+	err := r.ParseMultipartForm(10 << 20)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/add-witness", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	p, _ := strconv.Atoi(r.Form.Get("phone"))
+	witnessPhoto, _, _ := r.FormFile("witnessPhoto")
+
+	defer witnessPhoto.Close()
+	wtnImg, err := helpers.ProcessImage(witnessPhoto)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "error processing witness image")
+		http.Redirect(w, r, "/admin/add-witness", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	witn := models.Witness{
+		CustomerId: customerId,
+		FirstName:  r.Form.Get("firstname"),
+		LastName:   r.Form.Get("lastname"),
+		Phone:      p,
+		Terms:      r.Form.Get("terms"),
+		Image:      wtnImg,
+		UserId:     userId,
+	}
+
+	data := make(map[string]interface{})
+	form := forms.New(r.Form)
+	form.Required("firstname", "lastname", "phone", "terms")
+	if !form.Valid() {
+		meta := models.FormMetaData{
+			Message: "Add Witness Information",
+			Button:  "Add Witness Information",
+			Url:     "/admin/add-witness",
+			Section: "Contract",
+		}
+
+		data["witness"] = witn
+		data["metadata"] = meta
+		render.Template(w, r, "witnessform.page.html", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
+		return
+	}
+
+	wtn, _ := m.DB.FetchWitness(witn.CustomerId)
+	if wtn.CustomerId == witn.CustomerId {
+		m.App.Session.Put(r.Context(), "error", "Witness with such ID already exist")
+		http.Redirect(w, r, "/admin/add-witness", http.StatusSeeOther)
+		m.App.InfoLog.Println("Witness with such ID already exist")
+		return
+	}
+
+	wtn, err = m.audited(r).InsertWitnessData(witn)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Witness information could not be inserted!")
+		http.Redirect(w, r, "/admin/add-witness", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	data["witness"] = wtn
+	m.App.Session.Put(r.Context(), "witness", wtn)
+	m.App.Session.Put(r.Context(), "customerId", wtn.CustomerId)
+	m.App.Session.Put(r.Context(), "flash", "Witness information inserted successfully")
+	render.Template(w, r, "displayWitness.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// UpdateWitness update witness information with changes by ID
+func (m *Repository) UpdateWitness(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(10 << 20)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
+		http.Redirect(w, r, "/admin/add-witness", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	userId := m.App.Session.Get(r.Context(), "user_id").(int)
+	p, _ := strconv.Atoi(r.Form.Get("phone"))
+	witnessImage, _, _ := r.FormFile("witnessPhoto")
+	defer witnessImage.Close()
+
+	witnImg, err := helpers.ProcessImage(witnessImage)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "error processing witness's image!")
+		http.Redirect(w, r, "/admin/add-witness", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+	witn := models.Witness{
+		CustomerId: r.Form.Get("cust_id"),
+		FirstName:  r.Form.Get("firstname"),
+		LastName:   r.Form.Get("lastname"),
+		Phone:      p,
+		Terms:      r.Form.Get("terms"),
+		Image:      witnImg,
+		UserId:     userId,
+	}
+
+	data := make(map[string]interface{})
+	form := forms.New(r.Form)
+	form.Required("cust_id", "firstname", "lastname", "phone", "terms")
+	if !form.Valid() {
+		meta := models.FormMetaData{
+			Message: "Edit Witness Information",
+			Button:  "Edit Witness Information",
+			Url:     "/admin/update-witness",
+			Section: "Contract",
+		}
+
+		data["witness"] = witn
+		data["metadata"] = meta
+
+		render.Template(w, r, "witnessform.page.html", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
+		return
+	}
+
+	err = m.audited(r).UpdateWitness(witn)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Witness informaction could not be updated")
+		http.Redirect(w, r, "/admin/add-witness", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	data["witness"] = witn
+	m.App.Session.Put(r.Context(), "witness", witn)
+	m.App.Session.Put(r.Context(), "flash", "Witness information updated!")
+	render.Template(w, r, "displayWitness.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// ItemForm handles item form request
+func (m *Repository) ItemForm(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	custId, _ := m.App.Session.Get(r.Context(), "customerId").(string)
+
+	prods, err := m.DB.FetchAllProduct()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Server error, retry again")
+		http.Redirect(w, r, "/add-item", http.StatusSeeOther)
+		return
+	}
+
+	pt := models.PageTitle{
+		Main:        "Contract Form",
+		Sub:         "Contract",
+		Description: "Add Item",
+		PlaceHolder: "Deposit Amount",
+	}
+
+	if r.URL.Path == "/admin/edit-item" {
+		itm, _ := m.App.Session.Get(r.Context(), "item").(models.Item)
+		metaData := models.FormMetaData{
+			Message: "Edit Selected Product",
+			Button:  "Patch Product",
+			Url:     "/admin/edit-item",
+			Section: "Contract",
+		}
+
+		if itm.Quantity == 0 {
+			itm.Quantity = 1
+		}
+
+		itm.Price *= float64(itm.Quantity)
+
+		data["pageTitle"] = pt
+		data["item"] = itm
+		data["products"] = prods
+		data["customerId"] = custId
+		data["metadata"] = metaData
+	} else {
+		metaData := models.FormMetaData{
+			Message: "Select Product",
+			Button:  "Post Product",
+			Url:     "/admin/add-item",
+			Section: "Contract",
+		}
+
+		data["pageTitle"] = pt
+		data["products"] = prods
+		data["customerId"] = custId
+		data["metadata"] = metaData
+	}
+
+	m.App.Session.Put(r.Context(), "products", prods)
+	render.Template(w, r, "itemsform.page.html", &models.TemplateData{
+		Form: forms.New(nil),
+		Data: data,
+	})
+}
+
+// PostItem handles the processing and saving of purchased items
+func (m *Repository) PostItem(w http.ResponseWriter, r *http.Request) {
+	userId, ok := m.App.Session.Get(r.Context(), "user_id").(int)
+	data := make(map[string]interface{})
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Failed to get user ID")
+		http.Redirect(w, r, "/admin/add-item", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Failed to get user ID")
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/add-item", http.StatusSeeOther)
+		log.Println(err)
+		return
+	}
+
+	var price float64
+	custId := r.Form.Get("cust_id")
+	serial := r.Form.Get("serial")
+	qty, _ := strconv.Atoi(r.Form.Get("quantity"))
+	deposit, _ := strconv.ParseFloat(strings.TrimPrefix(r.Form.Get("deposit"), "₵"), 64)
+	//qty, _ := strconv.Atoi(quantity)
+	prods, _ := m.App.Session.Pop(r.Context(), "products").([]models.Product)
+
+	form := forms.New(r.Form)
+
+	form.Required("cust_id", "serial", "deposit", "quantity")
+	if qty <= 0 {
+		form.Errors.Add("quantity", "Quantity must be a whole number above zero")
+	}
+	if !form.Valid() {
+		data := make(map[string]interface{})
+		metaData := models.FormMetaData{
+			Message: "Select Product",
+			Button:  "Post Product",
+			Url:     "/admin/add-item",
+			Section: "Contract",
+		}
+		data["products"] = prods
+		data["customerId"] = custId
+		data["metadata"] = metaData
+
+		m.App.Session.Put(r.Context(), "products", prods)
+		m.App.Session.Put(r.Context(), "error", "Sorry, you took the wrong route!")
+		render.Template(w, r, "itemsform.page.html", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
+		return
+	}
+
+	// The item keeps the price of the moment it is sold, which may have changed since the form
+	// was loaded
+	prod, err := m.DB.FetchProduct(serial)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "No product with such serial number found")
+		http.Redirect(w, r, "/admin/add-item", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+	price = prod.Price
+
+	total := float64(qty) * float64(price)
+	item := models.Item{
+		CustomerId: custId,
+		Serial:     serial,
+		Price:      float64(price),
+		Quantity:   int(qty),
+		Deposit:    deposit,
+		Balance:    total - float64(deposit),
+		UserId:     userId,
+	}
+
+	err = m.audited(r).WithTx(r.Context(), func(repo repository.DatabaseRepo) error {
+		if err := repo.InsertItem(item); err != nil {
+			return err
+		}
+
+		return repo.RecordStockMovement(models.StockMovement{
+			Serial:    serial,
+			Quantity:  -qty,
+			Reason:    models.StockCreditSale,
+			Reference: "Contract " + custId,
+			UserId:    userId,
+		})
+	})
+	if errors.Is(err, repository.ErrInsufficientStock) {
+		data["pageTitle"] = models.PageTitle{
+			Main:        "Contract Form",
+			Sub:         "Contract",
+			Description: "Add Item",
+			PlaceHolder: "Deposit Amount",
+		}
+		data["customerId"] = custId
+		data["metadata"] = models.FormMetaData{
+			Message: "Select Product",
+			Button:  "Post Product",
+			Url:     "/admin/add-item",
+			Section: "Contract",
+		}
+		m.renderInsufficientStock(w, r, form, data, item, err)
+		return
+	}
+
+	if errors.Is(err, repository.ErrProductArchived) {
+		m.App.Session.Put(r.Context(), "error", "This product is archived and can no longer be sold")
+		http.Redirect(w, r, "/admin/add-item", http.StatusSeeOther)
+		return
+	}
+
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Failed to insert customer items purchased")
+		http.Redirect(w, r, "/admin/add-item", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	item.Total = total
+	data["item"] = item
+	m.App.Session.Put(r.Context(), "item", item)
+	m.App.Session.Put(r.Context(), "flash", "customer item saved!")
+	render.Template(w, r, "displayItembought.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// UpdateItem update items purchased on credit with changes by ID. The stock of the item as it
+// was is given back and the stock of the item as changed is taken, in one transaction.
+func (m *Repository) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	userId, ok := m.App.Session.Get(r.Context(), "user_id").(int)
+	data := make(map[string]interface{})
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Failed to get user ID")
+		http.Redirect(w, r, "/admin/edit-item", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Failed to get user ID")
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
+		http.Redirect(w, r, "/admin/edit-item", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Error parsing form")
+		return
+	}
+
+	var price float64
+	custId := r.Form.Get("cust_id")
+	serial := r.Form.Get("serial")
+	oldSerial := r.Form.Get("old_serial")
+	if oldSerial == "" {
+		oldSerial = serial
+	}
+	quantity := r.Form.Get("quantity")
+	deposit, _ := strconv.ParseFloat(strings.TrimPrefix(r.Form.Get("deposit"), "₵"), 64)
+	qty, _ := strconv.Atoi(quantity)
+	prods, _ := m.App.Session.Pop(r.Context(), "products").([]models.Product)
+
+	metaData := models.FormMetaData{
+		Message: "Select Product",
+		Button:  "Patch Product",
+		Url:     "/admin/edit-item",
+		Section: "Contract",
+	}
+
+	form := forms.New(r.Form)
+
+	form.Required("cust_id", "serial", "deposit", "quantity")
+	if qty <= 0 {
+		form.Errors.Add("quantity", "Quantity must be a whole number above zero")
+	}
+
+	// The item keeps the price it was sold at, later price changes do not reach it
+	old, found, err := creditItem(m.DB, custId, oldSerial)
+	if err != nil || !found {
+		m.App.Session.Put(r.Context(), "error", "Purchased item could not be found")
+		http.Redirect(w, r, "/admin/edit-item", http.StatusSeeOther)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+		return
+	}
+	price = old.Price
+
+	// An item changed to another product is sold at that product's price of the moment, the
+	// customer's items are told apart by product so the customer cannot hold it twice
+	if serial != oldSerial && form.Valid() {
+		_, taken, err := creditItem(m.DB, custId, serial)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+		if taken {
+			form.Errors.Add("serial", "The customer already bought this product, edit that item instead")
+		}
+
+		prod, err := m.DB.FetchProduct(serial)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "No product with such serial number found")
+			http.Redirect(w, r, "/admin/edit-item", http.StatusSeeOther)
+			m.App.ErrorLog.Println(err)
+			return
+		}
+		price = prod.Price
+	}
+
+	if !form.Valid() {
+		data := make(map[string]interface{})
+		data["products"] = prods
+		data["customerId"] = custId
+		data["oldSerial"] = oldSerial
+		data["metadata"] = metaData
+
+		m.App.Session.Put(r.Context(), "products", prods)
+		render.Template(w, r, "itemsform.page.html", &models.TemplateData{
 			Form: form,
 			Data: data,
 		})
-		m.App.ErrorLog.Println("One of the fields is empty")
 		return
 	}
 
-	err = m.DB.UpdateCustomer(c)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Customer informaction could not be updated")
-		http.Redirect(w, r, "/admin/add-contract", http.StatusSeeOther)
-		m.App.ErrorLog.Println(err)
+	total := float64(qty) * float64(price)
+	item := models.Item{
+		CustomerId: custId,
+		Serial:     serial,
+		Price:      float64(price),
+		Quantity:   int(qty),
+		Deposit:    float64(deposit),
+		Balance:    total - float64(deposit),
+		UserId:     userId,
+	}
+
+	err = m.audited(r).WithTx(r.Context(), func(repo repository.DatabaseRepo) error {
+		old, found, err := creditItem(repo, custId, oldSerial)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return sql.ErrNoRows
+		}
+
+		if err := repo.UpdateItem(oldSerial, item); err != nil {
+			return err
+		}
+
+		for _, mv := range itemMovements(old, serial, qty, userId) {
+			if err := repo.RecordStockMovement(mv); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, repository.ErrInsufficientStock) {
+		data["pageTitle"] = models.PageTitle{
+			Main:        "Contract Form",
+			Sub:         "Contract",
+			Description: "Add Item",
+			PlaceHolder: "Deposit Amount",
+		}
+		data["customerId"] = custId
+		data["oldSerial"] = oldSerial
+		data["metadata"] = metaData
+		m.renderInsufficientStock(w, r, form, data, item, err)
+		return
+	}
+
+	if errors.Is(err, repository.ErrProductArchived) {
+		m.App.Session.Put(r.Context(), "error", "This product is archived and can no longer be sold")
+		http.Redirect(w, r, "/admin/edit-item", http.StatusSeeOther)
+		return
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "Purchased item could not be found")
+		http.Redirect(w, r, "/admin/edit-item", http.StatusSeeOther)
+		return
+	}
+
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Purchased item could not be updated")
+		http.Redirect(w, r, "/admin/edit-item", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	item.Total = total
+	data["item"] = item
+	m.App.Session.Put(r.Context(), "flash", "customer item saved!")
+	render.Template(w, r, "displayItembought.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// itemMovements returns the stock movements of changing the credit item old to qty units of
+// serial. A change of quantity alone moves only the difference; units that come back to stock
+// are an adjustment, not a sale.
+func itemMovements(old models.Item, serial string, qty int, userId int) []models.StockMovement {
+	movements := []models.StockMovement{
+		{Serial: old.Serial, Quantity: old.Quantity},
+		{Serial: serial, Quantity: -qty},
+	}
+	if serial == old.Serial {
+		movements = []models.StockMovement{{Serial: serial, Quantity: old.Quantity - qty}}
+	}
+
+	var moved []models.StockMovement
+	for _, mv := range movements {
+		if mv.Quantity == 0 {
+			continue
+		}
+
+		mv.Reason = models.StockCreditSale
+		if mv.Quantity > 0 {
+			mv.Reason = models.StockAdjustment
+		}
+		mv.Reference = "Contract " + old.CustomerId
+		mv.UserId = userId
+		moved = append(moved, mv)
+	}
+	return moved
+}
+
+// creditItem returns the item a customer bought on credit with serial, found is false when the
+// customer has no such item
+func creditItem(repo repository.DatabaseRepo, customerId, serial string) (itm models.Item, found bool, err error) {
+	items, err := repo.CustomerDebt(customerId)
+	if err != nil {
+		return itm, false, err
+	}
+
+	for _, i := range items {
+		if i.Serial == serial {
+			return i, true, nil
+		}
+	}
+	return itm, false, nil
+}
+
+// ListCustomers handles request for customer history in the database
+func (m *Repository) ListCustomers(w http.ResponseWriter, r *http.Request) {
+	page := chi.URLParam(r, "page")
+	pg, _ := strconv.Atoi(page)
+	if pg == 0 {
+		pg = 1
+	}
+	// user, ok := m.App.Session.Get(r.Context(), "user").(models.User)
+	// if !ok {
+	// 	m.App.Session.Put(r.Context(), "error", "You must logged in first!")
+	// 	m.App.ErrorLog.Println("user could be found in the session!")
+	// 	http.Redirect(w, r, "/", http.StatusSeeOther)
+	// 	return
+	// }
+	meta := models.FormMetaData{
+		Section: "Contract",
+		Url:     "/admin/list-customers/1",
+	}
+
+	data := make(map[string]any)
+
+	cust, err := m.DB.FetchCustomersByPage(pg)
+	data["customers"] = cust
+	data["metadata"] = meta
+
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Customers cannot be fetched!")
+		m.App.ErrorLog.Println("Customers cannot be fetched!", err)
+		render.Template(w, r, "displaycustomers.page.html", &models.TemplateData{
+			Data: data,
+		})
+		return
+	}
+
+	if len(cust) == 0 {
+		m.App.Session.Put(r.Context(), "error", "No customer was found!")
+		render.Template(w, r, "displaycustomers.page.html", &models.TemplateData{
+			Data: data,
+		})
 		return
 	}
 
-	data["customer"] = c
-	m.App.Session.Put(r.Context(), "customer", c)
-	m.App.Session.Put(r.Context(), "customerId", c.CustomerId)
-	m.App.Session.Put(r.Context(), "flash", "Customer updated successfully")
-	render.Template(w, r, "displayCustomer.page.html", &models.TemplateData{
+	enterer, _ := m.DB.FetchUserById(cust[0].UserId)
+	data["enterer"] = enterer
+
+	render.Template(w, r, "displaycustomers.page.html", &models.TemplateData{
 		Data: data,
 	})
 }
 
-func (m *Repository) GetWitnessForm(w http.ResponseWriter, r *http.Request) {
+// Payments
+// PaymentForm handler handles payment form request
+func (m *Repository) PaymentForm(w http.ResponseWriter, r *http.Request) {
 	data := make(map[string]interface{})
 
-	if r.URL.Path == "/admin/edit-witness" {
-		witn, _ := m.App.Session.Pop(r.Context(), "witness").(models.Witness)
-		meta := models.FormMetaData{
-			Message: "Eidt Witness Information",
-			Button:  "Edit Witness Information",
-			Url:     "/admin/update-witness",
+	if r.URL.Path == "/admin/edit-payment" {
+		pymt, _ := m.App.Session.Get(r.Context(), "payment").(models.Payments)
+		metaData := models.FormMetaData{
 			Section: "Contract",
+			Message: "Edit Payment Information",
+			Button:  "Patch Payment",
+			Url:     "/admin/update-payment",
 		}
 
-		data["witness"] = witn
-		data["metadata"] = meta
+		data["payment"] = pymt
+		data["metadata"] = metaData
 	} else {
-		meta := models.FormMetaData{
-			Message: "Add Witness Information",
-			Button:  "Add Witness Information",
-			Url:     "/admin/add-witness",
+		metaData := models.FormMetaData{
 			Section: "Contract",
+			Message: "Add Payment Information",
+			Button:  "Post Payment",
+			Url:     "/admin/pay",
 		}
-		data["witness"] = models.Witness{}
-		data["metadata"] = meta
+		data["payment"] = models.Customer{}
+		data["metadata"] = metaData
 	}
 
-	render.Template(w, r, "witnessform.page.html", &models.TemplateData{
-		Form: forms.New(nil),
+	render.Template(w, r, "paymentform.page.html", &models.TemplateData{
 		Data: data,
+		Form: forms.New(nil),
 	})
 }
 
-// PostWitness handles post request for witness
-func (m *Repository) PostWitness(w http.ResponseWriter, r *http.Request) {
+// PostPayments handles the request for payment processing
+func (m *Repository) PostPayments(w http.ResponseWriter, r *http.Request) {
 	userId, ok := m.App.Session.Get(r.Context(), "user_id").(int)
 	if !ok {
 		m.App.Session.Put(r.Context(), "error", "Failed to get user ID")
-		http.Redirect(w, r, "/admin/add-witness", http.StatusSeeOther)
+		http.Redirect(w, r, "/admin/pay", http.StatusSeeOther)
 		m.App.ErrorLog.Println("Failed to get user ID")
 		return
 	}
-
-	customerId, ok := m.App.Session.Get(r.Context(), "customerId").(string)
-	if !ok {
-		m.App.Session.Put(r.Context(), "error", "Failed to get customer ID")
-		http.Redirect(w, r, "/admin/add-witness", http.StatusSeeOther)
-		m.App.ErrorLog.Println("Failed to get customer ID")
-		return
-	}
-
-	err := r.ParseMultipartForm(10 << 20)
+	err := r.ParseForm()
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't process form")
-		http.Redirect(w, r, "/admin/add-witness", http.StatusSeeOther)
-		m.App.ErrorLog.Println(err)
+		http.Redirect(w, r, "/admin/pay", http.StatusSeeOther)
+		log.Println(err)
 		return
 	}
 
-	p, _ := strconv.Atoi(r.Form.Get("phone"))
-	witnessPhoto, _, _ := r.FormFile("witnessPhoto")
-
-	defer witnessPhoto.Close()
-	wtnImg, err := helpers.ProcessImage(witnessPhoto)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "error processing witness image")
-		http.Redirect(w, r, "/admin/add-witness", http.StatusSeeOther)
-		m.App.ErrorLog.Println(err)
-		return
-	}
+	amount, _ := strconv.ParseFloat(strings.TrimPrefix(r.Form.Get("payingamount"), "₵"), 64)
+	data := make(map[string]interface{})
 
-	witn := models.Witness{
-		CustomerId: customerId,
-		FirstName:  r.Form.Get("firstname"),
-		LastName:   r.Form.Get("lastname"),
-		Phone:      p,
-		Terms:      r.Form.Get("terms"),
-		Image:      wtnImg,
+	p := models.Payments{
+		CustomerId: r.Form.Get("customerId"),
+		Month:      r.Form.Get("month"),
+		Amount:     float64(amount),
 		UserId:     userId,
 	}
 
-	data := make(map[string]interface{})
 	form := forms.New(r.Form)
-	form.Required("firstname", "lastname", "phone", "terms")
+	form.Required("customerId", "month", "payingamount")
 	if !form.Valid() {
-		meta := models.FormMetaData{
-			Message: "Add Witness Information",
-			Button:  "Add Witness Information",
-			Url:     "/admin/add-witness",
+		m.App.Session.Put(r.Context(), "error", "One of the fields is empty")
+		metaData := models.FormMetaData{
 			Section: "Contract",
+			Message: "Add Payment Information",
+			Button:  "Add Payment",
+			Url:     "/admin/pay",
 		}
-
-		data["witness"] = witn
-		data["metadata"] = meta
-		render.Template(w, r, "witnessform.page.html", &models.TemplateData{
+		data["payment"] = p
+		data["metadata"] = metaData
+		render.Template(w, r, "paymentform.page.html", &models.TemplateData{
 			Form: form,
 			Data: data,
 		})
 		return
 	}
 
-	wtn, _ := m.DB.FetchWitness(witn.CustomerId)
-	if wtn.CustomerId == witn.CustomerId {
-		m.App.Session.Put(r.Context(), "error", "Witness with such ID already exist")
-		http.Redirect(w, r, "/admin/add-witness", http.StatusSeeOther)
-		m.App.InfoLog.Println("Witness with such ID already exist")
+	if p.Month == "The Month" {
+		m.App.Session.Put(r.Context(), "error", "Choose the month of payment!")
+		metaData := models.FormMetaData{
+			Section: "Contract",
+			Message: "Add Payment Information",
+			Button:  "Add Payment",
+			Url:     "/admin/pay",
+		}
+		data["payment"] = p
+		data["metadata"] = metaData
+		render.Template(w, r, "paymentform.page.html", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
 		return
 	}
 
-	wtn, err = m.DB.InsertWitnessData(witn)
+	var bal float64
+	err = m.audited(r).WithTx(r.Context(), func(repo repository.DatabaseRepo) error {
+		if err := repo.InsertPayment(p); err != nil {
+			return fmt.Errorf("inserting payment: %w", err)
+		}
+
+		cust, err := repo.FetchCustomer(p.CustomerId)
+		if err != nil {
+			return fmt.Errorf("fetching customer: %w", err)
+		}
+
+		if cust.Months != 0 {
+			cust.Months--
+		}
+
+		if err := repo.UpdateCustomer(cust); err != nil {
+			return fmt.Errorf("updating customer: %w", err)
+		}
+
+		bal, _ = customerDebt(repo, p.CustomerId)
+		if bal != 0.00 {
+			return nil
+		}
+
+		c := models.Customer{
+			CustomerId: p.CustomerId,
+			Status:     "off_contract",
+			UserId:     userId,
+		}
+		if err := repo.UpdateContactStatus(c); err != nil {
+			return fmt.Errorf("updating contract status: %w", err)
+		}
+
+		return nil
+	})
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Witness information could not be inserted!")
-		http.Redirect(w, r, "/admin/add-witness", http.StatusSeeOther)
+		m.App.Session.Put(r.Context(), "error", "error saving payment! try again.")
+		http.Redirect(w, r, "/admin/pay", http.StatusSeeOther)
 		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	data["witness"] = wtn
-	m.App.Session.Put(r.Context(), "witness", wtn)
-	m.App.Session.Put(r.Context(), "customerId", wtn.CustomerId)
-	m.App.Session.Put(r.Context(), "flash", "Witness information inserted successfully")
-	render.Template(w, r, "displayWitness.page.html", &models.TemplateData{
+	if bal == 0.00 {
+		data["payment"] = p
+		m.App.Session.Put(r.Context(), "payment", p)
+		m.App.Session.Put(r.Context(), "customerId", p.CustomerId)
+		m.App.Session.Put(r.Context(), "flash", "Customer has completed payment!")
+		render.Template(w, r, "displayPayment.page.html", &models.TemplateData{
+			Data: data,
+		})
+		return
+	}
+
+	data["payment"] = p
+	m.App.Session.Put(r.Context(), "payment", p)
+	m.App.Session.Put(r.Context(), "customerId", p.CustomerId)
+	m.App.Session.Put(r.Context(), "flash", "Customer's payment has been inserted!")
+	render.Template(w, r, "displayPayment.page.html", &models.TemplateData{
 		Data: data,
 	})
 }
 
-// UpdateWitness update witness information with changes by ID
-func (m *Repository) UpdateWitness(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseMultipartForm(10 << 20)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
-		http.Redirect(w, r, "/admin/add-witness", http.StatusSeeOther)
-		m.App.ErrorLog.Println(err)
-		return
+// CalcCustomerDebt calculates customer debt to the enterprise
+func (c *Repository) CalcCustomerDebt(customerId string) (float64, error) {
+	return customerDebt(c.DB, customerId)
+}
+
+// customerDebt calculates customer debt to the enterprise from what repo can see
+func customerDebt(repo repository.DatabaseRepo, customerId string) (float64, error) {
+	if customerId == "" {
+		return 0, errors.New("customer ID not provided")
+	}
+
+	custDebt, err := repo.CustomerDebt(customerId)
+	if err != nil {
+		return 0, errors.New("customer debt information can't be retrieved")
+	}
+
+	if len(custDebt) == 0 {
+		return 0, fmt.Errorf("customer with this id: %s does not owe", customerId)
+	}
+
+	custPymt, err := repo.CustomerPayment(customerId)
+	if err != nil {
+		return 0, errors.New("customer payments information can't be retrieved")
+	}
+
+	amount := 0.00
+	if len(custPymt) != 0 {
+		for _, v := range custPymt {
+			amount += v.Amount
+		}
+	}
+
+	balance := 0.00
+	for _, v := range custDebt {
+		balance += v.Balance
+	}
+
+	balance -= amount
+	return balance, nil
+}
+
+// ListPayments handles request for customer payment history in the database
+func (m *Repository) ListPayments(w http.ResponseWriter, r *http.Request) {
+	page := chi.URLParam(r, "page")
+	pg, _ := strconv.Atoi(page)
+	meta := models.FormMetaData{
+		Section: "Contract",
+		Url:     "/admin/list-payments/1",
 	}
 
-	userId := m.App.Session.Get(r.Context(), "user_id").(int)
-	p, _ := strconv.Atoi(r.Form.Get("phone"))
-	witnessImage, _, _ := r.FormFile("witnessPhoto")
-	defer witnessImage.Close()
+	data := make(map[string]any)
 
-	witnImg, err := helpers.ProcessImage(witnessImage)
+	pymt, err := m.DB.FetchPaymentsByPage(pg)
+
+	var p []models.Payments
+	for _, v := range pymt {
+		v.Amount = helpers.ToDecimalPlace(v.Amount, 2)
+		p = append(p, v)
+	}
+	data["payments"] = p
+	data["metadata"] = meta
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "error processing witness's image!")
-		http.Redirect(w, r, "/admin/add-witness", http.StatusSeeOther)
-		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "error", "Payments cannot be fetched!")
+		m.App.ErrorLog.Println("Payments cannot be fetched!", err)
+		render.Template(w, r, "displaypayments.page.html", &models.TemplateData{
+			Data: data,
+		})
 		return
 	}
-	witn := models.Witness{
-		CustomerId: r.Form.Get("cust_id"),
-		FirstName:  r.Form.Get("firstname"),
-		LastName:   r.Form.Get("lastname"),
-		Phone:      p,
-		Terms:      r.Form.Get("terms"),
-		Image:      witnImg,
-		UserId:     userId,
-	}
-
-	data := make(map[string]interface{})
-	form := forms.New(r.Form)
-	form.Required("cust_id", "firstname", "lastname", "phone", "terms")
-	if !form.Valid() {
-		meta := models.FormMetaData{
-			Message: "Edit Witness Information",
-			Button:  "Edit Witness Information",
-			Url:     "/admin/update-witness",
-			Section: "Contract",
-		}
-
-		data["witness"] = witn
-		data["metadata"] = meta
 
-		render.Template(w, r, "witnessform.page.html", &models.TemplateData{
-			Form: form,
+	if len(pymt) == 0 {
+		m.App.Session.Put(r.Context(), "error", "No payment was found!")
+		render.Template(w, r, "displaypayments.page.html", &models.TemplateData{
 			Data: data,
 		})
 		return
 	}
 
-	err = m.DB.UpdateWitness(witn)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Witness informaction could not be updated")
-		http.Redirect(w, r, "/admin/add-witness", http.StatusSeeOther)
-		m.App.ErrorLog.Println(err)
-		return
+	enterer, _ := m.DB.FetchUserById(pymt[0].UserId)
+	data["enterer"] = enterer
+
+	render.Template(w, r, "displaypayments.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// ReceiptPage handle request for receipt generation page
+func (m *Repository) ReceiptPage(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]any)
+	metaData := models.FormMetaData{
+		Section: "Contract",
+		Message: "Add Payment Information",
+		Button:  "Add Payment",
+		Url:     "/admin/generate-receipt",
 	}
 
-	data["witness"] = witn
-	m.App.Session.Put(r.Context(), "witness", witn)
-	m.App.Session.Put(r.Context(), "flash", "Witness information updated!")
-	render.Template(w, r, "displayWitness.page.html", &models.TemplateData{
+	data["metadata"] = metaData
+	render.Template(w, r, "terminateAgreeM.page.html", &models.TemplateData{
 		Data: data,
+		Form: forms.New(nil),
 	})
 }
 
-// ItemForm handles item form request
-func (m *Repository) ItemForm(w http.ResponseWriter, r *http.Request) {
+// PurchaseForm handles item form request for purchase
+func (m *Repository) PurchaseForm(w http.ResponseWriter, r *http.Request) {
 	data := make(map[string]interface{})
 	custId, _ := m.App.Session.Get(r.Context(), "customerId").(string)
 
 	prods, err := m.DB.FetchAllProduct()
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "Server error, retry again")
-		http.Redirect(w, r, "/add-item", http.StatusSeeOther)
+		http.Redirect(w, r, "/admin/add-purchase", http.StatusSeeOther)
 		return
 	}
 
+	var p []models.Product
+	for _, prod := range prods {
+		prod.Price = helpers.ToDecimalPlace(prod.Price, 2)
+		p = append(p, prod)
+	}
+
 	pt := models.PageTitle{
-		Main:        "Contract Form",
-		Sub:         "Contract",
-		Description: "Add Item",
-		PlaceHolder: "Deposit Amount",
+		Main:        "Purchase Form",
+		Sub:         "Purchase",
+		Description: "Add Purchase",
+		PlaceHolder: "Enter Amount",
 	}
 
-	if r.URL.Path == "/admin/edit-item" {
+	if r.URL.Path == "/admin/edit-purchase" {
 		itm, _ := m.App.Session.Get(r.Context(), "item").(models.Item)
 		metaData := models.FormMetaData{
-			Message: "Edit Selected Product",
-			Button:  "Patch Product",
-			Url:     "/admin/edit-item",
-			Section: "Contract",
-		}
-
-		if itm.Quantity == 0 {
-			itm.Quantity = 1
+			Message: "Edit Purchase",
+			Button:  "Patch Purchase",
+			Url:     "/admin/edit-purchase",
+			Section: "Purchase",
 		}
-
-		itm.Price *= float64(itm.Quantity)
-
 		data["pageTitle"] = pt
 		data["item"] = itm
-		data["products"] = prods
+		data["products"] = p
 		data["customerId"] = custId
 		data["metadata"] = metaData
 	} else {
 		metaData := models.FormMetaData{
 			Message: "Select Product",
-			Button:  "Post Product",
-			Url:     "/admin/add-item",
-			Section: "Contract",
+			Button:  "Post Purchase",
+			Url:     "/admin/add-purchase",
+			Section: "Purchase",
 		}
-
 		data["pageTitle"] = pt
-		data["products"] = prods
+		data["products"] = p
 		data["customerId"] = custId
 		data["metadata"] = metaData
 	}
@@ -1318,13 +3066,14 @@ func (m *Repository) ItemForm(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// PostItem handles the processing and saving of purchased items
-func (m *Repository) PostItem(w http.ResponseWriter, r *http.Request) {
+// Purchases
+// PostPurchase handle request for the processing of purchase
+func (m *Repository) PostPurchase(w http.ResponseWriter, r *http.Request) {
 	userId, ok := m.App.Session.Get(r.Context(), "user_id").(int)
 	data := make(map[string]interface{})
 	if !ok {
 		m.App.Session.Put(r.Context(), "error", "Failed to get user ID")
-		http.Redirect(w, r, "/admin/add-item", http.StatusSeeOther)
+		http.Redirect(w, r, "/admin/add-purchase", http.StatusSeeOther)
 		m.App.ErrorLog.Println("Failed to get user ID")
 		return
 	}
@@ -1332,137 +3081,33 @@ func (m *Repository) PostItem(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't process form")
-		http.Redirect(w, r, "/admin/add-item", http.StatusSeeOther)
-		log.Println(err)
-		return
-	}
-
-	var price float64
-	custId := r.Form.Get("cust_id")
-	serial := r.Form.Get("serial")
-	qty, _ := strconv.Atoi(r.Form.Get("quantity"))
-	deposit, _ := strconv.ParseFloat(strings.TrimPrefix(r.Form.Get("deposit"), "₵"), 64)
-	//qty, _ := strconv.Atoi(quantity)
-	prods, _ := m.App.Session.Pop(r.Context(), "products").([]models.Product)
-
-	form := forms.New(r.Form)
-
-	form.Required("cust_id", "serial", "deposit", "quantity")
-	if !form.Valid() {
-		data := make(map[string]interface{})
-		metaData := models.FormMetaData{
-			Message: "Select Product",
-			Button:  "Post Product",
-			Url:     "/admin/add-item",
-			Section: "Contract",
-		}
-		data["products"] = prods
-		data["customerId"] = custId
-		data["metadata"] = metaData
-
-		m.App.Session.Put(r.Context(), "products", prods)
-		m.App.Session.Put(r.Context(), "error", "Sorry, you took the wrong route!")
-		render.Template(w, r, "itemsform.page.html", &models.TemplateData{
-			Form: form,
-			Data: data,
-		})
-		return
-	}
-
-	//Can be refactored
-	for _, prod := range prods {
-		if prod.Serial == serial {
-			price = prod.Price
-			break
-		}
-	}
-
-	total := float64(qty) * float64(price)
-	item := models.Item{
-		CustomerId: custId,
-		Serial:     serial,
-		Price:      float64(price),
-		Quantity:   int(qty),
-		Deposit:    deposit,
-		Balance:    total - float64(deposit),
-		UserId:     userId,
-	}
-
-	prod := models.Product{
-		Serial: serial,
-		Units:  int32(qty),
-		UserId: userId,
-	}
-
-	err = m.DB.InsertItem(item)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Failed to insert customer items purchased")
-		http.Redirect(w, r, "/admin/add-item", http.StatusSeeOther)
-		m.App.ErrorLog.Println(err)
-		return
-	}
-
-	err = m.DB.DecreaseQuantity(prod)
-	if err != nil {
-		m.DB.DeleteProduct(item.Serial)
-		m.App.Session.Put(r.Context(), "error", "Failed to insert customer items purchased")
-		http.Redirect(w, r, "/admin/add-item", http.StatusSeeOther)
+		http.Redirect(w, r, "/admin/add-purchase", http.StatusSeeOther)
 		m.App.ErrorLog.Println(err)
 		return
 	}
-
-	item.Total = total
-	data["item"] = item
-	m.App.Session.Put(r.Context(), "item", item)
-	m.App.Session.Put(r.Context(), "flash", "customer item saved!")
-	render.Template(w, r, "displayItembought.page.html", &models.TemplateData{
-		Data: data,
-	})
-}
-
-// UpdateItem update items purchased on credit with changes by ID
-func (m *Repository) UpdateItem(w http.ResponseWriter, r *http.Request) {
-	userId, ok := m.App.Session.Get(r.Context(), "user_id").(int)
-	data := make(map[string]interface{})
-	if !ok {
-		m.App.Session.Put(r.Context(), "error", "Failed to get user ID")
-		http.Redirect(w, r, "/admin/edit-item", http.StatusSeeOther)
-		m.App.ErrorLog.Println("Failed to get user ID")
-		return
-	}
-
-	err := r.ParseForm()
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
-		http.Redirect(w, r, "/admin/edit-item", http.StatusSeeOther)
-		m.App.ErrorLog.Println("Error parsing form")
-		return
-	}
-
-	var price float64
-	custId := r.Form.Get("cust_id")
-	serial := r.Form.Get("serial")
-	quantity := r.Form.Get("quantity")
-	deposit, _ := strconv.ParseFloat(strings.TrimPrefix(r.Form.Get("deposit"), "₵"), 64)
-	qty, _ := strconv.Atoi(quantity)
+
+	serial := r.Form.Get("serial")
+	quantity, _ := strconv.Atoi(r.Form.Get("quantity"))
+	amount, _ := strconv.ParseFloat(r.Form.Get("amount"), 64)
 	prods, _ := m.App.Session.Pop(r.Context(), "products").([]models.Product)
 
 	form := forms.New(r.Form)
 
-	form.Required("cust_id", "serial", "deposit", "quantity")
+	form.Required("cust_id", "serial", "quantity", "price")
+	if quantity <= 0 {
+		form.Errors.Add("quantity", "Quantity must be a whole number above zero")
+	}
 	if !form.Valid() {
-		data := make(map[string]interface{})
 		metaData := models.FormMetaData{
 			Message: "Select Product",
-			Button:  "Patch Product",
-			Url:     "/admin/edit-item",
+			Button:  "Post Product",
+			Url:     "/admin/add-item",
 			Section: "Contract",
 		}
 		data["products"] = prods
-		data["customerId"] = custId
+		data["customerId"] = ""
 		data["metadata"] = metaData
 
-		m.App.Session.Put(r.Context(), "products", prods)
 		render.Template(w, r, "itemsform.page.html", &models.TemplateData{
 			Form: form,
 			Data: data,
@@ -1470,559 +3115,596 @@ func (m *Repository) UpdateItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//Can be refactored
-	for _, prod := range prods {
-		if prod.Serial == serial {
-			price = prod.Price
-			break
+	p := models.Purchases{
+		Serial:   serial,
+		Quantity: quantity,
+		Amount:   amount,
+		UserId:   userId,
+	}
+
+	err = m.audited(r).WithTx(r.Context(), func(repo repository.DatabaseRepo) error {
+		id, err := repo.InsertPurchase(p)
+		if err != nil {
+			return err
+		}
+
+		return repo.RecordStockMovement(models.StockMovement{
+			Serial:    serial,
+			Quantity:  -quantity,
+			Reason:    models.StockCashSale,
+			Reference: fmt.Sprintf("Purchase #%d", id),
+			UserId:    userId,
+		})
+	})
+	if errors.Is(err, repository.ErrInsufficientStock) {
+		data["pageTitle"] = models.PageTitle{
+			Main:        "Purchase Form",
+			Sub:         "Purchase",
+			Description: "Add Purchase",
+			PlaceHolder: "Enter Amount",
+		}
+		data["customerId"] = ""
+		data["metadata"] = models.FormMetaData{
+			Message: "Select Product",
+			Button:  "Post Purchase",
+			Url:     "/admin/add-purchase",
+			Section: "Purchase",
 		}
+		m.renderInsufficientStock(w, r, form, data, models.Item{
+			Serial:   serial,
+			Price:    amount / float64(quantity),
+			Quantity: quantity,
+		}, err)
+		return
 	}
 
-	total := float64(qty) * float64(price)
-	item := models.Item{
-		CustomerId: custId,
-		Serial:     serial,
-		Price:      float64(price),
-		Quantity:   int(qty),
-		Deposit:    float64(deposit),
-		Balance:    total - float64(deposit),
-		UserId:     userId,
+	if errors.Is(err, repository.ErrProductArchived) {
+		m.App.Session.Put(r.Context(), "error", "This product is archived and can no longer be sold")
+		http.Redirect(w, r, "/admin/add-purchase", http.StatusSeeOther)
+		return
 	}
 
-	err = m.DB.UpdateItem(item)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Purchased item could not be updated")
-		http.Redirect(w, r, "/admin/edit-item", http.StatusSeeOther)
+		m.App.Session.Put(r.Context(), "error", "Error inserting purchase! try again.")
+		http.Redirect(w, r, "/admin/add-purchase", http.StatusSeeOther)
 		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	item.Total = total
-	data["item"] = item
-	m.App.Session.Put(r.Context(), "flash", "customer item saved!")
-	render.Template(w, r, "displayItembought.page.html", &models.TemplateData{
-		Data: data,
-	})
+	m.App.Session.Put(r.Context(), "flash", "Customer's purchase is saved!")
+	http.Redirect(w, r, "/admin/add-purchase", http.StatusSeeOther)
 }
 
-// ListCustomers handles request for customer history in the database
-func (m *Repository) ListCustomers(w http.ResponseWriter, r *http.Request) {
+// ListPurchases handles request for customer purchase history in the database
+func (m *Repository) ListPurchases(w http.ResponseWriter, r *http.Request) {
 	page := chi.URLParam(r, "page")
 	pg, _ := strconv.Atoi(page)
 	if pg == 0 {
 		pg = 1
 	}
-	// user, ok := m.App.Session.Get(r.Context(), "user").(models.User)
-	// if !ok {
-	// 	m.App.Session.Put(r.Context(), "error", "You must logged in first!")
-	// 	m.App.ErrorLog.Println("user could be found in the session!")
-	// 	http.Redirect(w, r, "/", http.StatusSeeOther)
-	// 	return
-	// }
 	meta := models.FormMetaData{
-		Section: "Contract",
-		Url:     "/admin/list-customers/1",
+		Section: "Purchase",
+		Url:     "/admin/list-purchases/1",
 	}
 
 	data := make(map[string]any)
 
-	cust, err := m.DB.FetchCustomersByPage(pg)
-	data["customers"] = cust
+	p, err := m.DB.FetchPurchaseByPage(pg)
+	data["purchases"] = p
 	data["metadata"] = meta
-
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Customers cannot be fetched!")
-		m.App.ErrorLog.Println("Customers cannot be fetched!", err)
-		render.Template(w, r, "displaycustomers.page.html", &models.TemplateData{
+		m.App.Session.Put(r.Context(), "error", "Purchases cannot be fetched!")
+		m.App.ErrorLog.Println("Purchases cannot be fetched!", err)
+		render.Template(w, r, "displaypurchases.page.html", &models.TemplateData{
 			Data: data,
 		})
 		return
 	}
 
-	if len(cust) == 0 {
-		m.App.Session.Put(r.Context(), "error", "No customer was found!")
-		render.Template(w, r, "displaycustomers.page.html", &models.TemplateData{
+	if len(p) == 0 {
+		m.App.Session.Put(r.Context(), "error", "No purchase was found!")
+		render.Template(w, r, "displaypurchases.page.html", &models.TemplateData{
 			Data: data,
 		})
 		return
 	}
 
-	enterer, _ := m.DB.FetchUserById(cust[0].UserId)
+	var purch []models.Purchases
+	for _, v := range p {
+		v.Amount = helpers.ToDecimalPlace(v.Amount, 2)
+		purch = append(purch, v)
+	}
+
+	enterer, _ := m.DB.FetchUserById(purch[0].UserId)
+
+	data["purchases"] = purch
 	data["enterer"] = enterer
 
-	render.Template(w, r, "displaycustomers.page.html", &models.TemplateData{
+	render.Template(w, r, "displaypurchases.page.html", &models.TemplateData{
 		Data: data,
 	})
 }
 
-// Payments
-// PaymentForm handler handles payment form request
-func (m *Repository) PaymentForm(w http.ResponseWriter, r *http.Request) {
-	data := make(map[string]interface{})
+// ListUsers handles request for users information in the database
+func (m *Repository) ListUsers(w http.ResponseWriter, r *http.Request) {
+	meta := models.FormMetaData{
+		Section: "User",
+		Url:     "/admin/list-users",
+	}
 
-	if r.URL.Path == "/admin/edit-payment" {
-		pymt, _ := m.App.Session.Get(r.Context(), "payment").(models.Payments)
-		metaData := models.FormMetaData{
-			Section: "Contract",
-			Message: "Edit Payment Information",
-			Button:  "Patch Payment",
-			Url:     "/admin/update-payment",
-		}
+	data := make(map[string]any)
 
-		data["payment"] = pymt
-		data["metadata"] = metaData
-	} else {
-		metaData := models.FormMetaData{
-			Section: "Contract",
-			Message: "Add Payment Information",
-			Button:  "Post Payment",
-			Url:     "/admin/pay",
+	urs, err := m.DB.FetchAllUsers()
+	data["users"] = urs
+	data["metadata"] = meta
+
+	pending := make(map[int]models.ActivationToken)
+	data["pending"] = pending
+	if err == nil {
+		var tokens []models.ActivationToken
+		tokens, err = m.DB.FetchPendingActivations()
+		for _, t := range tokens {
+			pending[t.UserId] = t
 		}
-		data["payment"] = models.Customer{}
-		data["metadata"] = metaData
+	}
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Users cannot be fetched!")
+		m.App.ErrorLog.Println("Users cannot be fetched!", err)
+		render.Template(w, r, "displayusers.page.html", &models.TemplateData{
+			Data: data,
+		})
+		return
 	}
 
-	render.Template(w, r, "paymentform.page.html", &models.TemplateData{
+	if len(urs) == 0 {
+		m.App.Session.Put(r.Context(), "error", "No user was found!")
+		render.Template(w, r, "displayusers.page.html", &models.TemplateData{
+			Data: data,
+		})
+		return
+	}
+
+	render.Template(w, r, "displayusers.page.html", &models.TemplateData{
 		Data: data,
-		Form: forms.New(nil),
 	})
 }
 
-// PostPayments handles the request for payment processing
-func (m *Repository) PostPayments(w http.ResponseWriter, r *http.Request) {
-	userId, ok := m.App.Session.Get(r.Context(), "user_id").(int)
-	if !ok {
-		m.App.Session.Put(r.Context(), "error", "Failed to get user ID")
-		http.Redirect(w, r, "/admin/pay", http.StatusSeeOther)
-		m.App.ErrorLog.Println("Failed to get user ID")
-		return
-	}
-	err := r.ParseForm()
+// addTwoFactorData puts the two-factor state of the user on the edit page into data
+func (m *Repository) addTwoFactorData(data map[string]interface{}, user models.User) error {
+	u, err := m.DB.FetchUser(user.Username)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't process form")
-		http.Redirect(w, r, "/admin/pay", http.StatusSeeOther)
-		log.Println(err)
-		return
+		return err
 	}
 
-	amount, _ := strconv.ParseFloat(strings.TrimPrefix(r.Form.Get("payingamount"), "₵"), 64)
-	data := make(map[string]interface{})
-
-	p := models.Payments{
-		CustomerId: r.Form.Get("customerId"),
-		Month:      r.Form.Get("month"),
-		Amount:     float64(amount),
-		UserId:     userId,
+	data["totpEnabled"] = u.TOTPEnabled
+	if u.TOTPEnabled {
+		n, err := m.DB.CountRecoveryCodes(u.ID)
+		if err != nil {
+			return err
+		}
+		data["recoveryCodes"] = n
+		return nil
 	}
 
-	form := forms.New(r.Form)
-	form.Required("customerId", "month", "payingamount")
-	if !form.Valid() {
-		m.App.Session.Put(r.Context(), "error", "One of the fields is empty")
-		metaData := models.FormMetaData{
-			Section: "Contract",
-			Message: "Add Payment Information",
-			Button:  "Add Payment",
-			Url:     "/admin/pay",
-		}
-		data["payment"] = p
-		data["metadata"] = metaData
-		render.Template(w, r, "paymentform.page.html", &models.TemplateData{
-			Form: form,
-			Data: data,
-		})
-		return
+	secret, err := m.totpSecret(u.ID)
+	if err != nil || secret == "" {
+		return err
 	}
 
-	if p.Month == "The Month" {
-		m.App.Session.Put(r.Context(), "error", "Choose the month of payment!")
-		metaData := models.FormMetaData{
-			Section: "Contract",
-			Message: "Add Payment Information",
-			Button:  "Add Payment",
-			Url:     "/admin/pay",
-		}
-		data["payment"] = p
-		data["metadata"] = metaData
-		render.Template(w, r, "paymentform.page.html", &models.TemplateData{
-			Form: form,
-			Data: data,
-		})
-		return
+	qrCode, err := helpers.QRCode(totp.URL(twoFactorIssuer, u.Username, secret), 200)
+	if err != nil {
+		return err
 	}
 
-	err = m.DB.InsertPayment(p)
+	data["totpSecret"] = secret
+	data["totpQR"] = qrCode
+	return nil
+}
+
+// PostTwoFactorSetup starts two-factor enrolment with a new secret for the logged in user
+func (m *Repository) PostTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	user, _ := m.App.Session.Get(r.Context(), "user").(models.User)
+
+	secret, err := totp.GenerateSecret()
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "error inserting payments! try again.")
-		http.Redirect(w, r, "/admin/pay", http.StatusSeeOther)
+		m.App.Session.Put(r.Context(), "error", "Two-factor setup failed! try again")
+		http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
 		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	cust, err := m.DB.FetchCustomer(p.CustomerId)
+	// The secret is kept sealed with the server's key, without one it cannot be kept
+	sealed, err := totp.Seal(secret, m.App.TOTPKey)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "error fetching customer! try again.")
-		http.Redirect(w, r, "/admin/pay", http.StatusSeeOther)
+		m.App.Session.Put(r.Context(), "error", "Two-factor authentication is not set up on this server yet!")
+		http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
 		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	if cust.Months != 0 {
-		cust.Months--
-	}
-
-	err = m.DB.UpdateCustomer(cust)
+	err = m.audited(r).SetTOTPSecret(user.ID, sealed)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "error updating customer! try again.")
-		http.Redirect(w, r, "/admin/pay", http.StatusSeeOther)
+		m.App.Session.Put(r.Context(), "error", "Two-factor setup failed! try again")
+		http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
 		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	bal, _ := m.CalcCustomerDebt(p.CustomerId)
+	m.App.Session.Put(r.Context(), "flash", "Scan the QR code with your authenticator app")
+	http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
+}
 
-	if bal == 0.00 {
-		c := models.Customer{
-			CustomerId: p.CustomerId,
-			Status:     "off_contract",
-			UserId:     userId,
-		}
-		m.DB.UpdateContactStatus(c)
-		data["payment"] = p
-		m.App.Session.Put(r.Context(), "payment", p)
-		m.App.Session.Put(r.Context(), "customerId", p.CustomerId)
-		m.App.Session.Put(r.Context(), "flash", "Customer has completed payment!")
-		render.Template(w, r, "displayPayment.page.html", &models.TemplateData{
-			Data: data,
-		})
+// PostTwoFactorEnable confirms enrolment with a code from the authenticator app and
+// shows the recovery codes once
+func (m *Repository) PostTwoFactorEnable(w http.ResponseWriter, r *http.Request) {
+	user, _ := m.App.Session.Get(r.Context(), "user").(models.User)
+
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
+		http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Form Parse error", err)
 		return
 	}
 
-	data["payment"] = p
-	m.App.Session.Put(r.Context(), "payment", p)
-	m.App.Session.Put(r.Context(), "customerId", p.CustomerId)
-	m.App.Session.Put(r.Context(), "flash", "Customer's payment has been inserted!")
-	render.Template(w, r, "displayPayment.page.html", &models.TemplateData{
-		Data: data,
-	})
-}
+	secret, err := m.totpSecret(user.ID)
+	if err != nil || secret == "" {
+		m.App.Session.Put(r.Context(), "error", "Start the two-factor setup first!")
+		http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
 
-// CalcCustomerDebt calculates customer debt to the enterprise
-func (c *Repository) CalcCustomerDebt(customerId string) (float64, error) {
-	if customerId == "" {
-		return 0, errors.New("customer ID not provided")
+	step, ok := totp.Match(r.Form.Get("code"), secret, time.Now())
+	if ok {
+		ok, err = m.useTOTPStep(user.ID, step)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+	}
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Invalid code, try again!")
+		http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
+		return
 	}
 
-	custDebt, err := c.DB.CustomerDebt(customerId)
-	if err != nil {
-		return 0, errors.New("customer debt information can't be retrieved")
+	var codes, hashes []string
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := helpers.NewRecoveryCode()
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Two-factor setup failed! try again")
+			http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
+			m.App.ErrorLog.Println(err)
+			return
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, helpers.HashRecoveryCode(code))
 	}
 
-	if len(custDebt) == 0 {
-		return 0, fmt.Errorf("customer with this id: %s does not owe", customerId)
+	err = m.audited(r).EnableTOTP(user.ID, hashes)
+	if errors.Is(err, repository.ErrNoTOTPSecret) {
+		m.App.Session.Put(r.Context(), "error", "Two-factor setup was cancelled, start again")
+		http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
+		return
 	}
 
-	custPymt, err := c.DB.CustomerPayment(customerId)
 	if err != nil {
-		return 0, errors.New("customer payments information can't be retrieved")
+		m.App.Session.Put(r.Context(), "error", "Two-factor setup failed! try again")
+		http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
 	}
 
-	amount := 0.00
-	if len(custPymt) != 0 {
-		for _, v := range custPymt {
-			amount += v.Amount
-		}
-	}
+	user.TOTPEnabled = true
+	m.App.Session.Put(r.Context(), "user", user)
+	m.App.Session.Remove(r.Context(), "two_factor_setup")
 
-	balance := 0.00
-	for _, v := range custDebt {
-		balance += v.Balance
+	data := make(map[string]interface{})
+	data["codes"] = codes
+	data["metadata"] = models.FormMetaData{
+		Section: "User",
+		Url:     "/admin/edit-user",
 	}
 
-	balance -= amount
-	return balance, nil
+	m.App.Session.Put(r.Context(), "flash", "Two-factor authentication enabled!")
+	render.Template(w, r, "recoverycodes.page.html", &models.TemplateData{
+		Data: data,
+	})
 }
 
-// ListPayments handles request for customer payment history in the database
-func (m *Repository) ListPayments(w http.ResponseWriter, r *http.Request) {
-	page := chi.URLParam(r, "page")
-	pg, _ := strconv.Atoi(page)
-	meta := models.FormMetaData{
-		Section: "Contract",
-		Url:     "/admin/list-payments/1",
-	}
+// PostTwoFactorDisable turns off two-factor authentication for the logged in user
+func (m *Repository) PostTwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	user, _ := m.App.Session.Get(r.Context(), "user").(models.User)
 
-	data := make(map[string]any)
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
+		http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Form Parse error", err)
+		return
+	}
 
-	pymt, err := m.DB.FetchPaymentsByPage(pg)
+	required, err := m.twoFactorRequired(user)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Internal server error! try again")
+		http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
 
-	var p []models.Payments
-	for _, v := range pymt {
-		v.Amount = helpers.ToDecimalPlace(v.Amount, 2)
-		p = append(p, v)
+	if required {
+		m.App.Session.Put(r.Context(), "error", "Your access level must use two-factor authentication!")
+		http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
+		return
 	}
-	data["payments"] = p
-	data["metadata"] = meta
+
+	ok, err := m.checkSecondFactor(user, r.Form.Get("code"))
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Payments cannot be fetched!")
-		m.App.ErrorLog.Println("Payments cannot be fetched!", err)
-		render.Template(w, r, "displaypayments.page.html", &models.TemplateData{
-			Data: data,
-		})
+		m.App.Session.Put(r.Context(), "error", "Internal server error! try again")
+		http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	if len(pymt) == 0 {
-		m.App.Session.Put(r.Context(), "error", "No payment was found!")
-		render.Template(w, r, "displaypayments.page.html", &models.TemplateData{
-			Data: data,
-		})
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Invalid code, try again!")
+		http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
 		return
 	}
 
-	enterer, _ := m.DB.FetchUserById(pymt[0].UserId)
-	data["enterer"] = enterer
+	err = m.audited(r).DisableTOTP(user.ID)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Two-factor authentication couldn't be disabled! try again")
+		http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
 
-	render.Template(w, r, "displaypayments.page.html", &models.TemplateData{
-		Data: data,
-	})
+	user.TOTPEnabled = false
+	m.App.Session.Put(r.Context(), "user", user)
+	m.App.Session.Put(r.Context(), "flash", "Two-factor authentication disabled!")
+	http.Redirect(w, r, "/admin/edit-user", http.StatusSeeOther)
 }
 
-// ReceiptPage handle request for receipt generation page
-func (m *Repository) ReceiptPage(w http.ResponseWriter, r *http.Request) {
-	data := make(map[string]any)
-	metaData := models.FormMetaData{
-		Section: "Contract",
-		Message: "Add Payment Information",
-		Button:  "Add Payment",
-		Url:     "/admin/generate-receipt",
+// TwoFactorPolicy displays the access levels that must use two-factor authentication
+func (m *Repository) TwoFactorPolicy(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "User",
+		Url:     "/admin/two-factor-policy",
+		Message: "Access levels that must use two-factor authentication",
+		Button:  "Save Policy",
 	}
+	data["accessLevels"] = models.AccessLevels
 
-	data["metadata"] = metaData
-	render.Template(w, r, "terminateAgreeM.page.html", &models.TemplateData{
+	levels, err := m.DB.FetchTwoFactorLevels()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Two-factor policy cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+	}
+
+	required := make(map[string]bool)
+	for _, level := range levels {
+		required[level] = true
+	}
+	data["required"] = required
+
+	render.Template(w, r, "twofactorpolicy.page.html", &models.TemplateData{
 		Data: data,
-		Form: forms.New(nil),
 	})
 }
 
-// PurchaseForm handles item form request for purchase
-func (m *Repository) PurchaseForm(w http.ResponseWriter, r *http.Request) {
-	data := make(map[string]interface{})
-	custId, _ := m.App.Session.Get(r.Context(), "customerId").(string)
-
-	prods, err := m.DB.FetchAllProduct()
+// PostTwoFactorPolicy saves the access levels that must use two-factor authentication
+func (m *Repository) PostTwoFactorPolicy(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Server error, retry again")
-		http.Redirect(w, r, "/admin/add-purchase", http.StatusSeeOther)
+		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
+		http.Redirect(w, r, "/admin/two-factor-policy", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Form Parse error", err)
 		return
 	}
 
-	var p []models.Product
-	for _, prod := range prods {
-		prod.Price = helpers.ToDecimalPlace(prod.Price, 2)
-		p = append(p, prod)
-	}
-
-	pt := models.PageTitle{
-		Main:        "Purchase Form",
-		Sub:         "Purchase",
-		Description: "Add Purchase",
-		PlaceHolder: "Enter Amount",
+	var levels []string
+	for _, level := range r.Form["levels"] {
+		if !models.IsAccessLevel(level) {
+			m.App.Session.Put(r.Context(), "error", "Choose a valid user type!")
+			http.Redirect(w, r, "/admin/two-factor-policy", http.StatusSeeOther)
+			return
+		}
+		levels = append(levels, level)
 	}
 
-	if r.URL.Path == "/admin/edit-purchase" {
-		itm, _ := m.App.Session.Get(r.Context(), "item").(models.Item)
-		metaData := models.FormMetaData{
-			Message: "Edit Purchase",
-			Button:  "Patch Purchase",
-			Url:     "/admin/edit-purchase",
-			Section: "Purchase",
-		}
-		data["pageTitle"] = pt
-		data["item"] = itm
-		data["products"] = p
-		data["customerId"] = custId
-		data["metadata"] = metaData
-	} else {
-		metaData := models.FormMetaData{
-			Message: "Select Product",
-			Button:  "Post Purchase",
-			Url:     "/admin/add-purchase",
-			Section: "Purchase",
-		}
-		data["pageTitle"] = pt
-		data["products"] = p
-		data["customerId"] = custId
-		data["metadata"] = metaData
+	err = m.audited(r).UpdateTwoFactorLevels(levels, m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Two-factor policy couldn't be saved! try again")
+		http.Redirect(w, r, "/admin/two-factor-policy", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
 	}
 
-	m.App.Session.Put(r.Context(), "products", prods)
-	render.Template(w, r, "itemsform.page.html", &models.TemplateData{
-		Form: forms.New(nil),
-		Data: data,
-	})
+	m.App.Session.Put(r.Context(), "flash", "Two-factor policy saved!")
+	http.Redirect(w, r, "/admin/two-factor-policy", http.StatusSeeOther)
 }
 
-// Purchases
-// PostPurchase handle request for the processing of purchase
-func (m *Repository) PostPurchase(w http.ResponseWriter, r *http.Request) {
-	userId, ok := m.App.Session.Get(r.Context(), "user_id").(int)
+// APITokens lists the api tokens of the logged in user
+func (m *Repository) APITokens(w http.ResponseWriter, r *http.Request) {
 	data := make(map[string]interface{})
-	if !ok {
-		m.App.Session.Put(r.Context(), "error", "Failed to get user ID")
-		http.Redirect(w, r, "/admin/add-purchase", http.StatusSeeOther)
-		m.App.ErrorLog.Println("Failed to get user ID")
-		return
-	}
+	m.renderAPITokens(w, r, data)
+}
+
+// PostAPIToken issues a personal access token for the api to the logged in user
+func (m *Repository) PostAPIToken(w http.ResponseWriter, r *http.Request) {
+	user, _ := m.App.Session.Get(r.Context(), "user").(models.User)
 
 	err := r.ParseForm()
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't process form")
-		http.Redirect(w, r, "/admin/add-purchase", http.StatusSeeOther)
-		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
+		http.Redirect(w, r, "/admin/api-tokens", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Form Parse error", err)
 		return
 	}
 
-	serial := r.Form.Get("serial")
-	quantity, _ := strconv.Atoi(r.Form.Get("quantity"))
-	amount, _ := strconv.ParseFloat(r.Form.Get("amount"), 64)
-	prods, _ := m.App.Session.Pop(r.Context(), "products").([]models.Product)
-
-	form := forms.New(r.Form)
+	form := forms.New(r.PostForm)
+	form.Required("name")
+	if len(r.Form["scopes"]) == 0 {
+		form.Errors.Add("scopes", "Choose at least one permission")
+	}
 
-	form.Required("cust_id", "serial", "quantity", "price")
-	if !form.Valid() {
-		metaData := models.FormMetaData{
-			Message: "Select Product",
-			Button:  "Post Product",
-			Url:     "/admin/add-item",
-			Section: "Contract",
+	for _, scope := range r.Form["scopes"] {
+		if !user.Can(scope) {
+			form.Errors.Add("scopes", fmt.Sprintf("You don't have the %s permission", scope))
+			break
 		}
-		data["products"] = prods
-		data["customerId"] = ""
-		data["metadata"] = metaData
+	}
 
-		render.Template(w, r, "itemsform.page.html", &models.TemplateData{
-			Form: form,
-			Data: data,
-		})
+	var expiresAt time.Time
+	if days := r.Form.Get("days"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 {
+			form.Errors.Add("days", "Enter a number of days, or leave empty for no expiry")
+		} else {
+			expiresAt = time.Now().AddDate(0, 0, n)
+		}
 	}
 
-	p := models.Purchases{
-		Serial:   serial,
-		Quantity: quantity,
-		Amount:   amount,
-		UserId:   userId,
+	if !form.Valid() {
+		data := make(map[string]interface{})
+		data["form"] = form
+		m.renderAPITokens(w, r, data)
+		return
 	}
 
-	id, err := m.DB.InsertPurchase(p)
+	token, hash, err := helpers.NewToken()
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Error inserting purchase! try again.")
-		http.Redirect(w, r, "/admin/add-purchase", http.StatusSeeOther)
+		m.App.Session.Put(r.Context(), "error", "Token couldn't be created! try again")
+		http.Redirect(w, r, "/admin/api-tokens", http.StatusSeeOther)
 		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	prod := models.Product{
-		Serial: serial,
-		Units:  int32(quantity),
-		UserId: userId,
-	}
-
-	err = m.DB.DecreaseQuantity(prod)
+	_, err = m.audited(r).InsertAPIToken(models.APIToken{
+		UserId:    user.ID,
+		Name:      form.Get("name"),
+		TokenHash: hash,
+		Scopes:    r.Form["scopes"],
+		ExpiresAt: expiresAt,
+	})
 	if err != nil {
-		m.DB.DeletePurchase(id)
-		m.App.Session.Put(r.Context(), "error", "Error inserting purchase! try again.")
-		http.Redirect(w, r, "/admin/add-purchase", http.StatusSeeOther)
+		m.App.Session.Put(r.Context(), "error", "Token couldn't be created! try again")
+		http.Redirect(w, r, "/admin/api-tokens", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	m.App.Session.Put(r.Context(), "flash", "Customer's purchase is saved!")
-	http.Redirect(w, r, "/admin/add-purchase", http.StatusSeeOther)
+	data := make(map[string]interface{})
+	data["newToken"] = token
+	m.renderAPITokens(w, r, data)
 }
 
-// ListPurchases handles request for customer purchase history in the database
-func (m *Repository) ListPurchases(w http.ResponseWriter, r *http.Request) {
-	page := chi.URLParam(r, "page")
-	pg, _ := strconv.Atoi(page)
-	if pg == 0 {
-		pg = 1
-	}
-	meta := models.FormMetaData{
-		Section: "Purchase",
-		Url:     "/admin/list-purchases/1",
+// PostRevokeAPIToken revokes one of the logged in user's api tokens
+func (m *Repository) PostRevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
+		http.Redirect(w, r, "/admin/api-tokens", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Form Parse error", err)
+		return
 	}
 
-	data := make(map[string]any)
-
-	p, err := m.DB.FetchPurchaseByPage(pg)
-	data["purchases"] = p
-	data["metadata"] = meta
+	id, err := strconv.Atoi(r.Form.Get("token_id"))
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Purchases cannot be fetched!")
-		m.App.ErrorLog.Println("Purchases cannot be fetched!", err)
-		render.Template(w, r, "displaypurchases.page.html", &models.TemplateData{
-			Data: data,
-		})
+		m.App.Session.Put(r.Context(), "error", "Invalid token selected!")
+		http.Redirect(w, r, "/admin/api-tokens", http.StatusSeeOther)
 		return
 	}
 
-	if len(p) == 0 {
-		m.App.Session.Put(r.Context(), "error", "No purchase was found!")
-		render.Template(w, r, "displaypurchases.page.html", &models.TemplateData{
-			Data: data,
-		})
+	err = m.audited(r).RevokeAPIToken(id, m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Token couldn't be revoked! try again")
+		http.Redirect(w, r, "/admin/api-tokens", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
 		return
 	}
 
-	var purch []models.Purchases
-	for _, v := range p {
-		v.Amount = helpers.ToDecimalPlace(v.Amount, 2)
-		purch = append(purch, v)
+	m.App.Session.Put(r.Context(), "flash", "Token revoked!")
+	http.Redirect(w, r, "/admin/api-tokens", http.StatusSeeOther)
+}
+
+// renderAPITokens shows the api tokens page with the user's tokens added to data
+func (m *Repository) renderAPITokens(w http.ResponseWriter, r *http.Request, data map[string]interface{}) {
+	user, _ := m.App.Session.Get(r.Context(), "user").(models.User)
+
+	data["metadata"] = models.FormMetaData{
+		Section: "Account",
+		Url:     "/admin/api-tokens",
 	}
+	data["permissions"] = user.Permissions()
 
-	enterer, _ := m.DB.FetchUserById(purch[0].UserId)
+	tokens, err := m.DB.FetchUserAPITokens(user.ID)
+	data["tokens"] = tokens
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Tokens cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+	}
 
-	data["purchases"] = purch
-	data["enterer"] = enterer
+	form, ok := data["form"].(*forms.Form)
+	if !ok {
+		form = forms.New(nil)
+	}
 
-	render.Template(w, r, "displaypurchases.page.html", &models.TemplateData{
+	render.Template(w, r, "apitokens.page.html", &models.TemplateData{
 		Data: data,
+		Form: form,
 	})
 }
 
-// ListUsers handles request for users information in the database
-func (m *Repository) ListUsers(w http.ResponseWriter, r *http.Request) {
-	meta := models.FormMetaData{
+// Lockouts lists the recent login lockouts
+func (m *Repository) Lockouts(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]any)
+	data["metadata"] = models.FormMetaData{
 		Section: "User",
-		Url:     "/admin/list-users",
+		Url:     "/admin/lockouts",
 	}
 
-	data := make(map[string]any)
+	lockouts, err := m.DB.FetchLockouts()
+	data["lockouts"] = lockouts
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Lockouts cannot be fetched!")
+		m.App.ErrorLog.Println("Lockouts cannot be fetched!", err)
+	}
 
-	urs, err := m.DB.FetchAllUsers()
-	data["users"] = urs
-	data["metadata"] = meta
+	render.Template(w, r, "lockouts.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// PostUnlock lifts a login lockout
+func (m *Repository) PostUnlock(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Users cannot be fetched!")
-		m.App.ErrorLog.Println("Users cannot be fetched!", err)
-		render.Template(w, r, "displayusers.page.html", &models.TemplateData{
-			Data: data,
-		})
+		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
+		http.Redirect(w, r, "/admin/lockouts", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Form Parse error", err)
 		return
 	}
 
-	if len(urs) == 0 {
-		m.App.Session.Put(r.Context(), "error", "No user was found!")
-		render.Template(w, r, "displayusers.page.html", &models.TemplateData{
-			Data: data,
-		})
+	id, err := strconv.Atoi(r.Form.Get("lockout_id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid lockout selected!")
+		http.Redirect(w, r, "/admin/lockouts", http.StatusSeeOther)
 		return
 	}
 
-	render.Template(w, r, "displayusers.page.html", &models.TemplateData{
-		Data: data,
-	})
+	err = m.audited(r).UnlockAccount(id, m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Account couldn't be unlocked! try again")
+		http.Redirect(w, r, "/admin/lockouts", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Account unlocked!")
+	http.Redirect(w, r, "/admin/lockouts", http.StatusSeeOther)
 }
 
 // Backup and recovery
@@ -2039,8 +3721,9 @@ func (m *Repository) BackupAndRecovery(w http.ResponseWriter, r *http.Request) {
 		}
 		//sourceDB := "oseeea.go"
 
+		// The audit log is left out, a restore keeps the log as it is rather than rolling it back
 		cmd := exec.Command("pg_dump", "-Fc", "-h", "127.0.0.1", "-U", "postgres", "oseeea.go", "-f",
-			dumpFilePath)
+			dumpFilePath, "--exclude-table="+auditrepo.AuditTable)
 		cmd.Env = append(os.Environ(), "PGPASSWORD=Science@1992")
 
 		ouput, err := cmd.CombinedOutput()
@@ -2076,7 +3759,7 @@ func (m *Repository) BackupAndRecovery(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		err = m.DB.DropTables(tables)
+		err = m.audited(r).DropTables(tables)
 		if err != nil {
 			data["message"] = "internal server error, try again or reach out to the developer"
 			data["metadata"] = metaData
@@ -2112,3 +3795,390 @@ func (m *Repository) BackupAndRecovery(w http.ResponseWriter, r *http.Request) {
 		Form: forms.New(nil),
 	})
 }
+
+// Sessions lists the logged in user's web sessions
+func (m *Repository) Sessions(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "Account",
+		Url:     "/admin/sessions",
+	}
+	data["current"] = m.App.Session.Token(r.Context())
+
+	sessions, err := m.DB.FetchUserSessions(m.App.Session.GetInt(r.Context(), "user_id"))
+	data["sessions"] = sessions
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Sessions cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+	}
+
+	render.Template(w, r, "sessions.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// PostRevokeSession logs out one of the logged in user's other sessions
+func (m *Repository) PostRevokeSession(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
+		http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Form Parse error", err)
+		return
+	}
+
+	id, err := strconv.Atoi(r.Form.Get("session_id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid session selected!")
+		http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+		return
+	}
+
+	err = m.audited(r).RevokeUserSession(id, m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Session couldn't be logged out! try again")
+		http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Session logged out!")
+	http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+}
+
+// PostRevokeOtherSessions logs out every session of the logged in user but the current one
+func (m *Repository) PostRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	err := m.audited(r).RevokeUserSessions(m.App.Session.GetInt(r.Context(), "user_id"), m.App.Session.Token(r.Context()))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Sessions couldn't be logged out! try again")
+		http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Your other sessions have been logged out!")
+	http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+}
+
+// ActiveSessions lists the web sessions of every user
+func (m *Repository) ActiveSessions(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "User",
+		Url:     "/admin/active-sessions",
+	}
+	data["current"] = m.App.Session.Token(r.Context())
+
+	sessions, err := m.DB.FetchAllUserSessions()
+	data["sessions"] = sessions
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Sessions cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+	}
+
+	render.Template(w, r, "activesessions.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// PostEndSession logs out a session of any user, or every session of the user when no
+// session is given
+func (m *Repository) PostEndSession(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't processing form!")
+		http.Redirect(w, r, "/admin/active-sessions", http.StatusSeeOther)
+		m.App.ErrorLog.Println("Form Parse error", err)
+		return
+	}
+
+	userId, err := strconv.Atoi(r.Form.Get("user_id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid user selected!")
+		http.Redirect(w, r, "/admin/active-sessions", http.StatusSeeOther)
+		return
+	}
+
+	if id := r.Form.Get("session_id"); id != "" {
+		sessionId, err := strconv.Atoi(id)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Invalid session selected!")
+			http.Redirect(w, r, "/admin/active-sessions", http.StatusSeeOther)
+			return
+		}
+		err = m.audited(r).RevokeUserSession(sessionId, userId)
+	} else {
+		err = m.audited(r).RevokeUserSessions(userId, m.App.Session.Token(r.Context()))
+	}
+
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Sessions couldn't be logged out! try again")
+		http.Redirect(w, r, "/admin/active-sessions", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Sessions logged out!")
+	http.Redirect(w, r, "/admin/active-sessions", http.StatusSeeOther)
+}
+
+// AuditLog shows the audit log narrowed down by the query string, and downloads it as csv
+// when export=csv is given
+func (m *Repository) AuditLog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := models.AuditFilter{
+		Action:    strings.TrimSpace(q.Get("action")),
+		Entity:    q.Get("entity"),
+		EntityKey: strings.TrimSpace(q.Get("key")),
+	}
+	filter.UserId, _ = strconv.Atoi(q.Get("user"))
+	if from, err := time.ParseInLocation("2006-01-02", q.Get("from"), time.Local); err == nil {
+		filter.From = from
+	}
+	if to, err := time.ParseInLocation("2006-01-02", q.Get("to"), time.Local); err == nil {
+		filter.To = to.AddDate(0, 0, 1)
+	}
+
+	export := q.Get("export") == "csv"
+	if !export {
+		filter.Limit = 500
+	}
+
+	entries, err := m.DB.FetchAuditEntries(filter)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Audit log cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+		if export {
+			http.Redirect(w, r, "/admin/audit", http.StatusSeeOther)
+			return
+		}
+	}
+
+	if export {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=audit-%s.csv", time.Now().Format("20060102")))
+
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"Date", "User", "IP Address", "Action", "Entity", "Key", "Before", "After"})
+		for _, e := range entries {
+			_ = cw.Write([]string{
+				e.CreatedAt.Format(time.RFC3339), e.Username, e.IPAddress, e.Action, e.Entity, e.EntityKey, e.Before, e.After,
+			})
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+		return
+	}
+
+	urs, err := m.DB.FetchAllUsers()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "User",
+		Url:     "/admin/audit",
+	}
+	data["entries"] = entries
+	data["users"] = urs
+	data["entities"] = auditrepo.Entities
+	data["filter"] = filter
+
+	render.Template(w, r, "audit.page.html", &models.TemplateData{
+		Data: data,
+		Form: forms.New(q),
+	})
+}
+
+// StockMovements shows the stock ledger of the product with the serial in the query string, at
+// one location or at all of them, or the products whose units on hand disagree with their ledger when none is given
+func (m *Repository) StockMovements(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "Product",
+		Url:     "/admin/stock-movements",
+	}
+	locationId, _ := m.locationFilter(r, data)
+
+	serial := strings.TrimSpace(r.URL.Query().Get("serial"))
+	if serial == "" {
+		drift, err := m.DB.FetchStockDrift()
+		data["drift"] = drift
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Stock ledger cannot be checked!")
+			m.App.ErrorLog.Println(err)
+		}
+
+		render.Template(w, r, "stockmovements.page.html", &models.TemplateData{
+			Data: data,
+			Form: forms.New(r.URL.Query()),
+		})
+		return
+	}
+
+	prod, err := m.DB.FetchProduct(serial)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Sorry, couldn't find a product with this serial number!")
+		http.Redirect(w, r, "/admin/stock-movements", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	movements, err := m.DB.FetchStockMovements(serial, locationId)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Stock movements cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+	}
+
+	stock, err := m.DB.FetchProductStock(serial)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+
+	batches, err := m.DB.FetchProductBatches(serial)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+
+	ledger := 0
+	if len(movements) > 0 {
+		ledger = movements[len(movements)-1].Balance
+	}
+
+	units := int(prod.Units)
+	if locationId != 0 {
+		units = 0
+		for _, s := range stock {
+			if s.LocationId == locationId {
+				units = s.Units
+			}
+		}
+	}
+
+	data["product"] = prod
+	data["stock"] = stock
+	data["batches"] = batches
+	data["movements"] = movements
+	data["ledger"] = ledger
+	data["units"] = units
+	data["drifted"] = ledger != units
+
+	render.Template(w, r, "stockmovements.page.html", &models.TemplateData{
+		Data: data,
+		Form: forms.New(r.URL.Query()),
+	})
+}
+
+// renderInsufficientStock shows the sale form again with the units of the product left at the
+// user's location when the sale asks for more than is in stock there, cause tells when the
+// units are there but expired
+func (m *Repository) renderInsufficientStock(w http.ResponseWriter, r *http.Request, form *forms.Form, data map[string]interface{}, itm models.Item, cause error) {
+	prods, err := m.DB.FetchAllProduct()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+
+	stock, err := m.DB.FetchProductStock(itm.Serial)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+
+	// The session holds a copy of the user taken at login, the location may have changed since.
+	// The default location is listed first and is where a user without one sells from.
+	userId, _ := m.App.Session.Get(r.Context(), "user_id").(int)
+	user, err := m.userByID(userId)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+	left := models.LocationStock{}
+	for i, s := range stock {
+		if s.LocationId == user.LocationId || (i == 0 && user.LocationId == 0) {
+			left = s
+			break
+		}
+	}
+
+	itm.Price *= float64(itm.Quantity)
+	if errors.Is(cause, repository.ErrStockExpired) {
+		form.Errors.Add("quantity", fmt.Sprintf("There is not enough unexpired stock to satisfy this quantity at %s, see Expiring Stock", left.LocationName))
+	} else {
+		form.Errors.Add("quantity", fmt.Sprintf("There is not enough stock to satisfy this quantity, %d left at %s", left.Units, left.LocationName))
+	}
+
+	data["item"] = itm
+	data["products"] = prods
+
+	m.App.Session.Put(r.Context(), "products", prods)
+	m.App.Session.Put(r.Context(), "error", "Insufficient stock for this sale!")
+	render.Template(w, r, "itemsform.page.html", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// reorderLevels reads the optional reorder point and reorder quantity of a product form
+func reorderLevels(form *forms.Form) (point, qty int32) {
+	read := func(field string) int32 {
+		v := strings.TrimSpace(form.Get(field))
+		if v == "" {
+			return 0
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			form.Errors.Add(field, "Enter a whole number of units")
+			return 0
+		}
+		return int32(n)
+	}
+
+	return read("reorder_point"), read("reorder_qty")
+}
+
+// unitCost reads an optional cost per unit from the form, an empty field is no cost
+func unitCost(form *forms.Form, field string) float64 {
+	v := strings.TrimPrefix(strings.TrimSpace(form.Get(field)), "₵")
+	if v == "" {
+		return 0
+	}
+
+	cost, err := strconv.ParseFloat(v, 64)
+	if err != nil || cost < 0 {
+		form.Errors.Add(field, "Enter a cost of zero or more")
+		return 0
+	}
+	return helpers.ToDecimalPlace(cost, 2)
+}
+
+// StockAlerts shows the products at their reorder point and the restock alerts raised
+func (m *Repository) StockAlerts(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "Product",
+		Url:     "/admin/stock-alerts",
+	}
+
+	locationId, _ := m.locationFilter(r, data)
+
+	lowStock, err := m.DB.FetchLowStock(locationId)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Low stock products cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+	}
+
+	alerts, err := m.DB.FetchStockAlerts(100)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Restock alerts cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+	}
+
+	data["lowStock"] = lowStock
+	data["alerts"] = alerts
+
+	render.Template(w, r, "stockalerts.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/helpers"
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+func TestItemMovements(t *testing.T) {
+	old := models.Item{CustomerId: "C1", Serial: "A", Quantity: 3}
+	sale := func(serial string, qty int) models.StockMovement {
+		return models.StockMovement{Serial: serial, Quantity: qty, Reason: models.StockCreditSale, Reference: "Contract C1", UserId: 7}
+	}
+	back := func(serial string, qty int) models.StockMovement {
+		return models.StockMovement{Serial: serial, Quantity: qty, Reason: models.StockAdjustment, Reference: "Contract C1", UserId: 7}
+	}
+
+	tests := []struct {
+		name     string
+		serial   string
+		qty      int
+		expected []models.StockMovement
+	}{
+		{"more of the same product", "A", 5, []models.StockMovement{sale("A", -2)}},
+		{"less of the same product", "A", 1, []models.StockMovement{back("A", 2)}},
+		{"quantity unchanged", "A", 3, nil},
+		{"another product", "B", 2, []models.StockMovement{back("A", 3), sale("B", -2)}},
+	}
+
+	for _, tt := range tests {
+		got := itemMovements(old, tt.serial, tt.qty, 7)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: got %+v, expected %+v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+// activationRepo knows one activation token, stored by its hash
+type activationRepo struct {
+	repository.DatabaseRepo
+	tokenHash string
+	user      models.User
+}
+
+func (f *activationRepo) FetchActivationToken(tokenHash string) (models.ActivationToken, error) {
+	if tokenHash != f.tokenHash {
+		return models.ActivationToken{}, repository.ErrInvalidToken
+	}
+	return models.ActivationToken{UserId: f.user.ID}, nil
+}
+
+func (f *activationRepo) FetchUserById(id int) (string, error) {
+	return f.user.Username, nil
+}
+
+func (f *activationRepo) FetchUser(username string) (models.User, error) {
+	return f.user, nil
+}
+
+func TestActivationUser(t *testing.T) {
+	token, hash, err := helpers.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Repository{DB: &activationRepo{tokenHash: hash, user: models.User{ID: 4, Username: "ama"}}}
+
+	user, err := m.activationUser(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "ama" {
+		t.Errorf("got user %s, expected ama", user.Username)
+	}
+
+	for _, bad := range []string{"", hash, token + "x"} {
+		if _, err := m.activationUser(bad); !errors.Is(err, repository.ErrInvalidToken) {
+			t.Errorf("%q: got %v, expected %v", bad, err, repository.ErrInvalidToken)
+		}
+	}
+}
+
+// usersRepo holds the users in memory
+type usersRepo struct {
+	repository.DatabaseRepo
+	users []models.User
+}
+
+func (f *usersRepo) FetchAllUsers() ([]models.User, error) {
+	return f.users, nil
+}
+
+func TestLastActiveOwner(t *testing.T) {
+	owner := models.User{ID: 1, Username: "ama", AccessLevel: models.AccessOwner}
+	disabled := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		others   []models.User
+		expected bool
+	}{
+		{"only owner", nil, true},
+		{"another active owner", []models.User{{ID: 2, AccessLevel: models.AccessOwner}}, false},
+		{"another owner from before roles", []models.User{{ID: 2, AccessLevel: "superuser"}}, false},
+		{"another owner deactivated", []models.User{{ID: 2, AccessLevel: models.AccessOwner, DisabledAt: disabled}}, true},
+		{"another owner deleted", []models.User{{ID: 2, AccessLevel: models.AccessOwner, DeletedAt: disabled}}, true},
+		{"only managers besides", []models.User{{ID: 2, AccessLevel: models.AccessManager}}, true},
+	}
+
+	for _, tt := range tests {
+		m := &Repository{DB: &usersRepo{users: append([]models.User{owner}, tt.others...)}}
+		got, err := m.lastActiveOwner(owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.expected {
+			t.Errorf("%s: got %t, expected %t", tt.name, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/jofosuware/small-business-management-app/internal/helpers"
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/render"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// Product images are kept scaled down to fit within these many pixels, in full and as thumbnails
+const (
+	productImageSize     = 1024
+	productThumbnailSize = 160
+)
+
+// productImagesUpload is the most bytes one upload of product images may send
+const productImagesUpload = 50 << 20
+
+// ProductImages shows the images of the product with the serial in the query string, with a
+// form to add more for those who manage products
+func (m *Repository) ProductImages(w http.ResponseWriter, r *http.Request) {
+	serial := r.URL.Query().Get("serial")
+
+	prod, err := m.DB.FetchProduct(serial)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			m.App.ErrorLog.Println(err)
+		}
+		m.App.Session.Put(r.Context(), "error", "No product with such serial number found")
+		http.Redirect(w, r, "/admin/list-products/1", http.StatusSeeOther)
+		return
+	}
+
+	images, err := m.DB.FetchProductImages(serial)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Product images cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+	}
+
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "Product",
+		Url:     "/admin/product-images",
+	}
+	data["product"] = prod
+	data["images"] = images
+
+	render.Template(w, r, "productimages.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// PostProductImages adds the uploaded photos to a product, the first image of a product becomes
+// its primary image
+func (m *Repository) PostProductImages(w http.ResponseWriter, r *http.Request) {
+	userId, _ := m.App.Session.Get(r.Context(), "user_id").(int)
+
+	r.Body = http.MaxBytesReader(w, r.Body, productImagesUpload)
+	err := r.ParseMultipartForm(20 << 20)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "The images are too large to upload!")
+		http.Redirect(w, r, "/admin/list-products/1", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	serial := r.Form.Get("serial")
+	back := "/admin/product-images?serial=" + url.QueryEscape(serial)
+
+	files := r.MultipartForm.File["images"]
+	if len(files) == 0 {
+		m.App.Session.Put(r.Context(), "error", "Choose the images to upload!")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	added := 0
+	for _, fh := range files {
+		file, err := fh.Open()
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			continue
+		}
+
+		image, thumbnail, err := helpers.ProductImage(file, productImageSize, productThumbnailSize)
+		file.Close()
+		if errors.Is(err, helpers.ErrImageTooLarge) {
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf("%s has too many pixels, the most allowed is %d megapixels!", fh.Filename, helpers.MaxImagePixels/1_000_000))
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf("%s is not a jpeg or png image!", fh.Filename))
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			m.App.ErrorLog.Println(err)
+			return
+		}
+
+		_, err = m.audited(r).InsertProductImage(models.ProductImage{
+			Serial: serial,
+			UserId: userId,
+		}, image, thumbnail)
+		if errors.Is(err, sql.ErrNoRows) {
+			m.App.Session.Put(r.Context(), "error", "No product with such serial number found")
+			http.Redirect(w, r, "/admin/list-products/1", http.StatusSeeOther)
+			return
+		}
+		if errors.Is(err, repository.ErrImageLimit) {
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf("%d images added, the product has as many images as it can have", added))
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Images could not be saved!")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			m.App.ErrorLog.Println(err)
+			return
+		}
+		added++
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("%d images added", added))
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// PostPrimaryProductImage makes an image the one shown for its product in the product list
+func (m *Repository) PostPrimaryProductImage(w http.ResponseWriter, r *http.Request) {
+	m.changeProductImage(w, r, "Primary image changed", m.audited(r).SetPrimaryProductImage)
+}
+
+// PostDeleteProductImage removes an image of a product
+func (m *Repository) PostDeleteProductImage(w http.ResponseWriter, r *http.Request) {
+	m.changeProductImage(w, r, "Image removed", m.audited(r).DeleteProductImage)
+}
+
+// changeProductImage applies change to the image with the posted id and goes back to the images
+// of its product
+func (m *Repository) changeProductImage(w http.ResponseWriter, r *http.Request, done string, change func(id int) error) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/list-products/1", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	back := "/admin/product-images?serial=" + url.QueryEscape(r.Form.Get("serial"))
+
+	id, _ := strconv.Atoi(r.Form.Get("id"))
+	err = change(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "This image no longer exists")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "The image could not be changed!")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", done)
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// ProductImage serves a product image by id. The image with an id never changes, so browsers
+// are told to keep it.
+func (m *Repository) ProductImage(w http.ResponseWriter, r *http.Request) {
+	m.serveProductImage(w, r, false)
+}
+
+// ProductThumbnail serves the thumbnail of a product image by id
+func (m *Repository) ProductThumbnail(w http.ResponseWriter, r *http.Request) {
+	m.serveProductImage(w, r, true)
+}
+
+// serveProductImage writes the image, or thumbnail, with the id in the path unless the browser
+// has it already
+func (m *Repository) serveProductImage(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	etag := "product-image-" + strconv.Itoa(id)
+	if thumbnail {
+		etag += "-thumb"
+	}
+	if helpers.ImageCached(w, r, etag) {
+		return
+	}
+
+	img, err := m.DB.FetchProductImageData(id, thumbnail)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			m.App.ErrorLog.Println(err)
+		}
+		w.Header().Del("Cache-Control")
+		w.Header().Del("ETag")
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	_, _ = w.Write(img)
+}
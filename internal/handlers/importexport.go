@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/forms"
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/productfile"
+	"github.com/jofosuware/small-business-management-app/internal/render"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// ImportProducts shows the upload form of the product import, and the column mapping of the
+// file uploaded last
+func (m *Repository) ImportProducts(w http.ResponseWriter, r *http.Request) {
+	sheet, _ := m.App.Session.Get(r.Context(), "import_sheet").(productfile.Sheet)
+	m.renderImport(w, r, forms.New(nil), sheet, productfile.Guess(sheet.Header), nil)
+}
+
+// PostUploadProducts reads an uploaded csv or xlsx file and keeps it in the session while its
+// columns are mapped
+func (m *Repository) PostUploadProducts(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(10 << 20)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "The file is too large to import!")
+		http.Redirect(w, r, "/admin/import-products", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Choose a csv or xlsx file to import!")
+		http.Redirect(w, r, "/admin/import-products", http.StatusSeeOther)
+		return
+	}
+	defer file.Close()
+
+	sheet, err := productfile.Read(file, header.Filename)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("%s cannot be read: %v", header.Filename, err))
+		http.Redirect(w, r, "/admin/import-products", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "import_sheet", sheet)
+	http.Redirect(w, r, "/admin/import-products", http.StatusSeeOther)
+}
+
+// PostPreviewImport checks every row of the uploaded file with the posted column mapping and
+// lists what importing it would do, nothing is saved
+func (m *Repository) PostPreviewImport(w http.ResponseWriter, r *http.Request) {
+	sheet, form, mapping, ok := m.importMapping(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := m.importRows(m.DB, sheet, mapping)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Products cannot be fetched!")
+		http.Redirect(w, r, "/admin/import-products", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.renderImport(w, r, form, sheet, mapping, rows)
+}
+
+// PostImportProducts adds or updates the products of the valid rows of the uploaded file in
+// one transaction, rows with errors are skipped
+func (m *Repository) PostImportProducts(w http.ResponseWriter, r *http.Request) {
+	sheet, _, mapping, ok := m.importMapping(w, r)
+	if !ok {
+		return
+	}
+
+	var result productfile.Result
+	err := m.audited(r).WithTx(r.Context(), func(repo repository.DatabaseRepo) error {
+		rows, err := m.importRows(repo, sheet, mapping)
+		if err != nil {
+			return err
+		}
+		result, err = productfile.Import(repo, rows, m.App.Session.GetInt(r.Context(), "user_id"))
+		return err
+	})
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Nothing was imported: %v", err))
+		http.Redirect(w, r, "/admin/import-products", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Remove(r.Context(), "import_sheet")
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("%d products added, %d updated and %d rows skipped!",
+		result.Created, result.Updated, result.Skipped))
+	http.Redirect(w, r, "/admin/list-products/1", http.StatusSeeOther)
+}
+
+// ExportProducts downloads the whole catalogue with its current stock as csv, or as xlsx when
+// format=xlsx is given, cost prices are only included for users who can view reports
+func (m *Repository) ExportProducts(w http.ResponseWriter, r *http.Request) {
+	format := productfile.CSV
+	if r.URL.Query().Get("format") == productfile.XLSX {
+		format = productfile.XLSX
+	}
+
+	products, err := productfile.Products(m.DB)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Products cannot be fetched!")
+		http.Redirect(w, r, "/admin/list-products/1", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	user, _ := m.App.Session.Get(r.Context(), "user").(models.User)
+
+	contentType := "text/csv"
+	if format == productfile.XLSX {
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=products-%s.%s", time.Now().Format("20060102"), format))
+
+	err = productfile.Write(w, format, products, user.Can(models.PermViewReports))
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+}
+
+// importMapping reads the uploaded file from the session and the column mapping from the form,
+// the mapping page is shown again when the mapping has problems
+func (m *Repository) importMapping(w http.ResponseWriter, r *http.Request) (productfile.Sheet, *forms.Form, productfile.Mapping, bool) {
+	sheet, ok := m.App.Session.Get(r.Context(), "import_sheet").(productfile.Sheet)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Upload the file to import first!")
+		http.Redirect(w, r, "/admin/import-products", http.StatusSeeOther)
+		return sheet, nil, nil, false
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/import-products", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return sheet, nil, nil, false
+	}
+
+	form := forms.New(r.PostForm)
+	mapping := productfile.ParseMapping(r.PostForm, len(sheet.Header))
+	for _, problem := range mapping.Check(sheet.Header) {
+		form.Errors.Add("mapping", problem)
+	}
+	if !form.Valid() {
+		m.renderImport(w, r, form, sheet, mapping, nil)
+		return sheet, form, mapping, false
+	}
+
+	return sheet, form, mapping, true
+}
+
+// importRows checks the rows of the uploaded file against the products in the catalogue
+func (m *Repository) importRows(repo repository.DatabaseRepo, sheet productfile.Sheet, mapping productfile.Mapping) ([]productfile.Row, error) {
+	products, err := productfile.Products(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]models.Product, len(products))
+	for _, p := range products {
+		existing[p.Serial] = p
+	}
+
+	return productfile.Check(sheet, mapping, existing), nil
+}
+
+// renderImport shows the product import page, with the column mapping once a file is uploaded
+// and the checked rows once the import is previewed
+func (m *Repository) renderImport(w http.ResponseWriter, r *http.Request, form *forms.Form, sheet productfile.Sheet, mapping productfile.Mapping, rows []productfile.Row) {
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "Product",
+		Url:     "/admin/import-products",
+	}
+
+	var summary productfile.Result
+	for _, row := range rows {
+		switch {
+		case !row.Valid():
+			summary.Skipped++
+		case row.New:
+			summary.Created++
+		default:
+			summary.Updated++
+		}
+	}
+
+	data["sheet"] = sheet
+	data["sample"] = sheet.Sample(3)
+	data["mapping"] = mapping
+	data["fields"] = productfile.Fields
+	data["attribute"] = productfile.Attribute
+	data["rows"] = rows
+	data["summary"] = summary
+
+	render.Template(w, r, "importproducts.page.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/forms"
+	"github.com/jofosuware/small-business-management-app/internal/labels"
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/render"
+)
+
+// maxLabelCopies is how many labels of one product a sheet can be asked for
+const maxLabelCopies = 500
+
+// Barcode serves the Code 128 barcode of a product's serial number as a PNG image, or its QR
+// code when type=qr is given
+func (m *Repository) Barcode(w http.ResponseWriter, r *http.Request) {
+	kind := labels.Code128
+	if r.URL.Query().Get("type") == labels.QR {
+		kind = labels.QR
+	}
+
+	p, err := m.DB.FetchProduct(r.URL.Query().Get("serial"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	img, err := labels.Image(p.Serial, kind)
+	if err != nil {
+		http.Error(w, "The serial number cannot be encoded", http.StatusUnprocessableEntity)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	_, _ = w.Write(img)
+}
+
+// Labels lists the products matching the query string so the ones to print labels for can be
+// chosen
+func (m *Repository) Labels(w http.ResponseWriter, r *http.Request) {
+	filter := models.ParseProductFilter(r.URL.Query())
+	filter.Limit = 50
+
+	products, err := m.DB.FetchProducts(filter)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Products cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+	}
+
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "Product",
+		Url:     "/admin/labels",
+	}
+	data["products"] = products
+	data["filter"] = filter
+	data["perSheet"] = labels.PerSheet
+
+	render.Template(w, r, "labels.page.html", &models.TemplateData{
+		Data: data,
+		Form: forms.New(r.URL.Query()),
+	})
+}
+
+// PostLabels downloads a pdf sheet of labels for the chosen products, each chosen serial is
+// posted with the number of copies wanted as copies_<serial>
+func (m *Repository) PostLabels(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/labels", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	kind := labels.Code128
+	if r.Form.Get("type") == labels.QR {
+		kind = labels.QR
+	}
+	skip, _ := strconv.Atoi(r.Form.Get("skip"))
+
+	var sheet []labels.Label
+	for _, serial := range r.Form["serial"] {
+		copies, err := strconv.Atoi(r.Form.Get("copies_" + serial))
+		if err != nil || copies < 1 || copies > maxLabelCopies {
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Ask for between 1 and %d labels of %s!", maxLabelCopies, serial))
+			http.Redirect(w, r, "/admin/labels", http.StatusSeeOther)
+			return
+		}
+
+		p, err := m.DB.FetchProduct(serial)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Product %s cannot be found!", serial))
+			http.Redirect(w, r, "/admin/labels", http.StatusSeeOther)
+			m.App.ErrorLog.Println(err)
+			return
+		}
+
+		for i := 0; i < copies; i++ {
+			sheet = append(sheet, labels.Label{Serial: p.Serial, Name: p.Name, Price: p.Price})
+		}
+	}
+
+	if len(sheet) == 0 {
+		m.App.Session.Put(r.Context(), "error", "Choose the products to print labels for!")
+		http.Redirect(w, r, "/admin/labels", http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=labels-%s.pdf", time.Now().Format("20060102-1504")))
+
+	err = labels.Sheet(w, sheet, kind, skip)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+}
+
+// scanResult is the reply to a scanned serial number
+type scanResult struct {
+	OK      bool            `json:"ok"`
+	Message string          `json:"message,omitempty"`
+	Product *scannedProduct `json:"product,omitempty"`
+}
+
+// scannedProduct is the part of a product the item and stock forms fill in from a scan
+type scannedProduct struct {
+	Serial   string  `json:"serial"`
+	Name     string  `json:"name"`
+	Price    float64 `json:"price"`
+	Units    int32   `json:"units"`
+	Archived bool    `json:"archived"`
+}
+
+// ScanProduct looks up the product with a scanned or typed serial number and replies with it
+// as json, for the scan input of the item and stock forms
+func (m *Repository) ScanProduct(w http.ResponseWriter, r *http.Request) {
+	serial := r.URL.Query().Get("serial")
+
+	var result scanResult
+	p, err := m.DB.FetchProduct(serial)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		m.App.ErrorLog.Println(err)
+	}
+	if err != nil || serial == "" {
+		result.Message = fmt.Sprintf("No product has the serial number %s", serial)
+	} else {
+		result.OK = true
+		result.Product = &scannedProduct{Serial: p.Serial, Name: p.Name, Price: p.Price, Units: p.Units, Archived: p.IsArchived()}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(result)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+}
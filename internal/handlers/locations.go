@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jofosuware/small-business-management-app/internal/forms"
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/render"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// Locations shows the places stock is kept with a form to add one, or to edit the one with the
+// id in the query string
+func (m *Repository) Locations(w http.ResponseWriter, r *http.Request) {
+	location := models.Location{}
+	if id, _ := strconv.Atoi(r.URL.Query().Get("id")); id != 0 {
+		l, err := m.DB.FetchLocation(id)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Location cannot be found!")
+			http.Redirect(w, r, "/admin/locations", http.StatusSeeOther)
+			m.App.ErrorLog.Println(err)
+			return
+		}
+		location = l
+	}
+
+	m.renderLocations(w, r, forms.New(nil), location)
+}
+
+// PostLocation adds a location, or saves the changes to an existing one
+func (m *Repository) PostLocation(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/locations", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	location := models.Location{
+		Name:      strings.TrimSpace(r.Form.Get("name")),
+		Address:   strings.TrimSpace(r.Form.Get("address")),
+		IsDefault: r.Form.Get("is_default") != "",
+	}
+	location.ID, _ = strconv.Atoi(r.Form.Get("location_id"))
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+	if !form.Valid() {
+		m.renderLocations(w, r, form, location)
+		return
+	}
+
+	if location.ID == 0 {
+		_, err = m.audited(r).InsertLocation(location)
+	} else {
+		err = m.audited(r).UpdateLocation(location)
+	}
+	if errors.Is(err, repository.ErrDuplicate) {
+		form.Errors.Add("name", "A location with this name already exists")
+		m.renderLocations(w, r, form, location)
+		return
+	}
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Location could not be saved!")
+		http.Redirect(w, r, "/admin/locations", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Location %s saved!", location.Name))
+	http.Redirect(w, r, "/admin/locations", http.StatusSeeOther)
+}
+
+// renderLocations shows the location list and the form to add or edit one
+func (m *Repository) renderLocations(w http.ResponseWriter, r *http.Request, form *forms.Form, location models.Location) {
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "Product",
+		Url:     "/admin/locations",
+	}
+
+	locations, err := m.DB.FetchLocations()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Locations cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+	}
+
+	data["locations"] = locations
+	data["location"] = location
+
+	render.Template(w, r, "locations.page.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// StockLevels shows the units of every product at the location in the query string, or at each
+// location and in total when none is given, and downloads them as csv when export=csv is given
+func (m *Repository) StockLevels(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "Product",
+		Url:     "/admin/stock-levels",
+	}
+
+	locationId, locations := m.locationFilter(r, data)
+
+	levels, err := m.DB.FetchStockLevels()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Stock levels cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+	}
+
+	if r.URL.Query().Get("export") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=stock-levels.csv")
+
+		columns := locations
+		if locationId != 0 {
+			columns = nil
+			for _, l := range locations {
+				if l.ID == locationId {
+					columns = append(columns, l)
+				}
+			}
+		}
+
+		header := []string{"Serial", "Name", "Cost Price"}
+		for _, l := range columns {
+			header = append(header, l.Name)
+		}
+		if locationId == 0 {
+			header = append(header, "Total")
+		}
+		header = append(header, "Value")
+
+		cw := csv.NewWriter(w)
+		_ = cw.Write(header)
+		for _, s := range levels {
+			row := []string{s.Serial, s.Name, strconv.FormatFloat(s.CostPrice, 'f', 2, 64)}
+			for _, l := range columns {
+				row = append(row, strconv.Itoa(s.Locations[l.ID]))
+			}
+			if locationId == 0 {
+				row = append(row, strconv.Itoa(s.Total))
+			}
+			row = append(row, strconv.FormatFloat(s.Value(locationId), 'f', 2, 64))
+			_ = cw.Write(row)
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+		return
+	}
+
+	var units int
+	var value float64
+	for _, s := range levels {
+		units += s.Units(locationId)
+		value += s.Value(locationId)
+	}
+
+	data["levels"] = levels
+	data["units"] = units
+	data["value"] = value
+
+	render.Template(w, r, "stocklevels.page.html", &models.TemplateData{
+		Data: data,
+		Form: forms.New(r.URL.Query()),
+	})
+}
+
+// locationFilter reads the location a stock report is narrowed down to from the query string,
+// zero for every location, and adds the locations to choose from to data
+func (m *Repository) locationFilter(r *http.Request, data map[string]interface{}) (int, []models.Location) {
+	locations, err := m.DB.FetchLocations()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+
+	locationId, _ := strconv.Atoi(r.URL.Query().Get("location"))
+	data["locations"] = locations
+	data["locationId"] = locationId
+
+	return locationId, locations
+}
+
+// StockTransfers lists the stock transfers, optionally those with one status
+func (m *Repository) StockTransfers(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "Product",
+		Url:     "/admin/stock-transfers",
+	}
+
+	status := r.URL.Query().Get("status")
+	transfers, err := m.DB.FetchStockTransfers(status)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Stock transfers cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+	}
+
+	data["transfers"] = transfers
+	data["statuses"] = []models.StockTransfer{
+		{Status: models.TransferDraft},
+		{Status: models.TransferTransferred},
+	}
+
+	render.Template(w, r, "stocktransfers.page.html", &models.TemplateData{
+		Data: data,
+		Form: forms.New(r.URL.Query()),
+	})
+}
+
+// StockTransfer shows the stock transfer with the id in the query string, a draft can be edited
+// and transferred. Without an id it shows a new draft.
+func (m *Repository) StockTransfer(w http.ResponseWriter, r *http.Request) {
+	t := models.StockTransfer{Status: models.TransferDraft}
+	if id, _ := strconv.Atoi(r.URL.Query().Get("id")); id != 0 {
+		transfer, err := m.DB.FetchStockTransfer(id)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				m.App.ErrorLog.Println(err)
+			}
+			m.App.Session.Put(r.Context(), "error", "Stock transfer cannot be found!")
+			http.Redirect(w, r, "/admin/stock-transfers", http.StatusSeeOther)
+			return
+		}
+		t = transfer
+	}
+
+	m.renderStockTransfer(w, r, forms.New(nil), t)
+}
+
+// PostStockTransfer saves a draft stock transfer
+func (m *Repository) PostStockTransfer(w http.ResponseWriter, r *http.Request) {
+	userId, _ := m.App.Session.Get(r.Context(), "user_id").(int)
+
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/stock-transfers", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("from_id", "to_id")
+
+	t := models.StockTransfer{
+		Status: models.TransferDraft,
+		Notes:  strings.TrimSpace(r.Form.Get("notes")),
+		UserId: userId,
+	}
+	t.ID, _ = strconv.Atoi(r.Form.Get("transfer_id"))
+	t.FromId, _ = strconv.Atoi(r.Form.Get("from_id"))
+	t.ToId, _ = strconv.Atoi(r.Form.Get("to_id"))
+	if t.FromId != 0 && t.FromId == t.ToId {
+		form.Errors.Add("to_id", "Choose a different location to move the stock to")
+	}
+
+	serials := r.Form["serial"]
+	quantities := r.Form["quantity"]
+	for i, serial := range serials {
+		serial = strings.TrimSpace(serial)
+		if serial == "" || i >= len(quantities) {
+			continue
+		}
+
+		qty, err := strconv.Atoi(strings.TrimSpace(quantities[i]))
+		if err != nil || qty <= 0 {
+			form.Errors.Add("lines", fmt.Sprintf("Line %d: quantity must be a whole number above zero", i+1))
+		}
+
+		t.Lines = append(t.Lines, models.StockTransferLine{
+			Serial:   serial,
+			Quantity: qty,
+		})
+	}
+
+	if len(t.Lines) == 0 {
+		form.Errors.Add("lines", "Add at least one product to the transfer")
+	}
+
+	if !form.Valid() {
+		m.renderStockTransfer(w, r, form, t)
+		return
+	}
+
+	if t.ID == 0 {
+		t.ID, err = m.audited(r).InsertStockTransfer(t)
+	} else {
+		err = m.audited(r).UpdateStockTransfer(t)
+	}
+	if errors.Is(err, repository.ErrTransferStatus) {
+		m.App.Session.Put(r.Context(), "error", "Only a draft stock transfer can be changed!")
+		http.Redirect(w, r, fmt.Sprintf("/admin/stock-transfer?id=%d", t.ID), http.StatusSeeOther)
+		return
+	}
+
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Stock transfer could not be saved!")
+		http.Redirect(w, r, "/admin/stock-transfers", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Stock transfer #%d saved!", t.ID))
+	http.Redirect(w, r, fmt.Sprintf("/admin/stock-transfer?id=%d", t.ID), http.StatusSeeOther)
+}
+
+// PostCompleteStockTransfer moves the stock on a draft transfer to its destination
+func (m *Repository) PostCompleteStockTransfer(w http.ResponseWriter, r *http.Request) {
+	userId, _ := m.App.Session.Get(r.Context(), "user_id").(int)
+	id, _ := strconv.Atoi(r.FormValue("transfer_id"))
+
+	err := m.audited(r).CompleteStockTransfer(id, userId)
+	switch {
+	case errors.Is(err, repository.ErrTransferStatus):
+		m.App.Session.Put(r.Context(), "error", "Only a draft stock transfer with products on it can be transferred!")
+	case errors.Is(err, repository.ErrInsufficientStock):
+		m.App.Session.Put(r.Context(), "error", "There are not enough units at the source location to transfer every line!")
+	case err != nil:
+		m.App.Session.Put(r.Context(), "error", "Stock could not be transferred!")
+		m.App.ErrorLog.Println(err)
+	default:
+		m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Stock transfer #%d transferred!", id))
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/stock-transfer?id=%d", id), http.StatusSeeOther)
+}
+
+// PostDeleteStockTransfer removes a draft stock transfer
+func (m *Repository) PostDeleteStockTransfer(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.FormValue("transfer_id"))
+
+	err := m.audited(r).DeleteStockTransfer(id)
+	if errors.Is(err, repository.ErrTransferStatus) {
+		m.App.Session.Put(r.Context(), "error", "Only a draft stock transfer can be deleted!")
+		http.Redirect(w, r, fmt.Sprintf("/admin/stock-transfer?id=%d", id), http.StatusSeeOther)
+		return
+	}
+
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Stock transfer could not be deleted!")
+		http.Redirect(w, r, fmt.Sprintf("/admin/stock-transfer?id=%d", id), http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Stock transfer #%d deleted!", id))
+	http.Redirect(w, r, "/admin/stock-transfers", http.StatusSeeOther)
+}
+
+// renderStockTransfer shows a stock transfer with the locations and products to choose from
+func (m *Repository) renderStockTransfer(w http.ResponseWriter, r *http.Request, form *forms.Form, t models.StockTransfer) {
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "Product",
+		Url:     "/admin/stock-transfer",
+	}
+
+	if t.Status == models.TransferDraft {
+		locations, err := m.DB.FetchLocations()
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+
+		prods, err := m.DB.FetchAllProduct()
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+
+		data["locations"] = locations
+		data["products"] = prods
+	}
+
+	data["transfer"] = t
+
+	render.Template(w, r, "stocktransfer.page.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/forms"
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/render"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// effectiveLayout is the format of the datetime-local input a price change is dated with
+const effectiveLayout = "2006-01-02T15:04"
+
+// ProductPrices shows the price changes waiting for their effective date, and the price history
+// of the product with the serial in the query string with a form to change its price
+func (m *Repository) ProductPrices(w http.ResponseWriter, r *http.Request) {
+	m.renderProductPrices(w, r, forms.New(r.URL.Query()), r.URL.Query().Get("serial"))
+}
+
+// PostProductPrice changes the price of a product now, or schedules the change for the
+// effective date in the form
+func (m *Repository) PostProductPrice(w http.ResponseWriter, r *http.Request) {
+	userId, ok := m.App.Session.Get(r.Context(), "user_id").(int)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Failed to get user ID")
+		http.Redirect(w, r, "/admin/product-prices", http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/product-prices", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	serial := r.Form.Get("serial")
+	form := forms.New(r.PostForm)
+	form.Required("serial", "price")
+	form.IsNumber("price", 0)
+
+	var effectiveAt time.Time
+	if v := r.Form.Get("effective_at"); v != "" {
+		effectiveAt, err = time.ParseInLocation(effectiveLayout, v, time.Local)
+		if err != nil {
+			form.Errors.Add("effective_at", "Enter the date and time the price takes effect")
+		}
+	}
+
+	if !form.Valid() {
+		m.renderProductPrices(w, r, form, serial)
+		return
+	}
+
+	price, _ := strconv.ParseFloat(r.Form.Get("price"), 64)
+	_, err = m.audited(r).SchedulePriceChange(models.PriceChange{
+		Serial:      serial,
+		Price:       price,
+		EffectiveAt: effectiveAt,
+		Note:        strings.TrimSpace(r.Form.Get("note")),
+		UserId:      userId,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		form.Errors.Add("serial", "No product with such serial number found")
+		m.renderProductPrices(w, r, form, serial)
+		return
+	}
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Price could not be changed!")
+		http.Redirect(w, r, "/admin/product-prices?serial="+url.QueryEscape(serial), http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	if effectiveAt.After(time.Now()) {
+		m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Price of ₵%.2f scheduled for %s", price, effectiveAt.Format("02-01-2006 3:04 pm")))
+	} else {
+		m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Price changed to ₵%.2f", price))
+	}
+	http.Redirect(w, r, "/admin/product-prices?serial="+url.QueryEscape(serial), http.StatusSeeOther)
+}
+
+// PostCancelPriceChange removes a scheduled price change before it takes effect
+func (m *Repository) PostCancelPriceChange(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/product-prices", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	back := "/admin/product-prices"
+	if serial := r.Form.Get("serial"); serial != "" {
+		back += "?serial=" + url.QueryEscape(serial)
+	}
+
+	id, _ := strconv.Atoi(r.Form.Get("id"))
+	err = m.audited(r).CancelPriceChange(id)
+	if errors.Is(err, repository.ErrPriceApplied) {
+		m.App.Session.Put(r.Context(), "error", "This price change has already taken effect")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Price change could not be cancelled!")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Scheduled price change cancelled")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// renderProductPrices shows the scheduled price changes, and the product with serial with its
+// price history when one is given
+func (m *Repository) renderProductPrices(w http.ResponseWriter, r *http.Request, form *forms.Form, serial string) {
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "Product",
+		Url:     "/admin/product-prices",
+	}
+
+	scheduled, err := m.DB.FetchScheduledPrices()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Scheduled prices cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+	}
+	data["scheduled"] = scheduled
+
+	if serial != "" {
+		prod, err := m.DB.FetchProduct(serial)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				m.App.ErrorLog.Println(err)
+			}
+			m.App.Session.Put(r.Context(), "error", "No product with such serial number found")
+		} else {
+			history, err := m.DB.FetchPriceHistory(serial)
+			if err != nil {
+				m.App.Session.Put(r.Context(), "error", "Price history cannot be fetched!")
+				m.App.ErrorLog.Println(err)
+			}
+			data["product"] = prod
+			data["history"] = history
+		}
+	}
+
+	data["minEffective"] = time.Now().Format(effectiveLayout)
+
+	render.Template(w, r, "productprices.page.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
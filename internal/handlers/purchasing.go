@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/forms"
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/render"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// Suppliers shows the suppliers with a form to add one, or to edit the one with the id in the
+// query string
+func (m *Repository) Suppliers(w http.ResponseWriter, r *http.Request) {
+	supplier := models.Supplier{}
+	if id, _ := strconv.Atoi(r.URL.Query().Get("id")); id != 0 {
+		s, err := m.DB.FetchSupplier(id)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Supplier cannot be found!")
+			http.Redirect(w, r, "/admin/suppliers", http.StatusSeeOther)
+			m.App.ErrorLog.Println(err)
+			return
+		}
+		supplier = s
+	}
+
+	m.renderSuppliers(w, r, forms.New(nil), supplier)
+}
+
+// PostSupplier adds a supplier, or saves the changes to an existing one
+func (m *Repository) PostSupplier(w http.ResponseWriter, r *http.Request) {
+	userId, _ := m.App.Session.Get(r.Context(), "user_id").(int)
+
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/suppliers", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	id, _ := strconv.Atoi(r.Form.Get("supplier_id"))
+	supplier := models.Supplier{
+		ID:          id,
+		Name:        strings.TrimSpace(r.Form.Get("name")),
+		ContactName: strings.TrimSpace(r.Form.Get("contact_name")),
+		Phone:       strings.TrimSpace(r.Form.Get("phone")),
+		Email:       strings.TrimSpace(r.Form.Get("email")),
+		Address:     strings.TrimSpace(r.Form.Get("address")),
+		Notes:       strings.TrimSpace(r.Form.Get("notes")),
+		UserId:      userId,
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+	if supplier.Email != "" {
+		form.IsEmail("email")
+	}
+	if !form.Valid() {
+		m.renderSuppliers(w, r, form, supplier)
+		return
+	}
+
+	if supplier.ID == 0 {
+		_, err = m.audited(r).InsertSupplier(supplier)
+	} else {
+		err = m.audited(r).UpdateSupplier(supplier)
+	}
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Supplier could not be saved!")
+		http.Redirect(w, r, "/admin/suppliers", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Supplier %s saved!", supplier.Name))
+	http.Redirect(w, r, "/admin/suppliers", http.StatusSeeOther)
+}
+
+// renderSuppliers shows the supplier list and form
+func (m *Repository) renderSuppliers(w http.ResponseWriter, r *http.Request, form *forms.Form, supplier models.Supplier) {
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "Purchasing",
+		Url:     "/admin/suppliers",
+	}
+
+	suppliers, err := m.DB.FetchSuppliers()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Suppliers cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+	}
+
+	data["suppliers"] = suppliers
+	data["supplier"] = supplier
+
+	render.Template(w, r, "suppliers.page.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// PurchaseOrders lists the purchase orders, optionally those with one status
+func (m *Repository) PurchaseOrders(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "Purchasing",
+		Url:     "/admin/purchase-orders",
+	}
+
+	status := r.URL.Query().Get("status")
+	orders, err := m.DB.FetchPurchaseOrders(status)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Purchase orders cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+	}
+
+	data["orders"] = orders
+	data["statuses"] = []models.PurchaseOrder{
+		{Status: models.OrderDraft},
+		{Status: models.OrderOrdered},
+		{Status: models.OrderPartial},
+		{Status: models.OrderReceived},
+	}
+
+	render.Template(w, r, "purchaseorders.page.html", &models.TemplateData{
+		Data: data,
+		Form: forms.New(r.URL.Query()),
+	})
+}
+
+// PurchaseOrder shows the purchase order with the id in the query string, a draft can be
+// edited and an order that was placed can be received. Without an id it shows a new draft.
+func (m *Repository) PurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	po := models.PurchaseOrder{Status: models.OrderDraft}
+	if id, _ := strconv.Atoi(r.URL.Query().Get("id")); id != 0 {
+		order, err := m.DB.FetchPurchaseOrder(id)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Purchase order cannot be found!")
+			http.Redirect(w, r, "/admin/purchase-orders", http.StatusSeeOther)
+			m.App.ErrorLog.Println(err)
+			return
+		}
+		po = order
+	}
+
+	m.renderPurchaseOrder(w, r, forms.New(nil), po)
+}
+
+// PostPurchaseOrder saves a draft purchase order
+func (m *Repository) PostPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	userId, _ := m.App.Session.Get(r.Context(), "user_id").(int)
+
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/purchase-orders", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("supplier_id")
+
+	po := models.PurchaseOrder{
+		Status: models.OrderDraft,
+		Notes:  strings.TrimSpace(r.Form.Get("notes")),
+		UserId: userId,
+	}
+	po.ID, _ = strconv.Atoi(r.Form.Get("order_id"))
+	po.SupplierId, _ = strconv.Atoi(r.Form.Get("supplier_id"))
+	if expected := r.Form.Get("expected_at"); expected != "" {
+		t, err := time.ParseInLocation("2006-01-02", expected, time.Local)
+		if err != nil {
+			form.Errors.Add("expected_at", "Enter a valid date")
+		}
+		po.ExpectedAt = t
+	}
+
+	serials := r.Form["serial"]
+	quantities := r.Form["quantity"]
+	costs := r.Form["unit_cost"]
+	for i, serial := range serials {
+		serial = strings.TrimSpace(serial)
+		if serial == "" || i >= len(quantities) || i >= len(costs) {
+			continue
+		}
+
+		qty, err := strconv.Atoi(strings.TrimSpace(quantities[i]))
+		if err != nil || qty <= 0 {
+			form.Errors.Add("lines", fmt.Sprintf("Line %d: quantity must be a whole number above zero", i+1))
+		}
+
+		cost, err := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(costs[i]), "₵"), 64)
+		if err != nil || cost < 0 {
+			form.Errors.Add("lines", fmt.Sprintf("Line %d: enter the unit cost", i+1))
+		}
+
+		po.Lines = append(po.Lines, models.PurchaseOrderLine{
+			Serial:   serial,
+			Quantity: qty,
+			UnitCost: cost,
+		})
+	}
+
+	if len(po.Lines) == 0 {
+		form.Errors.Add("lines", "Add at least one product to the order")
+	}
+
+	if !form.Valid() {
+		m.renderPurchaseOrder(w, r, form, po)
+		return
+	}
+
+	if po.ID == 0 {
+		po.ID, err = m.audited(r).InsertPurchaseOrder(po)
+	} else {
+		err = m.audited(r).UpdatePurchaseOrder(po)
+	}
+	if errors.Is(err, repository.ErrOrderStatus) {
+		m.App.Session.Put(r.Context(), "error", "Only a draft purchase order can be changed!")
+		http.Redirect(w, r, fmt.Sprintf("/admin/purchase-order?id=%d", po.ID), http.StatusSeeOther)
+		return
+	}
+
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Purchase order could not be saved!")
+		http.Redirect(w, r, "/admin/purchase-orders", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Purchase order #%d saved!", po.ID))
+	http.Redirect(w, r, fmt.Sprintf("/admin/purchase-order?id=%d", po.ID), http.StatusSeeOther)
+}
+
+// PostPlacePurchaseOrder marks a draft purchase order as sent to the supplier
+func (m *Repository) PostPlacePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	userId, _ := m.App.Session.Get(r.Context(), "user_id").(int)
+	id, _ := strconv.Atoi(r.FormValue("order_id"))
+
+	err := m.audited(r).PlacePurchaseOrder(id, userId)
+	if errors.Is(err, repository.ErrOrderStatus) {
+		m.App.Session.Put(r.Context(), "error", "Only a draft purchase order with products on it can be placed!")
+	} else if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Purchase order could not be placed!")
+		m.App.ErrorLog.Println(err)
+	} else {
+		m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Purchase order #%d placed with the supplier!", id))
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/purchase-order?id=%d", id), http.StatusSeeOther)
+}
+
+// PostReceivePurchaseOrder books the goods delivered against a purchase order into stock
+func (m *Repository) PostReceivePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	userId, _ := m.App.Session.Get(r.Context(), "user_id").(int)
+
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/purchase-orders", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	id, _ := strconv.Atoi(r.Form.Get("order_id"))
+	redirect := fmt.Sprintf("/admin/purchase-order?id=%d", id)
+
+	lineIds := r.Form["line_id"]
+	quantities := r.Form["receive_qty"]
+	costs := r.Form["receive_cost"]
+	batches := r.Form["receive_batch"]
+	expiries := r.Form["receive_expiry"]
+	if len(quantities) != len(lineIds) || len(costs) != len(lineIds) ||
+		len(batches) != len(lineIds) || len(expiries) != len(lineIds) {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+		return
+	}
+
+	var receipts []models.PurchaseOrderReceipt
+	for i := range lineIds {
+		if strings.TrimSpace(quantities[i]) == "" {
+			continue
+		}
+
+		lineId, err1 := strconv.Atoi(lineIds[i])
+		qty, err2 := strconv.Atoi(strings.TrimSpace(quantities[i]))
+		cost, err3 := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(costs[i]), "₵"), 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Line %d: enter whole units and a unit cost", i+1))
+			http.Redirect(w, r, redirect, http.StatusSeeOther)
+			return
+		}
+
+		var expiresAt time.Time
+		if v := strings.TrimSpace(expiries[i]); v != "" {
+			expiresAt, err = time.ParseInLocation("2006-01-02", v, time.Local)
+			if err != nil {
+				m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Line %d: enter the expiry date as a date", i+1))
+				http.Redirect(w, r, redirect, http.StatusSeeOther)
+				return
+			}
+		}
+
+		receipts = append(receipts, models.PurchaseOrderReceipt{
+			LineId:    lineId,
+			Quantity:  qty,
+			UnitCost:  cost,
+			BatchNo:   strings.TrimSpace(batches[i]),
+			ExpiresAt: expiresAt,
+		})
+	}
+
+	err = m.audited(r).ReceivePurchaseOrder(id, userId, receipts)
+	switch {
+	case errors.Is(err, repository.ErrOrderStatus):
+		m.App.Session.Put(r.Context(), "error", "Goods can only be received against a placed purchase order!")
+	case errors.Is(err, repository.ErrInvalidReceipt):
+		m.App.Session.Put(r.Context(), "error", "Enter the units received, no more than are outstanding on each line!")
+	case err != nil:
+		m.App.Session.Put(r.Context(), "error", "Goods could not be received!")
+		m.App.ErrorLog.Println(err)
+	default:
+		m.App.Session.Put(r.Context(), "flash", "Goods received into stock!")
+	}
+
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// PostDeletePurchaseOrder removes a draft purchase order
+func (m *Repository) PostDeletePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.FormValue("order_id"))
+
+	err := m.audited(r).DeletePurchaseOrder(id)
+	if errors.Is(err, repository.ErrOrderStatus) {
+		m.App.Session.Put(r.Context(), "error", "Only a draft purchase order can be deleted!")
+		http.Redirect(w, r, fmt.Sprintf("/admin/purchase-order?id=%d", id), http.StatusSeeOther)
+		return
+	}
+
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Purchase order could not be deleted!")
+		http.Redirect(w, r, fmt.Sprintf("/admin/purchase-order?id=%d", id), http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Purchase order #%d deleted!", id))
+	http.Redirect(w, r, "/admin/purchase-orders", http.StatusSeeOther)
+}
+
+// renderPurchaseOrder shows a purchase order with the suppliers and products to choose from
+func (m *Repository) renderPurchaseOrder(w http.ResponseWriter, r *http.Request, form *forms.Form, po models.PurchaseOrder) {
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "Purchasing",
+		Url:     "/admin/purchase-order",
+	}
+
+	if po.Status == models.OrderDraft {
+		suppliers, err := m.DB.FetchSuppliers()
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+
+		prods, err := m.DB.FetchAllProduct()
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+
+		data["suppliers"] = suppliers
+		data["products"] = prods
+	}
+
+	data["order"] = po
+
+	render.Template(w, r, "purchaseorder.page.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/forms"
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/render"
+)
+
+// reportOption is a choice offered on a report's filter
+type reportOption struct {
+	Value string
+	Label string
+}
+
+// profitGroupings lists the gross profit report groupings in the order they are offered
+var profitGroupings = []reportOption{
+	{Value: models.ProfitByProduct, Label: "Product"},
+	{Value: models.ProfitByDay, Label: "Day"},
+	{Value: models.ProfitByMonth, Label: "Month"},
+	{Value: models.ProfitBySalesperson, Label: "Salesperson"},
+}
+
+// GrossProfit shows the gross profit of the cash and credit sales grouped as the query string
+// asks, for the current month unless a period is given, and downloads it as csv when
+// export=csv is given
+func (m *Repository) GrossProfit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter := models.ProfitFilter{GroupBy: models.ProfitByProduct}
+	for _, g := range profitGroupings {
+		if q.Get("group") == g.Value {
+			filter.GroupBy = g.Value
+		}
+	}
+
+	if !q.Has("from") && !q.Has("to") {
+		now := time.Now()
+		q.Set("from", time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local).Format("2006-01-02"))
+	}
+	if from, err := time.ParseInLocation("2006-01-02", q.Get("from"), time.Local); err == nil {
+		filter.From = from
+	}
+	if to, err := time.ParseInLocation("2006-01-02", q.Get("to"), time.Local); err == nil {
+		filter.To = to.AddDate(0, 0, 1)
+	}
+
+	export := q.Get("export") == "csv"
+
+	lines, err := m.DB.FetchGrossProfit(filter)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Gross profit cannot be worked out!")
+		m.App.ErrorLog.Println(err)
+		if export {
+			http.Redirect(w, r, "/admin/reports/gross-profit", http.StatusSeeOther)
+			return
+		}
+	}
+
+	total := models.GrossProfit{Label: "Total"}
+	for _, l := range lines {
+		total.Quantity += l.Quantity
+		total.Revenue += l.Revenue
+		total.Cost += l.Cost
+	}
+
+	if export {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=gross-profit-%s.csv", time.Now().Format("20060102")))
+
+		money := func(f float64) string { return strconv.FormatFloat(f, 'f', 2, 64) }
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"Key", "Name", "Units Sold", "Revenue", "Cost", "Gross Profit", "Margin %"})
+		for _, l := range append(lines, total) {
+			_ = cw.Write([]string{
+				l.Key, l.Label, strconv.Itoa(l.Quantity), money(l.Revenue), money(l.Cost), money(l.Profit()), money(l.Margin()),
+			})
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "Reports",
+		Url:     "/admin/reports/gross-profit",
+	}
+	data["lines"] = lines
+	data["total"] = total
+	data["filter"] = filter
+	data["groupings"] = profitGroupings
+
+	render.Template(w, r, "grossprofit.page.html", &models.TemplateData{
+		Data: data,
+		Form: forms.New(q),
+	})
+}
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/jofosuware/small-business-management-app/internal/forms"
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/render"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// stockTakeViews lists the ways the lines of a stock take can be narrowed down
+var stockTakeViews = []reportOption{
+	{Value: "", Label: "All products"},
+	{Value: "uncounted", Label: "Not counted"},
+	{Value: "counted", Label: "Counted"},
+	{Value: "variance", Label: "With a variance"},
+}
+
+// StockTakes lists the stock takes with a form to start one
+func (m *Repository) StockTakes(w http.ResponseWriter, r *http.Request) {
+	m.renderStockTakes(w, r, forms.New(nil), models.StockTake{})
+}
+
+// PostStockTake starts a stock take, freezing a snapshot of the units on hand at the location
+// chosen, or at the user's own location when none is
+func (m *Repository) PostStockTake(w http.ResponseWriter, r *http.Request) {
+	userId, _ := m.App.Session.Get(r.Context(), "user_id").(int)
+
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/stock-takes", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	st := models.StockTake{
+		Name:   strings.TrimSpace(r.Form.Get("name")),
+		Notes:  strings.TrimSpace(r.Form.Get("notes")),
+		UserId: userId,
+	}
+	st.CategoryId, _ = strconv.Atoi(r.Form.Get("category_id"))
+	st.LocationId, _ = strconv.Atoi(r.Form.Get("location_id"))
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+	if !form.Valid() {
+		m.renderStockTakes(w, r, form, st)
+		return
+	}
+
+	st.ID, err = m.audited(r).InsertStockTake(st)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Stock take could not be started!")
+		http.Redirect(w, r, "/admin/stock-takes", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Stock take #%d started, the units on hand have been frozen!", st.ID))
+	http.Redirect(w, r, fmt.Sprintf("/admin/stock-take?id=%d", st.ID), http.StatusSeeOther)
+}
+
+// renderStockTakes shows the stock take list and the form to start one
+func (m *Repository) renderStockTakes(w http.ResponseWriter, r *http.Request, form *forms.Form, st models.StockTake) {
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "Product",
+		Url:     "/admin/stock-takes",
+	}
+
+	takes, err := m.DB.FetchStockTakes()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Stock takes cannot be fetched!")
+		m.App.ErrorLog.Println(err)
+	}
+
+	categories, err := m.DB.FetchCategories()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+
+	locations, err := m.DB.FetchLocations()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+
+	data["takes"] = takes
+	data["take"] = st
+	data["categories"] = categories
+	data["locations"] = locations
+
+	render.Template(w, r, "stocktakes.page.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// StockTake shows the count sheet and variance report of the stock take with the id in the
+// query string, narrowed down by show and q, and downloads the report as csv when export=csv
+// is given
+func (m *Repository) StockTake(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	id, _ := strconv.Atoi(q.Get("id"))
+
+	st, err := m.DB.FetchStockTake(id)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			m.App.ErrorLog.Println(err)
+		}
+		m.App.Session.Put(r.Context(), "error", "Stock take cannot be found!")
+		http.Redirect(w, r, "/admin/stock-takes", http.StatusSeeOther)
+		return
+	}
+
+	totals := st.Totals()
+	lines := stockTakeLines(st.Lines, q.Get("show"), q.Get("q"))
+
+	if q.Get("export") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=stock-take-%d.csv", st.ID))
+
+		money := func(f float64) string { return strconv.FormatFloat(f, 'f', 2, 64) }
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{
+			"Serial", "Name", "Unit Cost", "Expected", "Counted", "Variance", "Expected Value", "Counted Value", "Variance Value",
+		})
+		for _, l := range lines {
+			counted := ""
+			if l.IsCounted() {
+				counted = strconv.Itoa(l.Counted)
+			}
+			_ = cw.Write([]string{
+				l.Serial, l.Name, money(l.UnitCost), strconv.Itoa(l.Expected()), counted, strconv.Itoa(l.Variance()),
+				money(l.ExpectedValue()), money(l.CountedValue()), money(l.VarianceValue()),
+			})
+		}
+		_ = cw.Write([]string{
+			"", "Total", "", "", "", "", money(totals.ExpectedValue), money(totals.CountedValue), money(totals.VarianceValue),
+		})
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["metadata"] = models.FormMetaData{
+		Section: "Product",
+		Url:     "/admin/stock-takes",
+	}
+	data["take"] = st
+	data["lines"] = lines
+	data["totals"] = totals
+	data["views"] = stockTakeViews
+
+	render.Template(w, r, "stocktake.page.html", &models.TemplateData{
+		Data: data,
+		Form: forms.New(q),
+	})
+}
+
+// stockTakeLines returns the lines shown by view whose serial or name contains search
+func stockTakeLines(lines []models.StockTakeLine, view, search string) []models.StockTakeLine {
+	search = strings.ToLower(strings.TrimSpace(search))
+
+	var shown []models.StockTakeLine
+	for _, l := range lines {
+		switch {
+		case view == "uncounted" && l.IsCounted(),
+			view == "counted" && !l.IsCounted(),
+			view == "variance" && l.Variance() == 0:
+			continue
+		}
+
+		if search != "" && !strings.Contains(strings.ToLower(l.Serial), search) && !strings.Contains(strings.ToLower(l.Name), search) {
+			continue
+		}
+		shown = append(shown, l)
+	}
+	return shown
+}
+
+// PostStockCounts saves the units counted against the lines of a stock take, each line_id is
+// posted with its count in counted and lines left blank are not changed
+func (m *Repository) PostStockCounts(w http.ResponseWriter, r *http.Request) {
+	userId, _ := m.App.Session.Get(r.Context(), "user_id").(int)
+
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/stock-takes", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	id, _ := strconv.Atoi(r.Form.Get("stock_take_id"))
+	redirect := stockTakeURL(id, r.Form.Get("show"), r.Form.Get("q"))
+
+	lineIds := r.Form["line_id"]
+	counted := r.Form["counted"]
+	if len(counted) != len(lineIds) {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+		return
+	}
+
+	var counts []models.StockCount
+	for i := range lineIds {
+		if strings.TrimSpace(counted[i]) == "" {
+			continue
+		}
+
+		lineId, err1 := strconv.Atoi(lineIds[i])
+		units, err2 := strconv.Atoi(strings.TrimSpace(counted[i]))
+		if err1 != nil || err2 != nil || units < 0 {
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Line %d: enter the whole units counted", i+1))
+			http.Redirect(w, r, redirect, http.StatusSeeOther)
+			return
+		}
+
+		counts = append(counts, models.StockCount{LineId: lineId, Counted: units})
+	}
+
+	if len(counts) == 0 {
+		m.App.Session.Put(r.Context(), "error", "Enter the units counted for at least one product!")
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+		return
+	}
+
+	err = m.audited(r).RecordStockCounts(id, userId, counts)
+	switch {
+	case errors.Is(err, repository.ErrStockTakeStatus):
+		m.App.Session.Put(r.Context(), "error", "The stock take is closed, counts can no longer be entered!")
+	case errors.Is(err, repository.ErrInvalidCount):
+		m.App.Session.Put(r.Context(), "error", "Enter the whole units counted for products on this stock take!")
+	case err != nil:
+		m.App.Session.Put(r.Context(), "error", "Counts could not be saved!")
+		m.App.ErrorLog.Println(err)
+	default:
+		m.App.Session.Put(r.Context(), "flash", "Counts saved!")
+	}
+
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// PostApproveStockTake closes a stock take, posting a correction for the variance of each
+// counted line ticked in approve
+func (m *Repository) PostApproveStockTake(w http.ResponseWriter, r *http.Request) {
+	userId, _ := m.App.Session.Get(r.Context(), "user_id").(int)
+
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't process form")
+		http.Redirect(w, r, "/admin/stock-takes", http.StatusSeeOther)
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	id, _ := strconv.Atoi(r.Form.Get("stock_take_id"))
+	redirect := fmt.Sprintf("/admin/stock-take?id=%d", id)
+
+	var lineIds []int
+	for _, v := range r.Form["approve"] {
+		lineId, err := strconv.Atoi(v)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "can't process form")
+			http.Redirect(w, r, redirect, http.StatusSeeOther)
+			return
+		}
+		lineIds = append(lineIds, lineId)
+	}
+
+	err = m.audited(r).ApproveStockTake(id, userId, lineIds)
+	switch {
+	case errors.Is(err, repository.ErrStockTakeStatus):
+		m.App.Session.Put(r.Context(), "error", "The stock take has already been closed!")
+	case errors.Is(err, repository.ErrInvalidCount):
+		m.App.Session.Put(r.Context(), "error", "Only counted products on this stock take can be approved!")
+	case errors.Is(err, repository.ErrInsufficientStock):
+		m.App.Session.Put(r.Context(), "error", "Units sold since the count leave too few in stock to post a shortage, recount the products short!")
+	case err != nil:
+		m.App.Session.Put(r.Context(), "error", "Stock take could not be approved!")
+		m.App.ErrorLog.Println(err)
+	default:
+		m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Stock take #%d approved with %d lines corrected!", id, len(lineIds)))
+	}
+
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// PostCancelStockTake closes a stock take without changing any stock
+func (m *Repository) PostCancelStockTake(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.FormValue("stock_take_id"))
+
+	err := m.audited(r).CancelStockTake(id)
+	if errors.Is(err, repository.ErrStockTakeStatus) {
+		m.App.Session.Put(r.Context(), "error", "The stock take has already been closed!")
+	} else if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Stock take could not be cancelled!")
+		m.App.ErrorLog.Println(err)
+	} else {
+		m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Stock take #%d cancelled!", id))
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/stock-take?id=%d", id), http.StatusSeeOther)
+}
+
+// stockTakeURL returns the address of a stock take's page narrowed down by show and q
+func stockTakeURL(id int, show, search string) string {
+	v := url.Values{}
+	v.Set("id", strconv.Itoa(id))
+	if show != "" {
+		v.Set("show", show)
+	}
+	if search != "" {
+		v.Set("q", search)
+	}
+	return "/admin/stock-take?" + v.Encode()
+}
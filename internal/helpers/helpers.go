@@ -2,15 +2,23 @@ package helpers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"image"
-	_ "image/jpeg"
+	"image/jpeg"
 	"image/png"
+	"io"
 	"math"
 	"mime/multipart"
+	"net"
 	"net/http"
+	"net/netip"
 	"runtime/debug"
+	"strings"
 
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/qr"
 	"github.com/jofosuware/small-business-management-app/internal/config"
 	"github.com/nfnt/resize"
 )
@@ -38,6 +46,109 @@ func IsAuthenticated(r *http.Request) bool {
 	return exists
 }
 
+// ClientIP returns the address of the client that sent the request
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ForwardedClientIP returns the address of the client a request came from through the trusted
+// reverse proxies. The forwarded headers are only read when the request comes from one of them,
+// and X-Forwarded-For is read from the right so addresses a client puts in it are not believed.
+func ForwardedClientIP(r *http.Request, proxies []netip.Prefix) string {
+	peer := ClientIP(r)
+	if !trustedProxy(peer, proxies) {
+		return peer
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if _, err := netip.ParseAddr(hop); err != nil {
+				return peer
+			}
+			if !trustedProxy(hop, proxies) {
+				return hop
+			}
+		}
+		return peer
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		if _, err := netip.ParseAddr(realIP); err == nil {
+			return realIP
+		}
+	}
+	return peer
+}
+
+// trustedProxy reports whether ip is the address of one of the trusted proxies
+func trustedProxy(ip string, proxies []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, p := range proxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// QRCode encodes content as a square PNG QR code of the given size in pixels
+func QRCode(content string, size int) ([]byte, error) {
+	code, err := qr.Encode(content, qr.M, qr.Auto)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err = barcode.Scale(code, size, size)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	err = png.Encode(buf, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Code128 encodes content as a PNG Code 128 barcode of the given size in pixels, the width is
+// widened when it is too narrow for the bars
+func Code128(content string, width, height int) ([]byte, error) {
+	code, err := code128.Encode(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if min := code.Bounds().Dx(); width < min {
+		width = min
+	}
+
+	scaled, err := barcode.Scale(code, width, height)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	err = png.Encode(buf, scaled)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
 func ProcessImage(file multipart.File) ([]byte, error) {
 	//Decode the file into an image.Image type
 	img, _, err := image.Decode(file)
@@ -58,6 +169,75 @@ func ProcessImage(file multipart.File) ([]byte, error) {
 	return imgData, nil
 }
 
+// MaxImagePixels is the most pixels an uploaded photo may have. An image's header can claim far
+// more pixels than its file holds and decoding it would take that much memory.
+const MaxImagePixels = 50_000_000
+
+// ErrImageTooLarge is returned for uploaded photos with more than MaxImagePixels pixels
+var ErrImageTooLarge = errors.New("image has too many pixels")
+
+// ProductImage decodes an uploaded photo of a product and returns it as a JPEG scaled down to
+// fit within size pixels, and a thumbnail of it that fits within thumbSize pixels. Only the size
+// in the image's header is read before photos over MaxImagePixels are refused.
+func ProductImage(file multipart.File, size, thumbSize uint) ([]byte, []byte, error) {
+	cfg, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > MaxImagePixels {
+		return nil, nil, ErrImageTooLarge
+	}
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	full, err := encodeJPEG(resize.Thumbnail(size, size, img, resize.Lanczos3))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	thumb, err := encodeJPEG(resize.Thumbnail(thumbSize, thumbSize, img, resize.Lanczos3))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return full, thumb, nil
+}
+
+func encodeJPEG(img image.Image) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := jpeg.Encode(buf, img, &jpeg.Options{Quality: 85})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ImageCached sets the headers that let the browser keep an image that never changes for as
+// long as it likes, and answers 304 Not Modified when the browser already has the image tagged
+// etag. The image only needs writing when it returns false.
+func ImageCached(w http.ResponseWriter, r *http.Request, etag string) bool {
+	etag = `"` + etag + `"`
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("ETag", etag)
+
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if strings.TrimSpace(tag) == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+
+	return false
+}
+
 func ToDecimalPlace(x float64, precision int) float64 {
 	multipler := math.Pow(10, float64(precision))
 	rounded := math.Round(x*multipler) / multipler
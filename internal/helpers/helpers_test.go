@@ -0,0 +1,98 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jofosuware/small-business-management-app/internal/config"
+)
+
+func TestForwardedClientIP(t *testing.T) {
+	proxies, err := config.ParseProxies("10.0.0.1, 192.168.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		peer      string
+		forwarded string
+		realIP    string
+		expected  string
+	}{
+		{"direct client", "203.0.113.7:5100", "", "", "203.0.113.7"},
+		{"direct client forging headers", "203.0.113.7:5100", "198.51.100.1", "198.51.100.2", "203.0.113.7"},
+		{"through a proxy", "10.0.0.1:443", "198.51.100.1", "", "198.51.100.1"},
+		{"through a proxy with a forged hop", "10.0.0.1:443", "1.2.3.4, 198.51.100.1", "", "198.51.100.1"},
+		{"through a chain of proxies", "10.0.0.1:443", "198.51.100.1, 192.168.4.4", "", "198.51.100.1"},
+		{"through a proxy setting X-Real-IP", "192.168.1.1:443", "", "198.51.100.1", "198.51.100.1"},
+		{"through a proxy with garbage", "10.0.0.1:443", "not-an-ip", "", "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.peer
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+
+		if got := ForwardedClientIP(r, proxies); got != tt.expected {
+			t.Errorf("%s: got %s, expected %s", tt.name, got, tt.expected)
+		}
+	}
+
+	if _, err := config.ParseProxies("10.0.0.1, proxy.local"); err == nil {
+		t.Error("a proxy that is not an address was accepted")
+	}
+}
+
+// upload is an uploaded file held in memory
+type upload struct {
+	*bytes.Reader
+}
+
+func (upload) Close() error { return nil }
+
+func TestProductImage(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 300, 200))); err != nil {
+		t.Fatal(err)
+	}
+	photo := buf.Bytes()
+
+	full, thumb, err := ProductImage(upload{bytes.NewReader(photo)}, 100, 10)
+	if err != nil {
+		t.Fatalf("photo was refused: %s", err)
+	}
+	if cfg, err := jpegSize(full); err != nil || cfg.Width != 100 || cfg.Height != 66 {
+		t.Errorf("image is %dx%d, err %v", cfg.Width, cfg.Height, err)
+	}
+	if cfg, err := jpegSize(thumb); err != nil || cfg.Width != 10 {
+		t.Errorf("thumbnail is %dx%d, err %v", cfg.Width, cfg.Height, err)
+	}
+
+	// The header of the small photo is changed to claim 60000x60000 pixels, which would take
+	// gigabytes to decode
+	bomb := append([]byte(nil), photo...)
+	binary.BigEndian.PutUint32(bomb[16:], 60000)
+	binary.BigEndian.PutUint32(bomb[20:], 60000)
+	binary.BigEndian.PutUint32(bomb[29:], crc32.ChecksumIEEE(bomb[12:29]))
+
+	if _, _, err := ProductImage(upload{bytes.NewReader(bomb)}, 100, 10); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("oversized image was not refused, err %v", err)
+	}
+}
+
+func jpegSize(b []byte) (image.Config, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(b))
+	return cfg, err
+}
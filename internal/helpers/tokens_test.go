@@ -0,0 +1,25 @@
+package helpers
+
+import "testing"
+
+func TestNewToken(t *testing.T) {
+	token, hash, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hash != HashToken(token) {
+		t.Errorf("hash %s is not the hash of token %s", hash, token)
+	}
+	if hash == token {
+		t.Error("the token is stored as it is")
+	}
+
+	other, _, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == token {
+		t.Errorf("got the same token %s twice", token)
+	}
+}
@@ -0,0 +1,129 @@
+// Package labels lays out product labels carrying a Code 128 barcode or a QR code of the serial
+// number on printable A4 pdf sheets
+package labels
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/jofosuware/small-business-management-app/internal/helpers"
+)
+
+// The codes a label can carry
+const (
+	Code128 = "code128"
+	QR      = "qr"
+)
+
+// The sheet layout in millimetres, 21 labels of 63.5 x 38.1 to an A4 page as on the common
+// L7160 sheets
+const (
+	Columns     = 3
+	Rows        = 7
+	PerSheet    = Columns * Rows
+	labelWidth  = 63.5
+	labelHeight = 38.1
+	marginLeft  = 7.2
+	marginTop   = 15.15
+	columnGap   = 2.5
+	padding     = 3.0
+)
+
+// Label is what is printed on one label
+type Label struct {
+	Serial string
+	Name   string
+	Price  float64
+}
+
+// Image returns the code of a serial number as a PNG image of kind Code128 or QR
+func Image(serial, kind string) ([]byte, error) {
+	switch kind {
+	case Code128:
+		return helpers.Code128(serial, 600, 160)
+	case QR:
+		return helpers.QRCode(serial, 300)
+	}
+	return nil, fmt.Errorf("unknown label code %q", kind)
+}
+
+// Sheet writes the labels to w as a pdf of A4 sheets, skip leaves the first labels of the first
+// sheet blank so a part used sheet can be printed on
+func Sheet(w io.Writer, labels []Label, kind string, skip int) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	if skip < 0 || skip >= PerSheet {
+		skip = 0
+	}
+
+	images := make(map[string]string)
+	for i, l := range labels {
+		pos := (i + skip) % PerSheet
+		if i == 0 || pos == 0 {
+			pdf.AddPage()
+		}
+
+		name, ok := images[l.Serial]
+		if !ok {
+			img, err := Image(l.Serial, kind)
+			if err != nil {
+				return fmt.Errorf("%s: %w", l.Serial, err)
+			}
+			name = fmt.Sprintf("code%d", len(images))
+			pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(img))
+			images[l.Serial] = name
+		}
+
+		x := marginLeft + float64(pos%Columns)*(labelWidth+columnGap) + padding
+		y := marginTop + float64(pos/Columns)*labelHeight + padding
+		width := labelWidth - 2*padding
+
+		if kind == QR {
+			size := labelHeight - 2*padding
+			pdf.ImageOptions(name, x, y, size, size, false, fpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+			x += size + 2
+			width -= size + 2
+		}
+
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.SetXY(x, y)
+		pdf.CellFormat(width, 4.5, fit(pdf, tr(l.Name), width), "", 2, "L", false, 0, "")
+
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(width, 4.5, fmt.Sprintf("GHS %.2f", l.Price), "", 2, "L", false, 0, "")
+
+		if kind == Code128 {
+			pdf.ImageOptions(name, x, y+10, width, 16, false, fpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+			pdf.SetXY(x, y+26.5)
+			pdf.SetFont("Helvetica", "", 7)
+			pdf.CellFormat(width, 3.5, fit(pdf, tr(l.Serial), width), "", 0, "C", false, 0, "")
+		} else {
+			pdf.SetFont("Helvetica", "", 7)
+			pdf.MultiCell(width, 3.5, tr(l.Serial), "", "L", false)
+		}
+	}
+
+	if len(labels) == 0 {
+		pdf.AddPage()
+	}
+
+	return pdf.Output(w)
+}
+
+// fit shortens text with an ellipsis until it is no wider than width in the current font
+func fit(pdf *fpdf.Fpdf, text string, width float64) string {
+	if pdf.GetStringWidth(text) <= width {
+		return text
+	}
+
+	runes := []rune(text)
+	for len(runes) > 0 && pdf.GetStringWidth(string(runes)+"...") > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
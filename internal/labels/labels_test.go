@@ -0,0 +1,48 @@
+package labels
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestImage(t *testing.T) {
+	for _, kind := range []string{Code128, QR} {
+		img, err := Image("SN-0001", kind)
+		if err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		if !bytes.HasPrefix(img, []byte("\x89PNG")) {
+			t.Errorf("%s: image is not a png", kind)
+		}
+	}
+
+	if _, err := Image("SN-0001", "ean"); err == nil {
+		t.Error("made an image of an unknown code")
+	}
+}
+
+func TestSheet(t *testing.T) {
+	var labels []Label
+	for i := 0; i < PerSheet; i++ {
+		labels = append(labels, Label{Serial: "SN-0001", Name: "Binatone electric kettle, 1.7 litres, stainless steel", Price: 120})
+	}
+
+	for _, kind := range []string{Code128, QR} {
+		var buf bytes.Buffer
+		if err := Sheet(&buf, labels, kind, 3); err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+
+		pdf := buf.String()
+		if !strings.HasPrefix(pdf, "%PDF") {
+			t.Fatalf("%s: sheet is not a pdf", kind)
+		}
+		if pages := strings.Count(pdf, "/Type /Page\n"); pages != 2 {
+			t.Errorf("%s: %d labels after 3 skipped took %d pages, want 2", kind, PerSheet, pages)
+		}
+		if images := strings.Count(pdf, "/Subtype /Image"); images != 1 {
+			t.Errorf("%s: the code of one serial was embedded %d times", kind, images)
+		}
+	}
+}
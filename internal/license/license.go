@@ -0,0 +1,194 @@
+// Package license verifies the signed license files that enable the app offline.
+//
+// A license file is JSON holding the license payload and its Ed25519 signature. Licenses are
+// signed with the vendor's private key by cmd/license and verified with the matching public
+// key, which is compiled in through PublicKey.
+package license
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Modules that a license can enable, a license listing no modules enables all of them
+const (
+	ModuleInventory = "inventory"
+	ModuleContracts = "contracts"
+	ModuleSales     = "sales"
+	ModuleAPI       = "api"
+)
+
+// PublicKey is the base64 encoded Ed25519 key licenses are verified with, set at build time with
+// -ldflags "-X github.com/jofosuware/small-business-management-app/internal/license.PublicKey=..."
+var PublicKey string
+
+// ErrInvalidSignature is returned when a license was not signed by the vendor key
+var ErrInvalidSignature = errors.New("license signature is invalid")
+
+// License is the signed content of a license file
+type License struct {
+	ID        string    `json:"id"`
+	Licensee  string    `json:"licensee"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Seats     int       `json:"seats"`
+	Modules   []string  `json:"modules"`
+}
+
+type file struct {
+	Payload   []byte `json:"payload"`
+	Signature []byte `json:"signature"`
+}
+
+// ParsePublicKey decodes a base64 encoded Ed25519 public key
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be %d bytes, got %d", ed25519.PublicKeySize, len(b))
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// ParsePrivateKey decodes a base64 encoded Ed25519 private key
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("private key must be %d bytes, got %d", ed25519.PrivateKeySize, len(b))
+	}
+	return ed25519.PrivateKey(b), nil
+}
+
+// Sign returns the license file for l signed with key
+func Sign(l License, key ed25519.PrivateKey) ([]byte, error) {
+	payload, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(file{
+		Payload:   payload,
+		Signature: ed25519.Sign(key, payload),
+	}, "", "  ")
+}
+
+// Verify checks the signature of a license file and returns its license
+func Verify(data []byte, key ed25519.PublicKey) (License, error) {
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return License{}, fmt.Errorf("license file is malformed: %w", err)
+	}
+
+	if !ed25519.Verify(key, f.Payload, f.Signature) {
+		return License{}, ErrInvalidSignature
+	}
+
+	var l License
+	if err := json.Unmarshal(f.Payload, &l); err != nil {
+		return License{}, fmt.Errorf("license is malformed: %w", err)
+	}
+	return l, nil
+}
+
+// Status is the outcome of loading the license, the app runs read-only unless it holds a
+// verified license that has not expired
+type Status struct {
+	License License
+	Err     error
+}
+
+// ErrNoPublicKey is returned when the build has no public key to verify licenses with
+var ErrNoPublicKey = errors.New("no license public key was compiled in")
+
+// Load reads the license file at path and verifies it against the compiled in PublicKey
+func Load(path string) *Status {
+	return load(path, PublicKey)
+}
+
+// load reads and verifies the license file at path against the base64 encoded public key
+func load(path, publicKey string) *Status {
+	if publicKey == "" {
+		return &Status{Err: ErrNoPublicKey}
+	}
+
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return &Status{Err: fmt.Errorf("license public key: %w", err)}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return &Status{Err: err}
+	}
+
+	l, err := Verify(data, key)
+	if err != nil {
+		return &Status{Err: err}
+	}
+
+	return &Status{License: l}
+}
+
+// Valid reports whether a verified license was loaded
+func (s *Status) Valid() bool {
+	return s != nil && s.Err == nil
+}
+
+// Expired reports whether the verified license has passed its expiry date
+func (s *Status) Expired() bool {
+	return s.Valid() && !s.License.ExpiresAt.IsZero() && time.Now().After(s.License.ExpiresAt)
+}
+
+// ReadOnly reports whether changes must be refused
+func (s *Status) ReadOnly() bool {
+	return !s.Valid() || s.Expired()
+}
+
+// HasModule reports whether the license enables module. Without a verified license every
+// module stays available for reading, ReadOnly already stops changes.
+func (s *Status) HasModule(module string) bool {
+	if !s.Valid() || len(s.License.Modules) == 0 {
+		return true
+	}
+
+	for _, m := range s.License.Modules {
+		if m == module {
+			return true
+		}
+	}
+	return false
+}
+
+// SeatsLeft reports whether another user may be added when active users already exist,
+// a license without a seat limit allows any number
+func (s *Status) SeatsLeft(active int) bool {
+	if !s.Valid() || s.License.Seats == 0 {
+		return true
+	}
+	return active < s.License.Seats
+}
+
+// Banner returns the notice shown on every page, empty when nothing needs saying
+func (s *Status) Banner() string {
+	switch {
+	case !s.Valid():
+		return "No valid license was found. The app is read-only until a license is installed."
+	case s.Expired():
+		return fmt.Sprintf("The license expired on %s. The app is read-only until it is renewed.", s.License.ExpiresAt.Format("02-01-2006"))
+	case !s.License.ExpiresAt.IsZero() && time.Until(s.License.ExpiresAt) < 14*24*time.Hour:
+		return fmt.Sprintf("The license expires on %s. Renew it to keep making changes.", s.License.ExpiresAt.Format("02-01-2006"))
+	}
+	return ""
+}
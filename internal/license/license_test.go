@@ -0,0 +1,111 @@
+package license
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := License{
+		ID:        "test",
+		Licensee:  "Osee Enterprise",
+		ExpiresAt: time.Now().Add(24 * time.Hour).UTC(),
+		Seats:     3,
+		Modules:   []string{ModuleSales},
+	}
+
+	data, err := Sign(l, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Verify(data, pub)
+	if err != nil {
+		t.Fatalf("signed license was rejected: %s", err)
+	}
+
+	if got.Licensee != l.Licensee || got.Seats != l.Seats || !got.ExpiresAt.Equal(l.ExpiresAt) {
+		t.Errorf("got %+v, expected %+v", got, l)
+	}
+
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+	if _, err := Verify(data, otherPub); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("license verified with the wrong key, err %v", err)
+	}
+
+	data[len(data)/2] ^= 1
+	if _, err := Verify(data, pub); err == nil {
+		t.Error("tampered license was accepted")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	key := base64.StdEncoding.EncodeToString(pub)
+	dir := t.TempDir()
+
+	write := func(l License) string {
+		data, err := Sign(l, priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, l.ID+".lic")
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	s := load(write(License{ID: "current", ExpiresAt: time.Now().Add(60 * 24 * time.Hour), Seats: 2, Modules: []string{ModuleSales}}), key)
+	if s.ReadOnly() || s.Banner() != "" {
+		t.Errorf("current license: read-only %v, banner %q", s.ReadOnly(), s.Banner())
+	}
+	if !s.HasModule(ModuleSales) || s.HasModule(ModuleContracts) {
+		t.Error("current license enables the wrong modules")
+	}
+	if !s.SeatsLeft(1) || s.SeatsLeft(2) {
+		t.Error("current license seat limit not applied")
+	}
+
+	s = load(write(License{ID: "expiring", ExpiresAt: time.Now().Add(24 * time.Hour)}), key)
+	if s.ReadOnly() || s.Banner() == "" {
+		t.Errorf("expiring license: read-only %v, banner %q", s.ReadOnly(), s.Banner())
+	}
+
+	s = load(write(License{ID: "expired", ExpiresAt: time.Now().Add(-time.Hour)}), key)
+	if !s.ReadOnly() || s.Banner() == "" {
+		t.Errorf("expired license: read-only %v, banner %q", s.ReadOnly(), s.Banner())
+	}
+
+	s = load(filepath.Join(dir, "missing.lic"), key)
+	if !s.ReadOnly() || !s.HasModule(ModuleContracts) {
+		t.Error("missing license should be read-only with every module readable")
+	}
+}
+
+func TestLoadWithoutPublicKey(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(nil)
+	data, err := Sign(License{ID: "unlimited"}, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "unlimited.lic")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := load(path, "")
+	if !errors.Is(s.Err, ErrNoPublicKey) || !s.ReadOnly() {
+		t.Errorf("license loaded without a public key: err %v, read-only %v", s.Err, s.ReadOnly())
+	}
+}
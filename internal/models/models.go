@@ -1,6 +1,9 @@
 package models
 
 import (
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,21 +16,59 @@ type User struct {
 	Password    string
 	AccessLevel string
 	Image       []byte
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	TOTPEnabled bool
+	// LocationId is where the user sells from, zero for the default location
+	LocationId   int
+	LocationName string
+	DisabledAt   time.Time
+	DeletedAt    time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// Active reports whether the user may log in
+func (u User) Active() bool {
+	return u.DisabledAt.IsZero() && u.DeletedAt.IsZero()
 }
 
 // Product Data struct
 type Product struct {
-	ID          int
-	Serial      string
-	Name        string
-	Description string
-	Price       float64
-	Units       int32
-	UserId      int
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	ID           int
+	Serial       string
+	Name         string
+	Description  string
+	Price        float64
+	CostPrice    float64
+	Units        int32
+	ReorderPoint int32
+	ReorderQty   int32
+	CategoryId   int
+	CategoryPath string
+	BrandId      int
+	BrandName    string
+	Attributes   []ProductAttribute
+	ImageId      int
+	ArchivedAt   time.Time
+	UserId       int
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// IsArchived reports whether the product was taken off sale, it is kept for the records that
+// name it but can no longer be sold
+func (p Product) IsArchived() bool {
+	return !p.ArchivedAt.IsZero()
+}
+
+// LowStock reports whether the product has fallen to its reorder point, a reorder point of
+// zero means the product is not watched
+func (p Product) LowStock() bool {
+	return p.ReorderPoint > 0 && p.Units <= p.ReorderPoint
+}
+
+// Margin returns the gross profit made on each unit sold at the current price and cost
+func (p Product) Margin() float64 {
+	return p.Price - p.CostPrice
 }
 
 // Forms meta data struct
@@ -97,6 +138,7 @@ type Item struct {
 	Total           float64   `json:"-"`
 	Deposit         float64   `json:"deposit"`
 	Balance         float64   `json:"balance"`
+	UnitCost        float64   `json:"-"`
 	UserId          int       `json:"-"`
 	CreatedAt       time.Time `json:"-"`
 	UpdatedAt       time.Time `json:"-"`
@@ -128,9 +170,810 @@ type Purchases struct {
 	Serial          string
 	Quantity        int
 	Amount          float64
+	UnitPrice       float64
+	UnitCost        float64
 	UserId          int
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
 	CreatedAtString string
 	UpdatedAtString string
 }
+
+// ActivationToken is the model for the one-time links new users set their password with
+type ActivationToken struct {
+	ID        int
+	UserId    int
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    time.Time
+	RevokedAt time.Time
+	CreatedBy int
+	CreatedAt time.Time
+}
+
+// Lockout scopes
+const (
+	LockoutScopeUsername = "username"
+	LockoutScopeIP       = "ip"
+)
+
+// LoginAttempt is the model for a recorded login attempt
+type LoginAttempt struct {
+	ID        int
+	Username  string
+	IPAddress string
+	Succeeded bool
+	CreatedAt time.Time
+}
+
+// LoginFailures summarises the recent failed logins for a username and client IP
+type LoginFailures struct {
+	ByUsername  int
+	ByIP        int
+	LastFailure time.Time
+}
+
+// Lockout is the model for a temporary lockout of a username or client IP
+type Lockout struct {
+	ID          int
+	Scope       string
+	Username    string
+	IPAddress   string
+	Failures    int
+	LockedUntil time.Time
+	UnlockedBy  int
+	UnlockedAt  time.Time
+	CreatedAt   time.Time
+}
+
+// Active reports whether the lockout still blocks logins
+func (l Lockout) Active() bool {
+	return l.UnlockedAt.IsZero() && time.Now().Before(l.LockedUntil)
+}
+
+// APIToken is the model for a personal access token used on the api
+type APIToken struct {
+	ID         int
+	UserId     int
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+	RevokedAt  time.Time
+	CreatedAt  time.Time
+}
+
+// Allows reports whether the token was granted the permission
+func (t APIToken) Allows(perm string) bool {
+	for _, s := range t.Scopes {
+		if s == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Active reports whether the token can still be used
+func (t APIToken) Active() bool {
+	return t.RevokedAt.IsZero() && (t.ExpiresAt.IsZero() || time.Now().Before(t.ExpiresAt))
+}
+
+// UserSession is the model for a logged in web session
+type UserSession struct {
+	ID         int
+	Token      string
+	UserId     int
+	Username   string
+	APITokenId int
+	IPAddress  string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+}
+
+// AuditEntry is the model for a row of the audit log
+type AuditEntry struct {
+	ID        int
+	UserId    int
+	Username  string
+	Action    string
+	Entity    string
+	EntityKey string
+	Before    string
+	After     string
+	IPAddress string
+	CreatedAt time.Time
+}
+
+// AuditFilter narrows down the audit log, zero fields match everything
+type AuditFilter struct {
+	UserId    int
+	Action    string
+	Entity    string
+	EntityKey string
+	From      time.Time
+	To        time.Time
+	Limit     int
+}
+
+// Stock movement reasons
+const (
+	StockOpening        = "opening"
+	StockRestock        = "restock"
+	StockCreditSale     = "credit_sale"
+	StockCashSale       = "cash_sale"
+	StockAdjustment     = "adjustment"
+	StockReceived       = "received"
+	StockTakeCorrection = "stock_take"
+	StockTransferOut    = "transfer_out"
+	StockTransferIn     = "transfer_in"
+)
+
+// StockMovement is the model for a signed change to a product's units on hand at a location,
+// a zero LocationId is the location of the user making it. Units brought in with a BatchNo or
+// ExpiresAt are added to that batch, units taken out come from the batches that expire first.
+type StockMovement struct {
+	ID           int
+	Serial       string
+	LocationId   int
+	LocationName string
+	Quantity     int
+	Reason       string
+	Reference    string
+	BatchNo      string
+	ExpiresAt    time.Time
+	UnitCost     float64
+	UserId       int
+	Username     string
+	Balance      int
+	CreatedAt    time.Time
+}
+
+// IsSale reports whether the movement takes units out to sell them
+func (s StockMovement) IsSale() bool {
+	return s.Quantity < 0 && (s.Reason == StockCreditSale || s.Reason == StockCashSale)
+}
+
+// ReasonLabel returns the reason of the movement for display
+func (s StockMovement) ReasonLabel() string {
+	switch s.Reason {
+	case StockOpening:
+		return "Opening balance"
+	case StockRestock:
+		return "Restock"
+	case StockCreditSale:
+		return "Credit sale"
+	case StockCashSale:
+		return "Cash sale"
+	case StockAdjustment:
+		return "Adjustment"
+	case StockReceived:
+		return "Received from supplier"
+	case StockTakeCorrection:
+		return "Stock take"
+	case StockTransferOut:
+		return "Transferred out"
+	case StockTransferIn:
+		return "Transferred in"
+	}
+	return s.Reason
+}
+
+// StockDrift is a product whose units on hand disagree with its stock ledger, at one location
+// or, when Location is empty, in total
+type StockDrift struct {
+	Serial   string
+	Name     string
+	Location string
+	Units    int
+	Ledger   int
+}
+
+// StockAlert is raised once when a product falls to its reorder point and cleared when it is
+// restocked above it
+type StockAlert struct {
+	ID           int
+	Serial       string
+	Name         string
+	Units        int
+	ReorderPoint int
+	ReorderQty   int
+	RaisedAt     time.Time
+	ClearedAt    time.Time
+}
+
+// Location is a place stock is kept, such as the shop floor, a back store or a branch
+type Location struct {
+	ID        int
+	Name      string
+	Address   string
+	IsDefault bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// StockBatch is a lot of a product at a location and the units of it left, ExpiresAt is zero
+// for a batch that does not expire
+type StockBatch struct {
+	ID           int
+	Serial       string
+	Name         string
+	LocationId   int
+	LocationName string
+	BatchNo      string
+	ExpiresAt    time.Time
+	Units        int
+	CreatedAt    time.Time
+}
+
+// DaysLeft returns the whole days from now until the batch expires, negative once it has
+func (b StockBatch) DaysLeft(now time.Time) int {
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	y, m, d = b.ExpiresAt.Date()
+	expiry := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	return int(expiry.Sub(today).Hours() / 24)
+}
+
+// IsExpired reports whether the batch expired before today
+func (b StockBatch) IsExpired() bool {
+	return !b.ExpiresAt.IsZero() && b.DaysLeft(time.Now()) < 0
+}
+
+// LocationStock is the units of a product at a location
+type LocationStock struct {
+	LocationId   int
+	LocationName string
+	Units        int
+}
+
+// StockLevel is the units of a product at each location, by location id, and in total
+type StockLevel struct {
+	Serial    string
+	Name      string
+	CostPrice float64
+	Locations map[int]int
+	Total     int
+}
+
+// Units returns the units of the product at a location, or in total when locationId is zero
+func (s StockLevel) Units(locationId int) int {
+	if locationId == 0 {
+		return s.Total
+	}
+	return s.Locations[locationId]
+}
+
+// Value returns the units of the product at a location, or in total when locationId is zero, at
+// its cost price
+func (s StockLevel) Value(locationId int) float64 {
+	return float64(s.Units(locationId)) * s.CostPrice
+}
+
+// Stock transfer statuses
+const (
+	TransferDraft       = "draft"
+	TransferTransferred = "transferred"
+)
+
+// StockTransfer is a document moving stock from one location to another
+type StockTransfer struct {
+	ID            int
+	FromId        int
+	FromName      string
+	ToId          int
+	ToName        string
+	Status        string
+	Notes         string
+	UserId        int
+	Username      string
+	TransferredAt time.Time
+	Lines         []StockTransferLine
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// StockTransferLine is a product moved on a stock transfer
+type StockTransferLine struct {
+	ID         int
+	TransferId int
+	Serial     string
+	Name       string
+	Quantity   int
+}
+
+// Units returns the units moved on the transfer
+func (t StockTransfer) Units() int {
+	n := 0
+	for _, l := range t.Lines {
+		n += l.Quantity
+	}
+	return n
+}
+
+// StatusLabel returns the status of the transfer for display
+func (t StockTransfer) StatusLabel() string {
+	switch t.Status {
+	case TransferDraft:
+		return "Draft"
+	case TransferTransferred:
+		return "Transferred"
+	}
+	return t.Status
+}
+
+// ProductImage is a photo of a product, the primary image is the one shown in the product list
+type ProductImage struct {
+	ID        int
+	Serial    string
+	IsPrimary bool
+	Size      int
+	UserId    int
+	CreatedAt time.Time
+}
+
+// PriceChange is a price a product had from its effective date, or is scheduled to have when
+// AppliedAt is still zero
+type PriceChange struct {
+	ID          int
+	Serial      string
+	Name        string
+	Price       float64
+	EffectiveAt time.Time
+	AppliedAt   time.Time
+	Note        string
+	UserId      int
+	Username    string
+	CreatedAt   time.Time
+}
+
+// IsPending reports whether the change is waiting for its effective date
+func (c PriceChange) IsPending() bool {
+	return c.AppliedAt.IsZero()
+}
+
+// Supplier is a business stock is bought from
+type Supplier struct {
+	ID          int
+	Name        string
+	ContactName string
+	Phone       string
+	Email       string
+	Address     string
+	Notes       string
+	UserId      int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Purchase order statuses, an order moves through them in this order
+const (
+	OrderDraft    = "draft"
+	OrderOrdered  = "ordered"
+	OrderPartial  = "partially_received"
+	OrderReceived = "received"
+)
+
+// PurchaseOrder is an order of stock from a supplier
+type PurchaseOrder struct {
+	ID           int
+	SupplierId   int
+	SupplierName string
+	Status       string
+	Notes        string
+	ExpectedAt   time.Time
+	OrderedAt    time.Time
+	ReceivedAt   time.Time
+	UserId       int
+	Username     string
+	Lines        []PurchaseOrderLine
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// PurchaseOrderLine is a product ordered on a purchase order
+type PurchaseOrderLine struct {
+	ID       int
+	OrderId  int
+	Serial   string
+	Name     string
+	Quantity int
+	Received int
+	UnitCost float64
+}
+
+// Outstanding returns how many units are still to be received
+func (l PurchaseOrderLine) Outstanding() int {
+	return l.Quantity - l.Received
+}
+
+// Total returns the cost of the units ordered
+func (l PurchaseOrderLine) Total() float64 {
+	return float64(l.Quantity) * l.UnitCost
+}
+
+// Total returns the cost of the order
+func (o PurchaseOrder) Total() float64 {
+	total := 0.0
+	for _, l := range o.Lines {
+		total += l.Total()
+	}
+	return total
+}
+
+// StatusLabel returns the status of the order for display
+func (o PurchaseOrder) StatusLabel() string {
+	switch o.Status {
+	case OrderDraft:
+		return "Draft"
+	case OrderOrdered:
+		return "Ordered"
+	case OrderPartial:
+		return "Partially received"
+	case OrderReceived:
+		return "Received"
+	}
+	return o.Status
+}
+
+// Receivable reports whether goods can be received against the order
+func (o PurchaseOrder) Receivable() bool {
+	return o.Status == OrderOrdered || o.Status == OrderPartial
+}
+
+// PurchaseOrderReceipt is a delivery of units against a purchase order line, what was paid
+// for each and the batch they belong to
+type PurchaseOrderReceipt struct {
+	LineId    int
+	Quantity  int
+	UnitCost  float64
+	BatchNo   string
+	ExpiresAt time.Time
+}
+
+// Stock take statuses, a stock take is counted until it is approved or cancelled
+const (
+	StockTakeCounting  = "counting"
+	StockTakeApproved  = "approved"
+	StockTakeCancelled = "cancelled"
+)
+
+// StockTake is a count of the shelves against a snapshot of the units on hand, optionally of
+// the products in one category and its subcategories. Products and Counted say how many lines
+// it has and how many of them have been counted.
+type StockTake struct {
+	ID           int
+	Name         string
+	LocationId   int
+	LocationName string
+	CategoryId   int
+	CategoryPath string
+	Status       string
+	Notes        string
+	UserId       int
+	Username     string
+	ApprovedBy   int
+	ApproverName string
+	ApprovedAt   time.Time
+	Products     int
+	Counted      int
+	Lines        []StockTakeLine
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// StockTakeLine is a product on a stock take with the units on hand when the snapshot was
+// frozen and, once counted, the units found on the shelf
+type StockTakeLine struct {
+	ID          int
+	StockTakeId int
+	Serial      string
+	Name        string
+	Snapshot    int
+	UnitCost    float64
+	Counted     int
+	Moved       int
+	CountedBy   int
+	CounterName string
+	CountedAt   time.Time
+	Posted      bool
+}
+
+// IsCounted reports whether the line has been counted
+func (l StockTakeLine) IsCounted() bool {
+	return !l.CountedAt.IsZero()
+}
+
+// Expected returns the units that should have been on the shelf when the line was counted, the
+// snapshot with the sales and deliveries since
+func (l StockTakeLine) Expected() int {
+	return l.Snapshot + l.Moved
+}
+
+// Variance returns the units found over (or, when negative, short of) those expected
+func (l StockTakeLine) Variance() int {
+	if !l.IsCounted() {
+		return 0
+	}
+	return l.Counted - l.Expected()
+}
+
+// ExpectedValue returns the cost of the units expected
+func (l StockTakeLine) ExpectedValue() float64 {
+	return float64(l.Expected()) * l.UnitCost
+}
+
+// CountedValue returns the cost of the units counted
+func (l StockTakeLine) CountedValue() float64 {
+	return float64(l.Counted) * l.UnitCost
+}
+
+// VarianceValue returns the cost of the variance
+func (l StockTakeLine) VarianceValue() float64 {
+	return float64(l.Variance()) * l.UnitCost
+}
+
+// StatusLabel returns the status of the stock take for display
+func (t StockTake) StatusLabel() string {
+	switch t.Status {
+	case StockTakeCounting:
+		return "Counting"
+	case StockTakeApproved:
+		return "Approved"
+	case StockTakeCancelled:
+		return "Cancelled"
+	}
+	return t.Status
+}
+
+// StockTakeTotals sums the counted lines of a stock take
+type StockTakeTotals struct {
+	ExpectedValue float64
+	CountedValue  float64
+	VarianceValue float64
+	Over          int
+	Short         int
+}
+
+// Totals returns the expected, counted and variance values of the counted lines, with how many
+// were found over or short
+func (t StockTake) Totals() StockTakeTotals {
+	var totals StockTakeTotals
+	for _, l := range t.Lines {
+		if !l.IsCounted() {
+			continue
+		}
+		totals.ExpectedValue += l.ExpectedValue()
+		totals.CountedValue += l.CountedValue()
+		totals.VarianceValue += l.VarianceValue()
+		switch {
+		case l.Variance() > 0:
+			totals.Over++
+		case l.Variance() < 0:
+			totals.Short++
+		}
+	}
+	return totals
+}
+
+// StockCount is the units counted on the shelf for a stock take line
+type StockCount struct {
+	LineId  int
+	Counted int
+}
+
+// Gross profit report groupings
+const (
+	ProfitByProduct     = "product"
+	ProfitByDay         = "day"
+	ProfitByMonth       = "month"
+	ProfitBySalesperson = "salesperson"
+)
+
+// ProfitFilter chooses how the gross profit report is grouped and the sales it covers, a zero
+// time leaves that end of the period open
+type ProfitFilter struct {
+	GroupBy string
+	From    time.Time
+	To      time.Time
+}
+
+// GrossProfit is a line of the gross profit report, the cash and credit sales of a product,
+// period or salesperson at the cost the units were carried at when they were sold
+type GrossProfit struct {
+	Key      string
+	Label    string
+	Quantity int
+	Revenue  float64
+	Cost     float64
+}
+
+// Profit returns the revenue left after the cost of the units sold
+func (g GrossProfit) Profit() float64 {
+	return g.Revenue - g.Cost
+}
+
+// Margin returns the profit as a percentage of revenue
+func (g GrossProfit) Margin() float64 {
+	if g.Revenue == 0 {
+		return 0
+	}
+	return g.Profit() / g.Revenue * 100
+}
+
+// Category groups products, a category with a parent is a subcategory of it
+type Category struct {
+	ID        int
+	Name      string
+	ParentId  int
+	Path      string
+	Depth     int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Brand is the maker a product is sold under
+type Brand struct {
+	ID        int
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// ProductAttribute is a named property of a product such as its size or colour
+type ProductAttribute struct {
+	Name  string
+	Value string
+}
+
+// ProductFilter narrows down the product list, zero fields match everything. A category
+// matches the products in its subcategories too. Only products on sale are matched unless
+// Archived is set, which matches the archived products instead.
+type ProductFilter struct {
+	Search     string
+	CategoryId int
+	BrandId    int
+	Attributes []ProductAttribute
+	Archived   bool
+	Page       int
+	Limit      int
+}
+
+// ParseProductFilter reads a product filter from a query string, attributes are given as
+// attr=name:value
+func ParseProductFilter(q url.Values) ProductFilter {
+	f := ProductFilter{
+		Search: strings.TrimSpace(q.Get("q")),
+	}
+	f.CategoryId, _ = strconv.Atoi(q.Get("category"))
+	f.BrandId, _ = strconv.Atoi(q.Get("brand"))
+	f.Archived = q.Get("archived") == "1"
+
+	for _, attr := range q["attr"] {
+		name, value, ok := strings.Cut(attr, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" {
+			continue
+		}
+		f = f.withAttribute(name, strings.TrimSpace(value))
+	}
+
+	return f
+}
+
+// Values returns the filter as query string values, the page is left out
+func (f ProductFilter) Values() url.Values {
+	v := url.Values{}
+	if f.Search != "" {
+		v.Set("q", f.Search)
+	}
+	if f.CategoryId != 0 {
+		v.Set("category", strconv.Itoa(f.CategoryId))
+	}
+	if f.BrandId != 0 {
+		v.Set("brand", strconv.Itoa(f.BrandId))
+	}
+	for _, a := range f.Attributes {
+		v.Add("attr", a.Name+":"+a.Value)
+	}
+	if f.Archived {
+		v.Set("archived", "1")
+	}
+	return v
+}
+
+// Query returns the filter as a query string starting with ?, or nothing when no filter is set
+func (f ProductFilter) Query() string {
+	if q := f.Values().Encode(); q != "" {
+		return "?" + q
+	}
+	return ""
+}
+
+// Filtered reports whether any filter is set
+func (f ProductFilter) Filtered() bool {
+	return f.Query() != ""
+}
+
+// ToggleCategory returns the query string of the filter narrowed down to the category, or no
+// longer narrowed down by it when it is already chosen
+func (f ProductFilter) ToggleCategory(id int) string {
+	if f.CategoryId == id {
+		id = 0
+	}
+	f.CategoryId = id
+	return f.Query()
+}
+
+// ToggleBrand returns the query string of the filter narrowed down to the brand, or no longer
+// narrowed down by it when it is already chosen
+func (f ProductFilter) ToggleBrand(id int) string {
+	if f.BrandId == id {
+		id = 0
+	}
+	f.BrandId = id
+	return f.Query()
+}
+
+// ToggleArchived returns the query string of the filter switched between the products on sale
+// and the archived ones
+func (f ProductFilter) ToggleArchived() string {
+	f.Archived = !f.Archived
+	return f.Query()
+}
+
+// ToggleAttribute returns the query string of the filter narrowed down to the attribute value,
+// or no longer narrowed down by it when it is already chosen
+func (f ProductFilter) ToggleAttribute(name, value string) string {
+	if f.HasAttribute(name, value) {
+		f = f.withAttribute(name, "")
+	} else {
+		f = f.withAttribute(name, value)
+	}
+	return f.Query()
+}
+
+// HasAttribute reports whether the filter is narrowed down to the attribute value
+func (f ProductFilter) HasAttribute(name, value string) bool {
+	for _, a := range f.Attributes {
+		if a.Name == name && a.Value == value {
+			return true
+		}
+	}
+	return false
+}
+
+// withAttribute returns a copy of the filter with the attribute set to value, or removed when
+// value is empty, an attribute is matched on one value at a time
+func (f ProductFilter) withAttribute(name, value string) ProductFilter {
+	attrs := make([]ProductAttribute, 0, len(f.Attributes)+1)
+	for _, a := range f.Attributes {
+		if a.Name != name {
+			attrs = append(attrs, a)
+		}
+	}
+	if value != "" {
+		attrs = append(attrs, ProductAttribute{Name: name, Value: value})
+	}
+	f.Attributes = attrs
+	return f
+}
+
+// FacetCount is a category, brand or attribute value and how many products have it
+type FacetCount struct {
+	ID       int
+	Name     string
+	Value    string
+	Depth    int
+	Count    int
+	Selected bool
+}
+
+// ProductFacets counts the products in each category, brand and attribute value, each facet
+// is counted against the rest of the filter so the other choices stay visible
+type ProductFacets struct {
+	Categories []FacetCount
+	Brands     []FacetCount
+	Attributes []FacetCount
+}
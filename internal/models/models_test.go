@@ -0,0 +1,189 @@
+package models
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseProductFilter(t *testing.T) {
+	q := url.Values{}
+	q.Set("q", " phone ")
+	q.Set("category", "3")
+	q.Set("brand", "7")
+	q.Add("attr", "Size:Large")
+	q.Add("attr", "colour:Red")
+	q.Add("attr", "size:Small")
+	q.Add("attr", "broken")
+	q.Set("archived", "1")
+
+	f := ParseProductFilter(q)
+	if f.Search != "phone" || f.CategoryId != 3 || f.BrandId != 7 || !f.Archived {
+		t.Errorf("got %+v", f)
+	}
+
+	if len(f.Attributes) != 2 || !f.HasAttribute("colour", "Red") || !f.HasAttribute("size", "Small") {
+		t.Errorf("expected colour and the last size to be kept, got %v", f.Attributes)
+	}
+
+	again := ParseProductFilter(f.Values())
+	if again.Query() != f.Query() {
+		t.Errorf("query did not round trip, got %s want %s", again.Query(), f.Query())
+	}
+}
+
+func TestProductFilter_Toggle(t *testing.T) {
+	f := ProductFilter{CategoryId: 3}
+
+	if got := f.ToggleCategory(3); got != "" {
+		t.Errorf("toggling the chosen category should clear it, got %q", got)
+	}
+	if got := f.ToggleCategory(4); got != "?category=4" {
+		t.Errorf("got %q", got)
+	}
+	if got := f.ToggleBrand(2); got != "?brand=2&category=3" {
+		t.Errorf("got %q", got)
+	}
+
+	f.Attributes = []ProductAttribute{{Name: "size", Value: "Large"}}
+	if got := f.ToggleAttribute("size", "Large"); got != "?category=3" {
+		t.Errorf("toggling the chosen value should clear it, got %q", got)
+	}
+	if got := f.ToggleAttribute("size", "Small"); got != "?attr=size%3ASmall&category=3" {
+		t.Errorf("toggling another value should replace it, got %q", got)
+	}
+	if len(f.Attributes) != 1 || f.Attributes[0].Value != "Large" {
+		t.Errorf("toggling changed the filter, got %v", f.Attributes)
+	}
+	if got := f.ToggleArchived(); got != "?archived=1&attr=size%3ALarge&category=3" {
+		t.Errorf("got %q", got)
+	}
+
+	f.Archived = true
+	if got := f.ToggleArchived(); got != "?attr=size%3ALarge&category=3" {
+		t.Errorf("toggling back should list the products on sale, got %q", got)
+	}
+}
+
+func TestStockTake_Totals(t *testing.T) {
+	counted := time.Now()
+	st := StockTake{Lines: []StockTakeLine{
+		// 2 sold since the snapshot and 7 found, 1 over
+		{Snapshot: 8, Moved: -2, Counted: 7, CountedAt: counted, UnitCost: 2.5},
+		// 4 short
+		{Snapshot: 10, Counted: 6, CountedAt: counted, UnitCost: 1},
+		// not counted yet
+		{Snapshot: 5, UnitCost: 3},
+	}}
+
+	if v := st.Lines[0].Variance(); v != 1 {
+		t.Errorf("variance should allow for the units sold since the snapshot, got %d", v)
+	}
+	if v := st.Lines[2].Variance(); v != 0 {
+		t.Errorf("a line not counted has no variance, got %d", v)
+	}
+
+	got := st.Totals()
+	want := StockTakeTotals{ExpectedValue: 25, CountedValue: 23.5, VarianceValue: -1.5, Over: 1, Short: 1}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestStockLevel_Units(t *testing.T) {
+	s := StockLevel{CostPrice: 2.5, Locations: map[int]int{1: 3, 2: 5}, Total: 8}
+
+	if u := s.Units(0); u != 8 {
+		t.Errorf("units with no location should be the total, got %d", u)
+	}
+	if u := s.Units(2); u != 5 {
+		t.Errorf("got %d units at location 2, want 5", u)
+	}
+	if u := s.Units(3); u != 0 {
+		t.Errorf("a location without the product should hold no units, got %d", u)
+	}
+	if v := s.Value(1); v != 7.5 {
+		t.Errorf("got value %v at location 1, want 7.5", v)
+	}
+}
+
+func TestStockBatch_DaysLeft(t *testing.T) {
+	now := time.Date(2026, 3, 10, 18, 30, 0, 0, time.Local)
+
+	tests := []struct {
+		expires time.Time
+		want    int
+	}{
+		{time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC), 0},
+		{time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC), 1},
+		{time.Date(2026, 4, 9, 0, 0, 0, 0, time.UTC), 30},
+		{time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC), -2},
+	}
+
+	for _, tt := range tests {
+		b := StockBatch{ExpiresAt: tt.expires}
+		if got := b.DaysLeft(now); got != tt.want {
+			t.Errorf("expiring %s: got %d days left, want %d", tt.expires.Format("2006-01-02"), got, tt.want)
+		}
+	}
+
+	if (StockBatch{}).IsExpired() {
+		t.Error("a batch without an expiry date should never be expired")
+	}
+}
+
+func TestPurchaseOrder_Total(t *testing.T) {
+	o := PurchaseOrder{Lines: []PurchaseOrderLine{
+		{Quantity: 10, Received: 4, UnitCost: 2.5},
+		{Quantity: 3, Received: 3, UnitCost: 12},
+	}}
+
+	if got := o.Total(); got != 61 {
+		t.Errorf("got total %v, want 61", got)
+	}
+	if got := o.Lines[0].Outstanding(); got != 6 {
+		t.Errorf("got %d units outstanding, want 6", got)
+	}
+	if got := o.Lines[1].Outstanding(); got != 0 {
+		t.Errorf("got %d units outstanding on a received line, want 0", got)
+	}
+}
+
+func TestPurchaseOrder_Receivable(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{OrderDraft, false},
+		{OrderOrdered, true},
+		{OrderPartial, true},
+		{OrderReceived, false},
+	}
+
+	for _, tt := range tests {
+		if got := (PurchaseOrder{Status: tt.status}).Receivable(); got != tt.want {
+			t.Errorf("%s: got receivable %t, want %t", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestGrossProfit_Margin(t *testing.T) {
+	tests := []struct {
+		g          GrossProfit
+		wantProfit float64
+		wantMargin float64
+	}{
+		{GrossProfit{Revenue: 200, Cost: 150}, 50, 25},
+		{GrossProfit{Revenue: 100, Cost: 120}, -20, -20},
+		{GrossProfit{}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.g.Profit(); got != tt.wantProfit {
+			t.Errorf("revenue %v cost %v: got profit %v, want %v", tt.g.Revenue, tt.g.Cost, got, tt.wantProfit)
+		}
+		if got := tt.g.Margin(); got != tt.wantMargin {
+			t.Errorf("revenue %v cost %v: got margin %v, want %v", tt.g.Revenue, tt.g.Cost, got, tt.wantMargin)
+		}
+	}
+}
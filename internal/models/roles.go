@@ -0,0 +1,123 @@
+package models
+
+// Access levels a user can be given
+const (
+	AccessOwner     = "owner"
+	AccessManager   = "manager"
+	AccessClerk     = "clerk"
+	AccessCollector = "collector"
+)
+
+// Permissions checked by the web and api routes
+const (
+	PermViewProducts    = "products.view"
+	PermManageProducts  = "products.manage"
+	PermAdjustStock     = "stock.adjust"
+	PermCountStock      = "stock.count"
+	PermViewCustomers   = "customers.view"
+	PermManageContracts = "contracts.manage"
+	PermCollectPayments = "payments.collect"
+	PermSell            = "sales.create"
+	PermViewSales       = "sales.view"
+	PermManageUsers     = "users.manage"
+	PermUnlockUsers     = "users.unlock"
+	PermRevokeSessions  = "sessions.revoke"
+	PermViewAudit       = "audit.view"
+	PermManagePurchases = "purchasing.manage"
+	PermViewReports     = "reports.view"
+)
+
+// AccessLevel describes an access level offered on the user form
+type AccessLevel struct {
+	Value string
+	Label string
+}
+
+// AccessLevels lists the access levels in order of seniority
+var AccessLevels = []AccessLevel{
+	{Value: AccessOwner, Label: "Owner"},
+	{Value: AccessManager, Label: "Manager"},
+	{Value: AccessClerk, Label: "Sales Clerk"},
+	{Value: AccessCollector, Label: "Collector"},
+}
+
+// legacyAccessLevels maps the access levels stored before roles existed
+var legacyAccessLevels = map[string]string{
+	"superuser": AccessOwner,
+	"user":      AccessClerk,
+}
+
+var rolePermissions = map[string][]string{
+	AccessOwner: {
+		PermViewProducts, PermManageProducts, PermAdjustStock, PermCountStock, PermViewCustomers,
+		PermManageContracts, PermCollectPayments, PermSell, PermViewSales, PermManageUsers, PermUnlockUsers,
+		PermRevokeSessions, PermViewAudit, PermManagePurchases, PermViewReports,
+	},
+	AccessManager: {
+		PermViewProducts, PermManageProducts, PermAdjustStock, PermCountStock, PermViewCustomers,
+		PermManageContracts, PermCollectPayments, PermSell, PermViewSales, PermUnlockUsers,
+		PermRevokeSessions, PermManagePurchases, PermViewReports,
+	},
+	AccessClerk: {
+		PermViewProducts, PermCountStock, PermViewCustomers, PermManageContracts, PermCollectPayments, PermSell,
+		PermViewSales,
+	},
+	AccessCollector: {
+		PermViewCustomers, PermCollectPayments,
+	},
+}
+
+// Role returns the access level with legacy values mapped to their role
+func Role(accessLevel string) string {
+	if role, ok := legacyAccessLevels[accessLevel]; ok {
+		return role
+	}
+	return accessLevel
+}
+
+// IsAccessLevel reports whether level is one of the known access levels
+func IsAccessLevel(level string) bool {
+	_, ok := rolePermissions[level]
+	return ok
+}
+
+// RoleCan reports whether the access level grants the permission
+func RoleCan(accessLevel, perm string) bool {
+	for _, p := range rolePermissions[Role(accessLevel)] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns every permission granted to the access level
+func Permissions(accessLevel string) []string {
+	return append([]string(nil), rolePermissions[Role(accessLevel)]...)
+}
+
+// Role returns the user's role
+func (u User) Role() string {
+	return Role(u.AccessLevel)
+}
+
+// RoleLabel returns a display name for the user's role
+func (u User) RoleLabel() string {
+	role := u.Role()
+	for _, l := range AccessLevels {
+		if l.Value == role {
+			return l.Label
+		}
+	}
+	return role
+}
+
+// Permissions returns every permission the user has
+func (u User) Permissions() []string {
+	return Permissions(u.AccessLevel)
+}
+
+// Can reports whether the user has the permission
+func (u User) Can(perm string) bool {
+	return RoleCan(u.AccessLevel, perm)
+}
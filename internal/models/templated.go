@@ -13,4 +13,5 @@ type TemplateData struct {
 	Error           string
 	Form            *forms.Form
 	IsAuthenticated int
+	LicenseBanner   string
 }
@@ -0,0 +1,52 @@
+// Package pricing puts scheduled price changes into effect in the background once their
+// effective date is reached, so nobody has to be at the till to change the prices.
+package pricing
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// Scheduler applies the scheduled price changes
+type Scheduler struct {
+	DB       repository.DatabaseRepo
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// Apply writes the price changes that have reached their effective date since the last run to
+// their products and returns them
+func (s *Scheduler) Apply() ([]models.PriceChange, error) {
+	applied, err := s.DB.ApplyScheduledPrices()
+	if err != nil {
+		return applied, err
+	}
+
+	for _, c := range applied {
+		s.InfoLog.Printf("Price change: %s (%s) is now %.2f\n", c.Name, c.Serial, c.Price)
+	}
+
+	return applied, nil
+}
+
+// Run applies the due price changes now and then every interval until ctx is done
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Apply(); err != nil {
+			s.ErrorLog.Println("scheduled prices:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
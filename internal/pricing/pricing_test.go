@@ -0,0 +1,74 @@
+package pricing
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+type testRepo struct {
+	repository.DatabaseRepo
+	due  []models.PriceChange
+	runs int
+}
+
+func (r *testRepo) ApplyScheduledPrices() ([]models.PriceChange, error) {
+	r.runs++
+	due := r.due
+	r.due = nil
+	return due, nil
+}
+
+func TestScheduler_Apply(t *testing.T) {
+	var out bytes.Buffer
+	repo := &testRepo{due: []models.PriceChange{{Serial: "SN-1", Name: "Rice", Price: 12.5}}}
+	s := &Scheduler{DB: repo, InfoLog: log.New(&out, "", 0), ErrorLog: log.New(&out, "", 0)}
+
+	applied, err := s.Apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 {
+		t.Fatalf("expected 1 price change, got %d", len(applied))
+	}
+	if !strings.Contains(out.String(), "Rice (SN-1) is now 12.50") {
+		t.Errorf("price change was not logged: %q", out.String())
+	}
+
+	out.Reset()
+	applied, _ = s.Apply()
+	if len(applied) != 0 || out.Len() != 0 {
+		t.Errorf("expected nothing applied on the second run, got %d and %q", len(applied), out.String())
+	}
+}
+
+func TestScheduler_Run(t *testing.T) {
+	var out bytes.Buffer
+	repo := &testRepo{}
+	s := &Scheduler{DB: repo, InfoLog: log.New(&out, "", 0), ErrorLog: log.New(&out, "", 0)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx, 5*time.Millisecond)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return once its context was done")
+	}
+
+	if repo.runs < 2 {
+		t.Errorf("expected prices to be applied repeatedly, applied %d times", repo.runs)
+	}
+}
@@ -0,0 +1,282 @@
+package productfile
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jofosuware/small-business-management-app/internal/forms"
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// pageSize is how many products are fetched at a time when the whole catalogue is read
+const pageSize = 500
+
+// Row is a row of an import file checked against the product it adds or changes
+type Row struct {
+	Line    int
+	Product models.Product
+	New     bool
+	Form    *forms.Form
+}
+
+// Valid reports whether the row can be imported
+func (r Row) Valid() bool {
+	return r.Form.Valid()
+}
+
+// Problems lists the validation errors of the row with the labels of their fields
+func (r Row) Problems() []string {
+	var problems []string
+	for field, messages := range r.Form.Errors {
+		for _, msg := range messages {
+			problems = append(problems, fmt.Sprintf("%s: %s", Label(field), msg))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// Result counts the products an import added and changed, and the rows it skipped
+type Result struct {
+	Created int
+	Updated int
+	Skipped int
+}
+
+// Products reads the whole catalogue with the categories, brands and attributes of the products,
+// the archived products after those on sale so rows for them are matched rather than added
+func Products(repo repository.DatabaseRepo) ([]models.Product, error) {
+	var products []models.Product
+	for _, archived := range []bool{false, true} {
+		for page := 1; ; page++ {
+			p, err := repo.FetchProducts(models.ProductFilter{Archived: archived, Page: page, Limit: pageSize})
+			if err != nil {
+				return products, err
+			}
+			products = append(products, p...)
+			if len(p) < pageSize {
+				break
+			}
+		}
+	}
+	return products, nil
+}
+
+// Check validates each row of the sheet as mapped, with the same checks as a product added by
+// hand. existing holds the products in the catalogue by serial number, a row for one of them
+// only changes the fields it gives a value for.
+func Check(s Sheet, m Mapping, existing map[string]models.Product) []Row {
+	var rows []Row
+	seen := make(map[string]int)
+
+	for i, cells := range s.Rows {
+		if blank(cells) {
+			continue
+		}
+
+		values := url.Values{}
+		var attrs []models.ProductAttribute
+		for col, field := range m {
+			if field == "" || col >= len(cells) {
+				continue
+			}
+			v := strings.TrimSpace(cells[col])
+			if field == Attribute {
+				if v != "" {
+					attrs = append(attrs, models.ProductAttribute{Name: attributeName(s.Header, col), Value: v})
+				}
+				continue
+			}
+			values.Set(field, v)
+		}
+
+		row := Row{Line: i + 2, Form: forms.New(values)}
+		serial := values.Get("serial")
+
+		p, ok := existing[serial]
+		row.New = !ok
+		row.Form.Required("serial")
+		if row.New {
+			row.Form.Required("name", "description", "price", "units")
+		}
+		row.Form.IsNumber("price", 0)
+		row.Form.IsNumber("cost_price", 0)
+		row.Form.IsWholeNumber("units", 0)
+		row.Form.IsWholeNumber("reorder_point", 0)
+		row.Form.IsWholeNumber("reorder_qty", 0)
+
+		if line, dup := seen[serial]; dup && serial != "" {
+			row.Form.Errors.Add("serial", fmt.Sprintf("This serial number is also on line %d", line))
+		} else {
+			seen[serial] = row.Line
+		}
+
+		if row.New {
+			p = models.Product{Serial: serial}
+		}
+		row.Product = apply(p, values, attrs)
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// apply returns the product with the values given in a row, empty values leave a field as it is
+func apply(p models.Product, values url.Values, attrs []models.ProductAttribute) models.Product {
+	number := func(field string) float64 {
+		n, _ := strconv.ParseFloat(values.Get(field), 64)
+		return n
+	}
+
+	for field := range values {
+		if values.Get(field) == "" {
+			continue
+		}
+		switch field {
+		case "name":
+			p.Name = values.Get(field)
+		case "description":
+			p.Description = values.Get(field)
+		case "price":
+			p.Price = number(field)
+		case "cost_price":
+			p.CostPrice = number(field)
+		case "units":
+			p.Units = int32(number(field))
+		case "reorder_point":
+			p.ReorderPoint = int32(number(field))
+		case "reorder_qty":
+			p.ReorderQty = int32(number(field))
+		case "category":
+			p.CategoryId, p.CategoryPath = 0, values.Get(field)
+		case "brand":
+			p.BrandId, p.BrandName = 0, values.Get(field)
+		}
+	}
+
+	merged := append([]models.ProductAttribute(nil), p.Attributes...)
+	for _, a := range attrs {
+		replaced := false
+		for i := range merged {
+			if merged[i].Name == a.Name {
+				merged[i].Value, replaced = a.Value, true
+			}
+		}
+		if !replaced {
+			merged = append(merged, a)
+		}
+	}
+	p.Attributes = merged
+
+	return p
+}
+
+// Import adds or updates the product of each valid row and skips the others, the categories
+// and brands named by the rows are created when they do not exist yet. Run it in a transaction
+// so a failure leaves the catalogue as it was.
+func Import(repo repository.DatabaseRepo, rows []Row, userId int) (Result, error) {
+	var result Result
+
+	categories, err := repo.FetchCategories()
+	if err != nil {
+		return result, err
+	}
+	categoryIds := make(map[string]int)
+	for _, c := range categories {
+		categoryIds[categoryKey(c.Path)] = c.ID
+	}
+
+	brands, err := repo.FetchBrands()
+	if err != nil {
+		return result, err
+	}
+	brandIds := make(map[string]int)
+	for _, b := range brands {
+		brandIds[strings.ToLower(b.Name)] = b.ID
+	}
+
+	for _, row := range rows {
+		if !row.Valid() {
+			result.Skipped++
+			continue
+		}
+
+		p := row.Product
+		p.UserId = userId
+
+		if p.CategoryId == 0 && p.CategoryPath != "" {
+			p.CategoryId, err = category(repo, categoryIds, p.CategoryPath)
+			if err != nil {
+				return result, fmt.Errorf("line %d: %w", row.Line, err)
+			}
+		}
+
+		if key := strings.ToLower(p.BrandName); p.BrandId == 0 && key != "" {
+			id, ok := brandIds[key]
+			if !ok {
+				id, err = repo.InsertBrand(models.Brand{Name: p.BrandName})
+				if err != nil {
+					return result, fmt.Errorf("line %d: %w", row.Line, err)
+				}
+				brandIds[key] = id
+			}
+			p.BrandId = id
+		}
+
+		if row.New {
+			_, err = repo.InsertProduct(p)
+			result.Created++
+		} else {
+			err = repo.UpdateProduct(p)
+			result.Updated++
+		}
+		if err != nil {
+			return result, fmt.Errorf("line %d: %w", row.Line, err)
+		}
+	}
+
+	return result, nil
+}
+
+// category returns the id of the category at a path such as Phones / Android, creating the
+// categories along it that do not exist yet
+func category(repo repository.DatabaseRepo, ids map[string]int, path string) (int, error) {
+	var names []string
+	for _, name := range strings.Split(path, "/") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	parent := 0
+	for i, name := range names {
+		key := categoryKey(strings.Join(names[:i+1], "/"))
+		id, ok := ids[key]
+		if !ok {
+			var err error
+			id, err = repo.InsertCategory(models.Category{Name: name, ParentId: parent})
+			if err != nil {
+				return 0, err
+			}
+			ids[key] = id
+		}
+		parent = id
+	}
+
+	return parent, nil
+}
+
+// categoryKey returns a category path in one spelling, lower cased with single separators
+func categoryKey(path string) string {
+	var names []string
+	for _, name := range strings.Split(path, "/") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+	return strings.Join(names, " / ")
+}
@@ -0,0 +1,167 @@
+package productfile
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// AttributePrefix starts the header of a column holding a product attribute, as in attr:colour
+const AttributePrefix = "attr:"
+
+// Attribute maps a column to the product attribute named by its header
+const Attribute = "attribute"
+
+// Field is a product field a column can be mapped to
+type Field struct {
+	Name    string
+	Label   string
+	aliases []string
+}
+
+// Fields lists the product fields in the order they are offered when mapping columns
+var Fields = []Field{
+	{Name: "serial", Label: "Serial Number", aliases: []string{"serial no", "sku", "code", "item code", "barcode"}},
+	{Name: "name", Label: "Name", aliases: []string{"product", "product name", "item", "item name"}},
+	{Name: "description", Label: "Description", aliases: []string{"details"}},
+	{Name: "price", Label: "Price", aliases: []string{"selling price", "unit price"}},
+	{Name: "cost_price", Label: "Cost Price", aliases: []string{"cost", "unit cost"}},
+	{Name: "units", Label: "Units in Stock", aliases: []string{"stock", "quantity", "qty"}},
+	{Name: "reorder_point", Label: "Reorder Point"},
+	{Name: "reorder_qty", Label: "Reorder Quantity"},
+	{Name: "category", Label: "Category"},
+	{Name: "brand", Label: "Brand"},
+}
+
+// Mapping holds the field each column of a sheet is imported into, an empty string skips the
+// column
+type Mapping []string
+
+// Guess maps each column whose header names a field, or starts with AttributePrefix, a field
+// is only mapped to the first column naming it
+func Guess(header []string) Mapping {
+	m := make(Mapping, len(header))
+	used := make(map[string]bool)
+
+	for i, h := range header {
+		if strings.HasPrefix(strings.ToLower(h), AttributePrefix) {
+			m[i] = Attribute
+			continue
+		}
+
+		n := normalise(h)
+		for _, f := range Fields {
+			if used[f.Name] || !f.matches(n) {
+				continue
+			}
+			m[i] = f.Name
+			used[f.Name] = true
+			break
+		}
+	}
+
+	return m
+}
+
+// ParseMapping reads the mapping posted as map_0, map_1 and so on, one for each column
+func ParseMapping(form url.Values, columns int) Mapping {
+	m := make(Mapping, columns)
+	for i := range m {
+		m[i] = form.Get("map_" + strconv.Itoa(i))
+	}
+	return m
+}
+
+// Check returns what is wrong with the mapping of the header's columns, the serial number must
+// be mapped and no field or attribute can be mapped twice
+func (m Mapping) Check(header []string) []string {
+	var problems []string
+
+	known := map[string]bool{Attribute: true}
+	for _, f := range Fields {
+		known[f.Name] = true
+	}
+
+	used := make(map[string]bool)
+	attrs := make(map[string]bool)
+	for i, field := range m {
+		switch {
+		case field == "":
+			continue
+		case !known[field]:
+			problems = append(problems, fmt.Sprintf("Column %s cannot be mapped to %s", column(header, i), field))
+		case field == Attribute:
+			name := attributeName(header, i)
+			switch {
+			case name == "":
+				problems = append(problems, fmt.Sprintf("Column %s needs a header to name its attribute", column(header, i)))
+			case strings.Contains(name, ":"):
+				problems = append(problems, fmt.Sprintf("Attribute %s cannot contain a colon", name))
+			case attrs[name]:
+				problems = append(problems, fmt.Sprintf("Attribute %s is mapped more than once", name))
+			}
+			attrs[name] = true
+		case used[field]:
+			problems = append(problems, fmt.Sprintf("%s is mapped more than once", Label(field)))
+		}
+		used[field] = true
+	}
+
+	if !used["serial"] {
+		problems = append(problems, "Map a column to the serial number, products are matched by it")
+	}
+
+	return problems
+}
+
+// Label returns the label of a field
+func Label(field string) string {
+	for _, f := range Fields {
+		if f.Name == field {
+			return f.Label
+		}
+	}
+	return field
+}
+
+// matches reports whether a normalised header names the field
+func (f Field) matches(header string) bool {
+	if header == normalise(f.Name) || header == normalise(f.Label) {
+		return true
+	}
+	for _, a := range f.aliases {
+		if header == a {
+			return true
+		}
+	}
+	return false
+}
+
+// attributeName returns the name of the attribute held in a column, its header without
+// AttributePrefix
+func attributeName(header []string, i int) string {
+	if i >= len(header) {
+		return ""
+	}
+	h := strings.TrimSpace(header[i])
+	if strings.HasPrefix(strings.ToLower(h), AttributePrefix) {
+		h = h[len(AttributePrefix):]
+	}
+	return strings.ToLower(strings.TrimSpace(h))
+}
+
+// column names a column by its header, or its position when it has none
+func column(header []string, i int) string {
+	if i < len(header) && header[i] != "" {
+		return strconv.Quote(header[i])
+	}
+	return strconv.Itoa(i + 1)
+}
+
+// normalise lower cases a header and turns underscores and dashes into single spaces
+func normalise(s string) string {
+	s = strings.ToLower(s)
+	s = strings.NewReplacer("_", " ", "-", " ").Replace(s)
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,225 @@
+// Package productfile reads and writes the product catalogue as csv or xlsx files, so a shop
+// can import its products in bulk instead of adding them one at a time
+package productfile
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/xuri/excelize/v2"
+)
+
+// The file formats products can be imported from and exported to
+const (
+	CSV  = "csv"
+	XLSX = "xlsx"
+)
+
+// MaxRows is how many products a single file can import
+const MaxRows = 5000
+
+var (
+	// ErrFormat is returned for files that are neither csv nor xlsx
+	ErrFormat = errors.New("only csv and xlsx files can be imported")
+	// ErrEmpty is returned for files without a header row
+	ErrEmpty = errors.New("the file has no header row")
+	// ErrTooManyRows is returned for files with more than MaxRows products
+	ErrTooManyRows = fmt.Errorf("a file can import at most %d products", MaxRows)
+)
+
+// Sheet is the header and rows read from an import file
+type Sheet struct {
+	Name   string
+	Header []string
+	Rows   [][]string
+}
+
+// Format returns the file format of a file name, or an empty string when it is not supported
+func Format(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return CSV
+	case ".xlsx":
+		return XLSX
+	}
+	return ""
+}
+
+// Read reads the first sheet of a csv or xlsx file, the first row is taken as the header
+func Read(r io.Reader, filename string) (Sheet, error) {
+	sheet := Sheet{Name: filepath.Base(filename)}
+
+	var records [][]string
+	switch Format(filename) {
+	case CSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		cr.LazyQuotes = true
+		cr.TrimLeadingSpace = true
+
+		var err error
+		records, err = cr.ReadAll()
+		if err != nil {
+			return sheet, err
+		}
+	case XLSX:
+		f, err := excelize.OpenReader(r)
+		if err != nil {
+			return sheet, err
+		}
+		defer f.Close()
+
+		sheets := f.GetSheetList()
+		if len(sheets) == 0 {
+			return sheet, ErrEmpty
+		}
+		records, err = f.GetRows(sheets[0])
+		if err != nil {
+			return sheet, err
+		}
+	default:
+		return sheet, ErrFormat
+	}
+
+	if len(records) == 0 || blank(records[0]) {
+		return sheet, ErrEmpty
+	}
+	if len(records)-1 > MaxRows {
+		return sheet, ErrTooManyRows
+	}
+
+	sheet.Header = records[0]
+	sheet.Header[0] = strings.TrimPrefix(sheet.Header[0], "\ufeff")
+	for i := range sheet.Header {
+		sheet.Header[i] = strings.TrimSpace(sheet.Header[i])
+	}
+	sheet.Rows = records[1:]
+
+	return sheet, nil
+}
+
+// Sample returns up to n rows of the sheet padded to the width of the header, for showing
+// what each column holds while it is mapped
+func (s Sheet) Sample(n int) [][]string {
+	var rows [][]string
+	for _, row := range s.Rows {
+		if len(rows) == n {
+			break
+		}
+		if blank(row) {
+			continue
+		}
+		padded := make([]string, len(s.Header))
+		copy(padded, row)
+		rows = append(rows, padded)
+	}
+	return rows
+}
+
+// blank reports whether every cell of a row is empty
+func blank(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Write writes the products to w as a csv or xlsx file with the same columns an import maps
+// automatically, the cost price is left out unless withCost is set
+func Write(w io.Writer, format string, products []models.Product, withCost bool) error {
+	header := []string{"serial", "name", "description", "price"}
+	if withCost {
+		header = append(header, "cost_price")
+	}
+	header = append(header, "units", "reorder_point", "reorder_qty", "category", "brand")
+
+	seen := make(map[string]bool)
+	var attrs []string
+	for _, p := range products {
+		for _, a := range p.Attributes {
+			if !seen[a.Name] {
+				seen[a.Name] = true
+				attrs = append(attrs, a.Name)
+			}
+		}
+	}
+	sort.Strings(attrs)
+	for _, a := range attrs {
+		header = append(header, AttributePrefix+a)
+	}
+
+	money := func(f float64) string { return strconv.FormatFloat(f, 'f', 2, 64) }
+	count := func(n int32) string { return strconv.Itoa(int(n)) }
+
+	rows := [][]string{header}
+	for _, p := range products {
+		row := []string{p.Serial, p.Name, p.Description, money(p.Price)}
+		if withCost {
+			row = append(row, money(p.CostPrice))
+		}
+		row = append(row, count(p.Units), count(p.ReorderPoint), count(p.ReorderQty), p.CategoryPath, p.BrandName)
+
+		values := make(map[string]string)
+		for _, a := range p.Attributes {
+			values[a.Name] = a.Value
+		}
+		for _, a := range attrs {
+			row = append(row, values[a])
+		}
+		rows = append(rows, row)
+	}
+
+	switch format {
+	case CSV:
+		cw := csv.NewWriter(w)
+		if err := cw.WriteAll(rows); err != nil {
+			return err
+		}
+		return cw.Error()
+	case XLSX:
+		f := excelize.NewFile()
+		defer f.Close()
+
+		const sheet = "Products"
+		if err := f.SetSheetName("Sheet1", sheet); err != nil {
+			return err
+		}
+
+		numeric := make(map[int]bool)
+		for j, name := range header {
+			switch name {
+			case "price", "cost_price", "units", "reorder_point", "reorder_qty":
+				numeric[j] = true
+			}
+		}
+
+		for i, row := range rows {
+			cells := make([]interface{}, len(row))
+			for j, v := range row {
+				cells[j] = v
+				if n, err := strconv.ParseFloat(v, 64); i > 0 && numeric[j] && err == nil {
+					cells[j] = n
+				}
+			}
+			cell, err := excelize.CoordinatesToCellName(1, i+1)
+			if err != nil {
+				return err
+			}
+			if err := f.SetSheetRow(sheet, cell, &cells); err != nil {
+				return err
+			}
+		}
+		return f.Write(w)
+	}
+
+	return ErrFormat
+}
@@ -0,0 +1,144 @@
+package productfile
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+)
+
+func TestRead(t *testing.T) {
+	file := "\ufeffItem Code,Product Name,Qty,attr:Colour\nSN-1,Kettle,4,red\n,,,\nSN-2,Toaster,2,\n"
+
+	s, err := Read(strings.NewReader(file), "stock.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"Item Code", "Product Name", "Qty", "attr:Colour"}; !reflect.DeepEqual(s.Header, want) {
+		t.Errorf("header is %q, want %q", s.Header, want)
+	}
+	if len(s.Rows) != 3 {
+		t.Errorf("read %d rows, want 3", len(s.Rows))
+	}
+	if sample := s.Sample(5); len(sample) != 2 || sample[1][0] != "SN-2" {
+		t.Errorf("sample skipped the wrong rows: %q", sample)
+	}
+
+	if _, err := Read(strings.NewReader(file), "stock.txt"); err != ErrFormat {
+		t.Errorf("reading a txt file gave %v, want ErrFormat", err)
+	}
+	if _, err := Read(strings.NewReader(""), "stock.csv"); err != ErrEmpty {
+		t.Errorf("reading an empty file gave %v, want ErrEmpty", err)
+	}
+}
+
+func TestGuess(t *testing.T) {
+	m := Guess([]string{"SKU", "Product Name", "Selling-Price", "notes", "attr:Colour", "Serial Number"})
+	want := Mapping{"serial", "name", "price", "", Attribute, ""}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("guessed %q, want %q", m, want)
+	}
+}
+
+func TestMappingCheck(t *testing.T) {
+	header := []string{"code", "name", "name again", "attr:size", "size"}
+
+	if problems := (Mapping{"serial", "name", "", Attribute, ""}).Check(header); len(problems) != 0 {
+		t.Errorf("valid mapping has problems: %q", problems)
+	}
+
+	problems := (Mapping{"", "name", "name", Attribute, Attribute}).Check(header)
+	if len(problems) != 3 {
+		t.Errorf("got problems %q, want a missing serial, a field and an attribute mapped twice", problems)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	s := Sheet{
+		Header: []string{"serial", "name", "description", "price", "units", "attr:colour"},
+		Rows: [][]string{
+			{"SN-1", "Kettle", "1.7 litres", "120", "4", "red"},
+			{"SN-2", "", "", "12.5", "", "blue"},
+			{"SN-3", "Toaster", "Two slice", "cheap", "1"},
+			{"SN-1", "Kettle", "1.7 litres", "120", "4"},
+		},
+	}
+	existing := map[string]models.Product{
+		"SN-2": {ID: 7, Serial: "SN-2", Name: "Iron", Description: "Steam", Price: 10, Units: 3,
+			Attributes: []models.ProductAttribute{{Name: "colour", Value: "white"}, {Name: "size", Value: "m"}}},
+	}
+
+	rows := Check(s, Guess(s.Header), existing)
+	if len(rows) != 4 {
+		t.Fatalf("checked %d rows, want 4", len(rows))
+	}
+
+	if !rows[0].Valid() || !rows[0].New || rows[0].Product.Units != 4 || rows[0].Product.Attributes[0].Value != "red" {
+		t.Errorf("new product row was read wrongly: %+v %q", rows[0].Product, rows[0].Problems())
+	}
+
+	p := rows[1].Product
+	if !rows[1].Valid() || rows[1].New || p.ID != 7 || p.Name != "Iron" || p.Price != 12.5 || p.Units != 3 {
+		t.Errorf("existing product should only change its given fields: %+v %q", p, rows[1].Problems())
+	}
+	if want := []models.ProductAttribute{{Name: "colour", Value: "blue"}, {Name: "size", Value: "m"}}; !reflect.DeepEqual(p.Attributes, want) {
+		t.Errorf("attributes are %v, want %v", p.Attributes, want)
+	}
+	if existing["SN-2"].Attributes[0].Value != "white" {
+		t.Error("checking a row changed the existing product")
+	}
+
+	if rows[2].Valid() || rows[2].Form.Errors.Get("price") == "" {
+		t.Errorf("row with a bad price should not be valid: %q", rows[2].Problems())
+	}
+	if rows[3].Valid() || !strings.Contains(rows[3].Form.Errors.Get("serial"), "line 2") {
+		t.Errorf("repeated serial should point at its first line: %q", rows[3].Problems())
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	products := []models.Product{
+		{Serial: "SN-1", Name: "Kettle", Description: "1.7 litres", Price: 120, CostPrice: 80, Units: 4,
+			CategoryPath: "Kitchen / Small Appliances", BrandName: "Binatone",
+			Attributes: []models.ProductAttribute{{Name: "colour", Value: "red"}}},
+		{Serial: "SN-2", Name: "Iron", Description: "Steam", Price: 10.5, Units: 3},
+	}
+
+	for _, format := range []string{CSV, XLSX} {
+		var buf bytes.Buffer
+		if err := Write(&buf, format, products, false); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		s, err := Read(&buf, "products."+format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		m := Guess(s.Header)
+		if problems := m.Check(s.Header); len(problems) != 0 {
+			t.Errorf("%s: exported header does not map itself: %q", format, problems)
+		}
+		for _, field := range m {
+			if field == "cost_price" {
+				t.Errorf("%s: cost price exported without withCost", format)
+			}
+		}
+
+		rows := Check(s, m, nil)
+		if len(rows) != 2 {
+			t.Fatalf("%s: read back %d rows, want 2", format, len(rows))
+		}
+		got := rows[0].Product
+		if got.Name != "Kettle" || got.Price != 120 || got.Units != 4 || got.CategoryPath != "Kitchen / Small Appliances" ||
+			got.BrandName != "Binatone" || len(got.Attributes) != 1 {
+			t.Errorf("%s: read back %+v", format, got)
+		}
+		if rows[1].Product.Price != 10.5 {
+			t.Errorf("%s: price read back as %v", format, rows[1].Product.Price)
+		}
+	}
+}
@@ -51,6 +51,7 @@ func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateDa
 	td.Error = app.Session.PopString(r.Context(), "error")
 	td.Warning = app.Session.PopString(r.Context(), "warning")
 	td.CSRFToken = nosurf.Token(r)
+	td.LicenseBanner = app.License.Banner()
 	if app.Session.Exists(r.Context(), "user_id") {
 		td.IsAuthenticated = 1
 		td.Data["user"] = app.Session.Get(r.Context(), "user").(models.User)
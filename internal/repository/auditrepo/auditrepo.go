@@ -0,0 +1,1010 @@
+// Package auditrepo wraps a repository.DatabaseRepo so that every change made through it is
+// written to the audit log with who made it, from where, and what the record looked like
+// before and after.
+package auditrepo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// redacted lists the fields left out of snapshots, secrets and images
+var redacted = []string{
+	"Password", "TokenHash", "Image", "CustImage", "CardImage", "ImageString", "CustImgString", "CardImgString",
+}
+
+// Entities lists the kinds of record found in the audit log
+var Entities = []string{
+	"user", "api_token", "lockout", "two_factor_policy", "product", "customer", "witness", "item", "payment", "purchase",
+	"supplier", "purchase_order", "category", "brand", "stock_take", "location", "stock_transfer", "price_change",
+	"product_image", "database",
+}
+
+// AuditTable is the table the audit log is kept in
+const AuditTable = "audit_log"
+
+// Actor is who a change is attributed to
+type Actor struct {
+	UserId    int
+	IPAddress string
+}
+
+type auditRepo struct {
+	repository.DatabaseRepo
+	actor    Actor
+	errorLog *log.Logger
+}
+
+// New returns db with its changes recorded against actor. Each change is written in one
+// transaction with its audit entry, a change that cannot be audited is rolled back.
+func New(db repository.DatabaseRepo, actor Actor, errorLog *log.Logger) repository.DatabaseRepo {
+	return &auditRepo{
+		DatabaseRepo: db,
+		actor:        actor,
+		errorLog:     errorLog,
+	}
+}
+
+// WithTx runs fn in a transaction with its changes recorded against the same actor, the audit
+// entries are committed or rolled back with the changes
+func (a *auditRepo) WithTx(ctx context.Context, fn func(repo repository.DatabaseRepo) error) error {
+	return a.DatabaseRepo.WithTx(ctx, func(repo repository.DatabaseRepo) error {
+		return fn(New(repo, a.actor, a.errorLog))
+	})
+}
+
+// inTx runs fn with a repository bound to a transaction, so that the change fn makes and its
+// audit entry are committed together
+func (a *auditRepo) inTx(fn func(tx *auditRepo) error) error {
+	return a.DatabaseRepo.WithTx(context.Background(), func(repo repository.DatabaseRepo) error {
+		return fn(&auditRepo{DatabaseRepo: repo, actor: a.actor, errorLog: a.errorLog})
+	})
+}
+
+// record appends an entry to the audit log
+func (a *auditRepo) record(action, entity, key string, before, after any) error {
+	err := a.DatabaseRepo.InsertAuditEntry(models.AuditEntry{
+		UserId:    a.actor.UserId,
+		Action:    action,
+		Entity:    entity,
+		EntityKey: key,
+		Before:    snapshot(before),
+		After:     snapshot(after),
+		IPAddress: a.actor.IPAddress,
+	})
+	if err != nil {
+		a.errorLog.Printf("audit %s %s %s: %v", action, entity, key, err)
+		return fmt.Errorf("audit %s: %w", action, err)
+	}
+	return nil
+}
+
+// snapshot returns v as json without its redacted fields, nil gives an empty snapshot
+func snapshot(v any) string {
+	if v == nil {
+		return ""
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+
+	var fields map[string]any
+	if json.Unmarshal(b, &fields) == nil {
+		for _, f := range redacted {
+			delete(fields, f)
+		}
+		b, _ = json.Marshal(fields)
+	}
+
+	return string(b)
+}
+
+// user returns the user with id, or nil when it cannot be read
+func (a *auditRepo) user(id int) any {
+	username, err := a.DatabaseRepo.FetchUserById(id)
+	if err != nil {
+		return nil
+	}
+
+	u, err := a.DatabaseRepo.FetchUser(username)
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+// product returns the product with serial, or nil when it cannot be read
+func (a *auditRepo) product(serial string) any {
+	p, err := a.DatabaseRepo.FetchProduct(serial)
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+// customer returns the customer with customerId, or nil when it cannot be read
+func (a *auditRepo) customer(customerId string) any {
+	c, err := a.DatabaseRepo.FetchCustomer(customerId)
+	if err != nil {
+		return nil
+	}
+	return c
+}
+
+// witness returns the witness of customerId, or nil when it cannot be read
+func (a *auditRepo) witness(customerId string) any {
+	w, err := a.DatabaseRepo.FetchWitness(customerId)
+	if err != nil {
+		return nil
+	}
+	return w
+}
+
+// item returns the item of customerId with serial, or nil when it cannot be read
+func (a *auditRepo) item(customerId, serial string) any {
+	items, err := a.DatabaseRepo.CustomerDebt(customerId)
+	if err != nil {
+		return nil
+	}
+
+	for _, itm := range items {
+		if itm.Serial == serial {
+			return itm
+		}
+	}
+	return nil
+}
+
+// supplier returns the supplier with id, or nil when it cannot be read
+func (a *auditRepo) supplier(id int) any {
+	s, err := a.DatabaseRepo.FetchSupplier(id)
+	if err != nil {
+		return nil
+	}
+	return s
+}
+
+// purchaseOrder returns the purchase order with id, or nil when it cannot be read
+func (a *auditRepo) purchaseOrder(id int) any {
+	po, err := a.DatabaseRepo.FetchPurchaseOrder(id)
+	if err != nil {
+		return nil
+	}
+	return po
+}
+
+// category returns the category with id, or nil when it cannot be read
+func (a *auditRepo) category(id int) any {
+	c, err := a.DatabaseRepo.FetchCategory(id)
+	if err != nil {
+		return nil
+	}
+	return c
+}
+
+// brand returns the brand with id, or nil when it cannot be read
+func (a *auditRepo) brand(id int) any {
+	b, err := a.DatabaseRepo.FetchBrand(id)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// stockTake returns the stock take with id and its counted lines, or nil when it cannot be
+// read. Lines not counted yet are left out so the snapshot stays small.
+func (a *auditRepo) stockTake(id int) any {
+	st, err := a.DatabaseRepo.FetchStockTake(id)
+	if err != nil {
+		return nil
+	}
+
+	var counted []models.StockTakeLine
+	for _, l := range st.Lines {
+		if l.IsCounted() {
+			counted = append(counted, l)
+		}
+	}
+	st.Lines = counted
+	return st
+}
+
+// location returns the location with id, or nil when it cannot be read
+func (a *auditRepo) location(id int) any {
+	l, err := a.DatabaseRepo.FetchLocation(id)
+	if err != nil {
+		return nil
+	}
+	return l
+}
+
+// stockTransfer returns the stock transfer with id, or nil when it cannot be read
+func (a *auditRepo) stockTransfer(id int) any {
+	t, err := a.DatabaseRepo.FetchStockTransfer(id)
+	if err != nil {
+		return nil
+	}
+	return t
+}
+
+// priceChange returns the price change with id, or nil when it cannot be read
+func (a *auditRepo) priceChange(id int) any {
+	c, err := a.DatabaseRepo.FetchPriceChange(id)
+	if err != nil {
+		return nil
+	}
+	return c
+}
+
+// productImage returns the details of the product image with id, or nil when it cannot be read
+func (a *auditRepo) productImage(id int) any {
+	img, err := a.DatabaseRepo.FetchProductImage(id)
+	if err != nil {
+		return nil
+	}
+	return img
+}
+
+func itemKey(itm models.Item) string {
+	return itm.CustomerId + "/" + itm.Serial
+}
+
+// Users
+
+func (a *auditRepo) InsertUser(u models.User) (id int, err error) {
+	err = a.inTx(func(tx *auditRepo) error {
+		id, err = tx.DatabaseRepo.InsertUser(u)
+		if err != nil {
+			return err
+		}
+		u.ID = id
+		return tx.record("InsertUser", "user", strconv.Itoa(id), nil, u)
+	})
+	return id, err
+}
+
+func (a *auditRepo) ResetUser(u models.User) error {
+	return a.inTx(func(tx *auditRepo) error {
+		err := tx.DatabaseRepo.ResetUser(u)
+		if err != nil {
+			return err
+		}
+		key := u.Username
+		if usr, err := tx.DatabaseRepo.FetchUser(u.Username); err == nil {
+			key = strconv.Itoa(usr.ID)
+		}
+		return tx.record("ResetUser", "user", key, nil, nil)
+	})
+}
+
+func (a *auditRepo) UpdateUser(u models.User) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.user(u.ID)
+		err := tx.DatabaseRepo.UpdateUser(u)
+		if err != nil {
+			return err
+		}
+		return tx.record("UpdateUser", "user", strconv.Itoa(u.ID), before, tx.user(u.ID))
+	})
+}
+
+func (a *auditRepo) DeactivateUser(userId int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.user(userId)
+		err := tx.DatabaseRepo.DeactivateUser(userId)
+		if err != nil {
+			return err
+		}
+		return tx.record("DeactivateUser", "user", strconv.Itoa(userId), before, tx.user(userId))
+	})
+}
+
+func (a *auditRepo) ReactivateUser(userId int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.user(userId)
+		err := tx.DatabaseRepo.ReactivateUser(userId)
+		if err != nil {
+			return err
+		}
+		return tx.record("ReactivateUser", "user", strconv.Itoa(userId), before, tx.user(userId))
+	})
+}
+
+func (a *auditRepo) DeleteUser(userId int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.user(userId)
+		err := tx.DatabaseRepo.DeleteUser(userId)
+		if err != nil {
+			return err
+		}
+		return tx.record("DeleteUser", "user", strconv.Itoa(userId), before, tx.user(userId))
+	})
+}
+
+func (a *auditRepo) InsertActivationToken(t models.ActivationToken) error {
+	return a.inTx(func(tx *auditRepo) error {
+		err := tx.DatabaseRepo.InsertActivationToken(t)
+		if err != nil {
+			return err
+		}
+		return tx.record("InsertActivationToken", "user", strconv.Itoa(t.UserId), nil, t)
+	})
+}
+
+// ActivateUser is recorded against the user the token belongs to, the token is used up once
+// the user is activated so it is read first
+func (a *auditRepo) ActivateUser(tokenHash, password string) error {
+	return a.inTx(func(tx *auditRepo) error {
+		var key string
+		var before any
+		tok, err := tx.DatabaseRepo.FetchActivationToken(tokenHash)
+		if err == nil {
+			key = strconv.Itoa(tok.UserId)
+			before = tx.user(tok.UserId)
+		}
+
+		err = tx.DatabaseRepo.ActivateUser(tokenHash, password)
+		if err != nil {
+			return err
+		}
+		return tx.record("ActivateUser", "user", key, before, tx.user(tok.UserId))
+	})
+}
+
+func (a *auditRepo) RevokeActivationTokens(userId int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		err := tx.DatabaseRepo.RevokeActivationTokens(userId)
+		if err != nil {
+			return err
+		}
+		return tx.record("RevokeActivationTokens", "user", strconv.Itoa(userId), nil, nil)
+	})
+}
+
+func (a *auditRepo) UnlockAccount(id, unlockedBy int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		err := tx.DatabaseRepo.UnlockAccount(id, unlockedBy)
+		if err != nil {
+			return err
+		}
+		return tx.record("UnlockAccount", "lockout", strconv.Itoa(id), nil, nil)
+	})
+}
+
+// SetTOTPSecret is recorded without the secret
+func (a *auditRepo) SetTOTPSecret(userId int, secret string) error {
+	return a.inTx(func(tx *auditRepo) error {
+		err := tx.DatabaseRepo.SetTOTPSecret(userId, secret)
+		if err != nil {
+			return err
+		}
+		return tx.record("SetTOTPSecret", "user", strconv.Itoa(userId), nil, nil)
+	})
+}
+
+func (a *auditRepo) EnableTOTP(userId int, codeHashes []string) error {
+	return a.inTx(func(tx *auditRepo) error {
+		err := tx.DatabaseRepo.EnableTOTP(userId, codeHashes)
+		if err != nil {
+			return err
+		}
+		return tx.record("EnableTOTP", "user", strconv.Itoa(userId), nil, nil)
+	})
+}
+
+func (a *auditRepo) DisableTOTP(userId int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		err := tx.DatabaseRepo.DisableTOTP(userId)
+		if err != nil {
+			return err
+		}
+		return tx.record("DisableTOTP", "user", strconv.Itoa(userId), nil, nil)
+	})
+}
+
+func (a *auditRepo) UpdateTwoFactorLevels(levels []string, userId int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before, _ := tx.DatabaseRepo.FetchTwoFactorLevels()
+		err := tx.DatabaseRepo.UpdateTwoFactorLevels(levels, userId)
+		if err != nil {
+			return err
+		}
+		return tx.record("UpdateTwoFactorLevels", "two_factor_policy", "", before, levels)
+	})
+}
+
+func (a *auditRepo) InsertAPIToken(t models.APIToken) (id int, err error) {
+	err = a.inTx(func(tx *auditRepo) error {
+		id, err = tx.DatabaseRepo.InsertAPIToken(t)
+		if err != nil {
+			return err
+		}
+		t.ID = id
+		return tx.record("InsertAPIToken", "api_token", strconv.Itoa(id), nil, t)
+	})
+	return id, err
+}
+
+func (a *auditRepo) RevokeAPIToken(id, userId int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		err := tx.DatabaseRepo.RevokeAPIToken(id, userId)
+		if err != nil {
+			return err
+		}
+		return tx.record("RevokeAPIToken", "api_token", strconv.Itoa(id), nil, nil)
+	})
+}
+
+func (a *auditRepo) RevokeUserSession(id, userId int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		err := tx.DatabaseRepo.RevokeUserSession(id, userId)
+		if err != nil {
+			return err
+		}
+		return tx.record("RevokeUserSession", "user", strconv.Itoa(userId), nil, nil)
+	})
+}
+
+func (a *auditRepo) RevokeUserSessions(userId int, keepToken string) error {
+	return a.inTx(func(tx *auditRepo) error {
+		err := tx.DatabaseRepo.RevokeUserSessions(userId, keepToken)
+		if err != nil {
+			return err
+		}
+		return tx.record("RevokeUserSessions", "user", strconv.Itoa(userId), nil, nil)
+	})
+}
+
+// Products
+
+func (a *auditRepo) InsertProduct(p models.Product) (prod models.Product, err error) {
+	err = a.inTx(func(tx *auditRepo) error {
+		prod, err = tx.DatabaseRepo.InsertProduct(p)
+		if err != nil {
+			return err
+		}
+		return tx.record("InsertProduct", "product", p.Serial, nil, tx.product(p.Serial))
+	})
+	return prod, err
+}
+
+func (a *auditRepo) UpdateProduct(p models.Product) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.product(p.Serial)
+		err := tx.DatabaseRepo.UpdateProduct(p)
+		if err != nil {
+			return err
+		}
+		return tx.record("UpdateProduct", "product", p.Serial, before, tx.product(p.Serial))
+	})
+}
+
+func (a *auditRepo) RecordStockMovement(mv models.StockMovement) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.product(mv.Serial)
+		err := tx.DatabaseRepo.RecordStockMovement(mv)
+		if err != nil {
+			return err
+		}
+		return tx.record("RecordStockMovement", "product", mv.Serial, before, tx.product(mv.Serial))
+	})
+}
+
+func (a *auditRepo) DeleteProduct(serial string) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.product(serial)
+		err := tx.DatabaseRepo.DeleteProduct(serial)
+		if err != nil {
+			return err
+		}
+		return tx.record("DeleteProduct", "product", serial, before, nil)
+	})
+}
+
+func (a *auditRepo) ArchiveProduct(serial string, userId int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.product(serial)
+		err := tx.DatabaseRepo.ArchiveProduct(serial, userId)
+		if err != nil {
+			return err
+		}
+		return tx.record("ArchiveProduct", "product", serial, before, tx.product(serial))
+	})
+}
+
+func (a *auditRepo) RestoreProduct(serial string, userId int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.product(serial)
+		err := tx.DatabaseRepo.RestoreProduct(serial, userId)
+		if err != nil {
+			return err
+		}
+		return tx.record("RestoreProduct", "product", serial, before, tx.product(serial))
+	})
+}
+
+func (a *auditRepo) SchedulePriceChange(c models.PriceChange) (id int, err error) {
+	err = a.inTx(func(tx *auditRepo) error {
+		id, err = tx.DatabaseRepo.SchedulePriceChange(c)
+		if err != nil {
+			return err
+		}
+		return tx.record("SchedulePriceChange", "price_change", strconv.Itoa(id), nil, tx.priceChange(id))
+	})
+	return id, err
+}
+
+func (a *auditRepo) CancelPriceChange(id int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.priceChange(id)
+		err := tx.DatabaseRepo.CancelPriceChange(id)
+		if err != nil {
+			return err
+		}
+		return tx.record("CancelPriceChange", "price_change", strconv.Itoa(id), before, nil)
+	})
+}
+
+// ApplyScheduledPrices records every price change it puts into effect
+func (a *auditRepo) ApplyScheduledPrices() (applied []models.PriceChange, err error) {
+	err = a.inTx(func(tx *auditRepo) error {
+		applied, err = tx.DatabaseRepo.ApplyScheduledPrices()
+		if err != nil {
+			return err
+		}
+		for _, c := range applied {
+			err = tx.record("ApplyScheduledPrices", "price_change", strconv.Itoa(c.ID), nil, c)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return applied, err
+}
+
+func (a *auditRepo) InsertProductImage(img models.ProductImage, image, thumbnail []byte) (id int, err error) {
+	err = a.inTx(func(tx *auditRepo) error {
+		id, err = tx.DatabaseRepo.InsertProductImage(img, image, thumbnail)
+		if err != nil {
+			return err
+		}
+		return tx.record("InsertProductImage", "product_image", strconv.Itoa(id), nil, tx.productImage(id))
+	})
+	return id, err
+}
+
+func (a *auditRepo) SetPrimaryProductImage(id int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.productImage(id)
+		err := tx.DatabaseRepo.SetPrimaryProductImage(id)
+		if err != nil {
+			return err
+		}
+		return tx.record("SetPrimaryProductImage", "product_image", strconv.Itoa(id), before, tx.productImage(id))
+	})
+}
+
+func (a *auditRepo) DeleteProductImage(id int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.productImage(id)
+		err := tx.DatabaseRepo.DeleteProductImage(id)
+		if err != nil {
+			return err
+		}
+		return tx.record("DeleteProductImage", "product_image", strconv.Itoa(id), before, nil)
+	})
+}
+
+// Contracts
+
+func (a *auditRepo) InsertCustomer(c models.Customer) error {
+	return a.inTx(func(tx *auditRepo) error {
+		err := tx.DatabaseRepo.InsertCustomer(c)
+		if err != nil {
+			return err
+		}
+		return tx.record("InsertCustomer", "customer", c.CustomerId, nil, c)
+	})
+}
+
+func (a *auditRepo) UpdateCustomer(c models.Customer) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.customer(c.CustomerId)
+		err := tx.DatabaseRepo.UpdateCustomer(c)
+		if err != nil {
+			return err
+		}
+		return tx.record("UpdateCustomer", "customer", c.CustomerId, before, tx.customer(c.CustomerId))
+	})
+}
+
+func (a *auditRepo) UpdateContactStatus(c models.Customer) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.customer(c.CustomerId)
+		err := tx.DatabaseRepo.UpdateContactStatus(c)
+		if err != nil {
+			return err
+		}
+		return tx.record("UpdateContactStatus", "customer", c.CustomerId, before, tx.customer(c.CustomerId))
+	})
+}
+
+func (a *auditRepo) InsertWitnessData(w models.Witness) (wit models.Witness, err error) {
+	err = a.inTx(func(tx *auditRepo) error {
+		wit, err = tx.DatabaseRepo.InsertWitnessData(w)
+		if err != nil {
+			return err
+		}
+		return tx.record("InsertWitnessData", "witness", w.CustomerId, nil, w)
+	})
+	return wit, err
+}
+
+func (a *auditRepo) UpdateWitness(w models.Witness) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.witness(w.CustomerId)
+		err := tx.DatabaseRepo.UpdateWitness(w)
+		if err != nil {
+			return err
+		}
+		return tx.record("UpdateWitness", "witness", w.CustomerId, before, tx.witness(w.CustomerId))
+	})
+}
+
+func (a *auditRepo) InsertItem(itm models.Item) error {
+	return a.inTx(func(tx *auditRepo) error {
+		err := tx.DatabaseRepo.InsertItem(itm)
+		if err != nil {
+			return err
+		}
+		return tx.record("InsertItem", "item", itemKey(itm), nil, itm)
+	})
+}
+
+func (a *auditRepo) UpdateItem(serial string, itm models.Item) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.item(itm.CustomerId, serial)
+		err := tx.DatabaseRepo.UpdateItem(serial, itm)
+		if err != nil {
+			return err
+		}
+		return tx.record("UpdateItem", "item", itemKey(itm), before, tx.item(itm.CustomerId, itm.Serial))
+	})
+}
+
+func (a *auditRepo) UpdateBalance(itm models.Item) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.item(itm.CustomerId, itm.Serial)
+		err := tx.DatabaseRepo.UpdateBalance(itm)
+		if err != nil {
+			return err
+		}
+		return tx.record("UpdateBalance", "item", itemKey(itm), before, tx.item(itm.CustomerId, itm.Serial))
+	})
+}
+
+func (a *auditRepo) InsertPayment(p models.Payments) error {
+	return a.inTx(func(tx *auditRepo) error {
+		err := tx.DatabaseRepo.InsertPayment(p)
+		if err != nil {
+			return err
+		}
+		return tx.record("InsertPayment", "payment", p.CustomerId, nil, p)
+	})
+}
+
+// Sales
+
+func (a *auditRepo) InsertPurchase(p models.Purchases) (id int, err error) {
+	err = a.inTx(func(tx *auditRepo) error {
+		id, err = tx.DatabaseRepo.InsertPurchase(p)
+		if err != nil {
+			return err
+		}
+		return tx.record("InsertPurchase", "purchase", strconv.Itoa(id), nil, p)
+	})
+	return id, err
+}
+
+func (a *auditRepo) DeletePurchase(id int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		err := tx.DatabaseRepo.DeletePurchase(id)
+		if err != nil {
+			return err
+		}
+		return tx.record("DeletePurchase", "purchase", strconv.Itoa(id), nil, nil)
+	})
+}
+
+// Catalogue
+
+func (a *auditRepo) InsertCategory(c models.Category) (id int, err error) {
+	err = a.inTx(func(tx *auditRepo) error {
+		id, err = tx.DatabaseRepo.InsertCategory(c)
+		if err != nil {
+			return err
+		}
+		return tx.record("InsertCategory", "category", strconv.Itoa(id), nil, tx.category(id))
+	})
+	return id, err
+}
+
+func (a *auditRepo) UpdateCategory(c models.Category) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.category(c.ID)
+		err := tx.DatabaseRepo.UpdateCategory(c)
+		if err != nil {
+			return err
+		}
+		return tx.record("UpdateCategory", "category", strconv.Itoa(c.ID), before, tx.category(c.ID))
+	})
+}
+
+func (a *auditRepo) DeleteCategory(id int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.category(id)
+		err := tx.DatabaseRepo.DeleteCategory(id)
+		if err != nil {
+			return err
+		}
+		return tx.record("DeleteCategory", "category", strconv.Itoa(id), before, nil)
+	})
+}
+
+func (a *auditRepo) InsertBrand(b models.Brand) (id int, err error) {
+	err = a.inTx(func(tx *auditRepo) error {
+		id, err = tx.DatabaseRepo.InsertBrand(b)
+		if err != nil {
+			return err
+		}
+		return tx.record("InsertBrand", "brand", strconv.Itoa(id), nil, tx.brand(id))
+	})
+	return id, err
+}
+
+func (a *auditRepo) UpdateBrand(b models.Brand) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.brand(b.ID)
+		err := tx.DatabaseRepo.UpdateBrand(b)
+		if err != nil {
+			return err
+		}
+		return tx.record("UpdateBrand", "brand", strconv.Itoa(b.ID), before, tx.brand(b.ID))
+	})
+}
+
+func (a *auditRepo) DeleteBrand(id int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.brand(id)
+		err := tx.DatabaseRepo.DeleteBrand(id)
+		if err != nil {
+			return err
+		}
+		return tx.record("DeleteBrand", "brand", strconv.Itoa(id), before, nil)
+	})
+}
+
+// Purchasing
+
+func (a *auditRepo) InsertSupplier(s models.Supplier) (id int, err error) {
+	err = a.inTx(func(tx *auditRepo) error {
+		id, err = tx.DatabaseRepo.InsertSupplier(s)
+		if err != nil {
+			return err
+		}
+		return tx.record("InsertSupplier", "supplier", strconv.Itoa(id), nil, tx.supplier(id))
+	})
+	return id, err
+}
+
+func (a *auditRepo) UpdateSupplier(s models.Supplier) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.supplier(s.ID)
+		err := tx.DatabaseRepo.UpdateSupplier(s)
+		if err != nil {
+			return err
+		}
+		return tx.record("UpdateSupplier", "supplier", strconv.Itoa(s.ID), before, tx.supplier(s.ID))
+	})
+}
+
+func (a *auditRepo) InsertPurchaseOrder(po models.PurchaseOrder) (id int, err error) {
+	err = a.inTx(func(tx *auditRepo) error {
+		id, err = tx.DatabaseRepo.InsertPurchaseOrder(po)
+		if err != nil {
+			return err
+		}
+		return tx.record("InsertPurchaseOrder", "purchase_order", strconv.Itoa(id), nil, tx.purchaseOrder(id))
+	})
+	return id, err
+}
+
+func (a *auditRepo) UpdatePurchaseOrder(po models.PurchaseOrder) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.purchaseOrder(po.ID)
+		err := tx.DatabaseRepo.UpdatePurchaseOrder(po)
+		if err != nil {
+			return err
+		}
+		return tx.record("UpdatePurchaseOrder", "purchase_order", strconv.Itoa(po.ID), before, tx.purchaseOrder(po.ID))
+	})
+}
+
+func (a *auditRepo) PlacePurchaseOrder(id, userId int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.purchaseOrder(id)
+		err := tx.DatabaseRepo.PlacePurchaseOrder(id, userId)
+		if err != nil {
+			return err
+		}
+		return tx.record("PlacePurchaseOrder", "purchase_order", strconv.Itoa(id), before, tx.purchaseOrder(id))
+	})
+}
+
+func (a *auditRepo) ReceivePurchaseOrder(id, userId int, receipts []models.PurchaseOrderReceipt) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.purchaseOrder(id)
+		err := tx.DatabaseRepo.ReceivePurchaseOrder(id, userId, receipts)
+		if err != nil {
+			return err
+		}
+		return tx.record("ReceivePurchaseOrder", "purchase_order", strconv.Itoa(id), before, tx.purchaseOrder(id))
+	})
+}
+
+func (a *auditRepo) DeletePurchaseOrder(id int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.purchaseOrder(id)
+		err := tx.DatabaseRepo.DeletePurchaseOrder(id)
+		if err != nil {
+			return err
+		}
+		return tx.record("DeletePurchaseOrder", "purchase_order", strconv.Itoa(id), before, nil)
+	})
+}
+
+// Stock takes
+
+func (a *auditRepo) InsertStockTake(st models.StockTake) (id int, err error) {
+	err = a.inTx(func(tx *auditRepo) error {
+		id, err = tx.DatabaseRepo.InsertStockTake(st)
+		if err != nil {
+			return err
+		}
+		return tx.record("InsertStockTake", "stock_take", strconv.Itoa(id), nil, tx.stockTake(id))
+	})
+	return id, err
+}
+
+func (a *auditRepo) RecordStockCounts(id, userId int, counts []models.StockCount) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.stockTake(id)
+		err := tx.DatabaseRepo.RecordStockCounts(id, userId, counts)
+		if err != nil {
+			return err
+		}
+		return tx.record("RecordStockCounts", "stock_take", strconv.Itoa(id), before, tx.stockTake(id))
+	})
+}
+
+func (a *auditRepo) ApproveStockTake(id, userId int, lineIds []int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.stockTake(id)
+		err := tx.DatabaseRepo.ApproveStockTake(id, userId, lineIds)
+		if err != nil {
+			return err
+		}
+		return tx.record("ApproveStockTake", "stock_take", strconv.Itoa(id), before, tx.stockTake(id))
+	})
+}
+
+func (a *auditRepo) CancelStockTake(id int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.stockTake(id)
+		err := tx.DatabaseRepo.CancelStockTake(id)
+		if err != nil {
+			return err
+		}
+		return tx.record("CancelStockTake", "stock_take", strconv.Itoa(id), before, tx.stockTake(id))
+	})
+}
+
+// Locations
+
+func (a *auditRepo) InsertLocation(l models.Location) (id int, err error) {
+	err = a.inTx(func(tx *auditRepo) error {
+		id, err = tx.DatabaseRepo.InsertLocation(l)
+		if err != nil {
+			return err
+		}
+		return tx.record("InsertLocation", "location", strconv.Itoa(id), nil, tx.location(id))
+	})
+	return id, err
+}
+
+func (a *auditRepo) UpdateLocation(l models.Location) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.location(l.ID)
+		err := tx.DatabaseRepo.UpdateLocation(l)
+		if err != nil {
+			return err
+		}
+		return tx.record("UpdateLocation", "location", strconv.Itoa(l.ID), before, tx.location(l.ID))
+	})
+}
+
+// Stock transfers
+
+func (a *auditRepo) InsertStockTransfer(t models.StockTransfer) (id int, err error) {
+	err = a.inTx(func(tx *auditRepo) error {
+		id, err = tx.DatabaseRepo.InsertStockTransfer(t)
+		if err != nil {
+			return err
+		}
+		return tx.record("InsertStockTransfer", "stock_transfer", strconv.Itoa(id), nil, tx.stockTransfer(id))
+	})
+	return id, err
+}
+
+func (a *auditRepo) UpdateStockTransfer(t models.StockTransfer) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.stockTransfer(t.ID)
+		err := tx.DatabaseRepo.UpdateStockTransfer(t)
+		if err != nil {
+			return err
+		}
+		return tx.record("UpdateStockTransfer", "stock_transfer", strconv.Itoa(t.ID), before, tx.stockTransfer(t.ID))
+	})
+}
+
+func (a *auditRepo) CompleteStockTransfer(id, userId int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.stockTransfer(id)
+		err := tx.DatabaseRepo.CompleteStockTransfer(id, userId)
+		if err != nil {
+			return err
+		}
+		return tx.record("CompleteStockTransfer", "stock_transfer", strconv.Itoa(id), before, tx.stockTransfer(id))
+	})
+}
+
+func (a *auditRepo) DeleteStockTransfer(id int) error {
+	return a.inTx(func(tx *auditRepo) error {
+		before := tx.stockTransfer(id)
+		err := tx.DatabaseRepo.DeleteStockTransfer(id)
+		if err != nil {
+			return err
+		}
+		return tx.record("DeleteStockTransfer", "stock_transfer", strconv.Itoa(id), before, nil)
+	})
+}
+
+// Backup and recovery
+
+// DropTables keeps the audit log, it is append-only and has to outlive a restore, and records
+// the tables it drops
+func (a *auditRepo) DropTables(tables []string) error {
+	var drop []string
+	for _, table := range tables {
+		if table != AuditTable {
+			drop = append(drop, table)
+		}
+	}
+
+	return a.inTx(func(tx *auditRepo) error {
+		err := tx.DatabaseRepo.DropTables(drop)
+		if err != nil {
+			return err
+		}
+		return tx.record("DropTables", "database", "", nil, drop)
+	})
+}
@@ -0,0 +1,153 @@
+package auditrepo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+func TestSnapshot(t *testing.T) {
+	s := snapshot(models.User{ID: 4, Username: "ama", Password: "secret", Image: []byte("photo")})
+	if !strings.Contains(s, `"Username":"ama"`) {
+		t.Errorf("snapshot %s is missing the username", s)
+	}
+
+	for _, field := range []string{"Password", "Image", "secret"} {
+		if strings.Contains(s, field) {
+			t.Errorf("snapshot %s should not contain %s", s, field)
+		}
+	}
+
+	if s := snapshot(nil); s != "" {
+		t.Errorf("expected an empty snapshot for nil, got %s", s)
+	}
+
+	if s := snapshot([]string{"owner"}); s != `["owner"]` {
+		t.Errorf("unexpected snapshot of a slice %s", s)
+	}
+}
+
+// fakeRepo holds one user and the audit log in memory, a transaction that fails puts them back
+// as they were
+type fakeRepo struct {
+	repository.DatabaseRepo
+	user      models.User
+	secret    string
+	dropped   []string
+	entries   []models.AuditEntry
+	auditDown bool
+}
+
+func (f *fakeRepo) WithTx(ctx context.Context, fn func(repo repository.DatabaseRepo) error) error {
+	saved := *f
+	err := fn(f)
+	if err != nil {
+		*f = saved
+	}
+	return err
+}
+
+func (f *fakeRepo) InsertAuditEntry(e models.AuditEntry) error {
+	if f.auditDown {
+		return errors.New("audit_log is not there")
+	}
+	f.entries = append(f.entries, e)
+	return nil
+}
+
+func (f *fakeRepo) FetchUserById(id int) (string, error) {
+	return f.user.Username, nil
+}
+
+func (f *fakeRepo) FetchUser(username string) (models.User, error) {
+	return f.user, nil
+}
+
+func (f *fakeRepo) UpdateUser(u models.User) error {
+	f.user = u
+	return nil
+}
+
+func (f *fakeRepo) SetTOTPSecret(userId int, secret string) error {
+	f.secret = secret
+	return nil
+}
+
+func (f *fakeRepo) DropTables(tables []string) error {
+	f.dropped = tables
+	return nil
+}
+
+func TestAuditRepo_UpdateUser(t *testing.T) {
+	db := &fakeRepo{user: models.User{ID: 4, Username: "ama", Password: "old-hash", AccessLevel: "staff"}}
+	repo := New(db, Actor{UserId: 1, IPAddress: "203.0.113.7"}, log.New(io.Discard, "", 0))
+
+	err := repo.UpdateUser(models.User{ID: 4, Username: "ama", Password: "new-hash", AccessLevel: "owner"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(db.entries) != 1 {
+		t.Fatalf("expected 1 audit entry, got %d", len(db.entries))
+	}
+	e := db.entries[0]
+	if e.Action != "UpdateUser" || e.Entity != "user" || e.EntityKey != "4" || e.UserId != 1 || e.IPAddress != "203.0.113.7" {
+		t.Errorf("unexpected audit entry %+v", e)
+	}
+	if !strings.Contains(e.Before, `"AccessLevel":"staff"`) || !strings.Contains(e.After, `"AccessLevel":"owner"`) {
+		t.Errorf("entry does not show the change, before %s after %s", e.Before, e.After)
+	}
+	for _, s := range []string{e.Before, e.After} {
+		if strings.Contains(s, "Password") || strings.Contains(s, "hash") {
+			t.Errorf("snapshot %s contains the password", s)
+		}
+	}
+
+	// Without the audit log the change is rolled back
+	db.auditDown = true
+	err = repo.UpdateUser(models.User{ID: 4, Username: "ama", AccessLevel: "staff"})
+	if err == nil {
+		t.Error("change was made without an audit entry")
+	}
+	if db.user.AccessLevel != "owner" {
+		t.Errorf("change was kept without an audit entry, access level %s", db.user.AccessLevel)
+	}
+}
+
+func TestAuditRepo_SetTOTPSecret(t *testing.T) {
+	db := &fakeRepo{user: models.User{ID: 4, Username: "ama"}}
+	repo := New(db, Actor{UserId: 4}, log.New(io.Discard, "", 0))
+
+	if err := repo.SetTOTPSecret(4, "v1:sealed-secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(db.entries) != 1 || db.entries[0].Action != "SetTOTPSecret" || db.entries[0].EntityKey != "4" {
+		t.Fatalf("unexpected audit entries %+v", db.entries)
+	}
+	if e := db.entries[0]; strings.Contains(e.Before+e.After, "secret") {
+		t.Errorf("entry %+v contains the secret", e)
+	}
+}
+
+func TestAuditRepo_DropTables(t *testing.T) {
+	db := &fakeRepo{}
+	repo := New(db, Actor{UserId: 1}, log.New(io.Discard, "", 0))
+
+	if err := repo.DropTables([]string{"users", AuditTable, "products"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(db.dropped, ",") != "users,products" {
+		t.Errorf("dropped %v, the audit log has to be kept", db.dropped)
+	}
+	if len(db.entries) != 1 || db.entries[0].After != `["users","products"]` {
+		t.Errorf("unexpected audit entries %+v", db.entries)
+	}
+}
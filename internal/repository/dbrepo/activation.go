@@ -0,0 +1,170 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// InsertActivationToken stores the hash of a new activation token
+func (m *postgresDBRepo) InsertActivationToken(t models.ActivationToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		insert into activation_tokens (user_id, token_hash, expires_at, created_by, created_at)
+		values ($1, $2, $3, $4, $5)
+	`
+	_, err := m.DB.ExecContext(ctx, query,
+		t.UserId,
+		t.TokenHash,
+		t.ExpiresAt,
+		t.CreatedBy,
+		time.Now(),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FetchActivationToken retrieves a usable activation token by its hash
+func (m *postgresDBRepo) FetchActivationToken(tokenHash string) (models.ActivationToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var t models.ActivationToken
+
+	query := `
+		select id, user_id, token_hash, expires_at, created_by, created_at
+		from activation_tokens
+		where token_hash = $1 and used_at is null and revoked_at is null and expires_at > $2
+	`
+	err := m.DB.QueryRowContext(ctx, query, tokenHash, time.Now()).Scan(
+		&t.ID,
+		&t.UserId,
+		&t.TokenHash,
+		&t.ExpiresAt,
+		&t.CreatedBy,
+		&t.CreatedAt,
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, repository.ErrInvalidToken
+	}
+
+	if err != nil {
+		return t, err
+	}
+
+	return t, nil
+}
+
+// FetchPendingActivations retrieves the activation tokens that can still be used
+func (m *postgresDBRepo) FetchPendingActivations() ([]models.ActivationToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var tokens []models.ActivationToken
+
+	query := `
+		select id, user_id, expires_at, created_by, created_at
+		from activation_tokens
+		where used_at is null and revoked_at is null and expires_at > $1
+		order by created_at
+	`
+	rows, err := m.DB.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return tokens, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.ActivationToken
+		err = rows.Scan(&t.ID, &t.UserId, &t.ExpiresAt, &t.CreatedBy, &t.CreatedAt)
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return tokens, err
+	}
+
+	return tokens, nil
+}
+
+// ActivateUser consumes an activation token and sets the user's password
+func (m *postgresDBRepo) ActivateUser(tokenHash, password string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userId int
+	query := `
+		update activation_tokens set used_at = $1
+		where token_hash = $2 and used_at is null and revoked_at is null and expires_at > $1
+		returning user_id
+	`
+	err = tx.QueryRowContext(ctx, query, time.Now(), tokenHash).Scan(&userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrInvalidToken
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// Any other link handed out for this user must stop working as well
+	_, err = tx.ExecContext(ctx,
+		"update activation_tokens set revoked_at = $1 where user_id = $2 and used_at is null and revoked_at is null",
+		time.Now(), userId,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"update users set password = $1, updated_at = $2 where id = $3",
+		password, time.Now(), userId,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = insertPasswordHistory(ctx, tx, userId, password)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeActivationTokens revokes every outstanding activation token of a user
+func (m *postgresDBRepo) RevokeActivationTokens(userId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update activation_tokens set revoked_at = $1
+		where user_id = $2 and used_at is null and revoked_at is null
+	`
+	_, err := m.DB.ExecContext(ctx, query, time.Now(), userId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
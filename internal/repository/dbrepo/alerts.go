@@ -0,0 +1,165 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+)
+
+// FetchLowStock retrieves the products on sale that have fallen to their reorder point, the
+// emptiest first. With a locationId the units at that location are held against the reorder point and
+// returned as the product's units.
+func (m *postgresDBRepo) FetchLowStock(locationId int) ([]models.Product, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var p []models.Product
+
+	query := `
+		select id, serial, name, description, price, cost_price, units, reorder_point, reorder_qty, user_id, created_at, updated_at
+		from (
+			select p.id, p.serial, p.name, p.description, p.price, p.cost_price,
+				case when $1 = 0 then p.units else coalesce(ps.units, 0) end as units,
+				p.reorder_point, p.reorder_qty, p.user_id, p.created_at, p.updated_at
+			from products p
+			left join product_stock ps on ps.serial = p.serial and ps.location_id = $1
+			where p.archived_at is null
+		) s
+		where reorder_point > 0 and units <= reorder_point
+		order by units - reorder_point, serial
+	`
+	rows, err := m.DB.QueryContext(ctx, query, locationId)
+	if err != nil {
+		return p, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var prod models.Product
+		err := rows.Scan(
+			&prod.ID,
+			&prod.Serial,
+			&prod.Name,
+			&prod.Description,
+			&prod.Price,
+			&prod.CostPrice,
+			&prod.Units,
+			&prod.ReorderPoint,
+			&prod.ReorderQty,
+			&prod.UserId,
+			&prod.CreatedAt,
+			&prod.UpdatedAt,
+		)
+		if err != nil {
+			return p, err
+		}
+		p = append(p, prod)
+	}
+
+	if err = rows.Err(); err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
+// RaiseStockAlerts clears the alerts of products that were restocked or archived and raises an
+// alert for each product on sale that has fallen to its reorder point without one, it returns
+// the new alerts
+func (m *postgresDBRepo) RaiseStockAlerts() ([]models.StockAlert, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var alerts []models.StockAlert
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return alerts, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	_, err = tx.ExecContext(ctx, `
+		update stock_alerts a set cleared_at = $1
+		where a.cleared_at is null and not exists (
+			select 1 from products p
+			where p.serial = a.serial and p.archived_at is null and p.reorder_point > 0 and p.units <= p.reorder_point
+		)`, now)
+	if err != nil {
+		return alerts, err
+	}
+
+	query := `
+		with raised as (
+			insert into stock_alerts (serial, units, reorder_point, reorder_qty, raised_at)
+			select serial, units, reorder_point, reorder_qty, $1
+			from products
+			where archived_at is null and reorder_point > 0 and units <= reorder_point
+			on conflict (serial) where cleared_at is null do nothing
+			returning id, serial, units, reorder_point, reorder_qty, raised_at, cleared_at
+		)
+		select r.id, r.serial, coalesce(p.name, ''), r.units, r.reorder_point, r.reorder_qty, r.raised_at, r.cleared_at
+		from raised r
+		left join products p on p.serial = r.serial
+		order by r.serial
+	`
+	alerts, err = scanStockAlerts(tx.QueryContext(ctx, query, now))
+	if err != nil {
+		return alerts, err
+	}
+
+	return alerts, tx.Commit()
+}
+
+// FetchStockAlerts retrieves the latest restock alerts, newest first
+func (m *postgresDBRepo) FetchStockAlerts(limit int) ([]models.StockAlert, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select a.id, a.serial, coalesce(p.name, ''), a.units, a.reorder_point, a.reorder_qty, a.raised_at, a.cleared_at
+		from stock_alerts a
+		left join products p on p.serial = a.serial
+		order by a.raised_at desc, a.id desc
+		limit $1
+	`
+	return scanStockAlerts(m.DB.QueryContext(ctx, query, limit))
+}
+
+// scanStockAlerts reads the alerts returned by a query
+func scanStockAlerts(rows *sql.Rows, err error) ([]models.StockAlert, error) {
+	var alerts []models.StockAlert
+	if err != nil {
+		return alerts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a models.StockAlert
+		var clearedAt sql.NullTime
+		err := rows.Scan(
+			&a.ID,
+			&a.Serial,
+			&a.Name,
+			&a.Units,
+			&a.ReorderPoint,
+			&a.ReorderQty,
+			&a.RaisedAt,
+			&clearedAt,
+		)
+		if err != nil {
+			return alerts, err
+		}
+		a.ClearedAt = clearedAt.Time
+		alerts = append(alerts, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return alerts, err
+	}
+
+	return alerts, nil
+}
@@ -0,0 +1,163 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// InsertAPIToken stores the hash of a new api token
+func (m *postgresDBRepo) InsertAPIToken(t models.APIToken) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var expiresAt sql.NullTime
+	if !t.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: t.ExpiresAt, Valid: true}
+	}
+
+	var newID int
+	query := `
+		insert into api_tokens (user_id, name, token_hash, scopes, expires_at, created_at)
+		values ($1, $2, $3, $4, $5, $6) returning id
+	`
+	err := m.DB.QueryRowContext(ctx, query,
+		t.UserId,
+		t.Name,
+		t.TokenHash,
+		strings.Join(t.Scopes, ","),
+		expiresAt,
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// FetchAPIToken retrieves a usable api token by its hash
+func (m *postgresDBRepo) FetchAPIToken(tokenHash string) (models.APIToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select id, user_id, name, token_hash, scopes, expires_at, last_used_at, revoked_at, created_at
+		from api_tokens
+		where token_hash = $1 and revoked_at is null and (expires_at is null or expires_at > $2)
+	`
+	t, err := scanAPIToken(m.DB.QueryRowContext(ctx, query, tokenHash, time.Now()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, repository.ErrInvalidToken
+	}
+
+	if err != nil {
+		return t, err
+	}
+
+	return t, nil
+}
+
+// FetchUserAPITokens retrieves every api token of a user, newest first
+func (m *postgresDBRepo) FetchUserAPITokens(userId int) ([]models.APIToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var tokens []models.APIToken
+
+	query := `
+		select id, user_id, name, token_hash, scopes, expires_at, last_used_at, revoked_at, created_at
+		from api_tokens
+		where user_id = $1
+		order by created_at desc
+	`
+	rows, err := m.DB.QueryContext(ctx, query, userId)
+	if err != nil {
+		return tokens, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return tokens, err
+	}
+
+	return tokens, nil
+}
+
+// TouchAPIToken records that an api token was just used
+func (m *postgresDBRepo) TouchAPIToken(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, "update api_tokens set last_used_at = $1 where id = $2", time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RevokeAPIToken revokes an api token belonging to the user
+func (m *postgresDBRepo) RevokeAPIToken(id, userId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update api_tokens set revoked_at = $1
+		where id = $2 and user_id = $3 and revoked_at is null
+	`
+	_, err := m.DB.ExecContext(ctx, query, time.Now(), id, userId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIToken(row rowScanner) (models.APIToken, error) {
+	var t models.APIToken
+	var scopes string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+
+	err := row.Scan(
+		&t.ID,
+		&t.UserId,
+		&t.Name,
+		&t.TokenHash,
+		&scopes,
+		&expiresAt,
+		&lastUsedAt,
+		&revokedAt,
+		&t.CreatedAt,
+	)
+	if err != nil {
+		return t, err
+	}
+
+	if scopes != "" {
+		t.Scopes = strings.Split(scopes, ",")
+	}
+	t.ExpiresAt = expiresAt.Time
+	t.LastUsedAt = lastUsedAt.Time
+	t.RevokedAt = revokedAt.Time
+
+	return t, nil
+}
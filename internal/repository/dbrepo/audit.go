@@ -0,0 +1,120 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+)
+
+// InsertAuditEntry appends an entry to the audit log. Called in a transaction, a failure
+// aborts it, so that a change is not kept without its entry.
+func (m *postgresDBRepo) InsertAuditEntry(e models.AuditEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		insert into audit_log (user_id, action, entity, entity_key, before_data, after_data, ip_address, created_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := m.DB.ExecContext(ctx, query,
+		e.UserId,
+		e.Action,
+		e.Entity,
+		e.EntityKey,
+		nullJSON(e.Before),
+		nullJSON(e.After),
+		e.IPAddress,
+		time.Now(),
+	)
+	return err
+}
+
+// FetchAuditEntries retrieves the audit log entries matching f, newest first
+func (m *postgresDBRepo) FetchAuditEntries(f models.AuditFilter) ([]models.AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var entries []models.AuditEntry
+
+	var where []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.UserId != 0 {
+		add("a.user_id = $%d", f.UserId)
+	}
+	if f.Action != "" {
+		add("a.action = $%d", f.Action)
+	}
+	if f.Entity != "" {
+		add("a.entity = $%d", f.Entity)
+	}
+	if f.EntityKey != "" {
+		add("a.entity_key = $%d", f.EntityKey)
+	}
+	if !f.From.IsZero() {
+		add("a.created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("a.created_at < $%d", f.To)
+	}
+
+	query := `
+		select a.id, a.user_id, coalesce(u.user_name, ''), a.action, a.entity, a.entity_key,
+			coalesce(a.before_data::text, ''), coalesce(a.after_data::text, ''), a.ip_address, a.created_at
+		from audit_log a
+		left join users u on u.id = a.user_id
+	`
+	if len(where) > 0 {
+		query += " where " + strings.Join(where, " and ")
+	}
+	query += " order by a.created_at desc, a.id desc"
+	if f.Limit > 0 {
+		args = append(args, f.Limit)
+		query += fmt.Sprintf(" limit $%d", len(args))
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.AuditEntry
+		err := rows.Scan(
+			&e.ID,
+			&e.UserId,
+			&e.Username,
+			&e.Action,
+			&e.Entity,
+			&e.EntityKey,
+			&e.Before,
+			&e.After,
+			&e.IPAddress,
+			&e.CreatedAt,
+		)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return entries, err
+	}
+
+	return entries, nil
+}
+
+// nullJSON stores an empty snapshot as null
+func nullJSON(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
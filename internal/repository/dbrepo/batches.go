@@ -0,0 +1,214 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// FetchProductBatches retrieves the batches of a product that still have units, at every
+// location, in the order they are sold from
+func (m *postgresDBRepo) FetchProductBatches(serial string) ([]models.StockBatch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select b.id, b.serial, coalesce(p.name, ''), b.location_id, l.name, b.batch_no, b.expires_at, b.units, b.created_at
+		from product_batches b
+		join products p on p.serial = b.serial
+		join locations l on l.id = b.location_id
+		where b.serial = $1 and b.units > 0
+		order by l.is_default desc, lower(l.name), b.expires_at nulls last, b.created_at, b.id
+	`
+	return scanStockBatches(m.DB.QueryContext(ctx, query, serial))
+}
+
+// FetchExpiringBatches retrieves the batches with units left that expire within days from today
+// at a location, or at every location when locationId is zero, including those already expired,
+// soonest first
+func (m *postgresDBRepo) FetchExpiringBatches(days, locationId int) ([]models.StockBatch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select b.id, b.serial, coalesce(p.name, ''), b.location_id, l.name, b.batch_no, b.expires_at, b.units, b.created_at
+		from product_batches b
+		join products p on p.serial = b.serial
+		join locations l on l.id = b.location_id
+		where b.units > 0 and b.expires_at <= current_date + $1::integer
+			and ($2 = 0 or b.location_id = $2)
+		order by b.expires_at, lower(p.name), l.name
+	`
+	return scanStockBatches(m.DB.QueryContext(ctx, query, days, locationId))
+}
+
+// scanStockBatches reads the batches selected by FetchProductBatches and FetchExpiringBatches
+func scanStockBatches(rows *sql.Rows, err error) ([]models.StockBatch, error) {
+	var batches []models.StockBatch
+	if err != nil {
+		return batches, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b models.StockBatch
+		var expiresAt sql.NullTime
+		err := rows.Scan(
+			&b.ID,
+			&b.Serial,
+			&b.Name,
+			&b.LocationId,
+			&b.LocationName,
+			&b.BatchNo,
+			&expiresAt,
+			&b.Units,
+			&b.CreatedAt,
+		)
+		if err != nil {
+			return batches, err
+		}
+		b.ExpiresAt = expiresAt.Time
+		batches = append(batches, b)
+	}
+
+	if err = rows.Err(); err != nil {
+		return batches, err
+	}
+
+	return batches, nil
+}
+
+// moveBatchStock applies a movement at its location to the product's batches: units brought in
+// with a batch number or expiry date are added to that batch and units taken out come from the
+// batches that expire first. A sale skips expired batches and is refused with
+// repository.ErrStockExpired when the units it needs are only left in them. It is called once
+// the movement has been applied to the units at the location.
+func moveBatchStock(ctx context.Context, tx conn, mv models.StockMovement) error {
+	if mv.Quantity < 0 {
+		_, err := takeBatches(ctx, tx, mv.Serial, mv.LocationId, -mv.Quantity, mv.IsSale())
+		if err != nil || !mv.IsSale() {
+			return err
+		}
+
+		// Units sold beyond the batches are units received without one. The location's units
+		// less its batches is how many of those it has, fewer than none and the sale took
+		// units that are only in expired batches.
+		var untracked int
+		err = tx.QueryRowContext(ctx, `
+			select s.units - coalesce((select sum(b.units) from product_batches b
+				where b.serial = s.serial and b.location_id = s.location_id), 0)
+			from product_stock s
+			where s.serial = $1 and s.location_id = $2`,
+			mv.Serial, mv.LocationId,
+		).Scan(&untracked)
+		if err != nil {
+			return err
+		}
+
+		if untracked < 0 {
+			return repository.ErrStockExpired
+		}
+		return nil
+	}
+
+	if mv.Quantity == 0 || (mv.BatchNo == "" && mv.ExpiresAt.IsZero()) {
+		return nil
+	}
+
+	return addBatch(ctx, tx, models.StockBatch{
+		Serial:     mv.Serial,
+		LocationId: mv.LocationId,
+		BatchNo:    mv.BatchNo,
+		ExpiresAt:  mv.ExpiresAt,
+		Units:      mv.Quantity,
+	})
+}
+
+// addBatch adds units to a batch of a product at a location, creating the batch the first time
+// units of it arrive there
+func addBatch(ctx context.Context, tx conn, b models.StockBatch) error {
+	now := time.Now()
+	_, err := tx.ExecContext(ctx, `
+		insert into product_batches (serial, location_id, batch_no, expires_at, units, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $6)
+		on conflict (serial, location_id, batch_no, (coalesce(expires_at, 'infinity'::date)))
+		do update set units = product_batches.units + excluded.units, updated_at = excluded.updated_at`,
+		b.Serial, b.LocationId, b.BatchNo, nullTime(b.ExpiresAt), b.Units, now,
+	)
+	return err
+}
+
+// takeBatches takes up to units out of the batches of a product at a location, first expiry
+// first out, and returns what was taken from each batch. Units beyond those in batches were
+// received without one and are left to the caller. A sale leaves expired batches for a
+// write-off.
+func takeBatches(ctx context.Context, tx conn, serial string, locationId, units int, sale bool) ([]models.StockBatch, error) {
+	rows, err := tx.QueryContext(ctx, `
+		select id, batch_no, expires_at, units
+		from product_batches
+		where serial = $1 and location_id = $2 and units > 0
+		order by expires_at nulls last, created_at, id
+		for update`,
+		serial, locationId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var batches []models.StockBatch
+	for rows.Next() {
+		b := models.StockBatch{Serial: serial, LocationId: locationId}
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&b.ID, &b.BatchNo, &expiresAt, &b.Units); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		b.ExpiresAt = expiresAt.Time
+		batches = append(batches, b)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	taken := pickBatches(batches, units, sale)
+	for _, b := range taken {
+		_, err = tx.ExecContext(ctx,
+			"update product_batches set units = units - $1, updated_at = $2 where id = $3",
+			b.Units, time.Now(), b.ID,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return taken, nil
+}
+
+// pickBatches returns how many of units come out of each of batches, which are in the order
+// they are taken from. A sale skips the batches that have expired.
+func pickBatches(batches []models.StockBatch, units int, sale bool) []models.StockBatch {
+	var taken []models.StockBatch
+	for _, b := range batches {
+		if units == 0 {
+			break
+		}
+
+		if sale && b.IsExpired() {
+			continue
+		}
+
+		if b.Units > units {
+			b.Units = units
+		}
+
+		units -= b.Units
+		taken = append(taken, b)
+	}
+
+	return taken
+}
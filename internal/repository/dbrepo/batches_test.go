@@ -0,0 +1,53 @@
+package dbrepo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+)
+
+func TestPickBatches(t *testing.T) {
+	day := 24 * time.Hour
+	batches := []models.StockBatch{
+		{ID: 1, BatchNo: "EXP", ExpiresAt: time.Now().Add(-2 * day), Units: 5},
+		{ID: 2, BatchNo: "SOON", ExpiresAt: time.Now().Add(3 * day), Units: 4},
+		{ID: 3, BatchNo: "LATE", ExpiresAt: time.Now().Add(90 * day), Units: 10},
+		{ID: 4, BatchNo: "OPEN", Units: 2},
+	}
+
+	tests := []struct {
+		name     string
+		units    int
+		sale     bool
+		expected map[int]int
+	}{
+		{"sale skips the expired batch", 6, true, map[int]int{2: 4, 3: 2}},
+		{"sale of everything unexpired", 20, true, map[int]int{2: 4, 3: 10, 4: 2}},
+		{"write-off takes the expired batch first", 6, false, map[int]int{1: 5, 2: 1}},
+		{"nothing to take", 0, true, map[int]int{}},
+	}
+
+	for _, tt := range tests {
+		got := make(map[int]int)
+		for _, b := range pickBatches(batches, tt.units, tt.sale) {
+			got[b.ID] = b.Units
+		}
+
+		if len(got) != len(tt.expected) {
+			t.Errorf("%s: got %v, expected %v", tt.name, got, tt.expected)
+			continue
+		}
+		for id, units := range tt.expected {
+			if got[id] != units {
+				t.Errorf("%s: got %v, expected %v", tt.name, got, tt.expected)
+				break
+			}
+		}
+	}
+
+	// Only expired units are left, a sale takes none of them and moveBatchStock refuses it
+	if taken := pickBatches(batches[:1], 3, true); len(taken) != 0 {
+		t.Errorf("sale took expired units: %v", taken)
+	}
+}
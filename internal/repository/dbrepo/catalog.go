@@ -0,0 +1,640 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// productPageSize is how many products a page of the product list holds
+const productPageSize = 6
+
+// categoryTree lists every category with its path from the top of the tree and its depth
+const categoryTree = `
+	category_tree as (
+		select id, name::text as path, 0 as depth
+		from categories
+		where parent_id is null
+		union all
+		select c.id, t.path || ' / ' || c.name, t.depth + 1
+		from categories c
+		join category_tree t on t.id = c.parent_id
+	)
+`
+
+// InsertCategory adds a category and returns its id
+func (m *postgresDBRepo) InsertCategory(c models.Category) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	query := `
+		insert into categories (name, parent_id, created_at, updated_at)
+		values ($1, $2, $3, $3)
+		returning id
+	`
+	err := m.DB.QueryRowContext(ctx, query, c.Name, nullID(c.ParentId), time.Now()).Scan(&id)
+	if err != nil {
+		return 0, uniqueViolation(err)
+	}
+
+	return id, nil
+}
+
+// UpdateCategory renames a category or moves it under another parent, a category cannot be
+// moved under itself or one of its subcategories
+func (m *postgresDBRepo) UpdateCategory(c models.Category) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if c.ParentId != 0 {
+		var cycle bool
+		err := m.DB.QueryRowContext(ctx, `
+			with recursive sub as (
+				select id from categories where id = $1
+				union all
+				select c.id from categories c join sub s on c.parent_id = s.id
+			)
+			select exists (select 1 from sub where id = $2)`,
+			c.ID, c.ParentId,
+		).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+
+		if cycle {
+			return repository.ErrCategoryCycle
+		}
+	}
+
+	res, err := m.DB.ExecContext(ctx,
+		"update categories set name = $1, parent_id = $2, updated_at = $3 where id = $4",
+		c.Name, nullID(c.ParentId), time.Now(), c.ID,
+	)
+	if err != nil {
+		return uniqueViolation(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteCategory removes a category, its subcategories move up to its parent and its products
+// are left without a category
+func (m *postgresDBRepo) DeleteCategory(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		update categories set parent_id = (select parent_id from categories where id = $1), updated_at = $2
+		where parent_id = $1`,
+		id, time.Now(),
+	)
+	if err != nil {
+		return uniqueViolation(err)
+	}
+
+	res, err := tx.ExecContext(ctx, "delete from categories where id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+// FetchCategory retrieves a category by id
+func (m *postgresDBRepo) FetchCategory(id int) (models.Category, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var c models.Category
+	query := `
+		with recursive ` + categoryTree + `
+		select c.id, c.name, coalesce(c.parent_id, 0), t.path, t.depth, c.created_at, c.updated_at
+		from categories c
+		join category_tree t on t.id = c.id
+		where c.id = $1
+	`
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&c.ID,
+		&c.Name,
+		&c.ParentId,
+		&c.Path,
+		&c.Depth,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+	)
+	if err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// FetchCategories retrieves every category in tree order, each parent before its subcategories
+func (m *postgresDBRepo) FetchCategories() ([]models.Category, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var categories []models.Category
+
+	query := `
+		with recursive ` + categoryTree + `
+		select c.id, c.name, coalesce(c.parent_id, 0), t.path, t.depth, c.created_at, c.updated_at
+		from categories c
+		join category_tree t on t.id = c.id
+		order by lower(t.path)
+	`
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return categories, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.Category
+		err := rows.Scan(
+			&c.ID,
+			&c.Name,
+			&c.ParentId,
+			&c.Path,
+			&c.Depth,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+		)
+		if err != nil {
+			return categories, err
+		}
+		categories = append(categories, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return categories, err
+	}
+
+	return categories, nil
+}
+
+// InsertBrand adds a brand and returns its id
+func (m *postgresDBRepo) InsertBrand(b models.Brand) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	err := m.DB.QueryRowContext(ctx,
+		"insert into brands (name, created_at, updated_at) values ($1, $2, $2) returning id",
+		b.Name, time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return 0, uniqueViolation(err)
+	}
+
+	return id, nil
+}
+
+// UpdateBrand renames a brand
+func (m *postgresDBRepo) UpdateBrand(b models.Brand) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx,
+		"update brands set name = $1, updated_at = $2 where id = $3",
+		b.Name, time.Now(), b.ID,
+	)
+	if err != nil {
+		return uniqueViolation(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteBrand removes a brand, its products are left without one
+func (m *postgresDBRepo) DeleteBrand(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, "delete from brands where id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// FetchBrand retrieves a brand by id
+func (m *postgresDBRepo) FetchBrand(id int) (models.Brand, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var b models.Brand
+	err := m.DB.QueryRowContext(ctx,
+		"select id, name, created_at, updated_at from brands where id = $1", id,
+	).Scan(&b.ID, &b.Name, &b.CreatedAt, &b.UpdatedAt)
+	if err != nil {
+		return b, err
+	}
+
+	return b, nil
+}
+
+// FetchBrands retrieves every brand by name
+func (m *postgresDBRepo) FetchBrands() ([]models.Brand, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var brands []models.Brand
+
+	rows, err := m.DB.QueryContext(ctx, "select id, name, created_at, updated_at from brands order by lower(name)")
+	if err != nil {
+		return brands, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b models.Brand
+		if err := rows.Scan(&b.ID, &b.Name, &b.CreatedAt, &b.UpdatedAt); err != nil {
+			return brands, err
+		}
+		brands = append(brands, b)
+	}
+
+	if err = rows.Err(); err != nil {
+		return brands, err
+	}
+
+	return brands, nil
+}
+
+// FetchProducts retrieves a page of the products matching f ordered by serial, with their
+// category, brand, attributes and primary image
+func (m *postgresDBRepo) FetchProducts(f models.ProductFilter) ([]models.Product, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var p []models.Product
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = productPageSize
+	}
+	page := f.Page
+	if page <= 0 {
+		page = 1
+	}
+
+	where, args := productWhere(f, "")
+	args = append(args, limit, (page-1)*limit)
+	query := fmt.Sprintf(`
+		with recursive %s
+		select p.id, p.serial, p.name, p.description, p.price, p.cost_price, p.units, p.reorder_point, p.reorder_qty,
+			coalesce(p.category_id, 0), coalesce(t.path, ''), coalesce(p.brand_id, 0), coalesce(b.name, ''),
+			coalesce(i.id, 0), p.archived_at, p.user_id, p.created_at, p.updated_at
+		from products p
+		left join category_tree t on t.id = p.category_id
+		left join brands b on b.id = p.brand_id
+		left join product_images i on i.serial = p.serial and i.is_primary
+		%s
+		order by p.serial
+		limit $%d offset $%d
+	`, categoryTree, where, len(args)-1, len(args))
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return p, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var prod models.Product
+		var archivedAt sql.NullTime
+		err := rows.Scan(
+			&prod.ID,
+			&prod.Serial,
+			&prod.Name,
+			&prod.Description,
+			&prod.Price,
+			&prod.CostPrice,
+			&prod.Units,
+			&prod.ReorderPoint,
+			&prod.ReorderQty,
+			&prod.CategoryId,
+			&prod.CategoryPath,
+			&prod.BrandId,
+			&prod.BrandName,
+			&prod.ImageId,
+			&archivedAt,
+			&prod.UserId,
+			&prod.CreatedAt,
+			&prod.UpdatedAt,
+		)
+		if err != nil {
+			return p, err
+		}
+		prod.ArchivedAt = archivedAt.Time
+		p = append(p, prod)
+	}
+
+	if err = rows.Err(); err != nil {
+		return p, err
+	}
+
+	if len(p) == 0 {
+		return p, nil
+	}
+
+	ids := make([]int, len(p))
+	for i := range p {
+		ids[i] = p[i].ID
+	}
+
+	attrs, err := fetchProductAttributes(ctx, m.DB, ids...)
+	if err != nil {
+		return p, err
+	}
+
+	for i := range p {
+		p[i].Attributes = attrs[p[i].ID]
+	}
+
+	return p, nil
+}
+
+// FetchProductFacets counts the products matching f in each category, brand and attribute
+// value, each facet is counted without its own part of the filter
+func (m *postgresDBRepo) FetchProductFacets(f models.ProductFilter) (models.ProductFacets, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var facets models.ProductFacets
+
+	// A product counts towards its category and every category above it
+	where, args := productWhere(f, "category")
+	query := fmt.Sprintf(`
+		with recursive %s,
+		ancestors as (
+			select id, id as root from categories
+			union all
+			select c.id, a.root from categories c join ancestors a on c.parent_id = a.id
+		)
+		select a.root, c.name, t.depth, count(p.id)
+		from ancestors a
+		join products p on p.category_id = a.id
+		join categories c on c.id = a.root
+		join category_tree t on t.id = a.root
+		%s
+		group by a.root, c.name, t.depth, t.path
+		order by lower(t.path)
+	`, categoryTree, where)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return facets, err
+	}
+
+	for rows.Next() {
+		var fc models.FacetCount
+		if err := rows.Scan(&fc.ID, &fc.Name, &fc.Depth, &fc.Count); err != nil {
+			rows.Close()
+			return facets, err
+		}
+		fc.Selected = fc.ID == f.CategoryId
+		facets.Categories = append(facets.Categories, fc)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return facets, err
+	}
+
+	where, args = productWhere(f, "brand")
+	query = fmt.Sprintf(`
+		with recursive %s
+		select b.id, b.name, count(p.id)
+		from brands b
+		join products p on p.brand_id = b.id
+		%s
+		group by b.id, b.name
+		order by lower(b.name)
+	`, categoryTree, where)
+
+	rows, err = m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return facets, err
+	}
+
+	for rows.Next() {
+		var fc models.FacetCount
+		if err := rows.Scan(&fc.ID, &fc.Name, &fc.Count); err != nil {
+			rows.Close()
+			return facets, err
+		}
+		fc.Selected = fc.ID == f.BrandId
+		facets.Brands = append(facets.Brands, fc)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return facets, err
+	}
+
+	where, args = productWhere(f, "attribute")
+	query = fmt.Sprintf(`
+		with recursive %s
+		select pa.name, pa.value, count(p.id)
+		from product_attributes pa
+		join products p on p.id = pa.product_id
+		%s
+		group by pa.name, pa.value
+		order by pa.name, lower(pa.value)
+	`, categoryTree, where)
+
+	rows, err = m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return facets, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fc models.FacetCount
+		if err := rows.Scan(&fc.Name, &fc.Value, &fc.Count); err != nil {
+			return facets, err
+		}
+		fc.Selected = f.HasAttribute(fc.Name, fc.Value)
+		facets.Attributes = append(facets.Attributes, fc)
+	}
+
+	if err = rows.Err(); err != nil {
+		return facets, err
+	}
+
+	return facets, nil
+}
+
+// productWhere builds the where clause of f on products p, which always chooses between the
+// products on sale and the archived ones. The part of the filter named by skip is left out so
+// that facet can be counted against the rest, when skip is "attribute" each attribute condition
+// is waived for the attribute pa being counted.
+func productWhere(f models.ProductFilter, skip string) (string, []any) {
+	var where []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.Archived {
+		where = append(where, "p.archived_at is not null")
+	} else {
+		where = append(where, "p.archived_at is null")
+	}
+
+	if f.Search != "" {
+		like := arg("%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(f.Search) + "%")
+		where = append(where, fmt.Sprintf("(p.serial ilike %[1]s or p.name ilike %[1]s or p.description ilike %[1]s)", like))
+	}
+
+	if f.CategoryId != 0 && skip != "category" {
+		where = append(where, fmt.Sprintf(`p.category_id in (
+			with recursive sub as (
+				select id from categories where id = %s
+				union all
+				select c.id from categories c join sub s on c.parent_id = s.id
+			)
+			select id from sub
+		)`, arg(f.CategoryId)))
+	}
+
+	if f.BrandId != 0 && skip != "brand" {
+		where = append(where, "p.brand_id = "+arg(f.BrandId))
+	}
+
+	for _, a := range f.Attributes {
+		name, value := arg(a.Name), arg(a.Value)
+		cond := fmt.Sprintf(
+			"exists (select 1 from product_attributes x where x.product_id = p.id and x.name = %s and x.value = %s)",
+			name, value,
+		)
+		if skip == "attribute" {
+			cond = fmt.Sprintf("(pa.name = %s or %s)", name, cond)
+		}
+		where = append(where, cond)
+	}
+
+	return "where " + strings.Join(where, " and "), args
+}
+
+// fetchProductAttributes retrieves the attributes of the products with ids, by product id
+func fetchProductAttributes(ctx context.Context, tx conn, ids ...int) (map[int][]models.ProductAttribute, error) {
+	attrs := make(map[int][]models.ProductAttribute)
+
+	params := make([]string, len(ids))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		params[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		"select product_id, name, value from product_attributes where product_id in ("+strings.Join(params, ", ")+") order by name",
+		args...,
+	)
+	if err != nil {
+		return attrs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var a models.ProductAttribute
+		if err := rows.Scan(&id, &a.Name, &a.Value); err != nil {
+			return attrs, err
+		}
+		attrs[id] = append(attrs[id], a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return attrs, err
+	}
+
+	return attrs, nil
+}
+
+// replaceProductAttributes sets the attributes of a product to attrs
+func replaceProductAttributes(ctx context.Context, tx conn, productId int, attrs []models.ProductAttribute) error {
+	_, err := tx.ExecContext(ctx, "delete from product_attributes where product_id = $1", productId)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range attrs {
+		_, err = tx.ExecContext(ctx,
+			"insert into product_attributes (product_id, name, value) values ($1, $2, $3)",
+			productId, a.Name, a.Value,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// nullID stores an id of zero as null
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// uniqueViolation turns a unique constraint violation into repository.ErrDuplicate
+func uniqueViolation(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return repository.ErrDuplicate
+	}
+	return err
+}
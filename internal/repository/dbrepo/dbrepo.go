@@ -1,15 +1,25 @@
 package dbrepo
 
 import (
+	"context"
 	"database/sql"
 
 	"github.com/jofosuware/small-business-management-app/internal/config"
 	"github.com/jofosuware/small-business-management-app/internal/repository"
 )
 
+// conn runs statements on the database, or on the transaction the repository is bound to
+type conn interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 type postgresDBRepo struct {
 	App *config.AppConfig
-	DB  *sql.DB
+	DB  conn
 }
 
 func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
@@ -24,3 +34,87 @@ func NewDB(conn *sql.DB) repository.DatabaseRepo {
 		DB: conn,
 	}
 }
+
+// WithTx runs fn with a repository whose methods all run in one transaction. The transaction
+// is committed when fn returns nil and rolled back when it returns an error. Called on a
+// repository that is already in a transaction, fn runs in a savepoint of it.
+func (m *postgresDBRepo) WithTx(ctx context.Context, fn func(repo repository.DatabaseRepo) error) error {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(&postgresDBRepo{
+		App: m.App,
+		DB:  tx.Tx,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// begin starts a transaction, or a savepoint when the repository is already in one
+func (m *postgresDBRepo) begin(ctx context.Context) (*txn, error) {
+	if tx, ok := m.DB.(*sql.Tx); ok {
+		_, err := tx.ExecContext(ctx, "savepoint nested")
+		if err != nil {
+			return nil, err
+		}
+		return &txn{Tx: tx, ctx: ctx, nested: true}, nil
+	}
+
+	tx, err := m.DB.(*sql.DB).BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &txn{Tx: tx, ctx: ctx}, nil
+}
+
+// txn is a transaction, or a savepoint when the repository is already in one. Savepoints
+// share one name, postgres releases and rolls back to the most recent of them, so a savepoint
+// is always released when it is done with to leave the one of the enclosing scope on top.
+type txn struct {
+	*sql.Tx
+	ctx    context.Context
+	nested bool
+	done   bool
+}
+
+// Commit commits the transaction, or releases the savepoint
+func (t *txn) Commit() error {
+	if !t.nested {
+		return t.Tx.Commit()
+	}
+
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+
+	_, err := t.Tx.ExecContext(t.ctx, "release savepoint nested")
+	return err
+}
+
+// Rollback rolls the transaction back, or undoes the work done since the savepoint
+func (t *txn) Rollback() error {
+	if !t.nested {
+		return t.Tx.Rollback()
+	}
+
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+
+	_, err := t.Tx.ExecContext(t.ctx, "rollback to savepoint nested")
+	if err != nil {
+		return err
+	}
+
+	_, err = t.Tx.ExecContext(t.ctx, "release savepoint nested")
+	return err
+}
@@ -0,0 +1,213 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// savepointDriver is a database that only knows "insert <row>" and transactions with
+// savepoints, which it handles the way postgres does. Deletes are only counted.
+type savepointDriver struct {
+	mu      sync.Mutex
+	rows    []string
+	deletes int
+}
+
+type savepoint struct {
+	name string
+	rows []string
+}
+
+type savepointConn struct {
+	db         *savepointDriver
+	rows       []string
+	savepoints []savepoint
+	inTx       bool
+}
+
+func (d *savepointDriver) Open(name string) (driver.Conn, error) {
+	return &savepointConn{db: d}, nil
+}
+
+func (c *savepointConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare is not supported")
+}
+
+func (c *savepointConn) Close() error { return nil }
+
+func (c *savepointConn) Begin() (driver.Tx, error) {
+	c.db.mu.Lock()
+	c.rows = append([]string(nil), c.db.rows...)
+	c.db.mu.Unlock()
+	c.savepoints = nil
+	c.inTx = true
+	return c, nil
+}
+
+func (c *savepointConn) Commit() error {
+	c.db.mu.Lock()
+	c.db.rows = c.rows
+	c.db.mu.Unlock()
+	c.inTx = false
+	return nil
+}
+
+func (c *savepointConn) Rollback() error {
+	c.inTx = false
+	return nil
+}
+
+// find returns the index of the most recent savepoint called name
+func (c *savepointConn) find(name string) (int, error) {
+	for i := len(c.savepoints) - 1; i >= 0; i-- {
+		if c.savepoints[i].name == name {
+			return i, nil
+		}
+	}
+	return 0, errors.New("savepoint " + name + " does not exist")
+}
+
+func (c *savepointConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	switch f := strings.Fields(query); {
+	case len(f) == 2 && f[0] == "insert":
+		if !c.inTx {
+			c.db.mu.Lock()
+			c.db.rows = append(c.db.rows, f[1])
+			c.db.mu.Unlock()
+			break
+		}
+		c.rows = append(c.rows, f[1])
+	case len(f) == 2 && f[0] == "savepoint":
+		c.savepoints = append(c.savepoints, savepoint{f[1], append([]string(nil), c.rows...)})
+	case len(f) == 3 && f[0] == "release":
+		i, err := c.find(f[2])
+		if err != nil {
+			return nil, err
+		}
+		c.savepoints = c.savepoints[:i]
+	case len(f) == 4 && f[0] == "rollback":
+		i, err := c.find(f[3])
+		if err != nil {
+			return nil, err
+		}
+		c.rows = append([]string(nil), c.savepoints[i].rows...)
+		c.savepoints = c.savepoints[:i+1]
+	case len(f) > 0 && f[0] == "delete":
+		c.db.mu.Lock()
+		c.db.deletes++
+		c.db.mu.Unlock()
+	default:
+		return nil, errors.New("unknown statement " + query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+var savepoints = &savepointDriver{}
+
+func init() {
+	sql.Register("savepoints", savepoints)
+}
+
+// insert adds row through repo, in whatever transaction repo is bound to
+func insert(repo repository.DatabaseRepo, row string) error {
+	_, err := repo.(*postgresDBRepo).DB.ExecContext(context.Background(), "insert "+row)
+	return err
+}
+
+func TestWithTx(t *testing.T) {
+	db, err := sql.Open("savepoints", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	repo := NewDB(db)
+	fail := errors.New("fail")
+
+	tests := []struct {
+		name     string
+		fn       func(repo repository.DatabaseRepo) error
+		expected []string
+	}{
+		{"commit", func(repo repository.DatabaseRepo) error {
+			return insert(repo, "a")
+		}, []string{"a"}},
+		{"rollback", func(repo repository.DatabaseRepo) error {
+			if err := insert(repo, "a"); err != nil {
+				return err
+			}
+			return fail
+		}, nil},
+		{"nested rollback inside a committed scope", func(repo repository.DatabaseRepo) error {
+			if err := insert(repo, "a"); err != nil {
+				return err
+			}
+			err := repo.WithTx(context.Background(), func(repo repository.DatabaseRepo) error {
+				if err := insert(repo, "b"); err != nil {
+					return err
+				}
+				return fail
+			})
+			if !errors.Is(err, fail) {
+				return err
+			}
+			return insert(repo, "c")
+		}, []string{"a", "c"}},
+		{"rollback after a nested rollback", func(repo repository.DatabaseRepo) error {
+			if err := insert(repo, "a"); err != nil {
+				return err
+			}
+			err := repo.WithTx(context.Background(), func(repo repository.DatabaseRepo) error {
+				if err := insert(repo, "b"); err != nil {
+					return err
+				}
+				err := repo.WithTx(context.Background(), func(repo repository.DatabaseRepo) error {
+					if err := insert(repo, "c"); err != nil {
+						return err
+					}
+					return fail
+				})
+				if !errors.Is(err, fail) {
+					return err
+				}
+				return fail
+			})
+			if !errors.Is(err, fail) {
+				return err
+			}
+			return insert(repo, "d")
+		}, []string{"a", "d"}},
+		{"nested commits", func(repo repository.DatabaseRepo) error {
+			return repo.WithTx(context.Background(), func(repo repository.DatabaseRepo) error {
+				if err := insert(repo, "a"); err != nil {
+					return err
+				}
+				return repo.WithTx(context.Background(), func(repo repository.DatabaseRepo) error {
+					return insert(repo, "b")
+				})
+			})
+		}, []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		savepoints.rows = nil
+
+		err := repo.WithTx(context.Background(), tt.fn)
+		if err != nil && !errors.Is(err, fail) {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(savepoints.rows, tt.expected) {
+			t.Errorf("%s: committed %v, expected %v", tt.name, savepoints.rows, tt.expected)
+		}
+	}
+}
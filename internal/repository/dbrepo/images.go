@@ -0,0 +1,198 @@
+package dbrepo
+
+import (
+	"context"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// maxProductImages is the most images a product can have
+const maxProductImages = 10
+
+// InsertProductImage adds an image of a product with its thumbnail and returns its id, the
+// first image of a product becomes its primary image. A product with maxProductImages already
+// is refused with repository.ErrImageLimit.
+func (m *postgresDBRepo) InsertProductImage(img models.ProductImage, image, thumbnail []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Locking the product keeps concurrent uploads from both becoming primary or passing the limit
+	var serial string
+	err = tx.QueryRowContext(ctx, "select serial from products where serial = $1 for update", img.Serial).Scan(&serial)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, "select count(*) from product_images where serial = $1", serial).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	if count >= maxProductImages {
+		return 0, repository.ErrImageLimit
+	}
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		insert into product_images (serial, image, thumbnail, is_primary, user_id, created_at)
+		values ($1, $2, $3, $4, $5, $6)
+		returning id`,
+		serial, image, thumbnail, count == 0, img.UserId, time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// SetPrimaryProductImage makes an image the primary image of its product in place of the old one
+func (m *postgresDBRepo) SetPrimaryProductImage(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var serial string
+	err = tx.QueryRowContext(ctx, "select serial from product_images where id = $1 for update", id).Scan(&serial)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"update product_images set is_primary = false where serial = $1 and is_primary and id <> $2", serial, id,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "update product_images set is_primary = true where id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteProductImage removes an image of a product, when it was the primary image the oldest
+// image left takes its place
+func (m *postgresDBRepo) DeleteProductImage(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var serial string
+	var primary bool
+	err = tx.QueryRowContext(ctx,
+		"delete from product_images where id = $1 returning serial, is_primary", id,
+	).Scan(&serial, &primary)
+	if err != nil {
+		return err
+	}
+
+	if primary {
+		_, err = tx.ExecContext(ctx, `
+			update product_images set is_primary = true
+			where id = (select id from product_images where serial = $1 order by created_at, id limit 1)`,
+			serial,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// FetchProductImage retrieves the details of an image of a product by id, without the image
+func (m *postgresDBRepo) FetchProductImage(id int) (models.ProductImage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var img models.ProductImage
+	err := m.DB.QueryRowContext(ctx,
+		"select id, serial, is_primary, octet_length(image), user_id, created_at from product_images where id = $1", id,
+	).Scan(&img.ID, &img.Serial, &img.IsPrimary, &img.Size, &img.UserId, &img.CreatedAt)
+	if err != nil {
+		return img, err
+	}
+
+	return img, nil
+}
+
+// FetchProductImages retrieves the details of the images of a product, the primary image first
+// and then in the order they were added
+func (m *postgresDBRepo) FetchProductImages(serial string) ([]models.ProductImage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var images []models.ProductImage
+
+	rows, err := m.DB.QueryContext(ctx, `
+		select id, serial, is_primary, octet_length(image), user_id, created_at
+		from product_images
+		where serial = $1
+		order by is_primary desc, created_at, id`,
+		serial,
+	)
+	if err != nil {
+		return images, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var img models.ProductImage
+		err := rows.Scan(&img.ID, &img.Serial, &img.IsPrimary, &img.Size, &img.UserId, &img.CreatedAt)
+		if err != nil {
+			return images, err
+		}
+		images = append(images, img)
+	}
+
+	if err = rows.Err(); err != nil {
+		return images, err
+	}
+
+	return images, nil
+}
+
+// FetchProductImageData retrieves an image of a product, or its thumbnail
+func (m *postgresDBRepo) FetchProductImageData(id int, thumbnail bool) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := "select image from product_images where id = $1"
+	if thumbnail {
+		query = "select thumbnail from product_images where id = $1"
+	}
+
+	var data []byte
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
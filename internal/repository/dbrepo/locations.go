@@ -0,0 +1,545 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// InsertLocation adds a location and returns its id, it becomes the default location when
+// IsDefault is set
+func (m *postgresDBRepo) InsertLocation(l models.Location) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if l.IsDefault {
+		_, err = tx.ExecContext(ctx, "update locations set is_default = false where is_default")
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		insert into locations (name, address, is_default, created_at, updated_at)
+		values ($1, $2, $3, $4, $4)
+		returning id`,
+		l.Name, l.Address, l.IsDefault, time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return 0, uniqueViolation(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// UpdateLocation saves the changes to a location. Setting IsDefault makes it the default
+// location in place of the old one, the default can only be moved and not cleared.
+func (m *postgresDBRepo) UpdateLocation(l models.Location) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if l.IsDefault {
+		_, err = tx.ExecContext(ctx, "update locations set is_default = false where is_default and id <> $1", l.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	res, err := tx.ExecContext(ctx,
+		"update locations set name = $1, address = $2, is_default = is_default or $3, updated_at = $4 where id = $5",
+		l.Name, l.Address, l.IsDefault, time.Now(), l.ID,
+	)
+	if err != nil {
+		return uniqueViolation(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+// FetchLocation retrieves a location by id
+func (m *postgresDBRepo) FetchLocation(id int) (models.Location, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var l models.Location
+	err := m.DB.QueryRowContext(ctx,
+		"select id, name, address, is_default, created_at, updated_at from locations where id = $1", id,
+	).Scan(&l.ID, &l.Name, &l.Address, &l.IsDefault, &l.CreatedAt, &l.UpdatedAt)
+	if err != nil {
+		return l, err
+	}
+
+	return l, nil
+}
+
+// FetchLocations retrieves every location, the default first and then by name
+func (m *postgresDBRepo) FetchLocations() ([]models.Location, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var locations []models.Location
+
+	rows, err := m.DB.QueryContext(ctx,
+		"select id, name, address, is_default, created_at, updated_at from locations order by is_default desc, lower(name)",
+	)
+	if err != nil {
+		return locations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l models.Location
+		err := rows.Scan(&l.ID, &l.Name, &l.Address, &l.IsDefault, &l.CreatedAt, &l.UpdatedAt)
+		if err != nil {
+			return locations, err
+		}
+		locations = append(locations, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return locations, err
+	}
+
+	return locations, nil
+}
+
+// FetchProductStock retrieves the units of a product at every location, the default first
+func (m *postgresDBRepo) FetchProductStock(serial string) ([]models.LocationStock, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var stock []models.LocationStock
+
+	query := `
+		select l.id, l.name, coalesce(ps.units, 0)
+		from locations l
+		left join product_stock ps on ps.location_id = l.id and ps.serial = $1
+		order by l.is_default desc, lower(l.name)
+	`
+	rows, err := m.DB.QueryContext(ctx, query, serial)
+	if err != nil {
+		return stock, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.LocationStock
+		if err := rows.Scan(&s.LocationId, &s.LocationName, &s.Units); err != nil {
+			return stock, err
+		}
+		stock = append(stock, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return stock, err
+	}
+
+	return stock, nil
+}
+
+// FetchStockLevels retrieves the units of every product at each location and in total, by
+// product name
+func (m *postgresDBRepo) FetchStockLevels() ([]models.StockLevel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var levels []models.StockLevel
+
+	query := `
+		select p.serial, coalesce(p.name, ''), coalesce(p.cost_price, 0), coalesce(p.units, 0),
+			coalesce(ps.location_id, 0), coalesce(ps.units, 0)
+		from products p
+		left join product_stock ps on ps.serial = p.serial
+		where p.serial is not null
+		order by lower(p.name), p.serial
+	`
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return levels, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.StockLevel
+		var locationId, units int
+		err := rows.Scan(&s.Serial, &s.Name, &s.CostPrice, &s.Total, &locationId, &units)
+		if err != nil {
+			return levels, err
+		}
+
+		if len(levels) == 0 || levels[len(levels)-1].Serial != s.Serial {
+			s.Locations = make(map[int]int)
+			levels = append(levels, s)
+		}
+
+		if locationId != 0 {
+			levels[len(levels)-1].Locations[locationId] = units
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return levels, err
+	}
+
+	return levels, nil
+}
+
+// InsertStockTransfer adds a draft stock transfer with its lines and returns its id
+func (m *postgresDBRepo) InsertStockTransfer(t models.StockTransfer) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	query := `
+		insert into stock_transfers (from_location_id, to_location_id, status, notes, user_id, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $6)
+		returning id
+	`
+	err = tx.QueryRowContext(ctx, query,
+		t.FromId,
+		t.ToId,
+		models.TransferDraft,
+		t.Notes,
+		t.UserId,
+		time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertStockTransferLines(ctx, tx, id, t.Lines)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// UpdateStockTransfer replaces the locations, notes and lines of a draft stock transfer
+func (m *postgresDBRepo) UpdateStockTransfer(t models.StockTransfer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		update stock_transfers set from_location_id = $1, to_location_id = $2, notes = $3, user_id = $4, updated_at = $5
+		where id = $6 and status = $7
+	`
+	res, err := tx.ExecContext(ctx, query,
+		t.FromId,
+		t.ToId,
+		t.Notes,
+		t.UserId,
+		time.Now(),
+		t.ID,
+		models.TransferDraft,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return repository.ErrTransferStatus
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from stock_transfer_lines where transfer_id = $1", t.ID)
+	if err != nil {
+		return err
+	}
+
+	err = insertStockTransferLines(ctx, tx, t.ID, t.Lines)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CompleteStockTransfer moves the units on a draft stock transfer from its source location to
+// its destination, recording a movement out and in for each line at the product's cost price.
+// The total units and cost of each product are not changed, and the batches that expire first
+// are the ones moved.
+func (m *postgresDBRepo) CompleteStockTransfer(id, userId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	var fromId, toId int
+	err = tx.QueryRowContext(ctx,
+		"select status, from_location_id, to_location_id from stock_transfers where id = $1 for update", id,
+	).Scan(&status, &fromId, &toId)
+	if err != nil {
+		return err
+	}
+
+	if status != models.TransferDraft {
+		return repository.ErrTransferStatus
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		select l.serial, l.quantity, coalesce(p.cost_price, 0)
+		from stock_transfer_lines l
+		join products p on p.serial = l.serial
+		where l.transfer_id = $1
+		order by l.id`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	var movements []models.StockMovement
+	for rows.Next() {
+		var mv models.StockMovement
+		if err := rows.Scan(&mv.Serial, &mv.Quantity, &mv.UnitCost); err != nil {
+			rows.Close()
+			return err
+		}
+		movements = append(movements, mv)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if len(movements) == 0 {
+		return repository.ErrTransferStatus
+	}
+
+	reference := fmt.Sprintf("Transfer #%d", id)
+	for _, mv := range movements {
+		mv.Reference = reference
+		mv.UserId = userId
+
+		// The batches that expire first go, and arrive under the same batch numbers and dates
+		batches, err := takeBatches(ctx, tx, mv.Serial, fromId, mv.Quantity, false)
+		if err != nil {
+			return err
+		}
+
+		out := mv
+		out.LocationId = fromId
+		out.Quantity = -mv.Quantity
+		out.Reason = models.StockTransferOut
+		err = moveLocationStock(ctx, tx, out.Serial, out.LocationId, out.Quantity)
+		if err != nil {
+			return err
+		}
+		err = insertStockMovement(ctx, tx, out)
+		if err != nil {
+			return err
+		}
+
+		in := mv
+		in.LocationId = toId
+		in.Reason = models.StockTransferIn
+		for _, b := range batches {
+			b.LocationId = toId
+			if err = addBatch(ctx, tx, b); err != nil {
+				return err
+			}
+		}
+		err = insertLocatedMovement(ctx, tx, in)
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	_, err = tx.ExecContext(ctx,
+		"update stock_transfers set status = $1, transferred_at = $2, user_id = $3, updated_at = $2 where id = $4",
+		models.TransferTransferred, now, userId, id,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteStockTransfer removes a draft stock transfer
+func (m *postgresDBRepo) DeleteStockTransfer(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, "delete from stock_transfers where id = $1 and status = $2", id, models.TransferDraft)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return repository.ErrTransferStatus
+	}
+
+	return nil
+}
+
+// FetchStockTransfer retrieves a stock transfer with its lines
+func (m *postgresDBRepo) FetchStockTransfer(id int) (models.StockTransfer, error) {
+	transfers, err := m.fetchStockTransfers("where t.id = $1", id)
+	if err != nil {
+		return models.StockTransfer{}, err
+	}
+
+	if len(transfers) == 0 {
+		return models.StockTransfer{}, sql.ErrNoRows
+	}
+
+	return transfers[0], nil
+}
+
+// FetchStockTransfers retrieves the stock transfers with status, or every transfer when status
+// is empty, newest first
+func (m *postgresDBRepo) FetchStockTransfers(status string) ([]models.StockTransfer, error) {
+	if status == "" {
+		return m.fetchStockTransfers("")
+	}
+	return m.fetchStockTransfers("where t.status = $1", status)
+}
+
+func (m *postgresDBRepo) fetchStockTransfers(where string, args ...any) ([]models.StockTransfer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var transfers []models.StockTransfer
+
+	query := `
+		select t.id, t.from_location_id, f.name, t.to_location_id, d.name, t.status, t.notes,
+			t.user_id, coalesce(u.user_name, ''), t.transferred_at, t.created_at, t.updated_at,
+			coalesce(l.id, 0), coalesce(l.serial, ''), coalesce(p.name, ''), coalesce(l.quantity, 0)
+		from stock_transfers t
+		inner join locations f on f.id = t.from_location_id
+		inner join locations d on d.id = t.to_location_id
+		left join users u on u.id = t.user_id
+		left join stock_transfer_lines l on l.transfer_id = t.id
+		left join products p on p.serial = l.serial
+		` + where + `
+		order by t.created_at desc, t.id desc, l.id
+	`
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return transfers, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.StockTransfer
+		var l models.StockTransferLine
+		var transferredAt sql.NullTime
+		err := rows.Scan(
+			&t.ID,
+			&t.FromId,
+			&t.FromName,
+			&t.ToId,
+			&t.ToName,
+			&t.Status,
+			&t.Notes,
+			&t.UserId,
+			&t.Username,
+			&transferredAt,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+			&l.ID,
+			&l.Serial,
+			&l.Name,
+			&l.Quantity,
+		)
+		if err != nil {
+			return transfers, err
+		}
+
+		if len(transfers) == 0 || transfers[len(transfers)-1].ID != t.ID {
+			t.TransferredAt = transferredAt.Time
+			transfers = append(transfers, t)
+		}
+
+		if l.ID != 0 {
+			l.TransferId = t.ID
+			last := &transfers[len(transfers)-1]
+			last.Lines = append(last.Lines, l)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return transfers, err
+	}
+
+	return transfers, nil
+}
+
+// insertStockTransferLines writes the lines of a stock transfer
+func insertStockTransferLines(ctx context.Context, tx conn, transferId int, lines []models.StockTransferLine) error {
+	for _, l := range lines {
+		_, err := tx.ExecContext(ctx,
+			"insert into stock_transfer_lines (transfer_id, serial, quantity) values ($1, $2, $3)",
+			transferId, l.Serial, l.Quantity,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,204 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+)
+
+// InsertLoginAttempt records a successful or failed login
+func (m *postgresDBRepo) InsertLoginAttempt(a models.LoginAttempt) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		insert into login_attempts (username, ip_address, succeeded, created_at)
+		values ($1, $2, $3, $4)
+	`
+	_, err := m.DB.ExecContext(ctx, query,
+		a.Username,
+		a.IPAddress,
+		a.Succeeded,
+		time.Now(),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FetchLoginFailures counts the failed logins since the given time for a username and a client IP.
+// Username failures before the last successful login or unlock are not counted, neither are IP
+// failures before the IP was last unlocked.
+func (m *postgresDBRepo) FetchLoginFailures(username, ip string, since time.Time) (models.LoginFailures, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var f models.LoginFailures
+	var last sql.NullTime
+
+	query := `
+		with user_since as (
+			select greatest($3::timestamp,
+				coalesce((select max(created_at) from login_attempts where username = $1 and succeeded), $3::timestamp),
+				coalesce((select max(unlocked_at) from account_lockouts where scope = $4 and username = $1), $3::timestamp)
+			) as t
+		), ip_since as (
+			select greatest($3::timestamp,
+				coalesce((select max(unlocked_at) from account_lockouts where scope = $5 and ip_address = $2), $3::timestamp)
+			) as t
+		)
+		select
+			(select count(*) from login_attempts
+				where username = $1 and not succeeded and created_at > (select t from user_since)),
+			(select count(*) from login_attempts
+				where ip_address = $2 and not succeeded and created_at > (select t from ip_since)),
+			(select max(created_at) from login_attempts
+				where username = $1 and not succeeded and created_at > (select t from user_since))
+	`
+	err := m.DB.QueryRowContext(ctx, query,
+		username,
+		ip,
+		since,
+		models.LockoutScopeUsername,
+		models.LockoutScopeIP,
+	).Scan(&f.ByUsername, &f.ByIP, &last)
+
+	if err != nil {
+		return f, err
+	}
+	f.LastFailure = last.Time
+
+	return f, nil
+}
+
+// InsertLockout records a lockout of a username or client IP
+func (m *postgresDBRepo) InsertLockout(l models.Lockout) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		insert into account_lockouts (scope, username, ip_address, failures, locked_until, created_at)
+		values ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := m.DB.ExecContext(ctx, query,
+		l.Scope,
+		l.Username,
+		l.IPAddress,
+		l.Failures,
+		l.LockedUntil,
+		time.Now(),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FetchActiveLockout retrieves the lockout currently blocking the username or client IP
+func (m *postgresDBRepo) FetchActiveLockout(username, ip string) (models.Lockout, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select id, scope, username, ip_address, failures, locked_until, created_at
+		from account_lockouts
+		where unlocked_at is null and locked_until > $3
+			and ((scope = $4 and username = $1) or (scope = $5 and ip_address = $2))
+		order by locked_until desc
+		limit 1
+	`
+	var l models.Lockout
+	err := m.DB.QueryRowContext(ctx, query,
+		username,
+		ip,
+		time.Now(),
+		models.LockoutScopeUsername,
+		models.LockoutScopeIP,
+	).Scan(
+		&l.ID,
+		&l.Scope,
+		&l.Username,
+		&l.IPAddress,
+		&l.Failures,
+		&l.LockedUntil,
+		&l.CreatedAt,
+	)
+
+	if err != nil {
+		return l, err
+	}
+
+	return l, nil
+}
+
+// FetchLockouts retrieves the most recent lockouts for review
+func (m *postgresDBRepo) FetchLockouts() ([]models.Lockout, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var lockouts []models.Lockout
+
+	query := `
+		select id, scope, username, ip_address, failures, locked_until,
+			coalesce(unlocked_by, 0), unlocked_at, created_at
+		from account_lockouts
+		order by created_at desc
+		limit 200
+	`
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return lockouts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l models.Lockout
+		var unlockedAt sql.NullTime
+		err = rows.Scan(
+			&l.ID,
+			&l.Scope,
+			&l.Username,
+			&l.IPAddress,
+			&l.Failures,
+			&l.LockedUntil,
+			&l.UnlockedBy,
+			&unlockedAt,
+			&l.CreatedAt,
+		)
+		if err != nil {
+			return lockouts, err
+		}
+		l.UnlockedAt = unlockedAt.Time
+		lockouts = append(lockouts, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return lockouts, err
+	}
+
+	return lockouts, nil
+}
+
+// UnlockAccount lifts a lockout before it expires
+func (m *postgresDBRepo) UnlockAccount(id, unlockedBy int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update account_lockouts set unlocked_by = $1, unlocked_at = $2
+		where id = $3 and unlocked_at is null
+	`
+	_, err := m.DB.ExecContext(ctx, query, unlockedBy, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
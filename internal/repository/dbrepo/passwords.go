@@ -0,0 +1,53 @@
+package dbrepo
+
+import (
+	"context"
+	"time"
+)
+
+// FetchPasswordHistory retrieves the hashes of a user's current password and of the n
+// passwords set before it
+func (m *postgresDBRepo) FetchPasswordHistory(userId, n int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var hashes []string
+
+	query := `
+		select password from users where id = $1 and password <> ''
+		union all
+		(select password_hash from password_history where user_id = $1 order by created_at desc limit $2)
+	`
+	rows, err := m.DB.QueryContext(ctx, query, userId, n)
+	if err != nil {
+		return hashes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return hashes, err
+		}
+		hashes = append(hashes, hash)
+	}
+
+	if err = rows.Err(); err != nil {
+		return hashes, err
+	}
+
+	return hashes, nil
+}
+
+// insertPasswordHistory remembers a password hash a user has set
+func insertPasswordHistory(ctx context.Context, tx conn, userId int, hash string) error {
+	_, err := tx.ExecContext(ctx,
+		"insert into password_history (user_id, password_hash, created_at) values ($1, $2, $3)",
+		userId, hash, time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -2,11 +2,13 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -22,6 +24,14 @@ func (m *postgresDBRepo) Authenticate(username, password string) (models.User, e
 		return models.User{}, err
 	}
 
+	if !u.Active() {
+		return models.User{}, errors.New("account is deactivated")
+	}
+
+	if u.Password == "" {
+		return models.User{}, errors.New("account not activated")
+	}
+
 	err = bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 	if err == bcrypt.ErrMismatchedHashAndPassword {
 		return models.User{}, errors.New("incorrect password")
@@ -41,8 +51,8 @@ func (m *postgresDBRepo) InsertUser(u models.User) (int, error) {
 
 	query := `
 		insert into users (first_name, last_name, user_name,
-		 password, user_image, access_level, created_at, updated_at) 
-		values ($1, $2, $3, $4, $5, $6, $7, $8) returning id
+		 password, user_image, access_level, location_id, created_at, updated_at) 
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id
 	`
 	err := m.DB.QueryRowContext(ctx, query,
 		u.FirstName,
@@ -51,6 +61,7 @@ func (m *postgresDBRepo) InsertUser(u models.User) (int, error) {
 		u.Password,
 		u.Image,
 		u.AccessLevel,
+		nullID(u.LocationId),
 		u.CreatedAt,
 		u.UpdatedAt,
 	).Scan(&newID)
@@ -67,16 +78,65 @@ func (m *postgresDBRepo) ResetUser(u models.User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userId int
 	query := `
 			update users
 				set password = $1, updated_at = $2
 			where
 				user_name = $3
+			returning id
 	`
-	_, err := m.DB.ExecContext(ctx, query,
+	err = tx.QueryRowContext(ctx, query,
 		u.Password,
 		time.Now(),
 		u.Username,
+	).Scan(&userId)
+
+	if err != nil {
+		return err
+	}
+
+	err = insertPasswordHistory(ctx, tx, userId, u.Password)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateUser updates a user's profile, access level and location, the photo is kept when none
+// is given
+func (m *postgresDBRepo) UpdateUser(u models.User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var image any
+	if len(u.Image) > 0 {
+		image = u.Image
+	}
+
+	query := `
+			update users
+				set first_name = $1, last_name = $2, user_name = $3, access_level = $4,
+				user_image = coalesce($5, user_image), location_id = $6, updated_at = $7
+			where
+				id = $8 and deleted_at is null
+	`
+	_, err := m.DB.ExecContext(ctx, query,
+		u.FirstName,
+		u.LastName,
+		u.Username,
+		u.AccessLevel,
+		image,
+		nullID(u.LocationId),
+		time.Now(),
+		u.ID,
 	)
 
 	if err != nil {
@@ -86,6 +146,105 @@ func (m *postgresDBRepo) ResetUser(u models.User) error {
 	return nil
 }
 
+// DeactivateUser stops a user from logging in and ends their sessions and api tokens
+func (m *postgresDBRepo) DeactivateUser(userId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"update users set disabled_at = $1, updated_at = $1 where id = $2 and disabled_at is null",
+		time.Now(), userId,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"update api_tokens set revoked_at = $1 where user_id = $2 and revoked_at is null",
+		time.Now(), userId,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = deleteUserSessions(ctx, tx, "user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReactivateUser lets a deactivated user log in again
+func (m *postgresDBRepo) ReactivateUser(userId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx,
+		"update users set disabled_at = null, updated_at = $1 where id = $2 and deleted_at is null",
+		time.Now(), userId,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteUser removes a user's credentials and personal data but keeps the row, so every record
+// they created still points to a user. The username is freed for reuse.
+func (m *postgresDBRepo) DeleteUser(userId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		update users set
+			user_name = user_name || ' (deleted #' || id || ')',
+			password = '', user_image = null, totp_secret = '', totp_enabled = false,
+			disabled_at = coalesce(disabled_at, $1), deleted_at = $1, updated_at = $1
+		where id = $2 and deleted_at is null
+	`
+	_, err = tx.ExecContext(ctx, query, time.Now(), userId)
+	if err != nil {
+		return err
+	}
+
+	statements := []string{
+		"update api_tokens set revoked_at = $1 where user_id = $2 and revoked_at is null",
+		"update activation_tokens set revoked_at = $1 where user_id = $2 and used_at is null and revoked_at is null",
+	}
+	for _, stmt := range statements {
+		_, err = tx.ExecContext(ctx, stmt, time.Now(), userId)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from recovery_codes where user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+
+	err = deleteUserSessions(ctx, tx, "user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // FetchUser select a user with his/her username
 func (m *postgresDBRepo) FetchUser(username string) (models.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -93,10 +252,13 @@ func (m *postgresDBRepo) FetchUser(username string) (models.User, error) {
 
 	u := models.User{}
 	quary := `select 
-				id, first_name, last_name, user_name, password, access_level, user_image, created_at, 
-				updated_at
-		      from users where user_name = $1`
+				u.id, u.first_name, u.last_name, u.user_name, u.password, u.access_level, u.user_image, u.totp_enabled,
+				coalesce(u.location_id, 0), coalesce(l.name, ''), u.disabled_at, u.deleted_at, u.created_at, u.updated_at
+		      from users u
+		      left join locations l on l.id = u.location_id
+		      where u.user_name = $1`
 
+	var disabledAt, deletedAt sql.NullTime
 	row := m.DB.QueryRowContext(ctx, quary, username)
 	err := row.Scan(
 		&u.ID,
@@ -106,63 +268,138 @@ func (m *postgresDBRepo) FetchUser(username string) (models.User, error) {
 		&u.Password,
 		&u.AccessLevel,
 		&u.Image,
+		&u.TOTPEnabled,
+		&u.LocationId,
+		&u.LocationName,
+		&disabledAt,
+		&deletedAt,
 		&u.CreatedAt,
 		&u.UpdatedAt,
 	)
 	if err != nil {
 		return models.User{}, err
 	}
+	u.DisabledAt = disabledAt.Time
+	u.DeletedAt = deletedAt.Time
 
 	return u, nil
 }
 
-// InsertProduct inserts product information into the database
+// InsertProduct inserts product information into the database, its price is the first entry in
+// its price history
 func (m *postgresDBRepo) InsertProduct(p models.Product) (models.Product, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	var product models.Product
 
-	query := `insert into products (serial, name, description, price, units, user_id, created_at, updated_at) 
-				values ($1, $2, $3, $4, $5, $6, $7, $8) 
-				returning id, serial, name, description, price, units, user_id
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return product, err
+	}
+	defer tx.Rollback()
+
+	query := `insert into products (serial, name, description, price, cost_price, units, reorder_point, reorder_qty, 
+					category_id, brand_id, user_id, created_at, updated_at) 
+				values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) 
+				returning id, serial, name, description, price, cost_price, units, reorder_point, reorder_qty, 
+					coalesce(category_id, 0), coalesce(brand_id, 0), user_id
 	`
-	err := m.DB.QueryRowContext(ctx, query,
+	err = tx.QueryRowContext(ctx, query,
 		p.Serial,
 		p.Name,
 		p.Description,
 		p.Price,
+		p.CostPrice,
 		p.Units,
+		p.ReorderPoint,
+		p.ReorderQty,
+		nullID(p.CategoryId),
+		nullID(p.BrandId),
 		p.UserId,
 		time.Now(),
 		time.Now(),
-	).Scan(&product.ID, &product.Serial, &product.Name, &product.Description, &product.Price, &product.Units, &product.UserId)
+	).Scan(&product.ID, &product.Serial, &product.Name, &product.Description, &product.Price, &product.CostPrice,
+		&product.Units, &product.ReorderPoint, &product.ReorderQty, &product.CategoryId, &product.BrandId, &product.UserId)
 
 	if err != nil {
 		return product, err
 	}
 
-	return product, nil
+	err = replaceProductAttributes(ctx, tx, product.ID, p.Attributes)
+	if err != nil {
+		return product, err
+	}
+	product.Attributes = p.Attributes
+
+	err = insertPriceChange(ctx, tx, models.PriceChange{
+		Serial: product.Serial,
+		Price:  product.Price,
+		Note:   "New product",
+		UserId: p.UserId,
+	})
+	if err != nil {
+		return product, err
+	}
+
+	if product.Units != 0 {
+		err = insertLocatedMovement(ctx, tx, models.StockMovement{
+			Serial:    product.Serial,
+			Quantity:  int(product.Units),
+			Reason:    models.StockOpening,
+			Reference: "New product",
+			UnitCost:  product.CostPrice,
+			UserId:    p.UserId,
+		})
+		if err != nil {
+			return product, err
+		}
+	}
+
+	return product, tx.Commit()
 }
 
-// UpdateProduct updates product in the database by ID
+// UpdateProduct updates product in the database by ID, a change of units is recorded in the
+// stock ledger as an adjustment at the location of the user making it and a change of price in
+// the price history
 func (m *postgresDBRepo) UpdateProduct(p models.Product) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var serial string
+	var units int
+	var price float32
+	err = tx.QueryRowContext(ctx,
+		"select serial, coalesce(units, 0), coalesce(price, 0) from products where id = $1 for update", p.ID,
+	).Scan(&serial, &units, &price)
+	if err != nil {
+		return err
+	}
+
 	query := `
 		update 
-			products set name = $1, description = $2, price = $3, units = $4, user_id = $5, 
-			updated_at = $6 
+			products set name = $1, description = $2, price = $3, cost_price = $4, units = $5,
+			reorder_point = $6, reorder_qty = $7, category_id = $8, brand_id = $9, user_id = $10, updated_at = $11 
 		where 
-			id = $7
+			id = $12
 	`
 
-	_, err := m.DB.ExecContext(ctx, query,
+	_, err = tx.ExecContext(ctx, query,
 		p.Name,
 		p.Description,
 		p.Price,
+		p.CostPrice,
 		p.Units,
+		p.ReorderPoint,
+		p.ReorderQty,
+		nullID(p.CategoryId),
+		nullID(p.BrandId),
 		p.UserId,
 		time.Now(),
 		p.ID,
@@ -172,81 +409,79 @@ func (m *postgresDBRepo) UpdateProduct(p models.Product) error {
 		return err
 	}
 
-	return nil
-}
-
-// DecreaseQuantity updates the product's quantity by decreasing it value by value
-func (m *postgresDBRepo) DecreaseQuantity(p models.Product) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	query := `
-		update 
-			products set units = units - $1, user_id = $2, updated_at = $3 
-		where 
-			serial = $4
-	`
-
-	_, err := m.DB.ExecContext(ctx, query,
-		p.Units,
-		p.UserId,
-		time.Now(),
-		p.Serial,
-	)
-
+	err = replaceProductAttributes(ctx, tx, p.ID, p.Attributes)
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-// IncreaseQuantity updates the product's quantity by increasing it value by value
-func (m *postgresDBRepo) IncreaseQuantity(p models.Product) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	query := `
-		update 
-			products set units = units + $1, user_id = $2, updated_at = $3 
-		where 
-			serial = $4
-	`
-
-	_, err := m.DB.ExecContext(ctx, query,
-		p.Units,
-		p.UserId,
-		time.Now(),
-		p.Serial,
-	)
+	if delta := int(p.Units) - units; delta != 0 {
+		err = insertLocatedMovement(ctx, tx, models.StockMovement{
+			Serial:    serial,
+			Quantity:  delta,
+			Reason:    models.StockAdjustment,
+			Reference: "Product edited",
+			UnitCost:  p.CostPrice,
+			UserId:    p.UserId,
+		})
+		if err != nil {
+			return err
+		}
+	}
 
-	if err != nil {
-		return err
+	// Prices are stored as real, so they are compared at that precision
+	if float32(p.Price) != price {
+		err = insertPriceChange(ctx, tx, models.PriceChange{
+			Serial: serial,
+			Price:  p.Price,
+			Note:   "Product edited",
+			UserId: p.UserId,
+		})
+		if err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-// FetchProduct retrieves a product with its serial number
+// FetchProduct retrieves a product with its serial number, its category, brand, attributes and
+// primary image. Archived products are found too so the records naming them still resolve.
 func (m *postgresDBRepo) FetchProduct(serial string) (models.Product, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	var p models.Product
+	var archivedAt sql.NullTime
 
 	err := m.DB.QueryRowContext(ctx,
-		"select id, serial, name, description, price, units from products where serial = $1",
+		`with recursive `+categoryTree+`
+		select p.id, p.serial, p.name, p.description, p.price, p.cost_price, p.units, p.reorder_point, p.reorder_qty,
+			coalesce(p.category_id, 0), coalesce(t.path, ''), coalesce(p.brand_id, 0), coalesce(b.name, ''),
+			coalesce(i.id, 0), p.archived_at
+		from products p
+		left join product_images i on i.serial = p.serial and i.is_primary
+		left join category_tree t on t.id = p.category_id
+		left join brands b on b.id = p.brand_id
+		where p.serial = $1`,
 		serial,
-	).Scan(&p.ID, &p.Serial, &p.Name, &p.Description, &p.Price, &p.Units)
+	).Scan(&p.ID, &p.Serial, &p.Name, &p.Description, &p.Price, &p.CostPrice, &p.Units, &p.ReorderPoint, &p.ReorderQty,
+		&p.CategoryId, &p.CategoryPath, &p.BrandId, &p.BrandName, &p.ImageId, &archivedAt)
+
+	if err != nil {
+		return p, err
+	}
+	p.ArchivedAt = archivedAt.Time
 
+	attrs, err := fetchProductAttributes(ctx, m.DB, p.ID)
 	if err != nil {
 		return p, err
 	}
+	p.Attributes = attrs[p.ID]
 
 	return p, nil
 }
 
-// FetchAllProduct retrieves all product in the products database
+// FetchAllProduct retrieves all the products on sale, archived products are left out
 func (m *postgresDBRepo) FetchAllProduct() ([]models.Product, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -254,7 +489,9 @@ func (m *postgresDBRepo) FetchAllProduct() ([]models.Product, error) {
 	var p []models.Product
 
 	rows, err := m.DB.QueryContext(ctx,
-		"select * from products",
+		`select id, serial, name, description, price, cost_price, units, reorder_point, reorder_qty, user_id, created_at, updated_at
+		from products
+		where archived_at is null`,
 	)
 
 	if err != nil {
@@ -271,7 +508,10 @@ func (m *postgresDBRepo) FetchAllProduct() ([]models.Product, error) {
 			&prod.Name,
 			&prod.Description,
 			&prod.Price,
+			&prod.CostPrice,
 			&prod.Units,
+			&prod.ReorderPoint,
+			&prod.ReorderQty,
 			&prod.UserId,
 			&prod.CreatedAt,
 			&prod.UpdatedAt,
@@ -291,67 +531,98 @@ func (m *postgresDBRepo) FetchAllProduct() ([]models.Product, error) {
 	return p, nil
 }
 
-// FetchAllProduct retrieves all product in the products database
+// FetchProductByPage retrieves a page of the products ordered by serial
 func (m *postgresDBRepo) FetchProductByPage(page int) ([]models.Product, error) {
+	return m.FetchProducts(models.ProductFilter{Page: page})
+}
+
+// DeleteProduct removes product from the database by its serial number, with its restock
+// alerts, batches and images. A product that was sold, ordered, counted or transferred is
+// refused with repository.ErrProductInUse so the records naming it stay whole; it can be
+// archived instead. Its stock ledger and price history are kept, the units it still had are
+// written off the ledger so that a product added later under the serial starts from zero.
+func (m *postgresDBRepo) DeleteProduct(serial string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var p []models.Product
-	limit := 6
-	offset := (page - 1) * limit
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inUse bool
+	err = tx.QueryRowContext(ctx, `
+		select exists (select 1 from purchased_oncredit where serial = $1)
+			or exists (select 1 from purchases where serial = $1)
+			or exists (select 1 from purchase_order_lines where serial = $1)
+			or exists (select 1 from stock_take_lines where serial = $1)
+			or exists (select 1 from stock_transfer_lines where serial = $1)`,
+		serial,
+	).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return repository.ErrProductInUse
+	}
 
-	rows, err := m.DB.QueryContext(ctx,
-		"select * from products order by serial limit $1 offset $2",
-		limit, offset,
+	_, err = tx.ExecContext(ctx, `
+		insert into stock_movements (serial, location_id, quantity, reason, reference, batch_no, unit_cost, user_id, created_at)
+		select serial, location_id, -sum(quantity), $2, 'Product deleted', '', 0, 0, $3
+		from stock_movements
+		where serial = $1
+		group by serial, location_id
+		having sum(quantity) <> 0`,
+		serial, models.StockAdjustment, time.Now(),
 	)
-
 	if err != nil {
-		return p, err
+		return err
 	}
 
-	defer rows.Close()
-
-	for rows.Next() {
-		prod := models.Product{}
-		err = rows.Scan(
-			&prod.ID,
-			&prod.Serial,
-			&prod.Name,
-			&prod.Description,
-			&prod.Price,
-			&prod.Units,
-			&prod.UserId,
-			&prod.CreatedAt,
-			&prod.UpdatedAt,
-		)
-
-		if err != nil {
-			return p, err
-		}
-
-		p = append(p, prod)
-
-		if err = rows.Err(); err != nil {
-			return p, err
+	for _, query := range []string{
+		"delete from stock_alerts where serial = $1",
+		"delete from product_batches where serial = $1",
+		"delete from product_images where serial = $1",
+		"delete from product_stock where serial = $1",
+		"delete from products where serial = $1",
+	} {
+		if _, err := tx.ExecContext(ctx, query, serial); err != nil {
+			return err
 		}
 	}
 
-	return p, nil
+	return tx.Commit()
 }
 
-// DeleteProduct removes product from the database by its serial number
-func (m *postgresDBRepo) DeleteProduct(serial string) error {
+// ArchiveProduct takes the product with serial off sale, it is left out of the product pickers,
+// lists and restock alerts but kept for the records that name it
+func (m *postgresDBRepo) ArchiveProduct(serial string, userId int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := "delete from products where serial = $1"
+	now := time.Now()
+	_, err := m.DB.ExecContext(ctx,
+		`update products set archived_at = $1, user_id = $2, updated_at = $1
+		where serial = $3 and archived_at is null`,
+		now, userId, serial,
+	)
 
-	_, err := m.DB.ExecContext(ctx, query, serial)
-	if err != nil {
-		return err
-	}
+	return err
+}
 
-	return nil
+// RestoreProduct puts the archived product with serial back on sale
+func (m *postgresDBRepo) RestoreProduct(serial string, userId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx,
+		`update products set archived_at = null, user_id = $1, updated_at = $2
+		where serial = $3 and archived_at is not null`,
+		userId, time.Now(), serial,
+	)
+
+	return err
 }
 
 // FetchCustomer retrieves a customer info with its id
@@ -617,16 +888,17 @@ func (m *postgresDBRepo) UpdateWitness(w models.Witness) error {
 	return nil
 }
 
-// InsertItem inserts item purchased into the database
+// InsertItem inserts item purchased into the database, the product's cost price is copied onto
+// the item so the margin of the sale is kept when the cost changes
 func (m *postgresDBRepo) InsertItem(itm models.Item) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	stmt := `insert into 
 				purchased_oncredit 
-					(customer_id, serial, price, quantity, deposit, balance, user_id, created_at, updated_at) 
+					(customer_id, serial, price, quantity, deposit, balance, unit_cost, user_id, created_at, updated_at) 
 			  values 
-			  		($1, $2, $3, $4, $5, $6, $7, $8, $9) 
+			  		($1, $2, $3, $4, $5, $6, coalesce((select cost_price from products where serial = $2), 0), $7, $8, $9) 
 			
 	`
 	_, err := m.DB.ExecContext(ctx, stmt,
@@ -648,22 +920,26 @@ func (m *postgresDBRepo) InsertItem(itm models.Item) error {
 	return nil
 }
 
-// UpdateItem updates item in the database by ID
-func (m *postgresDBRepo) UpdateItem(itm models.Item) error {
+// UpdateItem updates the item the customer bought with serial. The item keeps the cost it was
+// sold at while its product stays the same and takes the cost price of the new product when it
+// changes. sql.ErrNoRows is returned when the customer has no such item.
+func (m *postgresDBRepo) UpdateItem(serial string, itm models.Item) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	query := `
 		update 
 			purchased_oncredit set serial = $1, price = $2, quantity = $3, 
-			deposit = $4, balance = $5, user_id = $6, updated_at = $7
+			deposit = $4, balance = $5, user_id = $6, updated_at = $7,
+			unit_cost = case when $1 = $9 then unit_cost
+				else coalesce((select cost_price from products where serial = $1), 0) end
 		where 
 			customer_id = $8 
 		AND
 			serial = $9
 			`
 
-	_, err := m.DB.ExecContext(ctx, query,
+	res, err := m.DB.ExecContext(ctx, query,
 		itm.Serial,
 		itm.Price,
 		itm.Quantity,
@@ -672,13 +948,22 @@ func (m *postgresDBRepo) UpdateItem(itm models.Item) error {
 		itm.UserId,
 		time.Now(),
 		itm.CustomerId,
-		itm.Serial,
+		serial,
 	)
 
 	if err != nil {
 		return err
 	}
 
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
 	return nil
 }
 
@@ -810,16 +1095,18 @@ func (m *postgresDBRepo) CustomerPayment(customerId string) ([]models.Payments,
 	return custPayment, nil
 }
 
-// InsertPurchase store the purchase made by a customer directly
+// InsertPurchase store the purchase made by a customer directly, the product's price and cost
+// price are copied onto the purchase so it keeps the prices of the moment it was made
 func (m *postgresDBRepo) InsertPurchase(p models.Purchases) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	var id int
 	query := `insert into purchases 
-				(serial, quantity, amount, user_id, created_at, updated_at) 
+				(serial, quantity, amount, unit_price, unit_cost, user_id, created_at, updated_at) 
 			  values 
-			  	($1, $2, $3, $4, $5, $6) 
+			  	($1, $2, $3, coalesce((select price from products where serial = $1), 0),
+			  	coalesce((select cost_price from products where serial = $1), 0), $4, $5, $6) 
 			  returning id
 	`
 	err := m.DB.QueryRowContext(ctx, query,
@@ -1062,7 +1349,7 @@ func (m *postgresDBRepo) FetchAllPurchase() ([]models.Purchases, error) {
 	var p []models.Purchases
 
 	rows, err := m.DB.QueryContext(ctx,
-		"select serial, quantity, user_id, created_at from purchases",
+		"select serial, quantity, unit_price, user_id, created_at from purchases",
 	)
 
 	if err != nil {
@@ -1076,6 +1363,7 @@ func (m *postgresDBRepo) FetchAllPurchase() ([]models.Purchases, error) {
 		err = rows.Scan(
 			&pymt.Serial,
 			&pymt.Quantity,
+			&pymt.UnitPrice,
 			&pymt.UserId,
 			&pymt.CreatedAt,
 		)
@@ -1104,7 +1392,7 @@ func (m *postgresDBRepo) FetchPurchaseByPage(page int) ([]models.Purchases, erro
 	offset := (page - 1) * limit
 
 	query := `
-			select serial, quantity, user_id, updated_at 
+			select serial, quantity, unit_price, user_id, updated_at 
 			from purchases order by serial limit $1 offset $2
 	`
 
@@ -1123,6 +1411,7 @@ func (m *postgresDBRepo) FetchPurchaseByPage(page int) ([]models.Purchases, erro
 		err = rows.Scan(
 			&pymt.Serial,
 			&pymt.Quantity,
+			&pymt.UnitPrice,
 			&pymt.UserId,
 			&pymt.UpdatedAt,
 		)
@@ -1149,7 +1438,11 @@ func (m *postgresDBRepo) FetchAllUsers() ([]models.User, error) {
 	var u []models.User
 
 	rows, err := m.DB.QueryContext(ctx,
-		"select first_name, last_name, user_name, access_level, created_at from users",
+		`select u.id, u.first_name, u.last_name, u.user_name, u.access_level, coalesce(u.location_id, 0), coalesce(l.name, ''),
+			u.disabled_at, u.created_at
+		from users u
+		left join locations l on l.id = u.location_id
+		where u.deleted_at is null order by u.id`,
 	)
 
 	if err != nil {
@@ -1160,17 +1453,23 @@ func (m *postgresDBRepo) FetchAllUsers() ([]models.User, error) {
 
 	for rows.Next() {
 		urs := models.User{}
+		var disabledAt sql.NullTime
 		err = rows.Scan(
+			&urs.ID,
 			&urs.FirstName,
 			&urs.LastName,
 			&urs.Username,
 			&urs.AccessLevel,
+			&urs.LocationId,
+			&urs.LocationName,
+			&disabledAt,
 			&urs.CreatedAt,
 		)
 
 		if err != nil {
 			return u, err
 		}
+		urs.DisabledAt = disabledAt.Time
 
 		u = append(u, urs)
 
@@ -1229,17 +1528,3 @@ func (m *postgresDBRepo) DropTables(tables []string) error {
 	}
 	return nil
 }
-
-func (m *postgresDBRepo) DeleteUsers() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	query := `
-		delete from users where user_name <> 'jofosuware'
-	`
-	_, err := m.DB.ExecContext(ctx, query)
-	if err != nil {
-		return err
-	}
-	return nil
-}
@@ -0,0 +1,227 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// SchedulePriceChange records a new price for a product and returns its id. A change effective
+// now or earlier is written to the product straight away, a later one waits in the price history
+// until ApplyScheduledPrices reaches its effective date.
+func (m *postgresDBRepo) SchedulePriceChange(c models.PriceChange) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if c.EffectiveAt.IsZero() || !c.EffectiveAt.After(now) {
+		res, err := tx.ExecContext(ctx,
+			"update products set price = $1, user_id = $2, updated_at = $3 where serial = $4",
+			c.Price, c.UserId, now, c.Serial,
+		)
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			return 0, sql.ErrNoRows
+		}
+
+		c.EffectiveAt = now
+		c.AppliedAt = now
+	} else {
+		var exists bool
+		err = tx.QueryRowContext(ctx, "select exists (select 1 from products where serial = $1)", c.Serial).Scan(&exists)
+		if err != nil {
+			return 0, err
+		}
+		if !exists {
+			return 0, sql.ErrNoRows
+		}
+	}
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		insert into product_prices (serial, price, effective_at, applied_at, note, user_id, created_at)
+		values ($1, $2, $3, $4, $5, $6, $7)
+		returning id`,
+		c.Serial, c.Price, c.EffectiveAt, nullTime(c.AppliedAt), c.Note, c.UserId, now,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// CancelPriceChange removes a scheduled price change that has not taken effect yet
+func (m *postgresDBRepo) CancelPriceChange(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, "delete from product_prices where id = $1 and applied_at is null", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return repository.ErrPriceApplied
+	}
+
+	return nil
+}
+
+// ApplyScheduledPrices writes the scheduled price changes that have reached their effective date
+// to their products, the latest one winning when a product has several, and returns them
+func (m *postgresDBRepo) ApplyScheduledPrices() ([]models.PriceChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	due, err := fetchPriceChanges(ctx, tx,
+		"where c.applied_at is null and c.effective_at <= $1 order by c.effective_at, c.id for update of c", now,
+	)
+	if err != nil {
+		return due, err
+	}
+
+	for i, c := range due {
+		_, err = tx.ExecContext(ctx,
+			"update products set price = $1, user_id = $2, updated_at = $3 where serial = $4",
+			c.Price, c.UserId, now, c.Serial,
+		)
+		if err != nil {
+			return due, err
+		}
+
+		_, err = tx.ExecContext(ctx, "update product_prices set applied_at = $1 where id = $2", now, c.ID)
+		if err != nil {
+			return due, err
+		}
+		due[i].AppliedAt = now
+	}
+
+	return due, tx.Commit()
+}
+
+// FetchPriceChange retrieves a price change by id
+func (m *postgresDBRepo) FetchPriceChange(id int) (models.PriceChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	changes, err := fetchPriceChanges(ctx, m.DB, "where c.id = $1", id)
+	if err != nil {
+		return models.PriceChange{}, err
+	}
+
+	if len(changes) == 0 {
+		return models.PriceChange{}, sql.ErrNoRows
+	}
+
+	return changes[0], nil
+}
+
+// FetchPriceHistory retrieves every price of a product, the scheduled ones included, latest
+// effective date first
+func (m *postgresDBRepo) FetchPriceHistory(serial string) ([]models.PriceChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return fetchPriceChanges(ctx, m.DB, "where c.serial = $1 order by c.effective_at desc, c.id desc", serial)
+}
+
+// FetchScheduledPrices retrieves the price changes waiting for their effective date, soonest first
+func (m *postgresDBRepo) FetchScheduledPrices() ([]models.PriceChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return fetchPriceChanges(ctx, m.DB, "where c.applied_at is null order by c.effective_at, c.id")
+}
+
+// insertPriceChange adds a price that takes effect now to the price history, for prices set on
+// the product itself
+func insertPriceChange(ctx context.Context, tx conn, c models.PriceChange) error {
+	now := time.Now()
+	_, err := tx.ExecContext(ctx, `
+		insert into product_prices (serial, price, effective_at, applied_at, note, user_id, created_at)
+		values ($1, $2, $3, $3, $4, $5, $3)`,
+		c.Serial, c.Price, now, c.Note, c.UserId,
+	)
+	return err
+}
+
+// fetchPriceChanges reads the price changes matching the where clause, which also orders them,
+// on product_prices c
+func fetchPriceChanges(ctx context.Context, tx conn, where string, args ...any) ([]models.PriceChange, error) {
+	var changes []models.PriceChange
+
+	query := `
+		select c.id, c.serial, coalesce(p.name, ''), c.price, c.effective_at, c.applied_at, c.note,
+			c.user_id, coalesce(u.user_name, ''), c.created_at
+		from product_prices c
+		left join products p on p.serial = c.serial
+		left join users u on u.id = c.user_id
+		` + where
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return changes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.PriceChange
+		var appliedAt sql.NullTime
+		err := rows.Scan(
+			&c.ID,
+			&c.Serial,
+			&c.Name,
+			&c.Price,
+			&c.EffectiveAt,
+			&appliedAt,
+			&c.Note,
+			&c.UserId,
+			&c.Username,
+			&c.CreatedAt,
+		)
+		if err != nil {
+			return changes, err
+		}
+		c.AppliedAt = appliedAt.Time
+		changes = append(changes, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return changes, err
+	}
+
+	return changes, nil
+}
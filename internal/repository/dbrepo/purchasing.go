@@ -0,0 +1,501 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// InsertSupplier adds a supplier and returns its id
+func (m *postgresDBRepo) InsertSupplier(s models.Supplier) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	query := `
+		insert into suppliers (name, contact_name, phone, email, address, notes, user_id, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+		returning id
+	`
+	err := m.DB.QueryRowContext(ctx, query,
+		s.Name,
+		s.ContactName,
+		s.Phone,
+		s.Email,
+		s.Address,
+		s.Notes,
+		s.UserId,
+		time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// UpdateSupplier saves the changes to a supplier
+func (m *postgresDBRepo) UpdateSupplier(s models.Supplier) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update suppliers set name = $1, contact_name = $2, phone = $3, email = $4, address = $5,
+			notes = $6, user_id = $7, updated_at = $8
+		where id = $9
+	`
+	res, err := m.DB.ExecContext(ctx, query,
+		s.Name,
+		s.ContactName,
+		s.Phone,
+		s.Email,
+		s.Address,
+		s.Notes,
+		s.UserId,
+		time.Now(),
+		s.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// FetchSupplier retrieves a supplier by id
+func (m *postgresDBRepo) FetchSupplier(id int) (models.Supplier, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var s models.Supplier
+	query := `
+		select id, name, contact_name, phone, email, address, notes, user_id, created_at, updated_at
+		from suppliers where id = $1
+	`
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&s.ID,
+		&s.Name,
+		&s.ContactName,
+		&s.Phone,
+		&s.Email,
+		&s.Address,
+		&s.Notes,
+		&s.UserId,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+	)
+	if err != nil {
+		return s, err
+	}
+
+	return s, nil
+}
+
+// FetchSuppliers retrieves every supplier by name
+func (m *postgresDBRepo) FetchSuppliers() ([]models.Supplier, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var suppliers []models.Supplier
+
+	query := `
+		select id, name, contact_name, phone, email, address, notes, user_id, created_at, updated_at
+		from suppliers order by lower(name)
+	`
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return suppliers, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.Supplier
+		err := rows.Scan(
+			&s.ID,
+			&s.Name,
+			&s.ContactName,
+			&s.Phone,
+			&s.Email,
+			&s.Address,
+			&s.Notes,
+			&s.UserId,
+			&s.CreatedAt,
+			&s.UpdatedAt,
+		)
+		if err != nil {
+			return suppliers, err
+		}
+		suppliers = append(suppliers, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return suppliers, err
+	}
+
+	return suppliers, nil
+}
+
+// InsertPurchaseOrder adds a draft purchase order with its lines and returns its id
+func (m *postgresDBRepo) InsertPurchaseOrder(po models.PurchaseOrder) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	query := `
+		insert into purchase_orders (supplier_id, status, notes, expected_at, user_id, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $6)
+		returning id
+	`
+	err = tx.QueryRowContext(ctx, query,
+		po.SupplierId,
+		models.OrderDraft,
+		po.Notes,
+		nullTime(po.ExpectedAt),
+		po.UserId,
+		time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertPurchaseOrderLines(ctx, tx, id, po.Lines)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// UpdatePurchaseOrder replaces the supplier, notes and lines of a draft purchase order
+func (m *postgresDBRepo) UpdatePurchaseOrder(po models.PurchaseOrder) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		update purchase_orders set supplier_id = $1, notes = $2, expected_at = $3, user_id = $4, updated_at = $5
+		where id = $6 and status = $7
+	`
+	res, err := tx.ExecContext(ctx, query,
+		po.SupplierId,
+		po.Notes,
+		nullTime(po.ExpectedAt),
+		po.UserId,
+		time.Now(),
+		po.ID,
+		models.OrderDraft,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return repository.ErrOrderStatus
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from purchase_order_lines where order_id = $1", po.ID)
+	if err != nil {
+		return err
+	}
+
+	err = insertPurchaseOrderLines(ctx, tx, po.ID, po.Lines)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PlacePurchaseOrder marks a draft purchase order as sent to the supplier
+func (m *postgresDBRepo) PlacePurchaseOrder(id, userId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update purchase_orders set status = $1, ordered_at = $2, user_id = $3, updated_at = $2
+		where id = $4 and status = $5 and exists (select 1 from purchase_order_lines where order_id = $4)
+	`
+	res, err := m.DB.ExecContext(ctx, query, models.OrderOrdered, time.Now(), userId, id, models.OrderDraft)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return repository.ErrOrderStatus
+	}
+
+	return nil
+}
+
+// ReceivePurchaseOrder books goods delivered against an ordered purchase order. Each receipt
+// raises the product's stock at the unit cost paid, into its batch when it has one, and the
+// order becomes partially received or received.
+func (m *postgresDBRepo) ReceivePurchaseOrder(id, userId int, receipts []models.PurchaseOrderReceipt) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRowContext(ctx, "select status from purchase_orders where id = $1 for update", id).Scan(&status)
+	if err != nil {
+		return err
+	}
+
+	if status != models.OrderOrdered && status != models.OrderPartial {
+		return repository.ErrOrderStatus
+	}
+
+	received := 0
+	for _, rc := range receipts {
+		if rc.Quantity == 0 {
+			continue
+		}
+
+		if rc.Quantity < 0 || rc.UnitCost < 0 {
+			return repository.ErrInvalidReceipt
+		}
+
+		var serial string
+		err = tx.QueryRowContext(ctx, `
+			update purchase_order_lines set received = received + $1
+			where id = $2 and order_id = $3 and received + $1 <= quantity
+			returning serial`,
+			rc.Quantity, rc.LineId, id,
+		).Scan(&serial)
+		if errors.Is(err, sql.ErrNoRows) {
+			return repository.ErrInvalidReceipt
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = applyStockMovement(ctx, tx, models.StockMovement{
+			Serial:    serial,
+			Quantity:  rc.Quantity,
+			Reason:    models.StockReceived,
+			Reference: fmt.Sprintf("PO #%d", id),
+			BatchNo:   rc.BatchNo,
+			ExpiresAt: rc.ExpiresAt,
+			UnitCost:  rc.UnitCost,
+			UserId:    userId,
+		})
+		if err != nil {
+			return err
+		}
+		received++
+	}
+
+	if received == 0 {
+		return repository.ErrInvalidReceipt
+	}
+
+	var outstanding int
+	err = tx.QueryRowContext(ctx,
+		"select count(*) from purchase_order_lines where order_id = $1 and received < quantity", id,
+	).Scan(&outstanding)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	status = models.OrderPartial
+	receivedAt := sql.NullTime{}
+	if outstanding == 0 {
+		status = models.OrderReceived
+		receivedAt = sql.NullTime{Time: now, Valid: true}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"update purchase_orders set status = $1, received_at = $2, user_id = $3, updated_at = $4 where id = $5",
+		status, receivedAt, userId, now, id,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeletePurchaseOrder removes a draft purchase order
+func (m *postgresDBRepo) DeletePurchaseOrder(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, "delete from purchase_orders where id = $1 and status = $2", id, models.OrderDraft)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return repository.ErrOrderStatus
+	}
+
+	return nil
+}
+
+// FetchPurchaseOrder retrieves a purchase order with its lines
+func (m *postgresDBRepo) FetchPurchaseOrder(id int) (models.PurchaseOrder, error) {
+	orders, err := m.fetchPurchaseOrders("where o.id = $1", id)
+	if err != nil {
+		return models.PurchaseOrder{}, err
+	}
+
+	if len(orders) == 0 {
+		return models.PurchaseOrder{}, sql.ErrNoRows
+	}
+
+	return orders[0], nil
+}
+
+// FetchPurchaseOrders retrieves the purchase orders with status, or every order when status is
+// empty, newest first
+func (m *postgresDBRepo) FetchPurchaseOrders(status string) ([]models.PurchaseOrder, error) {
+	if status == "" {
+		return m.fetchPurchaseOrders("")
+	}
+	return m.fetchPurchaseOrders("where o.status = $1", status)
+}
+
+func (m *postgresDBRepo) fetchPurchaseOrders(where string, args ...any) ([]models.PurchaseOrder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var orders []models.PurchaseOrder
+
+	query := `
+		select o.id, o.supplier_id, s.name, o.status, o.notes, o.expected_at, o.ordered_at, o.received_at,
+			o.user_id, coalesce(u.user_name, ''), o.created_at, o.updated_at,
+			coalesce(l.id, 0), coalesce(l.serial, ''), coalesce(p.name, ''), coalesce(l.quantity, 0),
+			coalesce(l.received, 0), coalesce(l.unit_cost, 0)
+		from purchase_orders o
+		inner join suppliers s on s.id = o.supplier_id
+		left join users u on u.id = o.user_id
+		left join purchase_order_lines l on l.order_id = o.id
+		left join products p on p.serial = l.serial
+		` + where + `
+		order by o.created_at desc, o.id desc, l.id
+	`
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return orders, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o models.PurchaseOrder
+		var l models.PurchaseOrderLine
+		var expectedAt, orderedAt, receivedAt sql.NullTime
+		err := rows.Scan(
+			&o.ID,
+			&o.SupplierId,
+			&o.SupplierName,
+			&o.Status,
+			&o.Notes,
+			&expectedAt,
+			&orderedAt,
+			&receivedAt,
+			&o.UserId,
+			&o.Username,
+			&o.CreatedAt,
+			&o.UpdatedAt,
+			&l.ID,
+			&l.Serial,
+			&l.Name,
+			&l.Quantity,
+			&l.Received,
+			&l.UnitCost,
+		)
+		if err != nil {
+			return orders, err
+		}
+
+		if len(orders) == 0 || orders[len(orders)-1].ID != o.ID {
+			o.ExpectedAt = expectedAt.Time
+			o.OrderedAt = orderedAt.Time
+			o.ReceivedAt = receivedAt.Time
+			orders = append(orders, o)
+		}
+
+		if l.ID != 0 {
+			l.OrderId = o.ID
+			last := &orders[len(orders)-1]
+			last.Lines = append(last.Lines, l)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return orders, err
+	}
+
+	return orders, nil
+}
+
+// insertPurchaseOrderLines writes the lines of a purchase order
+func insertPurchaseOrderLines(ctx context.Context, tx conn, orderId int, lines []models.PurchaseOrderLine) error {
+	for _, l := range lines {
+		_, err := tx.ExecContext(ctx,
+			"insert into purchase_order_lines (order_id, serial, quantity, unit_cost) values ($1, $2, $3, $4)",
+			orderId, l.Serial, l.Quantity, l.UnitCost,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// nullTime stores a zero time as null
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,105 @@
+package dbrepo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+)
+
+// profitGroups holds how the sales are keyed, labelled and ordered for each gross profit report
+// grouping, the label is worked out from the key after the sales are summed
+var profitGroups = map[string]struct{ key, label, order string }{
+	models.ProfitByProduct: {
+		key:   "s.serial",
+		label: "coalesce((select p.name from products p where p.serial = g.key limit 1), g.key)",
+		order: "g.revenue - g.cost desc, g.key",
+	},
+	models.ProfitByDay: {
+		key:   "to_char(s.created_at, 'YYYY-MM-DD')",
+		label: "to_char(to_date(g.key, 'YYYY-MM-DD'), 'DD Mon YYYY')",
+		order: "g.key",
+	},
+	models.ProfitByMonth: {
+		key:   "to_char(s.created_at, 'YYYY-MM')",
+		label: "to_char(to_date(g.key, 'YYYY-MM'), 'Mon YYYY')",
+		order: "g.key",
+	},
+	models.ProfitBySalesperson: {
+		key:   "coalesce(s.user_id, 0)::text",
+		label: "coalesce((select u.user_name from users u where u.id = g.key::int), 'Unknown')",
+		order: "g.revenue - g.cost desc, g.key",
+	},
+}
+
+// FetchGrossProfit retrieves the revenue and cost of the cash and credit sales matching f,
+// grouped by product, day, month or salesperson
+func (m *postgresDBRepo) FetchGrossProfit(f models.ProfitFilter) ([]models.GrossProfit, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var lines []models.GrossProfit
+
+	group, ok := profitGroups[f.GroupBy]
+	if !ok {
+		return lines, fmt.Errorf("unknown gross profit grouping %q", f.GroupBy)
+	}
+
+	var where []string
+	var args []any
+	if !f.From.IsZero() {
+		args = append(args, f.From)
+		where = append(where, fmt.Sprintf("s.created_at >= $%d", len(args)))
+	}
+	if !f.To.IsZero() {
+		args = append(args, f.To)
+		where = append(where, fmt.Sprintf("s.created_at < $%d", len(args)))
+	}
+
+	filter := ""
+	if len(where) > 0 {
+		filter = "where " + strings.Join(where, " and ")
+	}
+
+	query := fmt.Sprintf(`
+		with s as (
+			select coalesce(serial, '') as serial, coalesce(quantity, 0) as quantity,
+				coalesce(amount, 0)::numeric as revenue, unit_cost * coalesce(quantity, 0) as cost, user_id, created_at
+			from purchases
+			union all
+			select coalesce(serial, ''), coalesce(quantity, 0),
+				coalesce(price * quantity, 0)::numeric, unit_cost * coalesce(quantity, 0), user_id, created_at
+			from purchased_oncredit
+		)
+		select g.key, %s, g.quantity, g.revenue, g.cost
+		from (
+			select %s as key, sum(s.quantity) as quantity, sum(s.revenue) as revenue, sum(s.cost) as cost
+			from s
+			%s
+			group by 1
+		) g
+		order by %s
+	`, group.label, group.key, filter, group.order)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return lines, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g models.GrossProfit
+		if err := rows.Scan(&g.Key, &g.Label, &g.Quantity, &g.Revenue, &g.Cost); err != nil {
+			return lines, err
+		}
+		lines = append(lines, g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return lines, err
+	}
+
+	return lines, nil
+}
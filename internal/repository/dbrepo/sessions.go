@@ -0,0 +1,184 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+)
+
+// InsertUserSession records who a web session belongs to
+func (m *postgresDBRepo) InsertUserSession(s models.UserSession) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var apiTokenId sql.NullInt64
+	if s.APITokenId != 0 {
+		apiTokenId = sql.NullInt64{Int64: int64(s.APITokenId), Valid: true}
+	}
+
+	query := `
+		insert into user_sessions (token, user_id, api_token_id, ip_address, user_agent, created_at, last_seen_at)
+		values ($1, $2, $3, $4, $5, $6, $6)
+		on conflict (token) do nothing
+	`
+	_, err := m.DB.ExecContext(ctx, query,
+		s.Token,
+		s.UserId,
+		apiTokenId,
+		s.IPAddress,
+		s.UserAgent,
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// TouchUserSession records that a web session was just used, it reports false when the
+// session has been revoked
+func (m *postgresDBRepo) TouchUserSession(token, ip string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update user_sessions set last_seen_at = $1, ip_address = $2
+		where token = $3
+	`
+	res, err := m.DB.ExecContext(ctx, query, time.Now(), ip, token)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// FetchUserSessions retrieves the live web sessions of a user, most recently used first
+func (m *postgresDBRepo) FetchUserSessions(userId int) ([]models.UserSession, error) {
+	return m.fetchUserSessions("where us.user_id = $2", time.Now(), userId)
+}
+
+// FetchAllUserSessions retrieves the live web sessions of every user, most recently used first
+func (m *postgresDBRepo) FetchAllUserSessions() ([]models.UserSession, error) {
+	return m.fetchUserSessions("", time.Now())
+}
+
+func (m *postgresDBRepo) fetchUserSessions(where string, args ...any) ([]models.UserSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var sessions []models.UserSession
+
+	query := `
+		select us.id, us.token, us.user_id, u.user_name, coalesce(us.api_token_id, 0),
+			us.ip_address, us.user_agent, us.created_at, us.last_seen_at
+		from user_sessions us
+		inner join users u on u.id = us.user_id
+		inner join sessions s on s.token = us.token and s.expiry > $1
+		` + where + `
+		order by us.last_seen_at desc
+	`
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return sessions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.UserSession
+		err := rows.Scan(
+			&s.ID,
+			&s.Token,
+			&s.UserId,
+			&s.Username,
+			&s.APITokenId,
+			&s.IPAddress,
+			&s.UserAgent,
+			&s.CreatedAt,
+			&s.LastSeenAt,
+		)
+		if err != nil {
+			return sessions, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return sessions, err
+	}
+
+	return sessions, nil
+}
+
+// RevokeUserSession ends one web session of a user and revokes its api token
+func (m *postgresDBRepo) RevokeUserSession(id, userId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = deleteUserSessions(ctx, tx, "id = $1 and user_id = $2", id, userId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeUserSessions ends every web session of a user apart from the one with keepToken
+func (m *postgresDBRepo) RevokeUserSessions(userId int, keepToken string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = deleteUserSessions(ctx, tx, "user_id = $1 and token <> $2", userId, keepToken)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// deleteUserSessions removes the sessions matching where together with their details,
+// and revokes the api tokens they were issued
+func deleteUserSessions(ctx context.Context, tx conn, where string, args ...any) error {
+	query := fmt.Sprintf(`
+		update api_tokens set revoked_at = $%d
+		where revoked_at is null and id in (select api_token_id from user_sessions where %s)
+	`, len(args)+1, where)
+	_, err := tx.ExecContext(ctx, query, append(args, time.Now())...)
+	if err != nil {
+		return err
+	}
+
+	statements := []string{
+		"delete from sessions where token in (select token from user_sessions where " + where + ")",
+		"delete from user_sessions where " + where,
+	}
+	for _, stmt := range statements {
+		_, err = tx.ExecContext(ctx, stmt, args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
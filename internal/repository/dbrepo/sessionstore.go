@@ -0,0 +1,102 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// SessionStore keeps the web sessions in the sessions table so they survive restarts and
+// can be revoked, it satisfies the scs.Store interface
+type SessionStore struct {
+	DB *sql.DB
+}
+
+// NewSessionStore returns a session store on db that removes expired sessions every
+// cleanupInterval until ctx is done
+func NewSessionStore(ctx context.Context, db *sql.DB, cleanupInterval time.Duration) *SessionStore {
+	s := &SessionStore{DB: db}
+	if cleanupInterval > 0 {
+		go s.cleanup(ctx, cleanupInterval)
+	}
+	return s
+}
+
+// Find returns the data of an unexpired session
+func (s *SessionStore) Find(token string) ([]byte, bool, error) {
+	var b []byte
+	err := s.DB.QueryRow("select data from sessions where token = $1 and expiry > $2", token, time.Now()).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return b, true, nil
+}
+
+// Commit saves the data of a session
+func (s *SessionStore) Commit(token string, b []byte, expiry time.Time) error {
+	query := `
+		insert into sessions (token, data, expiry) values ($1, $2, $3)
+		on conflict (token) do update set data = excluded.data, expiry = excluded.expiry
+	`
+	_, err := s.DB.Exec(query, token, b, expiry)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes a session and the details recorded about it
+func (s *SessionStore) Delete(token string) error {
+	_, err := s.DB.Exec("delete from sessions where token = $1", token)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.DB.Exec("delete from user_sessions where token = $1", token)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// cleanup removes expired sessions every interval until ctx is done
+func (s *SessionStore) cleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.deleteExpired(ctx); err != nil {
+			log.Println("session cleanup:", err)
+		}
+	}
+}
+
+// deleteExpired deletes expired sessions, and the details of sessions that no longer exist
+func (s *SessionStore) deleteExpired(ctx context.Context) error {
+	_, err := s.DB.ExecContext(ctx, "delete from sessions where expiry < $1", time.Now())
+	if err != nil {
+		return err
+	}
+
+	query := `
+		delete from user_sessions
+		where last_seen_at < $1 and token not in (select token from sessions)
+	`
+	_, err = s.DB.ExecContext(ctx, query, time.Now().Add(-time.Hour))
+	return err
+}
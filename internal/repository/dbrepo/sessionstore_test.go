@@ -0,0 +1,39 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestSessionStore_cleanup(t *testing.T) {
+	db, err := sql.Open("savepoints", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &SessionStore{DB: db}
+	done := make(chan struct{})
+	go func() {
+		s.cleanup(ctx, time.Millisecond)
+		close(done)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("cleanup did not stop when its context was done")
+	}
+
+	savepoints.mu.Lock()
+	defer savepoints.mu.Unlock()
+	if savepoints.deletes == 0 {
+		t.Error("cleanup never deleted expired sessions")
+	}
+}
@@ -0,0 +1,304 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// RecordStockMovement adds a movement to the stock ledger and applies it to the product's
+// units on hand
+func (m *postgresDBRepo) RecordStockMovement(mv models.StockMovement) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = applyStockMovement(ctx, tx, mv)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// FetchStockMovements retrieves the stock ledger of a product at a location, or at every
+// location when locationId is zero, with the running balance after each movement, oldest first
+func (m *postgresDBRepo) FetchStockMovements(serial string, locationId int) ([]models.StockMovement, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var movements []models.StockMovement
+
+	query := `
+		select s.id, s.serial, s.location_id, l.name, s.quantity, s.reason, s.reference, s.batch_no, s.unit_cost, s.user_id,
+			coalesce(u.user_name, ''), sum(s.quantity) over (order by s.created_at, s.id), s.created_at
+		from stock_movements s
+		join locations l on l.id = s.location_id
+		left join users u on u.id = s.user_id
+		where s.serial = $1 and ($2 = 0 or s.location_id = $2)
+		order by s.created_at, s.id
+	`
+	rows, err := m.DB.QueryContext(ctx, query, serial, locationId)
+	if err != nil {
+		return movements, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mv models.StockMovement
+		err := rows.Scan(
+			&mv.ID,
+			&mv.Serial,
+			&mv.LocationId,
+			&mv.LocationName,
+			&mv.Quantity,
+			&mv.Reason,
+			&mv.Reference,
+			&mv.BatchNo,
+			&mv.UnitCost,
+			&mv.UserId,
+			&mv.Username,
+			&mv.Balance,
+			&mv.CreatedAt,
+		)
+		if err != nil {
+			return movements, err
+		}
+		movements = append(movements, mv)
+	}
+
+	if err = rows.Err(); err != nil {
+		return movements, err
+	}
+
+	return movements, nil
+}
+
+// FetchStockDrift retrieves the products whose units on hand differ from the sum of their
+// stock ledger, in total or at a location
+func (m *postgresDBRepo) FetchStockDrift() ([]models.StockDrift, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var drift []models.StockDrift
+
+	query := `
+		with ledger as (
+			select serial, location_id, sum(quantity) as units
+			from stock_movements
+			group by serial, location_id
+		), located as (
+			select coalesce(ps.serial, g.serial) as serial, coalesce(ps.location_id, g.location_id) as location_id,
+				coalesce(ps.units, 0) as units, coalesce(g.units, 0) as ledger
+			from product_stock ps
+			full join ledger g on g.serial = ps.serial and g.location_id = ps.location_id
+		)
+		select p.serial, coalesce(p.name, ''), '', coalesce(p.units, 0), coalesce(sum(g.units), 0)
+		from products p
+		left join ledger g on g.serial = p.serial
+		where p.serial is not null
+		group by p.serial, p.name, p.units
+		having coalesce(p.units, 0) <> coalesce(sum(g.units), 0)
+		union all
+		select d.serial, coalesce(p.name, ''), l.name, d.units, d.ledger
+		from located d
+		join products p on p.serial = d.serial
+		join locations l on l.id = d.location_id
+		where d.units <> d.ledger
+		order by 1, 3
+	`
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return drift, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.StockDrift
+		if err := rows.Scan(&d.Serial, &d.Name, &d.Location, &d.Units, &d.Ledger); err != nil {
+			return drift, err
+		}
+		drift = append(drift, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return drift, err
+	}
+
+	return drift, nil
+}
+
+// applyStockMovement changes the product's units on hand, in total and at the movement's
+// location, and records the movement. The units are only taken out when enough are in stock at
+// the location so concurrent sales cannot oversell, and archived products cannot be sold. Units
+// brought in at a cost move the product's cost price to the weighted average of the stock on
+// hand, and units taken out are recorded at the cost they were carried at. Units taken out come
+// from the product's batches at the location that expire first, expired batches are not sold.
+func applyStockMovement(ctx context.Context, tx conn, mv models.StockMovement) error {
+	var err error
+	mv.LocationId, err = stockLocation(ctx, tx, mv.LocationId, mv.UserId)
+	if err != nil {
+		return err
+	}
+
+	if mv.IsSale() {
+		var archived bool
+		err = tx.QueryRowContext(ctx,
+			"select archived_at is not null from products where serial = $1", mv.Serial,
+		).Scan(&archived)
+		if err != nil {
+			return err
+		}
+		if archived {
+			return repository.ErrProductArchived
+		}
+	}
+
+	var cost float64
+	err = tx.QueryRowContext(ctx, `
+		update products set units = units + $1,
+			cost_price = case when $1 > 0 and $5::numeric > 0
+				then round((greatest(units, 0) * cost_price + $1 * $5::numeric) / (greatest(units, 0) + $1), 2)
+				else cost_price end,
+			user_id = $2, updated_at = $3
+		where serial = $4 and units + $1 >= 0
+		returning cost_price`,
+		mv.Quantity, mv.UserId, time.Now(), mv.Serial, mv.UnitCost,
+	).Scan(&cost)
+
+	// No row is updated for a product that does not exist as well as for one short of units, a
+	// missing product is reported as sql.ErrNoRows
+	if errors.Is(err, sql.ErrNoRows) {
+		var exists bool
+		err = tx.QueryRowContext(ctx, "select exists (select 1 from products where serial = $1)", mv.Serial).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return sql.ErrNoRows
+		}
+		return repository.ErrInsufficientStock
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if mv.Quantity < 0 {
+		mv.UnitCost = cost
+	}
+
+	err = moveLocationStock(ctx, tx, mv.Serial, mv.LocationId, mv.Quantity)
+	if err != nil {
+		return err
+	}
+
+	err = moveBatchStock(ctx, tx, mv)
+	if err != nil {
+		return err
+	}
+
+	return insertStockMovement(ctx, tx, mv)
+}
+
+// stockLocation returns locationId, or when it is zero the location the user is assigned to, or
+// the default location when they have none
+func stockLocation(ctx context.Context, tx conn, locationId, userId int) (int, error) {
+	if locationId != 0 {
+		return locationId, nil
+	}
+
+	err := tx.QueryRowContext(ctx,
+		"select coalesce((select location_id from users where id = $1), id) from locations where is_default", userId,
+	).Scan(&locationId)
+	if err != nil {
+		return 0, err
+	}
+
+	return locationId, nil
+}
+
+// moveLocationStock changes the units of a product at a location, units are only taken out when
+// enough are there
+func moveLocationStock(ctx context.Context, tx conn, serial string, locationId, quantity int) error {
+	if quantity >= 0 {
+		_, err := tx.ExecContext(ctx, `
+			insert into product_stock (serial, location_id, units) values ($1, $2, $3)
+			on conflict (serial, location_id) do update set units = product_stock.units + excluded.units`,
+			serial, locationId, quantity,
+		)
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx,
+		"update product_stock set units = units + $1 where serial = $2 and location_id = $3 and units + $1 >= 0",
+		quantity, serial, locationId,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return repository.ErrInsufficientStock
+	}
+
+	return nil
+}
+
+// insertLocatedMovement records a change made directly to a product's units at the movement's
+// location and its batches, a zero LocationId being the location of the user making it
+func insertLocatedMovement(ctx context.Context, tx conn, mv models.StockMovement) error {
+	var err error
+	mv.LocationId, err = stockLocation(ctx, tx, mv.LocationId, mv.UserId)
+	if err != nil {
+		return err
+	}
+
+	err = moveLocationStock(ctx, tx, mv.Serial, mv.LocationId, mv.Quantity)
+	if err != nil {
+		return err
+	}
+
+	err = moveBatchStock(ctx, tx, mv)
+	if err != nil {
+		return err
+	}
+
+	return insertStockMovement(ctx, tx, mv)
+}
+
+// insertStockMovement writes a movement to the stock ledger
+func insertStockMovement(ctx context.Context, tx conn, mv models.StockMovement) error {
+	_, err := tx.ExecContext(ctx, `
+		insert into stock_movements (serial, location_id, quantity, reason, reference, batch_no, unit_cost, user_id, created_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		mv.Serial,
+		mv.LocationId,
+		mv.Quantity,
+		mv.Reason,
+		mv.Reference,
+		mv.BatchNo,
+		mv.UnitCost,
+		mv.UserId,
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
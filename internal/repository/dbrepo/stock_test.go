@@ -0,0 +1,122 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// product is a row of the products table of productsDriver
+type product struct {
+	units    int64
+	archived bool
+}
+
+// productsDriver is a database that only answers the queries applyStockMovement makes of the
+// products table before the stock is moved
+type productsDriver struct {
+	products map[string]product
+}
+
+type productsConn struct {
+	db *productsDriver
+}
+
+// productRows returns the values it holds as a single column
+type productRows struct {
+	values []driver.Value
+}
+
+func (d *productsDriver) Open(name string) (driver.Conn, error) {
+	return &productsConn{db: d}, nil
+}
+
+func (c *productsConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare is not supported")
+}
+
+func (c *productsConn) Close() error { return nil }
+
+func (c *productsConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+func (c *productsConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	query = strings.Join(strings.Fields(query), " ")
+	serial := args[0].Value
+	if strings.HasPrefix(query, "update products") {
+		serial = args[3].Value
+	}
+	p, found := c.db.products[serial.(string)]
+
+	switch {
+	case strings.HasPrefix(query, "select archived_at is not null from products"):
+		if !found {
+			return &productRows{}, nil
+		}
+		return &productRows{[]driver.Value{p.archived}}, nil
+	case strings.HasPrefix(query, "update products set units"):
+		if !found || p.units+args[0].Value.(int64) < 0 {
+			return &productRows{}, nil
+		}
+		return &productRows{[]driver.Value{10.0}}, nil
+	case strings.HasPrefix(query, "select exists (select 1 from products"):
+		return &productRows{[]driver.Value{found}}, nil
+	}
+	return nil, errors.New("unknown query " + query)
+}
+
+func (r *productRows) Columns() []string { return []string{"value"} }
+
+func (r *productRows) Close() error { return nil }
+
+func (r *productRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+func init() {
+	sql.Register("products", &productsDriver{products: map[string]product{
+		"A":   {units: 3},
+		"OLD": {units: 5, archived: true},
+	}})
+}
+
+func TestApplyStockMovement_Refused(t *testing.T) {
+	db, err := sql.Open("products", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name     string
+		mv       models.StockMovement
+		expected error
+	}{
+		{"sale of a missing product", models.StockMovement{Serial: "X", Quantity: -1, Reason: models.StockCashSale}, sql.ErrNoRows},
+		{"adjustment of a missing product", models.StockMovement{Serial: "X", Quantity: -1, Reason: models.StockAdjustment}, sql.ErrNoRows},
+		{"restock of a missing product", models.StockMovement{Serial: "X", Quantity: 4, Reason: models.StockRestock}, sql.ErrNoRows},
+		{"sale of more than is in stock", models.StockMovement{Serial: "A", Quantity: -4, Reason: models.StockCreditSale}, repository.ErrInsufficientStock},
+		{"write-off of more than is in stock", models.StockMovement{Serial: "A", Quantity: -4, Reason: models.StockAdjustment}, repository.ErrInsufficientStock},
+		{"sale of an archived product", models.StockMovement{Serial: "OLD", Quantity: -1, Reason: models.StockCashSale}, repository.ErrProductArchived},
+	}
+
+	for _, tt := range tests {
+		tt.mv.LocationId = 1
+		err := applyStockMovement(context.Background(), db, tt.mv)
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%s: got %v, expected %v", tt.name, err, tt.expected)
+		}
+	}
+}
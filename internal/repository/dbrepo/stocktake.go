@@ -0,0 +1,413 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// InsertStockTake starts a stock take at a location, freezing a snapshot of the units on hand
+// there and cost of every product, or of those in its category and the subcategories under it,
+// and returns its id. A zero LocationId is the location of the user starting it.
+func (m *postgresDBRepo) InsertStockTake(st models.StockTake) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Wait for stock movements being written to commit so the snapshot and the last movement
+	// it covers agree
+	_, err = tx.ExecContext(ctx, "lock table stock_movements in exclusive mode")
+	if err != nil {
+		return 0, err
+	}
+
+	st.LocationId, err = stockLocation(ctx, tx, st.LocationId, st.UserId)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	query := `
+		insert into stock_takes (name, location_id, category_id, status, notes, movement_id, user_id, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, (select coalesce(max(id), 0) from stock_movements), $6, $7, $7)
+		returning id
+	`
+	err = tx.QueryRowContext(ctx, query,
+		st.Name,
+		st.LocationId,
+		nullID(st.CategoryId),
+		models.StockTakeCounting,
+		st.Notes,
+		st.UserId,
+		time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		with recursive sub as (
+			select id from categories where id = $2
+			union all
+			select c.id from categories c join sub s on c.parent_id = s.id
+		)
+		insert into stock_take_lines (stock_take_id, serial, snapshot, unit_cost)
+		select $1, p.serial, coalesce(ps.units, 0), p.cost_price
+		from products p
+		left join product_stock ps on ps.serial = p.serial and ps.location_id = $3
+		where p.serial is not null and ($2 = 0 or p.category_id in (select id from sub))`,
+		id, st.CategoryId, st.LocationId,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// RecordStockCounts saves the units counted on the shelf against lines of a stock take that is
+// still being counted, a line counted again to a different figure keeps the latest count. The
+// stock sold or received since the snapshot is noted with each count so it is compared with
+// what should have been on the shelf when it was counted.
+func (m *postgresDBRepo) RecordStockCounts(id, userId int, counts []models.StockCount) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	movementId, locationId, err := lockStockTake(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, c := range counts {
+		if c.Counted < 0 {
+			return repository.ErrInvalidCount
+		}
+
+		res, err := tx.ExecContext(ctx, `
+			update stock_take_lines l set counted = $1, counted_by = $2, counted_at = $3,
+				moved = coalesce((
+					select sum(quantity) from stock_movements where serial = l.serial and location_id = $5 and id > $4
+				), 0)
+			where l.id = $6 and l.stock_take_id = $7 and l.counted is distinct from $1`,
+			c.Counted, userId, now, movementId, locationId, c.LineId, id,
+		)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			var exists bool
+			err = tx.QueryRowContext(ctx,
+				"select exists (select 1 from stock_take_lines where id = $1 and stock_take_id = $2)", c.LineId, id,
+			).Scan(&exists)
+			if err != nil {
+				return err
+			}
+
+			if !exists {
+				return repository.ErrInvalidCount
+			}
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "update stock_takes set updated_at = $1 where id = $2", now, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ApproveStockTake closes a stock take, posting a stock take correction by userId for the
+// variance of each counted line in lineIds. Lines left out are closed without a correction.
+func (m *postgresDBRepo) ApproveStockTake(id, userId int, lineIds []int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, locationId, err := lockStockTake(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, lineId := range lineIds {
+		var serial string
+		var counted sql.NullInt64
+		var expected int
+		var unitCost float64
+		err = tx.QueryRowContext(ctx, `
+			update stock_take_lines set posted = true
+			where id = $1 and stock_take_id = $2 and not posted
+			returning serial, counted, snapshot + moved, unit_cost`,
+			lineId, id,
+		).Scan(&serial, &counted, &expected, &unitCost)
+		if errors.Is(err, sql.ErrNoRows) {
+			return repository.ErrInvalidCount
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !counted.Valid {
+			return repository.ErrInvalidCount
+		}
+
+		variance := int(counted.Int64) - expected
+		if variance == 0 {
+			continue
+		}
+
+		err = applyStockMovement(ctx, tx, models.StockMovement{
+			Serial:     serial,
+			LocationId: locationId,
+			Quantity:   variance,
+			Reason:     models.StockTakeCorrection,
+			Reference:  fmt.Sprintf("Stock take #%d", id),
+			UnitCost:   unitCost,
+			UserId:     userId,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	_, err = tx.ExecContext(ctx,
+		"update stock_takes set status = $1, approved_by = $2, approved_at = $3, updated_at = $3 where id = $4",
+		models.StockTakeApproved, userId, now, id,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CancelStockTake closes a stock take that is still being counted without changing any stock
+func (m *postgresDBRepo) CancelStockTake(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx,
+		"update stock_takes set status = $1, updated_at = $2 where id = $3 and status = $4",
+		models.StockTakeCancelled, time.Now(), id, models.StockTakeCounting,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return repository.ErrStockTakeStatus
+	}
+
+	return nil
+}
+
+// FetchStockTake retrieves a stock take with its lines by product name
+func (m *postgresDBRepo) FetchStockTake(id int) (models.StockTake, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var st models.StockTake
+
+	query := `
+		with recursive ` + categoryTree + `
+		select t.id, t.name, t.location_id, lc.name, coalesce(t.category_id, 0), coalesce(ct.path, ''), t.status, t.notes,
+			t.user_id, coalesce(u.user_name, ''), coalesce(t.approved_by, 0), coalesce(a.user_name, ''),
+			t.approved_at, t.created_at, t.updated_at,
+			coalesce(l.id, 0), coalesce(l.serial, ''), coalesce(p.name, ''), coalesce(l.snapshot, 0),
+			coalesce(l.unit_cost, 0), coalesce(l.counted, 0), coalesce(l.moved, 0), coalesce(l.counted_by, 0),
+			coalesce(c.user_name, ''), l.counted_at, coalesce(l.posted, false)
+		from stock_takes t
+		join locations lc on lc.id = t.location_id
+		left join category_tree ct on ct.id = t.category_id
+		left join users u on u.id = t.user_id
+		left join users a on a.id = t.approved_by
+		left join stock_take_lines l on l.stock_take_id = t.id
+		left join products p on p.serial = l.serial
+		left join users c on c.id = l.counted_by
+		where t.id = $1
+		order by lower(p.name), l.serial
+	`
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return st, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l models.StockTakeLine
+		var approvedAt, countedAt sql.NullTime
+		err := rows.Scan(
+			&st.ID,
+			&st.Name,
+			&st.LocationId,
+			&st.LocationName,
+			&st.CategoryId,
+			&st.CategoryPath,
+			&st.Status,
+			&st.Notes,
+			&st.UserId,
+			&st.Username,
+			&st.ApprovedBy,
+			&st.ApproverName,
+			&approvedAt,
+			&st.CreatedAt,
+			&st.UpdatedAt,
+			&l.ID,
+			&l.Serial,
+			&l.Name,
+			&l.Snapshot,
+			&l.UnitCost,
+			&l.Counted,
+			&l.Moved,
+			&l.CountedBy,
+			&l.CounterName,
+			&countedAt,
+			&l.Posted,
+		)
+		if err != nil {
+			return st, err
+		}
+		st.ApprovedAt = approvedAt.Time
+
+		if l.ID != 0 {
+			l.StockTakeId = st.ID
+			l.CountedAt = countedAt.Time
+			st.Lines = append(st.Lines, l)
+			st.Products++
+			if l.IsCounted() {
+				st.Counted++
+			}
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return st, err
+	}
+
+	if st.ID == 0 {
+		return st, sql.ErrNoRows
+	}
+
+	return st, nil
+}
+
+// FetchStockTakes retrieves every stock take without its lines, newest first
+func (m *postgresDBRepo) FetchStockTakes() ([]models.StockTake, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var takes []models.StockTake
+
+	query := `
+		with recursive ` + categoryTree + `
+		select t.id, t.name, t.location_id, lc.name, coalesce(t.category_id, 0), coalesce(ct.path, ''), t.status, t.notes,
+			t.user_id, coalesce(u.user_name, ''), coalesce(t.approved_by, 0), coalesce(a.user_name, ''),
+			t.approved_at, t.created_at, t.updated_at,
+			(select count(*) from stock_take_lines where stock_take_id = t.id),
+			(select count(*) from stock_take_lines where stock_take_id = t.id and counted_at is not null)
+		from stock_takes t
+		join locations lc on lc.id = t.location_id
+		left join category_tree ct on ct.id = t.category_id
+		left join users u on u.id = t.user_id
+		left join users a on a.id = t.approved_by
+		order by t.created_at desc, t.id desc
+	`
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return takes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var st models.StockTake
+		var approvedAt sql.NullTime
+		err := rows.Scan(
+			&st.ID,
+			&st.Name,
+			&st.LocationId,
+			&st.LocationName,
+			&st.CategoryId,
+			&st.CategoryPath,
+			&st.Status,
+			&st.Notes,
+			&st.UserId,
+			&st.Username,
+			&st.ApprovedBy,
+			&st.ApproverName,
+			&approvedAt,
+			&st.CreatedAt,
+			&st.UpdatedAt,
+			&st.Products,
+			&st.Counted,
+		)
+		if err != nil {
+			return takes, err
+		}
+		st.ApprovedAt = approvedAt.Time
+		takes = append(takes, st)
+	}
+
+	if err = rows.Err(); err != nil {
+		return takes, err
+	}
+
+	return takes, nil
+}
+
+// lockStockTake locks a stock take that is still being counted and returns the last stock
+// movement its snapshot covers and the location it counts
+func lockStockTake(ctx context.Context, tx conn, id int) (int, int, error) {
+	var status string
+	var movementId, locationId int
+	err := tx.QueryRowContext(ctx,
+		"select status, movement_id, location_id from stock_takes where id = $1 for update", id,
+	).Scan(&status, &movementId, &locationId)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if status != models.StockTakeCounting {
+		return 0, 0, repository.ErrStockTakeStatus
+	}
+
+	return movementId, locationId, nil
+}
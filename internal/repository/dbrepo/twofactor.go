@@ -0,0 +1,250 @@
+package dbrepo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/repository"
+)
+
+// FetchTOTPSecret retrieves the TOTP secret of a user, enabled or still being enrolled
+func (m *postgresDBRepo) FetchTOTPSecret(userId int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var secret string
+	err := m.DB.QueryRowContext(ctx, "select totp_secret from users where id = $1", userId).Scan(&secret)
+	if err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// SetTOTPSecret stores the secret a user is enrolling with, sealed by the caller, it is not used
+// until EnableTOTP
+func (m *postgresDBRepo) SetTOTPSecret(userId int, secret string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update users set totp_secret = $1, updated_at = $2
+		where id = $3 and not totp_enabled
+	`
+	res, err := m.DB.ExecContext(ctx, query, secret, time.Now(), userId)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return errors.New("two-factor authentication is already enabled")
+	}
+
+	return nil
+}
+
+// EnableTOTP turns on two-factor authentication for a user and replaces their recovery codes,
+// it returns repository.ErrNoTOTPSecret when the user has no secret set up
+func (m *postgresDBRepo) EnableTOTP(userId int, codeHashes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		"update users set totp_enabled = true, updated_at = $1 where id = $2 and totp_secret <> ''",
+		time.Now(), userId,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return repository.ErrNoTOTPSecret
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from recovery_codes where user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		_, err = tx.ExecContext(ctx,
+			"insert into recovery_codes (user_id, code_hash, created_at) values ($1, $2, $3)",
+			userId, hash, time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP turns off two-factor authentication for a user and drops their recovery codes
+func (m *postgresDBRepo) DisableTOTP(userId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"update users set totp_enabled = false, totp_secret = '', updated_at = $1 where id = $2",
+		time.Now(), userId,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from recovery_codes where user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep keeps the time step of an authenticator code a user signed in with, the code is
+// refused with repository.ErrInvalidToken when a code for that step or a later one was used
+func (m *postgresDBRepo) UseTOTPStep(userId int, step uint64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx,
+		"update users set totp_last_step = $1 where id = $2 and totp_last_step < $1",
+		int64(step), userId,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return repository.ErrInvalidToken
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code of a user as used
+func (m *postgresDBRepo) UseRecoveryCode(userId int, codeHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update recovery_codes set used_at = $1
+		where user_id = $2 and code_hash = $3 and used_at is null
+	`
+	res, err := m.DB.ExecContext(ctx, query, time.Now(), userId, codeHash)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return repository.ErrInvalidToken
+	}
+
+	return nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes a user has left
+func (m *postgresDBRepo) CountRecoveryCodes(userId int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var n int
+	err := m.DB.QueryRowContext(ctx,
+		"select count(*) from recovery_codes where user_id = $1 and used_at is null",
+		userId,
+	).Scan(&n)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// FetchTwoFactorLevels retrieves the access levels that must use two-factor authentication
+func (m *postgresDBRepo) FetchTwoFactorLevels() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var levels []string
+
+	rows, err := m.DB.QueryContext(ctx, "select access_level from two_factor_requirements order by access_level")
+	if err != nil {
+		return levels, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var level string
+		if err = rows.Scan(&level); err != nil {
+			return levels, err
+		}
+		levels = append(levels, level)
+	}
+
+	if err = rows.Err(); err != nil {
+		return levels, err
+	}
+
+	return levels, nil
+}
+
+// UpdateTwoFactorLevels replaces the access levels that must use two-factor authentication
+func (m *postgresDBRepo) UpdateTwoFactorLevels(levels []string, userId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "delete from two_factor_requirements")
+	if err != nil {
+		return err
+	}
+
+	for _, level := range levels {
+		_, err = tx.ExecContext(ctx,
+			"insert into two_factor_requirements (access_level, created_by, created_at) values ($1, $2, $3)",
+			level, userId, time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
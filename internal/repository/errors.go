@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidToken is returned when a token is unknown, used, revoked or expired
+var ErrInvalidToken = errors.New("token is invalid or has expired")
+
+// ErrInsufficientStock is returned when a stock movement would take a product's units below zero
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// ErrStockExpired is returned when a sale needs units that are only left in expired batches, it
+// is also an ErrInsufficientStock
+var ErrStockExpired = fmt.Errorf("%w, the rest has expired", ErrInsufficientStock)
+
+// ErrOrderStatus is returned when a purchase order is changed in a way its status does not allow
+var ErrOrderStatus = errors.New("purchase order cannot be changed in its current status")
+
+// ErrInvalidReceipt is returned when goods received do not match what is outstanding on a purchase order
+var ErrInvalidReceipt = errors.New("received quantity is more than is outstanding")
+
+// ErrCategoryCycle is returned when a category would be moved under itself or one of its subcategories
+var ErrCategoryCycle = errors.New("category cannot be moved under itself")
+
+// ErrDuplicate is returned when a record with the same name already exists
+var ErrDuplicate = errors.New("a record with this name already exists")
+
+// ErrStockTakeStatus is returned when a stock take is counted, approved or cancelled after it was closed
+var ErrStockTakeStatus = errors.New("stock take is no longer being counted")
+
+// ErrInvalidCount is returned when a count is negative or for a line not on the stock take
+var ErrInvalidCount = errors.New("count is not valid for this stock take")
+
+// ErrTransferStatus is returned when a stock transfer is changed after it was transferred
+var ErrTransferStatus = errors.New("stock transfer cannot be changed in its current status")
+
+// ErrProductInUse is returned when a product named by sales, orders or stock records is deleted
+var ErrProductInUse = errors.New("product is referenced by sales or stock records")
+
+// ErrProductArchived is returned when an archived product is sold
+var ErrProductArchived = errors.New("product is archived and cannot be sold")
+
+// ErrImageLimit is returned when a product already has as many images as it can have
+var ErrImageLimit = errors.New("product has too many images")
+
+// ErrPriceApplied is returned when a scheduled price change is cancelled after it took effect
+var ErrPriceApplied = errors.New("price change has already taken effect")
+
+// ErrNoTOTPSecret is returned when two-factor authentication is enabled before a secret was set up
+var ErrNoTOTPSecret = errors.New("two-factor authentication has not been set up")
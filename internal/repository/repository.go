@@ -1,8 +1,15 @@
 package repository
 
-import "github.com/jofosuware/small-business-management-app/internal/models"
+import (
+	"context"
+	"time"
+
+	"github.com/jofosuware/small-business-management-app/internal/models"
+)
 
 type DatabaseRepo interface {
+	WithTx(ctx context.Context, fn func(repo DatabaseRepo) error) error
+
 	AllUsers() bool
 
 	InsertUser(u models.User) (int, error)
@@ -11,14 +18,113 @@ type DatabaseRepo interface {
 	FetchUserById(userId int) (string, error)
 	FetchAllUsers() ([]models.User, error)
 	ResetUser(user models.User) error
+	FetchPasswordHistory(userId, n int) ([]string, error)
+	UpdateUser(u models.User) error
+	DeactivateUser(userId int) error
+	ReactivateUser(userId int) error
+	DeleteUser(userId int) error
+	InsertActivationToken(t models.ActivationToken) error
+	FetchActivationToken(tokenHash string) (models.ActivationToken, error)
+	FetchPendingActivations() ([]models.ActivationToken, error)
+	ActivateUser(tokenHash, password string) error
+	RevokeActivationTokens(userId int) error
+	InsertLoginAttempt(a models.LoginAttempt) error
+	FetchLoginFailures(username, ip string, since time.Time) (models.LoginFailures, error)
+	InsertLockout(l models.Lockout) error
+	FetchActiveLockout(username, ip string) (models.Lockout, error)
+	FetchLockouts() ([]models.Lockout, error)
+	UnlockAccount(id, unlockedBy int) error
+	FetchTOTPSecret(userId int) (string, error)
+	SetTOTPSecret(userId int, secret string) error
+	EnableTOTP(userId int, codeHashes []string) error
+	DisableTOTP(userId int) error
+	UseTOTPStep(userId int, step uint64) error
+	UseRecoveryCode(userId int, codeHash string) error
+	CountRecoveryCodes(userId int) (int, error)
+	FetchTwoFactorLevels() ([]string, error)
+	UpdateTwoFactorLevels(levels []string, userId int) error
+	InsertAPIToken(t models.APIToken) (int, error)
+	FetchAPIToken(tokenHash string) (models.APIToken, error)
+	FetchUserAPITokens(userId int) ([]models.APIToken, error)
+	TouchAPIToken(id int) error
+	RevokeAPIToken(id, userId int) error
+	InsertUserSession(s models.UserSession) error
+	TouchUserSession(token, ip string) (bool, error)
+	FetchUserSessions(userId int) ([]models.UserSession, error)
+	FetchAllUserSessions() ([]models.UserSession, error)
+	RevokeUserSession(id, userId int) error
+	RevokeUserSessions(userId int, keepToken string) error
+	InsertAuditEntry(e models.AuditEntry) error
+	FetchAuditEntries(f models.AuditFilter) ([]models.AuditEntry, error)
 	InsertProduct(p models.Product) (models.Product, error)
 	UpdateProduct(models.Product) error
-	DecreaseQuantity(models.Product) error
-	IncreaseQuantity(models.Product) error
+	RecordStockMovement(mv models.StockMovement) error
+	FetchStockMovements(serial string, locationId int) ([]models.StockMovement, error)
+	FetchStockDrift() ([]models.StockDrift, error)
+	FetchLowStock(locationId int) ([]models.Product, error)
+	RaiseStockAlerts() ([]models.StockAlert, error)
+	FetchStockAlerts(limit int) ([]models.StockAlert, error)
+	InsertSupplier(s models.Supplier) (int, error)
+	UpdateSupplier(s models.Supplier) error
+	FetchSupplier(id int) (models.Supplier, error)
+	FetchSuppliers() ([]models.Supplier, error)
+	InsertPurchaseOrder(po models.PurchaseOrder) (int, error)
+	UpdatePurchaseOrder(po models.PurchaseOrder) error
+	PlacePurchaseOrder(id, userId int) error
+	ReceivePurchaseOrder(id, userId int, receipts []models.PurchaseOrderReceipt) error
+	DeletePurchaseOrder(id int) error
+	FetchPurchaseOrder(id int) (models.PurchaseOrder, error)
+	FetchPurchaseOrders(status string) ([]models.PurchaseOrder, error)
+	InsertStockTake(st models.StockTake) (int, error)
+	RecordStockCounts(id, userId int, counts []models.StockCount) error
+	ApproveStockTake(id, userId int, lineIds []int) error
+	CancelStockTake(id int) error
+	FetchStockTake(id int) (models.StockTake, error)
+	FetchStockTakes() ([]models.StockTake, error)
+	InsertLocation(l models.Location) (int, error)
+	UpdateLocation(l models.Location) error
+	FetchLocation(id int) (models.Location, error)
+	FetchLocations() ([]models.Location, error)
+	FetchProductStock(serial string) ([]models.LocationStock, error)
+	FetchStockLevels() ([]models.StockLevel, error)
+	FetchProductBatches(serial string) ([]models.StockBatch, error)
+	FetchExpiringBatches(days, locationId int) ([]models.StockBatch, error)
+	InsertStockTransfer(t models.StockTransfer) (int, error)
+	UpdateStockTransfer(t models.StockTransfer) error
+	CompleteStockTransfer(id, userId int) error
+	DeleteStockTransfer(id int) error
+	FetchStockTransfer(id int) (models.StockTransfer, error)
+	FetchStockTransfers(status string) ([]models.StockTransfer, error)
 	FetchProduct(serial string) (models.Product, error)
 	FetchAllProduct() ([]models.Product, error)
 	FetchProductByPage(page int) ([]models.Product, error)
+	FetchProducts(f models.ProductFilter) ([]models.Product, error)
+	FetchProductFacets(f models.ProductFilter) (models.ProductFacets, error)
+	InsertCategory(c models.Category) (int, error)
+	UpdateCategory(c models.Category) error
+	DeleteCategory(id int) error
+	FetchCategory(id int) (models.Category, error)
+	FetchCategories() ([]models.Category, error)
+	InsertBrand(b models.Brand) (int, error)
+	UpdateBrand(b models.Brand) error
+	DeleteBrand(id int) error
+	FetchBrand(id int) (models.Brand, error)
+	FetchBrands() ([]models.Brand, error)
 	DeleteProduct(serial string) error
+	ArchiveProduct(serial string, userId int) error
+	RestoreProduct(serial string, userId int) error
+	SchedulePriceChange(c models.PriceChange) (int, error)
+	CancelPriceChange(id int) error
+	ApplyScheduledPrices() ([]models.PriceChange, error)
+	FetchPriceChange(id int) (models.PriceChange, error)
+	InsertProductImage(img models.ProductImage, image, thumbnail []byte) (int, error)
+	SetPrimaryProductImage(id int) error
+	DeleteProductImage(id int) error
+	FetchProductImage(id int) (models.ProductImage, error)
+	FetchProductImages(serial string) ([]models.ProductImage, error)
+	FetchProductImageData(id int, thumbnail bool) ([]byte, error)
+	FetchPriceHistory(serial string) ([]models.PriceChange, error)
+	FetchScheduledPrices() ([]models.PriceChange, error)
 	FetchCustomer(customerId string) (models.Customer, error)
 	FetchAllCustomers() ([]models.Customer, error)
 	FetchCustomersByPage(page int) ([]models.Customer, error)
@@ -30,7 +136,7 @@ type DatabaseRepo interface {
 	InsertWitnessData(w models.Witness) (models.Witness, error)
 	UpdateWitness(w models.Witness) error
 	InsertItem(itm models.Item) error
-	UpdateItem(itm models.Item) error
+	UpdateItem(serial string, itm models.Item) error
 	UpdateBalance(itm models.Item) error
 	CustomerDebt(customerId string) ([]models.Item, error)
 	InsertPayment(p models.Payments) error
@@ -39,9 +145,9 @@ type DatabaseRepo interface {
 	CustomerPayment(customerId string) ([]models.Payments, error)
 	InsertPurchase(models.Purchases) (int, error)
 	FetchAllPurchase() ([]models.Purchases, error)
+	FetchGrossProfit(f models.ProfitFilter) ([]models.GrossProfit, error)
 	FetchPurchaseByPage(page int) ([]models.Purchases, error)
 	DeletePurchase(int) error
 	ListTables() ([]string, error)
 	DropTables(tables []string) error
-	DeleteUsers() error
 }
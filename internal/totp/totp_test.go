@@ -0,0 +1,123 @@
+package totp
+
+import (
+	"bytes"
+	"encoding/base32"
+	"errors"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B test vectors for SHA1
+var rfcTests = []struct {
+	unix int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+func TestHOTP_RFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	for _, tt := range rfcTests {
+		got := hotp(key, counter(time.Unix(tt.unix, 0)), 8)
+		if got != tt.code {
+			t.Errorf("at %d got %s, expected %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+
+	code, err := Code(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code != "050471" {
+		t.Errorf("got code %s, expected 050471", code)
+	}
+
+	if !Validate(code, secret, now) {
+		t.Error("current code was rejected")
+	}
+
+	if !Validate(code, secret, now.Add(Period)) {
+		t.Error("code from the previous period was rejected")
+	}
+
+	if Validate(code, secret, now.Add(3*Period)) {
+		t.Error("code from three periods ago was accepted")
+	}
+
+	if Validate("12345", secret, now) {
+		t.Error("short code was accepted")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Code(secret, time.Now()); err != nil {
+		t.Errorf("generated secret cannot be used: %s", err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+
+	code, _ := Code(secret, now)
+	if step, ok := Match(code, secret, now); !ok || step != counter(now) {
+		t.Errorf("current code matched step %d, ok %v, expected %d", step, ok, counter(now))
+	}
+
+	// The step is that of the code, not of the time it is checked at
+	if step, ok := Match(code, secret, now.Add(Period)); !ok || step != counter(now) {
+		t.Errorf("code of the previous period matched step %d, ok %v, expected %d", step, ok, counter(now))
+	}
+
+	if _, ok := Match("000000", secret, now); ok && code != "000000" {
+		t.Error("wrong code was matched")
+	}
+}
+
+func TestSealAndOpen(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, KeySize)
+
+	stored, err := Seal("JBSWY3DPEHPK3PXP", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains([]byte(stored), []byte("JBSWY3DPEHPK3PXP")) {
+		t.Error("sealed secret holds the secret in the clear")
+	}
+
+	secret, err := Open(stored, key)
+	if err != nil || secret != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("got %q, err %v", secret, err)
+	}
+
+	if _, err := Open(stored, bytes.Repeat([]byte{8}, KeySize)); err == nil {
+		t.Error("secret was opened with the wrong key")
+	}
+
+	if _, err := Open(stored, nil); !errors.Is(err, ErrNoKey) {
+		t.Errorf("secret was opened without a key, err %v", err)
+	}
+
+	if secret, _ := Open("JBSWY3DPEHPK3PXP", key); secret != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("secret stored before sealing came back as %q", secret)
+	}
+}
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS activation_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash VARCHAR NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_by INTEGER,
+    created_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS activation_tokens_user_id_idx ON activation_tokens (user_id);
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR NOT NULL,
+    ip_address VARCHAR NOT NULL,
+    succeeded BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS login_attempts_username_idx ON login_attempts (username, created_at);
+CREATE INDEX IF NOT EXISTS login_attempts_ip_address_idx ON login_attempts (ip_address, created_at);
+
+CREATE TABLE IF NOT EXISTS account_lockouts (
+    id SERIAL PRIMARY KEY,
+    scope VARCHAR NOT NULL,
+    username VARCHAR NOT NULL,
+    ip_address VARCHAR NOT NULL,
+    failures INTEGER NOT NULL,
+    locked_until TIMESTAMP NOT NULL,
+    unlocked_by INTEGER,
+    unlocked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS account_lockouts_username_idx ON account_lockouts (username);
+CREATE INDEX IF NOT EXISTS account_lockouts_ip_address_idx ON account_lockouts (ip_address);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id SERIAL PRIMARY KEY,
+    serial VARCHAR NOT NULL,
+    quantity INTEGER NOT NULL,
+    reason VARCHAR NOT NULL,
+    reference VARCHAR NOT NULL DEFAULT '',
+    user_id INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS stock_movements_serial_idx ON stock_movements (serial, created_at);
+
+-- Open the ledger with what is on hand today
+INSERT INTO stock_movements (serial, quantity, reason, reference, user_id, created_at)
+SELECT serial, units, 'opening', 'Units on hand when the ledger started', coalesce(user_id, 0), now()
+FROM products
+WHERE serial IS NOT NULL AND coalesce(units, 0) <> 0;
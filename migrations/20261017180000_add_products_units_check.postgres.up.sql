@@ -0,0 +1 @@
+ALTER TABLE products ADD CONSTRAINT products_units_not_negative CHECK (units >= 0) NOT VALID;
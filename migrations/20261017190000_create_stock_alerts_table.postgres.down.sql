@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS stock_alerts;
+ALTER TABLE products DROP COLUMN IF EXISTS reorder_qty;
+ALTER TABLE products DROP COLUMN IF EXISTS reorder_point;
@@ -0,0 +1,15 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS reorder_point INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS reorder_qty INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS stock_alerts (
+    id SERIAL PRIMARY KEY,
+    serial VARCHAR NOT NULL,
+    units INTEGER NOT NULL,
+    reorder_point INTEGER NOT NULL,
+    reorder_qty INTEGER NOT NULL,
+    raised_at TIMESTAMP NOT NULL,
+    cleared_at TIMESTAMP
+);
+
+-- A product has at most one open alert, so it is raised once per crossing
+CREATE UNIQUE INDEX IF NOT EXISTS stock_alerts_open_idx ON stock_alerts (serial) WHERE cleared_at IS NULL;
@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS suppliers (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR NOT NULL,
+    contact_name VARCHAR NOT NULL DEFAULT '',
+    phone VARCHAR NOT NULL DEFAULT '',
+    email VARCHAR NOT NULL DEFAULT '',
+    address TEXT NOT NULL DEFAULT '',
+    notes TEXT NOT NULL DEFAULT '',
+    user_id INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS purchase_orders (
+    id SERIAL PRIMARY KEY,
+    supplier_id INTEGER NOT NULL REFERENCES suppliers (id),
+    status VARCHAR NOT NULL DEFAULT 'draft',
+    notes TEXT NOT NULL DEFAULT '',
+    expected_at TIMESTAMP,
+    ordered_at TIMESTAMP,
+    received_at TIMESTAMP,
+    user_id INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS purchase_orders_status_idx ON purchase_orders (status, created_at);
+
+CREATE TABLE IF NOT EXISTS purchase_order_lines (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES purchase_orders (id) ON DELETE CASCADE,
+    serial VARCHAR NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    received INTEGER NOT NULL DEFAULT 0 CHECK (received >= 0 AND received <= quantity),
+    unit_cost NUMERIC(12, 2) NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS purchase_order_lines_order_idx ON purchase_order_lines (order_id);
+
+-- What was paid per unit for stock coming in, zero when unknown
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS unit_cost NUMERIC(12, 2) NOT NULL DEFAULT 0;
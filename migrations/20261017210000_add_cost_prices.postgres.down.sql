@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS purchased_oncredit_created_at_idx;
+DROP INDEX IF EXISTS purchases_created_at_idx;
+ALTER TABLE purchased_oncredit DROP COLUMN IF EXISTS unit_cost;
+ALTER TABLE purchases DROP COLUMN IF EXISTS unit_cost;
+ALTER TABLE products DROP COLUMN IF EXISTS cost_price;
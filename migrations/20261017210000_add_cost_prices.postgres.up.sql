@@ -0,0 +1,9 @@
+-- The weighted average cost of the units on hand
+ALTER TABLE products ADD COLUMN IF NOT EXISTS cost_price NUMERIC(12,2) NOT NULL DEFAULT 0;
+
+-- The cost of a unit when it was sold, sales made before costs were tracked stay at zero
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS unit_cost NUMERIC(12,2) NOT NULL DEFAULT 0;
+ALTER TABLE purchased_oncredit ADD COLUMN IF NOT EXISTS unit_cost NUMERIC(12,2) NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS purchases_created_at_idx ON purchases (created_at);
+CREATE INDEX IF NOT EXISTS purchased_oncredit_created_at_idx ON purchased_oncredit (created_at);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS product_attributes;
+ALTER TABLE products DROP COLUMN IF EXISTS brand_id;
+ALTER TABLE products DROP COLUMN IF EXISTS category_id;
+DROP TABLE IF EXISTS brands;
+DROP TABLE IF EXISTS categories;
@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS categories (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR NOT NULL,
+    parent_id INTEGER REFERENCES categories (id),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- Sibling categories have different names
+CREATE UNIQUE INDEX IF NOT EXISTS categories_name_idx ON categories (coalesce(parent_id, 0), lower(name));
+
+CREATE TABLE IF NOT EXISTS brands (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS brands_name_idx ON brands (lower(name));
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS category_id INTEGER REFERENCES categories (id) ON DELETE SET NULL;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS brand_id INTEGER REFERENCES brands (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS products_category_id_idx ON products (category_id);
+CREATE INDEX IF NOT EXISTS products_brand_id_idx ON products (brand_id);
+
+CREATE TABLE IF NOT EXISTS product_attributes (
+    product_id INTEGER NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    name VARCHAR NOT NULL,
+    value VARCHAR NOT NULL,
+    PRIMARY KEY (product_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS product_attributes_name_value_idx ON product_attributes (name, value);
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS stock_takes (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR NOT NULL,
+    category_id INTEGER REFERENCES categories (id) ON DELETE SET NULL,
+    status VARCHAR NOT NULL DEFAULT 'counting',
+    notes TEXT NOT NULL DEFAULT '',
+    -- The last stock movement when the snapshot was frozen, later movements are allowed for
+    -- when the counts are compared
+    movement_id INTEGER NOT NULL DEFAULT 0,
+    user_id INTEGER NOT NULL DEFAULT 0,
+    approved_by INTEGER,
+    approved_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS stock_takes_status_idx ON stock_takes (status, created_at);
+
+CREATE TABLE IF NOT EXISTS stock_take_lines (
+    id SERIAL PRIMARY KEY,
+    stock_take_id INTEGER NOT NULL REFERENCES stock_takes (id) ON DELETE CASCADE,
+    serial VARCHAR NOT NULL,
+    snapshot INTEGER NOT NULL,
+    unit_cost NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    counted INTEGER CHECK (counted >= 0),
+    -- Units sold or received between the snapshot and the count
+    moved INTEGER NOT NULL DEFAULT 0,
+    counted_by INTEGER,
+    counted_at TIMESTAMP,
+    posted BOOLEAN NOT NULL DEFAULT false,
+    UNIQUE (stock_take_id, serial)
+);
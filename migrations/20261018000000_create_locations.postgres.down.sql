@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS stock_transfer_lines;
+DROP TABLE IF EXISTS stock_transfers;
+ALTER TABLE stock_takes DROP COLUMN IF EXISTS location_id;
+ALTER TABLE users DROP COLUMN IF EXISTS location_id;
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS location_id;
+DROP TABLE IF EXISTS product_stock;
+DROP TABLE IF EXISTS locations;
@@ -0,0 +1,67 @@
+CREATE TABLE IF NOT EXISTS locations (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR NOT NULL,
+    address TEXT NOT NULL DEFAULT '',
+    is_default BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS locations_name_idx ON locations (lower(name));
+
+-- Stock moved without a location, by a user with none assigned, is at the default location
+CREATE UNIQUE INDEX IF NOT EXISTS locations_default_idx ON locations (is_default) WHERE is_default;
+
+INSERT INTO locations (name, is_default, created_at, updated_at) VALUES ('Shop floor', true, now(), now());
+
+-- The units of each product at each location, products.units stays the total of them all
+CREATE TABLE IF NOT EXISTS product_stock (
+    serial VARCHAR NOT NULL,
+    location_id INTEGER NOT NULL REFERENCES locations (id),
+    units INTEGER NOT NULL DEFAULT 0 CHECK (units >= 0),
+    PRIMARY KEY (serial, location_id)
+);
+
+CREATE INDEX IF NOT EXISTS product_stock_location_idx ON product_stock (location_id);
+
+INSERT INTO product_stock (serial, location_id, units)
+SELECT serial, (SELECT id FROM locations WHERE is_default), units
+FROM products
+WHERE serial IS NOT NULL AND coalesce(units, 0) > 0;
+
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS location_id INTEGER REFERENCES locations (id);
+UPDATE stock_movements SET location_id = (SELECT id FROM locations WHERE is_default) WHERE location_id IS NULL;
+ALTER TABLE stock_movements ALTER COLUMN location_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS stock_movements_location_idx ON stock_movements (location_id, serial);
+
+-- Where a user sells from, none is the default location
+ALTER TABLE users ADD COLUMN IF NOT EXISTS location_id INTEGER REFERENCES locations (id) ON DELETE SET NULL;
+
+ALTER TABLE stock_takes ADD COLUMN IF NOT EXISTS location_id INTEGER REFERENCES locations (id);
+UPDATE stock_takes SET location_id = (SELECT id FROM locations WHERE is_default) WHERE location_id IS NULL;
+ALTER TABLE stock_takes ALTER COLUMN location_id SET NOT NULL;
+
+CREATE TABLE IF NOT EXISTS stock_transfers (
+    id SERIAL PRIMARY KEY,
+    from_location_id INTEGER NOT NULL REFERENCES locations (id),
+    to_location_id INTEGER NOT NULL REFERENCES locations (id),
+    status VARCHAR NOT NULL DEFAULT 'draft',
+    notes TEXT NOT NULL DEFAULT '',
+    user_id INTEGER NOT NULL DEFAULT 0,
+    transferred_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    CHECK (from_location_id <> to_location_id)
+);
+
+CREATE INDEX IF NOT EXISTS stock_transfers_status_idx ON stock_transfers (status, created_at);
+
+CREATE TABLE IF NOT EXISTS stock_transfer_lines (
+    id SERIAL PRIMARY KEY,
+    transfer_id INTEGER NOT NULL REFERENCES stock_transfers (id) ON DELETE CASCADE,
+    serial VARCHAR NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0)
+);
+
+CREATE INDEX IF NOT EXISTS stock_transfer_lines_transfer_idx ON stock_transfer_lines (transfer_id);
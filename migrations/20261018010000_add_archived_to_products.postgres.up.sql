@@ -0,0 +1,3 @@
+-- When the product was taken off sale, archived products are kept so the sales, orders and
+-- stock records naming them still resolve
+ALTER TABLE products ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;
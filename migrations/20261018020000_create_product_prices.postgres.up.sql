@@ -0,0 +1,25 @@
+-- Every price a product has had or is scheduled to have, applied_at is null while a scheduled
+-- change is waiting for its effective date
+CREATE TABLE IF NOT EXISTS product_prices (
+    id SERIAL PRIMARY KEY,
+    serial VARCHAR NOT NULL,
+    price REAL NOT NULL CHECK (price >= 0),
+    effective_at TIMESTAMP NOT NULL,
+    applied_at TIMESTAMP,
+    note TEXT NOT NULL DEFAULT '',
+    user_id INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS product_prices_serial_idx ON product_prices (serial, effective_at);
+CREATE INDEX IF NOT EXISTS product_prices_pending_idx ON product_prices (effective_at) WHERE applied_at IS NULL;
+
+-- The prices products have now, dated from when the product was added
+INSERT INTO product_prices (serial, price, effective_at, applied_at, user_id, created_at)
+SELECT serial, coalesce(price, 0), coalesce(created_at, now()), coalesce(created_at, now()), coalesce(user_id, 0), now()
+FROM products
+WHERE serial IS NOT NULL;
+
+-- The price of a unit when it was sold for cash, worked out from the amount for past sales
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS unit_price REAL NOT NULL DEFAULT 0;
+UPDATE purchases SET unit_price = amount / quantity WHERE quantity > 0 AND amount IS NOT NULL;
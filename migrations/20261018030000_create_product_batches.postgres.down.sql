@@ -0,0 +1,2 @@
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS batch_no;
+DROP TABLE IF EXISTS product_batches;
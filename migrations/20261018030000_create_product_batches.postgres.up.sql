@@ -0,0 +1,19 @@
+-- The lots of a product at each location with the date they expire, product_stock.units stays at
+-- least the units of its batches and any units above them were received without a batch
+CREATE TABLE IF NOT EXISTS product_batches (
+    id SERIAL PRIMARY KEY,
+    serial VARCHAR NOT NULL,
+    location_id INTEGER NOT NULL REFERENCES locations (id),
+    batch_no VARCHAR NOT NULL DEFAULT '',
+    expires_at DATE,
+    units INTEGER NOT NULL DEFAULT 0 CHECK (units >= 0),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS product_batches_lot_idx
+    ON product_batches (serial, location_id, batch_no, (coalesce(expires_at, 'infinity'::date)));
+CREATE INDEX IF NOT EXISTS product_batches_expiry_idx ON product_batches (expires_at) WHERE units > 0;
+
+-- The batch units were received into
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS batch_no VARCHAR NOT NULL DEFAULT '';
@@ -0,0 +1,15 @@
+-- Photos of products, each kept at the size it is shown in full and as a thumbnail for lists
+CREATE TABLE IF NOT EXISTS product_images (
+    id SERIAL PRIMARY KEY,
+    serial VARCHAR NOT NULL,
+    image BYTEA NOT NULL,
+    thumbnail BYTEA NOT NULL,
+    is_primary BOOLEAN NOT NULL DEFAULT false,
+    user_id INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS product_images_serial_idx ON product_images (serial, created_at);
+
+-- A product has at most one primary image
+CREATE UNIQUE INDEX IF NOT EXISTS product_images_primary_idx ON product_images (serial) WHERE is_primary;
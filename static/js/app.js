@@ -104,4 +104,32 @@ function Prompt() {
         error: error,
         custom: custom,
     }
-}
\ No newline at end of file
+}
+
+// scanInput looks up the serial number scanned or typed into input as soon as Enter is pressed,
+// barcode scanners press Enter after the code, and passes the product found to onProduct or
+// the reason it was not found to onError
+function scanInput(input, onProduct, onError) {
+    input.addEventListener("keydown", (e) => {
+        if (e.key !== "Enter") {
+            return
+        }
+        e.preventDefault()
+
+        const serial = input.value.trim()
+        if (serial === "") {
+            return
+        }
+
+        fetch("/admin/scan-product?serial=" + encodeURIComponent(serial))
+            .then((res) => res.json())
+            .then((data) => {
+                if (data.ok) {
+                    onProduct(data.product)
+                } else {
+                    onError(data.message)
+                }
+            })
+            .catch(() => onError("The product could not be looked up, try again"))
+    })
+}